@@ -37,10 +37,22 @@ export interface NFe {
     supplier_name?: string;
     total_items: number;
     total_value: number;
-    status: 'PENDENTE' | 'PROCESSADA';
+    status: 'PENDENTE' | 'EM_CONFERENCIA' | 'PROCESSADA' | 'PARCIAL' | 'REJEITADA' | 'CANCELADA';
+    authorization_state?: 'AUTORIZADA' | 'DENEGADA' | 'NAO_AUTORIZADA' | 'SEM_PROTOCOLO';
+    protocol_number?: string;
+    direction?: 'ENTRADA' | 'SAIDA';
+    operation?: string;
+    recipient_name?: string;
+    issued_at?: string;
     processed_at: string;
 }
 
+export interface NFeListSummary {
+    count: number;
+    total_value: number;
+    by_status: { status: string; count: number; total_value: number }[];
+}
+
 export interface NFeDetail {
     access_key: string;
     number: string;
@@ -284,41 +296,87 @@ export function useUserMutations() {
     return { saveUser, toggleUserStatus };
 }
 
-export function useEmailConfigQuery() {
+export interface MailboxStatus {
+    last_run_at?: string;
+    last_success_at?: string;
+    last_error?: string;
+    last_error_at?: string;
+    last_run_messages: number;
+    mode?: 'IDLE' | 'POLLING' | '';
+    messages_imported: number;
+    documents_imported: number;
+}
+
+export interface Mailbox {
+    ID?: number;
+    name: string;
+    imap_host: string;
+    imap_port: number;
+    imap_user: string;
+    imap_password: string;
+    imap_folder: string;
+    imap_allowed_senders: string;
+    imap_subject_filter: string;
+    use_tls: boolean;
+    active: boolean;
+    poll_interval: number;
+    processed_folder: string;
+    error_folder: string;
+    ignored_folder: string;
+    status?: MailboxStatus;
+}
+
+export function useMailboxesQuery() {
     const { apiFetch } = useAuth();
-    return useQuery({
-        queryKey: ['email-config'],
+    return useQuery<Mailbox[]>({
+        queryKey: ['mailboxes'],
         queryFn: async () => {
-            const response = await apiFetch('/api/config/email');
-            if (!response.ok) throw new Error('Failed to fetch email config');
+            const response = await apiFetch('/api/config/mailboxes');
+            if (!response.ok) throw new Error('Failed to fetch mailboxes');
             return response.json();
-        }
+        },
+        refetchInterval: 60000
     });
 }
 
-export function useEmailConfigMutations() {
+export function useMailboxMutations() {
     const { apiFetch } = useAuth();
     const queryClient = useQueryClient();
 
-    const saveEmailConfig = useMutation({
-        mutationFn: async (data: any) => {
-            const response = await apiFetch('/api/config/email', {
-                method: 'PUT',
+    const saveMailbox = useMutation({
+        mutationFn: async (data: Mailbox) => {
+            const url = data.ID ? `/api/config/mailboxes/${data.ID}` : '/api/config/mailboxes';
+            const response = await apiFetch(url, {
+                method: data.ID ? 'PUT' : 'POST',
                 body: JSON.stringify(data)
             });
             if (!response.ok) {
                 const errData = await response.json();
-                throw new Error(errData.error || 'Erro ao salvar configuração');
+                throw new Error(errData.error || 'Erro ao salvar caixa de e-mail');
             }
             return response.json();
         },
         onSuccess: () => {
-            queryClient.invalidateQueries({ queryKey: ['email-config'] });
+            queryClient.invalidateQueries({ queryKey: ['mailboxes'] });
+        }
+    });
+
+    const deleteMailbox = useMutation({
+        mutationFn: async (id: number) => {
+            const response = await apiFetch(`/api/config/mailboxes/${id}`, { method: 'DELETE' });
+            if (!response.ok) {
+                const errData = await response.json();
+                throw new Error(errData.error || 'Erro ao remover caixa de e-mail');
+            }
+            return response.json();
+        },
+        onSuccess: () => {
+            queryClient.invalidateQueries({ queryKey: ['mailboxes'] });
         }
     });
 
     const testConnection = useMutation({
-        mutationFn: async (data: any) => {
+        mutationFn: async (data: Mailbox) => {
             const response = await apiFetch('/api/config/email/test', {
                 method: 'POST',
                 body: JSON.stringify(data)
@@ -329,7 +387,70 @@ export function useEmailConfigMutations() {
         }
     });
 
-    return { saveEmailConfig, testConnection };
+    return { saveMailbox, deleteMailbox, testConnection };
+}
+
+export interface EmailIngestion {
+    id: number;
+    email_config_id: number;
+    mailbox_name: string;
+    uid: number;
+    message_id: string;
+    sender: string;
+    subject: string;
+    email_date?: string;
+    filename: string;
+    outcome: 'REGISTRADO' | 'DUPLICADO' | 'SUSPEITO' | 'INVALIDO' | 'ERRO' | 'IGNORADO';
+    error_code?: string;
+    error?: string;
+    access_key?: string;
+    content_size: number;
+    attempts: number;
+    retried_at?: string;
+    created_at: string;
+}
+
+export interface EmailIngestionFilters {
+    mailbox_id?: string;
+    outcome?: string;
+    search?: string;
+    start_date?: string;
+    end_date?: string;
+}
+
+export function useEmailIngestionsQuery(page = 1, limit = 50, filters: EmailIngestionFilters = {}) {
+    const { apiFetch } = useAuth();
+    return useQuery({
+        queryKey: ['email-ingestions', page, limit, filters],
+        queryFn: async () => {
+            const query = new URLSearchParams({ page: page.toString(), limit: limit.toString() });
+            Object.entries(filters).forEach(([key, value]) => {
+                if (value) query.set(key, value);
+            });
+            const response = await apiFetch(`/api/email-ingestions?${query.toString()}`);
+            if (!response.ok) throw new Error('Failed to fetch email ingestions');
+            return response.json();
+        }
+    });
+}
+
+export function useEmailIngestionMutations() {
+    const { apiFetch } = useAuth();
+    const queryClient = useQueryClient();
+
+    const retryIngestion = useMutation({
+        mutationFn: async (id: number) => {
+            const response = await apiFetch(`/api/email-ingestions/${id}/retry`, { method: 'POST' });
+            const result = await response.json();
+            if (!response.ok) throw new Error(result.error || 'Erro ao reprocessar anexo');
+            return result as EmailIngestion;
+        },
+        onSuccess: () => {
+            queryClient.invalidateQueries({ queryKey: ['email-ingestions'] });
+        }
+    });
+
+    return { retryIngestion };
 }
 
 export function useAuditLogsQuery(page = 1, limit = 50) {
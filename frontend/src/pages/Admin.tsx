@@ -1,4 +1,4 @@
-import { useState, useEffect } from 'react';
+import { useState } from 'react';
 import {
     FolderTree,
     Mail,
@@ -10,7 +10,10 @@ import {
     Database,
     Users,
     Edit2,
-    Check
+    Check,
+    Inbox,
+    Download,
+    RotateCcw
 } from 'lucide-react';
 import { Card, TableContainer, THead, TBody, Tr, Th, Td, Button, Modal } from '../components/UI';
 import ConfirmModal from '../components/ConfirmModal';
@@ -19,12 +22,16 @@ import {
     useUsersQuery,
     useCategoryMutations,
     useUserMutations,
-    useEmailConfigQuery,
-    useEmailConfigMutations,
-    useAuditLogsQuery
+    useMailboxesQuery,
+    useMailboxMutations,
+    useAuditLogsQuery,
+    useEmailIngestionsQuery,
+    useEmailIngestionMutations
 } from '../hooks/useQueries';
+import type { Mailbox, EmailIngestion, EmailIngestionFilters } from '../hooks/useQueries';
+import { useAuth } from '../contexts/AuthContext';
 
-type AdminTab = 'categories' | 'users' | 'settings' | 'notifications';
+type AdminTab = 'categories' | 'users' | 'settings' | 'imports' | 'notifications';
 
 interface User {
     id: number;
@@ -45,10 +52,11 @@ export default function Admin() {
     const { saveCategory, deleteCategory } = useCategoryMutations();
     const { saveUser, toggleUserStatus } = useUserMutations();
 
-    // Configuração de E-mail
-    const { data: remoteEmailConfig } = useEmailConfigQuery();
-    const { saveEmailConfig, testConnection } = useEmailConfigMutations();
-    const [emailConfigLocal, setEmailConfigLocal] = useState({
+    // Caixas de e-mail monitoradas
+    const { data: mailboxes = [] } = useMailboxesQuery();
+    const { saveMailbox, deleteMailbox, testConnection } = useMailboxMutations();
+    const emptyMailbox: Mailbox = {
+        name: '',
         imap_host: '',
         imap_port: 993,
         imap_user: '',
@@ -57,17 +65,13 @@ export default function Admin() {
         imap_allowed_senders: '',
         imap_subject_filter: '',
         use_tls: true,
-        active: false
-    });
-
-    useEffect(() => {
-        if (remoteEmailConfig) {
-            setEmailConfigLocal({
-                ...remoteEmailConfig,
-                imap_password: '********'
-            });
-        }
-    }, [remoteEmailConfig]);
+        active: true,
+        poll_interval: 5,
+        processed_folder: 'Processadas',
+        error_folder: 'Erros',
+        ignored_folder: 'Ignoradas'
+    };
+    const [emailConfigLocal, setEmailConfigLocal] = useState<Mailbox | null>(null);
 
     // Categorias state
     const [isAddingCat, setIsAddingCat] = useState(false);
@@ -135,6 +139,24 @@ export default function Admin() {
         });
     };
 
+    const handleDeleteMailbox = (mailbox: Mailbox) => {
+        setConfirmModal({
+            isOpen: true,
+            title: 'Remover Caixa de E-mail',
+            message: `Tem certeza que deseja remover a caixa "${mailbox.name}"? Os e-mails dela deixarão de ser verificados.`,
+            onConfirm: async () => {
+                try {
+                    await deleteMailbox.mutateAsync(mailbox.ID!);
+                    showMsg('Caixa de e-mail removida!');
+                } catch (err: any) {
+                    showMsg(err.message || 'Erro ao remover caixa de e-mail', 'error');
+                }
+                setConfirmModal({ ...confirmModal, isOpen: false });
+            },
+            variant: 'danger'
+        });
+    };
+
     const handleSaveUser = async (e: React.FormEvent) => {
         e.preventDefault();
         try {
@@ -173,6 +195,7 @@ export default function Admin() {
         { id: 'categories', label: 'Categorias', icon: FolderTree },
         { id: 'users', label: 'Usuários', icon: Users },
         { id: 'settings', label: 'E-mail', icon: Mail },
+        { id: 'imports', label: 'Importações', icon: Inbox },
         { id: 'notifications', label: 'Sistema', icon: Bell },
     ];
 
@@ -200,7 +223,7 @@ export default function Admin() {
             </div>
 
             {/* Hub Navigation */}
-            <div className="grid grid-cols-2 lg:grid-cols-4 gap-3 md:gap-4 px-4 md:px-0">
+            <div className="grid grid-cols-2 lg:grid-cols-5 gap-3 md:gap-4 px-4 md:px-0">
                 {tabs.map((tab) => {
                     const Icon = tab.icon;
                     const isActive = activeTab === tab.id;
@@ -440,19 +463,98 @@ export default function Admin() {
 
                 {activeTab === 'settings' && (
                     <div className="space-y-6 animate-in slide-in-from-bottom-4 duration-500 max-w-2xl px-4 md:px-0">
-                        <div className="flex items-center gap-3">
-                            <Mail className="text-ruby-600 w-5 h-5" />
-                            <h3 className="text-base md:text-lg font-black text-charcoal-900 uppercase tracking-tight">Configuração de E-mail (IMAP)</h3>
+                        <div className="flex items-center justify-between gap-3">
+                            <div className="flex items-center gap-3">
+                                <Mail className="text-ruby-600 w-5 h-5" />
+                                <h3 className="text-base md:text-lg font-black text-charcoal-900 uppercase tracking-tight">Caixas de E-mail (IMAP)</h3>
+                            </div>
+                            {!emailConfigLocal && (
+                                <Button onClick={() => setEmailConfigLocal(emptyMailbox)} className="bg-charcoal-900 h-10">
+                                    <Plus className="w-4 h-4" />
+                                    <span className="font-black uppercase tracking-widest text-[10px]">Nova Caixa</span>
+                                </Button>
+                            )}
                         </div>
 
+                        {!emailConfigLocal && (
+                            <div className="space-y-3">
+                                {mailboxes.length === 0 && (
+                                    <Card className="p-6 rounded-3xl text-center text-xs text-charcoal-400 font-bold">
+                                        Nenhuma caixa de e-mail cadastrada.
+                                    </Card>
+                                )}
+                                {mailboxes.map(mb => (
+                                    <Card key={mb.ID} className="p-4 md:p-6 rounded-3xl flex items-start justify-between gap-4">
+                                        <div className="space-y-1 min-w-0">
+                                            <div className="flex items-center gap-2 flex-wrap">
+                                                <span className="font-black text-charcoal-900 text-sm truncate">{mb.name || mb.imap_user}</span>
+                                                <span className={`px-2 py-0.5 rounded-full text-[9px] font-black uppercase ${!mb.active ? 'bg-charcoal-100 text-charcoal-500' : mb.status?.last_error ? 'bg-ruby-50 text-ruby-700' : 'bg-emerald-50 text-emerald-700'}`}>
+                                                    {!mb.active ? 'Inativa' : mb.status?.last_error ? 'Com erro' : 'Ativa'}
+                                                </span>
+                                            </div>
+                                            <p className="text-[10px] text-charcoal-400 font-bold">
+                                                {mb.imap_user} · {mb.imap_folder} · {mb.status?.mode === 'IDLE'
+                                                    ? 'tempo real (IDLE)'
+                                                    : `a cada ${mb.poll_interval || 5} min`}
+                                            </p>
+                                            <p className="text-[10px] text-charcoal-500 font-medium">
+                                                {mb.status?.last_run_at
+                                                    ? `Última verificação: ${new Date(mb.status.last_run_at).toLocaleString('pt-BR')} · ${mb.status.last_run_messages} e-mail(s)`
+                                                    : 'Ainda não verificada'}
+                                                {mb.status && ` · ${mb.status.messages_imported} e-mail(s) e ${mb.status.documents_imported} documento(s) importados`}
+                                            </p>
+                                            {mb.status?.last_error && (
+                                                <p className="text-[10px] text-ruby-600 font-bold break-all">{mb.status.last_error}</p>
+                                            )}
+                                        </div>
+                                        <div className="flex items-center gap-1 shrink-0">
+                                            <button onClick={() => setEmailConfigLocal({ ...mb, imap_password: '********' })} className="p-2 text-charcoal-400 hover:text-navy-900">
+                                                <Edit2 className="w-4 h-4" />
+                                            </button>
+                                            <button onClick={() => handleDeleteMailbox(mb)} className="p-2 text-charcoal-400 hover:text-ruby-600">
+                                                <Trash2 className="w-4 h-4" />
+                                            </button>
+                                        </div>
+                                    </Card>
+                                ))}
+                            </div>
+                        )}
+
+                        {emailConfigLocal && (
                         <Card className="p-4 md:p-8 space-y-8 rounded-3xl">
                             <form className="space-y-6" onSubmit={(e) => {
                                 e.preventDefault();
-                                saveEmailConfig.mutate(emailConfigLocal, {
-                                    onSuccess: () => showMsg('Configurações salvas com sucesso!')
+                                saveMailbox.mutate(emailConfigLocal, {
+                                    onSuccess: () => {
+                                        showMsg('Caixa de e-mail salva com sucesso!');
+                                        setEmailConfigLocal(null);
+                                    },
+                                    onError: (err: any) => showMsg(err.message, 'error')
                                 });
                             }}>
                                 <div className="grid grid-cols-1 md:grid-cols-2 gap-4 md:gap-6">
+                                    <div className="space-y-2">
+                                        <label className="text-[10px] font-black text-charcoal-700 uppercase tracking-widest">Nome da Caixa</label>
+                                        <input
+                                            type="text"
+                                            value={emailConfigLocal.name}
+                                            onChange={(e) => setEmailConfigLocal({ ...emailConfigLocal, name: e.target.value })}
+                                            className="w-full h-12 px-4 bg-charcoal-50 border border-charcoal-300 rounded-xl font-bold text-sm"
+                                            placeholder="Ex: Compras Matriz"
+                                        />
+                                    </div>
+                                    <div className="space-y-2">
+                                        <label className="text-[10px] font-black text-charcoal-700 uppercase tracking-widest">Verificar a cada (min)</label>
+                                        <input
+                                            type="number"
+                                            min={1}
+                                            max={1440}
+                                            value={emailConfigLocal.poll_interval}
+                                            onChange={(e) => setEmailConfigLocal({ ...emailConfigLocal, poll_interval: parseInt(e.target.value) })}
+                                            className="w-full h-12 px-4 bg-charcoal-50 border border-charcoal-300 rounded-xl font-bold text-sm"
+                                            placeholder="5"
+                                        />
+                                    </div>
                                     <div className="space-y-2">
                                         <label className="text-[10px] font-black text-charcoal-700 uppercase tracking-widest">Servidor IMAP (Host)</label>
                                         <input
@@ -522,6 +624,28 @@ export default function Admin() {
                                             placeholder="exemplo@gmail.com"
                                         />
                                     </div>
+                                    <div className="space-y-2 md:col-span-2">
+                                        <label className="text-[10px] font-black text-charcoal-700 uppercase tracking-widest">Depois de ler, mover para</label>
+                                        <div className="grid grid-cols-1 md:grid-cols-3 gap-3">
+                                            {([
+                                                ['processed_folder', 'Importados', 'Processadas'],
+                                                ['error_folder', 'Com erro', 'Erros'],
+                                                ['ignored_folder', 'Sem NF-e', 'Ignoradas'],
+                                            ] as const).map(([field, label, placeholder]) => (
+                                                <div key={field} className="space-y-1">
+                                                    <span className="text-[9px] font-bold text-charcoal-500 uppercase tracking-widest">{label}</span>
+                                                    <input
+                                                        type="text"
+                                                        value={emailConfigLocal[field]}
+                                                        onChange={(e) => setEmailConfigLocal({ ...emailConfigLocal, [field]: e.target.value })}
+                                                        className="w-full h-12 px-4 bg-charcoal-50 border border-charcoal-300 rounded-xl font-bold text-sm"
+                                                        placeholder={placeholder}
+                                                    />
+                                                </div>
+                                            ))}
+                                        </div>
+                                        <p className="text-[9px] text-charcoal-400 font-medium">Deixe em branco para manter o e-mail na pasta, marcado como lido. Pastas inexistentes são criadas.</p>
+                                    </div>
                                     <div className="flex flex-col md:flex-row md:items-center gap-4 md:gap-6">
                                         <div className="flex items-center gap-3">
                                             <input
@@ -547,6 +671,14 @@ export default function Admin() {
                                 </div>
 
                                 <div className="flex flex-col md:flex-row gap-3 pt-6 border-t border-charcoal-50">
+                                    <Button
+                                        type="button"
+                                        variant="outline"
+                                        className="h-12 border-charcoal-300"
+                                        onClick={() => setEmailConfigLocal(null)}
+                                    >
+                                        Cancelar
+                                    </Button>
                                     <Button
                                         type="button"
                                         variant="outline"
@@ -564,22 +696,25 @@ export default function Admin() {
                                     <Button
                                         type="submit"
                                         className="bg-charcoal-900 h-12 shadow-lg"
-                                        disabled={saveEmailConfig.isPending}
+                                        disabled={saveMailbox.isPending}
                                     >
                                         <Save className="w-4 h-4" />
                                         <span className="font-black uppercase tracking-widest">
-                                            {saveEmailConfig.isPending ? 'Salvando...' : 'Salvar'}
+                                            {saveMailbox.isPending ? 'Salvando...' : 'Salvar'}
                                         </span>
                                     </Button>
                                 </div>
                             </form>
                         </Card>
+                        )}
                         <p className="text-[9px] md:text-[10px] text-charcoal-400 font-medium italic text-center px-4">
-                            O sistema verificará novos e-mails a cada 5 minutos em busca de arquivos .xml ou .zip contendo notas fiscais.
+                            Caixas cujo servidor suporta IMAP IDLE recebem os e-mails em tempo real; nas demais, a verificação segue o intervalo configurado. Anexos .xml ou .zip com notas fiscais são importados, mesmo de e-mails já abertos em outro programa.
                         </p>
                     </div>
                 )}
 
+                {activeTab === 'imports' && <EmailIngestionsView mailboxes={mailboxes} showMsg={showMsg} />}
+
                 {activeTab === 'notifications' && <AuditLogsView />}
             </div>
 
@@ -598,6 +733,192 @@ export default function Admin() {
     );
 }
 
+const ingestionOutcomeStyles: Record<EmailIngestion['outcome'], string> = {
+    REGISTRADO: 'bg-emerald-50 text-emerald-700 border-emerald-100',
+    DUPLICADO: 'bg-charcoal-50 text-charcoal-700 border-charcoal-100',
+    SUSPEITO: 'bg-amber-50 text-amber-700 border-amber-100',
+    INVALIDO: 'bg-ruby-50 text-ruby-700 border-ruby-100',
+    ERRO: 'bg-ruby-50 text-ruby-700 border-ruby-100',
+    IGNORADO: 'bg-charcoal-50 text-charcoal-400 border-charcoal-100',
+};
+
+// Só XMLs guardados cuja importação falhou podem voltar ao processamento
+const canRetryIngestion = (row: EmailIngestion) =>
+    (row.outcome === 'ERRO' || row.outcome === 'INVALIDO') &&
+    row.content_size > 0 &&
+    !row.filename.toLowerCase().endsWith('.zip');
+
+function EmailIngestionsView({ mailboxes, showMsg }: { mailboxes: Mailbox[]; showMsg: (text: string, type?: 'success' | 'error') => void }) {
+    const { apiFetch } = useAuth();
+    const [page, setPage] = useState(1);
+    const [filters, setFilters] = useState<EmailIngestionFilters>({});
+    const { data, isLoading } = useEmailIngestionsQuery(page, 50, filters);
+    const { retryIngestion } = useEmailIngestionMutations();
+    const rows: EmailIngestion[] = data?.data || [];
+    const totalPages: number = data?.pagination?.total_pages || 1;
+
+    const updateFilter = (key: keyof EmailIngestionFilters, value: string) => {
+        setFilters(f => ({ ...f, [key]: value }));
+        setPage(1);
+    };
+
+    const handleDownload = async (row: EmailIngestion) => {
+        try {
+            const response = await apiFetch(`/api/email-ingestions/${row.id}/attachment`);
+            if (!response.ok) {
+                const err = await response.json();
+                showMsg(err.error || 'Falha ao baixar anexo', 'error');
+                return;
+            }
+            const url = window.URL.createObjectURL(await response.blob());
+            const a = document.createElement('a');
+            a.href = url;
+            a.download = row.filename.split('/').pop() || `anexo-${row.id}`;
+            document.body.appendChild(a);
+            a.click();
+            window.URL.revokeObjectURL(url);
+            document.body.removeChild(a);
+        } catch (err) {
+            console.error('Erro ao baixar anexo:', err);
+        }
+    };
+
+    const handleRetry = (row: EmailIngestion) => {
+        retryIngestion.mutate(row.id, {
+            onSuccess: (result) => showMsg(`Anexo reprocessado: ${result.outcome}`, result.outcome === 'ERRO' || result.outcome === 'INVALIDO' ? 'error' : 'success'),
+            onError: (err: any) => showMsg(err.message, 'error')
+        });
+    };
+
+    const inputClass = 'h-10 px-3 rounded-xl border border-charcoal-200 bg-white text-xs font-bold text-charcoal-700';
+
+    return (
+        <div className="space-y-6 animate-in slide-in-from-bottom-4 duration-500 px-4 md:px-0">
+            <div className="flex items-center gap-3">
+                <Inbox className="text-ruby-600 w-5 h-5" />
+                <h3 className="text-base md:text-lg font-black text-charcoal-900 uppercase tracking-tight">Importações por E-mail</h3>
+            </div>
+
+            <div className="grid grid-cols-2 md:grid-cols-5 gap-3 bg-white p-4 rounded-2xl border border-charcoal-100">
+                <input
+                    type="text"
+                    placeholder="Remetente, assunto, arquivo ou chave"
+                    className={`${inputClass} col-span-2 md:col-span-1`}
+                    value={filters.search || ''}
+                    onChange={(e) => updateFilter('search', e.target.value)}
+                />
+                <select className={inputClass} value={filters.mailbox_id || ''} onChange={(e) => updateFilter('mailbox_id', e.target.value)}>
+                    <option value="">Todas as caixas</option>
+                    {mailboxes.map((m) => (
+                        <option key={m.ID} value={m.ID}>{m.name || m.imap_user}</option>
+                    ))}
+                </select>
+                <select className={inputClass} value={filters.outcome || ''} onChange={(e) => updateFilter('outcome', e.target.value)}>
+                    <option value="">Todos os resultados</option>
+                    {Object.keys(ingestionOutcomeStyles).map((o) => (
+                        <option key={o} value={o}>{o}</option>
+                    ))}
+                </select>
+                <input type="date" className={inputClass} value={filters.start_date || ''} onChange={(e) => updateFilter('start_date', e.target.value)} />
+                <input type="date" className={inputClass} value={filters.end_date || ''} onChange={(e) => updateFilter('end_date', e.target.value)} />
+            </div>
+
+            {isLoading ? (
+                <div className="flex justify-center p-12">
+                    <div className="w-8 h-8 border-4 border-ruby-600 border-t-transparent rounded-full animate-spin"></div>
+                </div>
+            ) : rows.length === 0 ? (
+                <div className="p-12 text-center opacity-30 space-y-4">
+                    <Inbox className="w-12 h-12 mx-auto text-charcoal-200" />
+                    <p className="text-[10px] font-bold uppercase tracking-[0.3em]">Nenhuma importação encontrada</p>
+                </div>
+            ) : (
+                <div className="bg-white rounded-3xl border border-charcoal-100 overflow-hidden shadow-premium">
+                    <TableContainer className="border-none">
+                        <THead>
+                            <Tr className="bg-navy-950">
+                                <Th className="text-white">Data</Th>
+                                <Th className="text-white">E-mail</Th>
+                                <Th className="text-white">Arquivo</Th>
+                                <Th className="text-white">Resultado</Th>
+                                <Th className="text-white text-right">Ações</Th>
+                            </Tr>
+                        </THead>
+                        <TBody>
+                            {rows.map((row) => (
+                                <Tr key={row.id}>
+                                    <Td className="text-[10px] font-bold text-charcoal-500">
+                                        {new Date(row.created_at).toLocaleString('pt-BR')}
+                                        <div className="text-[9px] text-charcoal-400">{row.mailbox_name} · UID {row.uid}</div>
+                                    </Td>
+                                    <Td>
+                                        <div className="flex flex-col">
+                                            <span className="font-bold text-navy-900 text-xs">{row.sender}</span>
+                                            <span className="text-[10px] text-charcoal-500 truncate max-w-xs">{row.subject || '(sem assunto)'}</span>
+                                        </div>
+                                    </Td>
+                                    <Td className="text-[10px] font-bold text-charcoal-600 break-all">
+                                        {row.filename || '—'}
+                                        {row.access_key && <div className="text-[9px] font-mono text-charcoal-400">{row.access_key}</div>}
+                                    </Td>
+                                    <Td>
+                                        <span className={`text-[9px] font-black px-2 py-0.5 rounded-full border ${ingestionOutcomeStyles[row.outcome] || ingestionOutcomeStyles.IGNORADO}`}>
+                                            {row.outcome}
+                                        </span>
+                                        {row.attempts > 1 && <span className="ml-2 text-[9px] text-charcoal-400">{row.attempts} tentativas</span>}
+                                        {row.error && <div className="text-[10px] text-ruby-600 mt-1 max-w-xs">{row.error}</div>}
+                                    </Td>
+                                    <Td className="text-right whitespace-nowrap">
+                                        {row.content_size > 0 && (
+                                            <button
+                                                onClick={() => handleDownload(row)}
+                                                className="p-2 text-charcoal-400 hover:text-navy-900"
+                                                title="Baixar anexo"
+                                            >
+                                                <Download className="w-4 h-4" />
+                                            </button>
+                                        )}
+                                        {canRetryIngestion(row) && (
+                                            <button
+                                                onClick={() => handleRetry(row)}
+                                                disabled={retryIngestion.isPending}
+                                                className="p-2 text-charcoal-400 hover:text-ruby-600 disabled:opacity-30"
+                                                title="Reprocessar"
+                                            >
+                                                <RotateCcw className="w-4 h-4" />
+                                            </button>
+                                        )}
+                                    </Td>
+                                </Tr>
+                            ))}
+                        </TBody>
+                    </TableContainer>
+                </div>
+            )}
+
+            <div className="flex justify-between items-center bg-white p-4 rounded-2xl border border-charcoal-100">
+                <Button
+                    variant="outline"
+                    onClick={() => setPage(p => Math.max(1, p - 1))}
+                    disabled={page === 1}
+                    className="h-10 text-[10px]"
+                >
+                    Anterior
+                </Button>
+                <span className="text-[10px] font-black uppercase text-charcoal-400">Página {page} de {totalPages}</span>
+                <Button
+                    variant="outline"
+                    onClick={() => setPage(p => p + 1)}
+                    disabled={page >= totalPages}
+                    className="h-10 text-[10px]"
+                >
+                    Próxima
+                </Button>
+            </div>
+        </div>
+    );
+}
+
 function AuditLogsView() {
     const [page, setPage] = useState(1);
     const { data, isLoading } = useAuditLogsQuery(page, 50);
@@ -49,22 +49,32 @@ export default function Dashboard() {
     };
 
     const handleFileChange = async (e: React.ChangeEvent<HTMLInputElement>) => {
-        const file = e.target.files?.[0];
-        if (!file) return;
+        const files = Array.from(e.target.files || []);
+        if (files.length === 0) return;
 
         setUploading(true);
         const formData = new FormData();
-        formData.append('file', file);
+        files.forEach((file) => formData.append('files', file));
 
         try {
-            const response = await apiFetch('/api/nfe/upload', {
+            const response = await apiFetch('/api/nfe/upload/batch', {
                 method: 'POST',
                 body: formData,
                 // Não setamos Content-Type para o browser gerar o boundary correto
             });
 
             if (response.ok) {
-                alert('NF-e processada com sucesso!');
+                const report = await response.json();
+                const summary = report.summary || {};
+                const failures = (report.results || [])
+                    .filter((r: { status: string }) => r.status === 'SUSPEITO' || r.status === 'INVALIDO' || r.status === 'ERRO')
+                    .slice(0, 10)
+                    .map((r: { file: string; reason?: string }) => `• ${r.file}: ${r.reason || 'falha'}`);
+                alert(
+                    `${report.total} documento(s) processado(s): ${summary.REGISTRADO || 0} registrado(s), ` +
+                    `${summary.DUPLICADO || 0} duplicado(s), ${summary.SUSPEITO || 0} suspeito(s), ${summary.INVALIDO || 0} inválido(s), ${summary.ERRO || 0} com erro.` +
+                    (failures.length > 0 ? `\n\n${failures.join('\n')}` : '')
+                );
                 handleRefresh();
             } else {
                 const err = await response.json();
@@ -118,7 +128,8 @@ export default function Dashboard() {
                             type="file"
                             ref={fileInputRef}
                             onChange={handleFileChange}
-                            accept=".xml"
+                            accept=".xml,.zip"
+                            multiple
                             className="hidden"
                         />
                         <Button
@@ -126,7 +137,7 @@ export default function Dashboard() {
                             loading={uploading}
                             className="bg-white hover:bg-ruby-50 text-ruby-600 border-none px-12 h-14 rounded-2xl shadow-ruby group-hover:scale-105 transition-transform"
                         >
-                            <span className="text-xs font-black uppercase tracking-widest">Selecionar XML</span>
+                            <span className="text-xs font-black uppercase tracking-widest">Selecionar XML/ZIP</span>
                         </Button>
                     </div>
                 </Card>
@@ -1,9 +1,9 @@
 import { useState, useEffect } from 'react';
-import { TableContainer, THead, TBody, Tr, Th, Td, Badge, Button, Modal } from '../components/UI';
-import { FileText, Eye, ShieldCheck, TrendingUp, Package } from 'lucide-react';
+import { TableContainer, THead, TBody, Tr, Th, Td, Badge, Button, Modal, Input, Select } from '../components/UI';
+import { FileText, Eye, ShieldCheck, TrendingUp, Package, Search, ArrowUpDown } from 'lucide-react';
 import { useAuth } from '../contexts/AuthContext';
 import { useQueryClient } from '@tanstack/react-query';
-import { type NFe, type NFeDetail } from '../hooks/useQueries';
+import { type NFe, type NFeDetail, type NFeListSummary } from '../hooks/useQueries';
 import PullToRefresh from '../components/PullToRefresh';
 
 export default function NFe() {
@@ -12,18 +12,35 @@ export default function NFe() {
     const [nfes, setNfes] = useState<NFe[]>([]);
     const [loading, setLoading] = useState(true);
     const [processing, setProcessing] = useState<string | null>(null);
+    const [printing, setPrinting] = useState<string | null>(null);
 
     // Modal state
     const [selectedNfe, setSelectedNfe] = useState<NFe | null>(null);
     const [nfeDetail, setNfeDetail] = useState<NFeDetail | null>(null);
     const [loadingDetail, setLoadingDetail] = useState(false);
 
+    // Filtros e ordenação da listagem (aplicados no servidor)
+    const [filters, setFilters] = useState({
+        status: '', supplier: '', number: '', product: '',
+        issued_from: '', issued_to: '', min_value: '', max_value: ''
+    });
+    const [sort, setSort] = useState({ field: 'processed_at', desc: true });
+    const [summary, setSummary] = useState<NFeListSummary | null>(null);
+
     const fetchNFes = async () => {
         try {
-            const response = await apiFetch('/api/nfes');
+            const params = new URLSearchParams({ sort: sort.field, order: sort.desc ? 'desc' : 'asc' });
+            Object.entries(filters).forEach(([key, value]) => {
+                if (value.trim()) params.set(key, value.trim());
+            });
+            const response = await apiFetch(`/api/nfes?${params.toString()}`);
             if (response.ok) {
                 const result = await response.json();
                 setNfes(result.data || []);
+                setSummary(result.summary || null);
+            } else {
+                const err = await response.json().catch(() => ({}));
+                alert(`Erro: ${err.error || 'Falha ao buscar notas'}`);
             }
         } catch (err) {
             console.error('Error fetching NFes:', err);
@@ -59,7 +76,21 @@ export default function NFe() {
 
     useEffect(() => {
         fetchNFes();
-    }, []);
+    }, [sort]);
+
+    const handleSearch = (e: React.FormEvent) => {
+        e.preventDefault();
+        setLoading(true);
+        fetchNFes();
+    };
+
+    const handleSort = (field: string) => {
+        setLoading(true);
+        setSort(prev => ({ field, desc: prev.field === field ? !prev.desc : true }));
+    };
+
+    const updateFilter = (key: keyof typeof filters) => (e: React.ChangeEvent<HTMLInputElement | HTMLSelectElement>) =>
+        setFilters(prev => ({ ...prev, [key]: e.target.value }));
 
     const handleProcess = async (accessKey: string) => {
         setProcessing(accessKey);
@@ -68,12 +99,14 @@ export default function NFe() {
                 method: 'POST'
             });
             if (response.ok) {
-                setNfes(prev => prev.map(n =>
-                    n.access_key === accessKey ? { ...n, status: 'PROCESSADA' } : n
-                ));
+                // Status final pode ser PROCESSADA ou PARCIAL, conforme a conferência
+                await fetchNFes();
                 queryClient.invalidateQueries({ queryKey: ['dashboard-stats'] });
                 queryClient.invalidateQueries({ queryKey: ['dashboard-evolution'] });
                 queryClient.invalidateQueries({ queryKey: ['stock'] });
+            } else {
+                const err = await response.json();
+                alert(`Erro: ${err.error || 'Falha ao efetivar nota'}`);
             }
         } catch (err) {
             console.error('Error processing NFe:', err);
@@ -82,6 +115,39 @@ export default function NFe() {
         }
     };
 
+    const handleDanfe = async (accessKey: string) => {
+        setPrinting(accessKey);
+        try {
+            const response = await apiFetch(`/api/nfes/${accessKey}/danfe.pdf`);
+            if (!response.ok) {
+                const err = await response.json();
+                alert(`Erro: ${err.error || 'Falha ao gerar DANFE'}`);
+                return;
+            }
+            // O PDF abre em nova aba; a URL temporária é liberada depois do carregamento
+            const url = window.URL.createObjectURL(await response.blob());
+            window.open(url, '_blank');
+            setTimeout(() => window.URL.revokeObjectURL(url), 60000);
+        } catch (err) {
+            console.error('Error generating DANFE:', err);
+        } finally {
+            setPrinting(null);
+        }
+    };
+
+    const closedStatusLabels: Record<string, string> = {
+        PARCIAL: 'Recebida parcial',
+        REJEITADA: 'Rejeitada',
+        CANCELADA: 'Cancelada'
+    };
+
+    const authorizationLabels: Record<string, string> = {
+        AUTORIZADA: 'Autorizada',
+        DENEGADA: 'Uso denegado',
+        NAO_AUTORIZADA: 'Não autorizada',
+        SEM_PROTOCOLO: 'Sem protocolo SEFAZ'
+    };
+
     const formatCurrency = (value: number) => {
         return new Intl.NumberFormat('pt-BR', { style: 'currency', currency: 'BRL' }).format(value);
     };
@@ -98,7 +164,8 @@ export default function NFe() {
         });
     };
 
-    const totalValue = nfes.reduce((acc, curr) => acc + (curr.total_value || 0), 0);
+    // Totais do conjunto filtrado inteiro (não só da página)
+    const totalValue = summary ? summary.total_value : nfes.reduce((acc, curr) => acc + (curr.total_value || 0), 0);
 
     return (
         <PullToRefresh onRefresh={handleRefresh}>
@@ -132,16 +199,66 @@ export default function NFe() {
                     </div>
                 </div>
 
+                {/* Filtros */}
+                <form onSubmit={handleSearch} className="bg-white rounded-[24px] border border-charcoal-200 shadow-sm p-6 space-y-4">
+                    <div className="grid grid-cols-2 md:grid-cols-4 gap-4">
+                        <Select value={filters.status} onChange={updateFilter('status')}>
+                            <option value="">Todos os status</option>
+                            <option value="PENDENTE">Pendente</option>
+                            <option value="EM_CONFERENCIA">Em conferência</option>
+                            <option value="PROCESSADA">Processada</option>
+                            <option value="PARCIAL">Recebida parcial</option>
+                            <option value="REJEITADA">Rejeitada</option>
+                            <option value="CANCELADA">Cancelada</option>
+                        </Select>
+                        <Input placeholder="Fornecedor ou CNPJ" value={filters.supplier} onChange={updateFilter('supplier')} />
+                        <Input placeholder="Número da nota" value={filters.number} onChange={updateFilter('number')} />
+                        <Input placeholder="Produto (código ou descrição)" value={filters.product} onChange={updateFilter('product')} />
+                        <Input type="date" title="Emitida a partir de" value={filters.issued_from} onChange={updateFilter('issued_from')} />
+                        <Input type="date" title="Emitida até" value={filters.issued_to} onChange={updateFilter('issued_to')} />
+                        <Input type="number" step="0.01" placeholder="Valor mínimo" value={filters.min_value} onChange={updateFilter('min_value')} />
+                        <Input type="number" step="0.01" placeholder="Valor máximo" value={filters.max_value} onChange={updateFilter('max_value')} />
+                    </div>
+                    <div className="flex flex-wrap items-center justify-between gap-4">
+                        <div className="flex flex-wrap gap-2">
+                            {summary?.by_status.map((st) => (
+                                <Badge key={st.status} variant="info" className="text-[9px] uppercase tracking-widest">
+                                    {st.status}: {st.count} · {formatCurrency(st.total_value)}
+                                </Badge>
+                            ))}
+                        </div>
+                        <Button type="submit" className="h-10 px-6 bg-navy-950 hover:bg-ruby-600 text-[10px] font-black uppercase tracking-widest rounded-xl">
+                            <Search className="w-4 h-4 mr-2" /> Filtrar
+                        </Button>
+                    </div>
+                </form>
+
                 {/* Tabela de Histórico */}
                 <div className="bg-white rounded-[32px] border border-charcoal-200 shadow-premium overflow-hidden">
                     <TableContainer className="border-none">
                         <THead>
                             <Tr className="bg-navy-950 border-none">
                                 <Th className="text-white py-6">Emissor & Documento</Th>
-                                <Th className="text-white">Data de Registro</Th>
-                                <Th className="text-center text-white">Itens</Th>
-                                <Th className="text-right text-white">Valor Total</Th>
-                                <Th className="text-white">Status</Th>
+                                <Th className="text-white">
+                                    <button type="button" onClick={() => handleSort('issued_at')} className="flex items-center gap-1 uppercase">
+                                        Emissão / Registro <ArrowUpDown className="w-3 h-3" />
+                                    </button>
+                                </Th>
+                                <Th className="text-center text-white">
+                                    <button type="button" onClick={() => handleSort('total_items')} className="inline-flex items-center gap-1 uppercase">
+                                        Itens <ArrowUpDown className="w-3 h-3" />
+                                    </button>
+                                </Th>
+                                <Th className="text-right text-white">
+                                    <button type="button" onClick={() => handleSort('total_value')} className="inline-flex items-center gap-1 uppercase">
+                                        Valor Total <ArrowUpDown className="w-3 h-3" />
+                                    </button>
+                                </Th>
+                                <Th className="text-white">
+                                    <button type="button" onClick={() => handleSort('status')} className="flex items-center gap-1 uppercase">
+                                        Status <ArrowUpDown className="w-3 h-3" />
+                                    </button>
+                                </Th>
                                 <Th className="w-10 text-white">{null}</Th>
                             </Tr>
                         </THead>
@@ -166,19 +283,22 @@ export default function NFe() {
                                                     <FileText className="w-5 h-5" />
                                                 </div>
                                                 <div className="flex flex-col">
-                                                    <span className="text-xs font-black text-navy-900 uppercase tracking-tight truncate max-w-[240px]" title={nfe.supplier_name}>
-                                                        {nfe.supplier_name || "Fornecedor não identificado"}
+                                                    <span className="text-xs font-black text-navy-900 uppercase tracking-tight truncate max-w-[240px]" title={nfe.direction === 'SAIDA' ? nfe.recipient_name : nfe.supplier_name}>
+                                                        {nfe.direction === 'SAIDA'
+                                                            ? nfe.recipient_name || "Destinatário não identificado"
+                                                            : nfe.supplier_name || "Fornecedor não identificado"}
                                                     </span>
                                                     <span className="text-[10px] font-bold text-charcoal-400 mt-1 uppercase tracking-[0.15em] font-mono">
                                                         Nº NF: {nfe.number || "---"}
+                                                        {nfe.direction === 'SAIDA' && ` · Saída${nfe.operation ? ` (${nfe.operation})` : ''}`}
                                                     </span>
                                                 </div>
                                             </div>
                                         </Td>
                                         <Td>
                                             <div className="flex flex-col">
-                                                <span className="text-sm font-bold text-navy-900 tracking-tight">{formatDate(nfe.processed_at).split(' ')[0]}</span>
-                                                <span className="text-[10px] font-medium text-charcoal-400">{formatDate(nfe.processed_at).split(' ')[1]}</span>
+                                                <span className="text-sm font-bold text-navy-900 tracking-tight">{nfe.issued_at ? formatDate(nfe.issued_at).split(' ')[0] : '---'}</span>
+                                                <span className="text-[10px] font-medium text-charcoal-400">Registro: {formatDate(nfe.processed_at)}</span>
                                             </div>
                                         </Td>
                                         <Td className="text-center">
@@ -196,15 +316,23 @@ export default function NFe() {
                                                     <ShieldCheck className="w-4 h-4" />
                                                     <span className="text-[10px] font-black uppercase tracking-widest">Conciliada</span>
                                                 </div>
+                                            ) : closedStatusLabels[nfe.status] ? (
+                                                <span className="text-[10px] font-black uppercase tracking-widest text-ruby-600">{closedStatusLabels[nfe.status]}</span>
                                             ) : (
                                                 <Button
                                                     onClick={(e) => { e.stopPropagation(); handleProcess(nfe.access_key); }}
                                                     loading={processing === nfe.access_key}
+                                                    disabled={nfe.authorization_state === 'DENEGADA' || nfe.authorization_state === 'NAO_AUTORIZADA'}
                                                     className="h-8 px-4 bg-navy-950 hover:bg-ruby-600 text-[9px] font-black uppercase tracking-widest rounded-lg"
                                                 >
                                                     Efetivar
                                                 </Button>
                                             )}
+                                            {nfe.authorization_state && nfe.authorization_state !== 'AUTORIZADA' && (
+                                                <span className="block mt-1 text-[9px] font-black uppercase tracking-widest text-ruby-600" title={nfe.protocol_number}>
+                                                    {authorizationLabels[nfe.authorization_state]}
+                                                </span>
+                                            )}
                                         </Td>
                                         <Td className="text-right">
                                             <button
@@ -325,15 +453,26 @@ export default function NFe() {
                                     <span className="text-[10px] font-black uppercase tracking-widest">Dados validados via SEFAZ XML</span>
                                 </div>
 
-                                {selectedNfe.status === 'PENDENTE' && (
+                                <div className="flex flex-col md:flex-row gap-3 w-full md:w-auto">
                                     <Button
-                                        onClick={() => handleProcess(selectedNfe.access_key)}
-                                        loading={processing === selectedNfe.access_key}
-                                        className="w-full md:w-auto bg-ruby-600 hover:bg-ruby-500 text-white"
+                                        variant="secondary"
+                                        onClick={() => handleDanfe(selectedNfe.access_key)}
+                                        loading={printing === selectedNfe.access_key}
+                                        className="w-full md:w-auto"
                                     >
-                                        Confirmar e Efetivar Estoque
+                                        <FileText className="w-4 h-4 mr-2" />
+                                        DANFE (PDF)
                                     </Button>
-                                )}
+                                    {(selectedNfe.status === 'PENDENTE' || selectedNfe.status === 'EM_CONFERENCIA') && (
+                                        <Button
+                                            onClick={() => handleProcess(selectedNfe.access_key)}
+                                            loading={processing === selectedNfe.access_key}
+                                            className="w-full md:w-auto bg-ruby-600 hover:bg-ruby-500 text-white"
+                                        >
+                                            Confirmar e Efetivar Estoque
+                                        </Button>
+                                    )}
+                                </div>
                             </div>
                         </div>
                     </Modal>
@@ -45,6 +45,24 @@ class NotificationService {
             });
         });
 
+        this.eventSource.addEventListener('NFE_CONFLICT', (e: any) => {
+            const data = JSON.parse(e.data);
+            this.showNotification('Documento suspeito retido', {
+                body: data.message,
+                icon: '/icon-192.png',
+                tag: `nfe-conflict-${data.data?.conflict_id}`
+            });
+        });
+
+        this.eventSource.addEventListener('NFE_BATCH_DONE', (e: any) => {
+            const data = JSON.parse(e.data);
+            this.showNotification('Lote de NF-e concluído', {
+                body: data.message,
+                icon: '/icon-192.png',
+                tag: `nfe-batch-${data.data?.batch_id}`
+            });
+        });
+
         this.eventSource.onerror = (e) => {
             console.error('SSE connection error:', e);
             this.eventSource?.close();
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/certstore"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ListCertificatesHandler lista os certificados digitais cadastrados (sem a chave privada)
+func (h *Handler) ListCertificatesHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Certificates.List()
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar certificados", err), "Erro ao buscar certificados")
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":             h.Certificates.Enabled(),
+		"expiry_warning_days": int(certstore.ExpiryWarningPeriod.Hours() / 24),
+		"certificates":        list,
+	})
+}
+
+// UploadCertificateHandler recebe o PFX do certificado A1 (campo "certificate") e a
+// senha (campo "password") e o torna o certificado ativo
+func (h *Handler) UploadCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		HandleError(w, NewAppError(http.StatusBadRequest, "Erro ao processar formulário", err), "Erro ao enviar certificado")
+		return
+	}
+	file, _, err := r.FormFile("certificate")
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusBadRequest, "Arquivo não encontrado (chave 'certificate' obrigatória)", err), "Erro ao enviar certificado")
+		return
+	}
+	defer file.Close()
+
+	pfx, err := io.ReadAll(io.LimitReader(file, 1<<20))
+	if err != nil || len(pfx) == 0 {
+		HandleError(w, NewAppError(http.StatusBadRequest, "Erro ao ler arquivo", err), "Erro ao enviar certificado")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	cert, err := h.Certificates.Upload(pfx, r.FormValue("password"), &userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, certstore.ErrNoEncryption):
+			RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, certstore.ErrInvalidPassword), errors.Is(err, certstore.ErrInvalidPFX),
+			errors.Is(err, certstore.ErrUnsupportedPFX), errors.Is(err, certstore.ErrNoPrivateKey), errors.Is(err, certstore.ErrExpired):
+			RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao salvar certificado", err), "Erro ao enviar certificado")
+		}
+		return
+	}
+
+	LogAuditAction(h.DB, r, &userID, "UPLOAD", "digital_certificate", strconv.Itoa(int(cert.ID)),
+		"Certificado digital enviado e ativado: "+cert.Subject, nil, certificateAudit(*cert))
+
+	slog.Info("Certificado digital ativado", "subject", cert.Subject, "cnpj", cert.CNPJ, "not_after", cert.NotAfter)
+	RespondWithJSON(w, http.StatusCreated, cert)
+}
+
+// ActivateCertificateHandler volta a usar um certificado já cadastrado
+func (h *Handler) ActivateCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+	id, err := strconv.Atoi(parts[4])
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	cert, err := h.Certificates.Activate(int32(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			RespondWithError(w, http.StatusNotFound, "Certificado não encontrado")
+		case errors.Is(err, certstore.ErrExpired):
+			RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao ativar certificado", err), "Erro ao ativar certificado")
+		}
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "UPDATE", "digital_certificate", strconv.Itoa(id),
+		"Certificado digital ativado: "+cert.Subject, nil, certificateAudit(*cert))
+	RespondWithJSON(w, http.StatusOK, cert)
+}
+
+// DeleteCertificateHandler remove um certificado cadastrado
+func (h *Handler) DeleteCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	cert, err := h.Certificates.Delete(int32(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondWithError(w, http.StatusNotFound, "Certificado não encontrado")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao remover certificado", err), "Erro ao remover certificado")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "DELETE", "digital_certificate", strconv.Itoa(id),
+		"Certificado digital removido: "+cert.Subject, certificateAudit(*cert), nil)
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Certificado removido"})
+}
+
+// certificateAudit resume o certificado para o log de auditoria
+func certificateAudit(cert models.DigitalCertificate) map[string]interface{} {
+	return map[string]interface{}{
+		"subject":     cert.Subject,
+		"cnpj":        cert.CNPJ,
+		"serial":      cert.SerialNumber,
+		"fingerprint": cert.Fingerprint,
+		"not_after":   cert.NotAfter,
+		"active":      cert.Active,
+	}
+}
@@ -3,15 +3,19 @@ package api
 import (
 	"encoding/json"
 	"estoque/internal/models"
+	"estoque/internal/services"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/emersion/go-imap/client"
 )
 
-// GetEmailConfigHandler retorna a configuração de e-mail atual
+// GetEmailConfigHandler retorna a primeira caixa de e-mail cadastrada (as demais
+// são mantidas em /config/mailboxes)
 func (h *Handler) GetEmailConfigHandler(w http.ResponseWriter, r *http.Request) {
 	var config models.EmailConfig
 	// Busca a primeira configuração (considerando que só temos uma para o sistema todo)
@@ -28,59 +32,12 @@ func (h *Handler) GetEmailConfigHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Não retornar a senha em texto claro
-	config.IMAPPassword = "********"
+	config.IMAPPassword = maskedPassword
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(config)
 }
 
-// UpdateEmailConfigHandler cria ou atualiza a configuração de e-mail
-func (h *Handler) UpdateEmailConfigHandler(w http.ResponseWriter, r *http.Request) {
-	var req models.EmailConfig
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
-		return
-	}
-
-	var configs []models.EmailConfig
-	h.DB.Limit(1).Find(&configs)
-
-	if len(configs) == 0 {
-		// Criar nova
-		if err := h.DB.Create(&req).Error; err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Erro ao criar configuração")
-			return
-		}
-	} else {
-		config := configs[0]
-		isNewPassword := req.IMAPPassword != "********"
-
-		// Se a senha enviada for "********", mantemos a atual
-		if !isNewPassword {
-			req.IMAPPassword = config.IMAPPassword
-		}
-
-		// Garante que o ID e metadados sejam preservados para o Save
-		req.ID = config.ID
-		req.CreatedAt = config.CreatedAt
-
-		// Usar Save para garantir que TODOS os campos sejam atualizados (incluindo booleans false)
-		if err := h.DB.Save(&req).Error; err != nil {
-			RespondWithError(w, http.StatusInternalServerError, "Erro ao atualizar configuração")
-			return
-		}
-
-		if isNewPassword {
-			slog.Info("Configuração de e-mail atualizada com NOVA senha")
-		} else {
-			slog.Info("Configuração de e-mail atualizada (mantendo senha atual)")
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Configuração salva com sucesso"})
-}
-
 // TestEmailConnectionHandler testa a conexão com o servidor IMAP
 func (h *Handler) TestEmailConnectionHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.EmailConfig
@@ -89,11 +46,16 @@ func (h *Handler) TestEmailConnectionHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Se for teste de uma configuração existente e a senha for "********"
-	if req.IMAPPassword == "********" {
+	req.IMAPHost = strings.TrimSpace(req.IMAPHost)
+	req.IMAPUser = strings.TrimSpace(req.IMAPUser)
+
+	// Teste de uma caixa existente com a senha mascarada: usa a gravada, desde
+	// que servidor e usuário sejam os da caixa
+	if req.IMAPPassword == maskedPassword {
 		var existing models.EmailConfig
-		if err := h.DB.First(&existing).Error; err == nil {
-			req.IMAPPassword = existing.IMAPPassword
+		if req.ID == 0 || h.DB.First(&existing, req.ID).Error != nil || !reuseStoredPassword(&req, existing) {
+			RespondWithError(w, http.StatusBadRequest, "Informe a senha para testar a conexão")
+			return
 		}
 	}
 
@@ -115,7 +77,7 @@ func (h *Handler) TestEmailConnectionHandler(w http.ResponseWriter, r *http.Requ
 	defer c.Logout()
 
 	// Tenta login
-	if err := c.Login(req.IMAPUser, req.IMAPPassword); err != nil {
+	if err := c.Login(req.IMAPUser, string(req.IMAPPassword)); err != nil {
 		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Erro de login: %v", err))
 		return
 	}
@@ -129,3 +91,75 @@ func (h *Handler) TestEmailConnectionHandler(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Conexão estabelecida com sucesso!"})
 }
+
+// GetNfeConfigHandler retorna as regras de recebimento de NF-e
+func (h *Handler) GetNfeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(w, http.StatusOK, services.GetNfeConfig(h.DB))
+}
+
+// UpdateNfeConfigHandler cria ou atualiza as regras de recebimento de NF-e
+func (h *Handler) UpdateNfeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.NfeConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	if req.SignaturePolicy != services.SignaturePolicyReject && req.SignaturePolicy != services.SignaturePolicyFlag {
+		RespondWithError(w, http.StatusBadRequest, "Política de assinatura deve ser REJEITAR ou SINALIZAR")
+		return
+	}
+
+	switch req.CostProration {
+	case "":
+		req.CostProration = services.ProrationByValue
+	case services.ProrationByValue, services.ProrationByQuantity:
+	default:
+		RespondWithError(w, http.StatusBadRequest, "Rateio de custo deve ser VALOR ou QUANTIDADE")
+		return
+	}
+
+	// Normaliza a lista de CNPJs próprios e rejeita documentos incompletos
+	ownCNPJs := services.ParseOwnCNPJs(req.OwnCNPJs)
+	for _, doc := range ownCNPJs {
+		if len(doc) != 14 {
+			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("CNPJ próprio inválido: %s", doc))
+			return
+		}
+	}
+	req.OwnCNPJs = strings.Join(ownCNPJs, ",")
+
+	current := services.GetNfeConfig(h.DB)
+	req.ID = current.ID
+	req.CreatedAt = current.CreatedAt
+
+	// Save cria o registro quando ID é zero e atualiza todos os campos caso contrário
+	if err := h.DB.Save(&req).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao salvar configuração de NF-e", err), "Erro ao salvar configuração")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "UPDATE", "nfe_config", strconv.FormatUint(uint64(req.ID), 10),
+		"Configuração de recebimento de NF-e atualizada",
+		nfeConfigAudit(current),
+		nfeConfigAudit(req),
+	)
+
+	slog.Info("Configuração de NF-e atualizada", "signature_policy", req.SignaturePolicy, "own_cnpjs", len(ownCNPJs))
+	RespondWithJSON(w, http.StatusOK, req)
+}
+
+// nfeConfigAudit resume a configuração de NF-e para o log de auditoria
+func nfeConfigAudit(cfg models.NfeConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"signature_policy":     cfg.SignaturePolicy,
+		"own_cnpjs":            cfg.OwnCNPJs,
+		"cost_proration":       cfg.CostProration,
+		"cost_exclude_ipi":     cfg.CostExcludeIPI,
+		"cost_exclude_icms_st": cfg.CostExcludeICMSST,
+		"cost_credit_icms":     cfg.CostCreditICMS,
+		"auto_ciencia":         cfg.AutoCiencia,
+		"auto_confirmation":    cfg.AutoConfirmation,
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// respondAlreadyRegistered devolve a nota existente quando o mesmo XML é reenviado
+func (h *Handler) respondAlreadyRegistered(w http.ResponseWriter, accessKey string) {
+	var nfe models.ProcessedNFe
+	if err := h.DB.Omit("xml_data").First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar nota", err), "Erro ao processar NF-e")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":            "NF-e já registrada com o mesmo conteúdo",
+		"already_registered": true,
+		"access_key":         nfe.AccessKey,
+		"status":             nfe.Status,
+		"total_items":        nfe.TotalItems,
+		"processed_at":       nfe.ProcessedAt,
+	})
+}
+
+// ListNfeConflictsHandler lista os XMLs divergentes retidos para análise (?status=PENDENTE)
+func (h *Handler) ListNfeConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	conflicts, err := h.NfeService.ListConflicts(r.URL.Query().Get("status"))
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar documentos divergentes", err), "Erro ao buscar documentos divergentes")
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, conflicts)
+}
+
+// GetNfeConflictXMLHandler baixa o XML divergente para comparação com o registrado
+func (h *Handler) GetNfeConflictXMLHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := conflictIDFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	var conflict models.NFeConflict
+	if err := h.DB.First(&conflict, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, NewAppError(http.StatusNotFound, services.ErrConflictNotFound.Error(), err), "Erro ao buscar documento divergente")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar documento divergente", err), "Erro ao buscar documento divergente")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", "attachment; filename="+conflict.AccessKey+"-divergente-"+strconv.Itoa(int(conflict.ID))+".xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(conflict.XMLData)
+}
+
+// ReviewNfeConflictHandler registra a conclusão da análise de um documento divergente
+func (h *Handler) ReviewNfeConflictHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := conflictIDFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	var req struct {
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+	if strings.TrimSpace(req.Resolution) == "" {
+		RespondWithError(w, http.StatusBadRequest, "Informe a conclusão da análise")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	conflict, err := h.NfeService.ReviewConflict(id, req.Resolution, &userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrConflictNotFound):
+			HandleError(w, NewAppError(http.StatusNotFound, err.Error(), err), "Erro ao analisar documento divergente")
+		case errors.Is(err, services.ErrConflictAlreadyReviewed):
+			HandleError(w, NewAppError(http.StatusConflict, err.Error(), err), "Erro ao analisar documento divergente")
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao analisar documento divergente", err), "Erro ao analisar documento divergente")
+		}
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, conflict)
+}
+
+// conflictIDFromPath extrai o ID de /api/nfe-conflicts/{id}/...
+func conflictIDFromPath(path string) (int32, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[3], 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return int32(id), true
+}
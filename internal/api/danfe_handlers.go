@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/danfe"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DanfeHandler gera o DANFE em PDF a partir do XML armazenado da nota
+func (h *Handler) DanfeHandler(w http.ResponseWriter, r *http.Request) {
+	// Extrair access_key da URL (ex: /api/nfes/{access_key}/danfe.pdf)
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+	accessKey := parts[3]
+
+	var nfe models.ProcessedNFe
+	if err := h.DB.Select("access_key", "status", "xml_data").First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar nota", err), "Erro ao buscar nota")
+		return
+	}
+	if len(nfe.XMLData) == 0 {
+		RespondWithError(w, http.StatusUnprocessableEntity, "XML da nota não está armazenado")
+		return
+	}
+
+	var proc models.NfeProc
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		HandleError(w, NewAppError(http.StatusUnprocessableEntity, "XML da nota inválido", err), "Erro ao gerar DANFE")
+		return
+	}
+
+	pdf, err := danfe.Render(&proc, danfe.Options{Cancelled: nfe.Status == services.NfeStatusCancelled})
+	if err != nil {
+		if errors.Is(err, danfe.ErrInvalidNfe) {
+			HandleError(w, NewAppError(http.StatusUnprocessableEntity, err.Error(), err), "Erro ao gerar DANFE")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao gerar DANFE", err), "Erro ao gerar DANFE")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="DANFE-`+nfe.AccessKey+`.pdf"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pdf)
+}
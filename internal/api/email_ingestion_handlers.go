@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/nfe_consumer"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ListEmailIngestionsHandler lista o histórico de anexos lidos das caixas de e-mail.
+// Filtros: mailbox_id, outcome, search (remetente, assunto, arquivo ou chave),
+// start_date e end_date (YYYY-MM-DD)
+func (h *Handler) ListEmailIngestionsHandler(w http.ResponseWriter, r *http.Request) {
+	params := ParsePaginationParams(r)
+	offset := (params.Page - 1) * params.Limit
+	query := r.URL.Query()
+
+	db := h.DB.Model(&models.EmailIngestion{})
+	if mailboxID := query.Get("mailbox_id"); mailboxID != "" {
+		id, err := strconv.Atoi(mailboxID)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Parâmetro 'mailbox_id' inválido")
+			return
+		}
+		db = db.Where("email_config_id = ?", id)
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		db = db.Where("outcome = ?", strings.ToUpper(outcome))
+	}
+	if search := strings.TrimSpace(query.Get("search")); search != "" {
+		like := "%" + search + "%"
+		db = db.Where("sender LIKE ? OR subject LIKE ? OR filename LIKE ? OR access_key LIKE ?", like, like, like, like)
+	}
+	if startDateStr := query.Get("start_date"); startDateStr != "" {
+		startDate, err := time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Formato de 'start_date' inválido. Use YYYY-MM-DD.")
+			return
+		}
+		db = db.Where("created_at >= ?", startDate)
+	}
+	if endDateStr := query.Get("end_date"); endDateStr != "" {
+		endDate, err := time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "Formato de 'end_date' inválido. Use YYYY-MM-DD.")
+			return
+		}
+		db = db.Where("created_at < ?", endDate.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar histórico de importação", err), "Erro ao buscar histórico de importação")
+		return
+	}
+
+	// O anexo fica de fora da listagem; é baixado em /attachment
+	var rows []models.EmailIngestion
+	if err := db.Omit("content").Order("created_at DESC, id DESC").Offset(offset).Limit(params.Limit).Find(&rows).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar histórico de importação", err), "Erro ao buscar histórico de importação")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, NewPaginatedResponse(rows, total, params))
+}
+
+// DownloadEmailIngestionHandler baixa o anexo original recebido por e-mail
+func (h *Handler) DownloadEmailIngestionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := ingestionIDFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	var row models.EmailIngestion
+	if err := h.DB.First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondWithError(w, http.StatusNotFound, "Registro de importação não encontrado")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar registro de importação", err), "Erro ao baixar anexo")
+		return
+	}
+	content := row.Content
+	if len(content) == 0 && row.AccessKey != "" {
+		// NF-e registrada: o histórico guarda só a chave, o XML fica na nota
+		var nfe models.ProcessedNFe
+		err := h.DB.Select("xml_data").Where("access_key = ?", row.AccessKey).Limit(1).Find(&nfe).Error
+		if err != nil {
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar XML da nota", err), "Erro ao baixar anexo")
+			return
+		}
+		content = nfe.XMLData
+	}
+	if len(content) == 0 {
+		RespondWithError(w, http.StatusNotFound, "Anexo não disponível para este registro")
+		return
+	}
+
+	// Arquivos de dentro de ZIP ficam como "lote.zip/nota.xml"
+	filename := path.Base(row.Filename)
+	contentType := "application/xml"
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		contentType = "application/zip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(filename))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
+
+// RetryEmailIngestionHandler reenvia ao pool um anexo cuja importação falhou
+func (h *Handler) RetryEmailIngestionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := ingestionIDFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	user, _ := GetUserFromContext(r, h.DB)
+	var userID *int32
+	userEmail := "system"
+	if user != nil {
+		userID = &user.ID
+		userEmail = user.Email
+	}
+
+	previous := ""
+	var old models.EmailIngestion
+	if err := h.DB.Select("outcome").First(&old, id).Error; err == nil {
+		previous = old.Outcome
+	}
+
+	row, err := nfe_consumer.RetryIngestion(h.DB, h.NFeWorkerPool, id, userID, userEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			RespondWithError(w, http.StatusNotFound, "Registro de importação não encontrado")
+		case errors.Is(err, nfe_consumer.ErrIngestionNotRetryable):
+			HandleError(w, NewAppError(http.StatusUnprocessableEntity, err.Error(), err), "Erro ao reprocessar anexo")
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao reprocessar anexo", err), "Erro ao reprocessar anexo")
+		}
+		return
+	}
+
+	LogAuditAction(h.DB, r, userID, "RETRY", "email_ingestion", strconv.Itoa(int(row.ID)),
+		"Anexo de e-mail reprocessado: "+row.Filename,
+		map[string]interface{}{"outcome": previous},
+		map[string]interface{}{"outcome": row.Outcome, "access_key": row.AccessKey})
+
+	RespondWithJSON(w, http.StatusOK, row)
+}
+
+// ingestionIDFromPath extrai o ID de /api/email-ingestions/{id}/...
+func ingestionIDFromPath(urlPath string) (int32, bool) {
+	parts := strings.Split(urlPath, "/")
+	if len(parts) < 4 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[3], 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return int32(id), true
+}
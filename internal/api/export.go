@@ -37,6 +37,9 @@ func (h *Handler) ExportStockHandler(w http.ResponseWriter, r *http.Request) {
 	if categoryID := r.URL.Query().Get("category_id"); categoryID != "" {
 		job.Filters["category_id"] = categoryID
 	}
+	if supplierID := r.URL.Query().Get("supplier_id"); supplierID != "" {
+		job.Filters["supplier_id"] = supplierID
+	}
 
 	// Processar exportação via worker pool
 	result, err := h.ExportPool.SubmitSync(job)
@@ -106,6 +109,9 @@ func (h *Handler) ExportMovementsHandler(w http.ResponseWriter, r *http.Request)
 	if movType := r.URL.Query().Get("type"); movType != "" {
 		job.Filters["type"] = movType
 	}
+	if supplierID := r.URL.Query().Get("supplier_id"); supplierID != "" {
+		job.Filters["supplier_id"] = supplierID
+	}
 
 	// Processar exportação via worker pool
 	result, err := h.ExportPool.SubmitSync(job)
@@ -6,6 +6,7 @@ import (
 	"estoque/internal/database"
 	"estoque/internal/models"
 	"estoque/internal/services"
+	"estoque/internal/services/certstore"
 	"estoque/internal/services/worker_pools"
 	"fmt"
 	"io"
@@ -24,15 +25,17 @@ type Handler struct {
 	ProductService *services.ProductService
 	NFeWorkerPool  *worker_pools.NFeWorkerPool
 	ExportPool     *worker_pools.ExportWorkerPool
+	Certificates   *certstore.Store
 }
 
-func NewHandler(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool, exportPool *worker_pools.ExportWorkerPool) *Handler {
+func NewHandler(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool, exportPool *worker_pools.ExportWorkerPool, certs *certstore.Store) *Handler {
 	return &Handler{
 		DB:             db,
 		NfeService:     services.NewNfeService(db),
 		ProductService: services.NewProductService(db),
 		NFeWorkerPool:  nfePool,
 		ExportPool:     exportPool,
+		Certificates:   certs,
 	}
 }
 
@@ -150,11 +153,44 @@ func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if result.Duplicate {
+		h.respondAlreadyRegistered(w, result.AccessKey)
+		return
+	}
 	if !result.Success {
 		if result.Error == gorm.ErrDuplicatedKey {
 			HandleError(w, ErrDuplicateNFe, "Erro ao processar NF-e")
 			return
 		}
+		if result.ErrorCode == services.ErrNfeContentConflict.Code {
+			slog.Warn("NF-e com conteúdo divergente retida para análise",
+				"file", fileHeader.Filename,
+				"access_key", result.AccessKey,
+				"user_email", userEmail,
+			)
+			RespondWithJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":      result.Error.Error(),
+				"code":       result.ErrorCode,
+				"file":       fileHeader.Filename,
+				"access_key": result.AccessKey,
+			})
+			return
+		}
+		if result.ErrorCode != "" {
+			slog.Warn("NF-e rejeitada na validação",
+				"file", fileHeader.Filename,
+				"access_key", result.AccessKey,
+				"code", result.ErrorCode,
+				"user_email", userEmail,
+			)
+			RespondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":      result.Error.Error(),
+				"code":       result.ErrorCode,
+				"file":       fileHeader.Filename,
+				"access_key": result.AccessKey,
+			})
+			return
+		}
 		HandleError(w, NewAppErrorWithContext(
 			http.StatusInternalServerError,
 			"Erro ao processar NF-e",
@@ -164,6 +200,25 @@ func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if result.Document == services.DocumentEvent {
+		slog.Info("Evento de NF-e registrado",
+			"access_key", result.AccessKey,
+			"event_type", result.EventType,
+			"user_email", userEmail,
+		)
+
+		// Cancelamento pode ter estornado estoque
+		InvalidateCacheByTags(TagDashboard, TagStock)
+
+		RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message":    services.EventDescription(result.EventType) + " registrado com sucesso",
+			"document":   result.Document,
+			"event_type": result.EventType,
+			"access_key": result.AccessKey,
+		})
+		return
+	}
+
 	slog.Info("NF-e processada",
 		"access_key", result.AccessKey,
 		"total_items", result.Items,
@@ -189,18 +244,19 @@ func (h *Handler) StockHandler(w http.ResponseWriter, r *http.Request) {
 
 	search := r.URL.Query().Get("search")
 	categoryID := r.URL.Query().Get("category_id")
+	supplierID := r.URL.Query().Get("supplier_id")
 	params := ParsePaginationParams(r)
 
 	// Tentar buscar do cache apenas se não houver busca ativa (para simplificar)
 	cacheKey := fmt.Sprintf("%s:%s:%s:%d:%d", CacheKeyStockList, search, categoryID, params.Page, params.Limit)
-	if search == "" && categoryID == "" {
+	if search == "" && categoryID == "" && supplierID == "" {
 		if cachedData, ok := GetAdvancedCache().Get(cacheKey); ok {
 			RespondWithJSON(w, http.StatusOK, cachedData)
 			return
 		}
 	}
 
-	list, total, err := h.ProductService.GetStockList(search, categoryID, params.Page, params.Limit)
+	list, total, err := h.ProductService.GetStockList(search, categoryID, supplierID, params.Page, params.Limit)
 	if err != nil {
 		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar estoque", err), "Erro ao buscar estoque")
 		return
@@ -209,7 +265,7 @@ func (h *Handler) StockHandler(w http.ResponseWriter, r *http.Request) {
 	response := NewPaginatedResponse(list, total, params)
 
 	// Armazenar no cache se for a listagem padrão
-	if search == "" && categoryID == "" {
+	if search == "" && categoryID == "" && supplierID == "" {
 		GetAdvancedCache().Set(cacheKey, response, 5*time.Minute, TagStock)
 	}
 
@@ -224,6 +280,7 @@ func (h *Handler) GetMovementsReport(w http.ResponseWriter, r *http.Request) {
 
 	startDateStr := r.URL.Query().Get("start_date")
 	endDateStr := r.URL.Query().Get("end_date")
+	supplierID := r.URL.Query().Get("supplier_id")
 
 	if startDateStr == "" || endDateStr == "" {
 		RespondWithError(w, http.StatusBadRequest, "Parâmetros 'start_date' e 'end_date' são obrigatórios.")
@@ -246,21 +303,22 @@ func (h *Handler) GetMovementsReport(w http.ResponseWriter, r *http.Request) {
 	endDate = endDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
 
 	// Tentar buscar do cache
-	cacheKey := fmt.Sprintf("report:movements:%s:%s", startDateStr, endDateStr)
+	cacheKey := fmt.Sprintf("report:movements:%s:%s:%s", startDateStr, endDateStr, supplierID)
 	if cachedReport, ok := GetAdvancedCache().Get(cacheKey); ok {
 		RespondWithJSON(w, http.StatusOK, cachedReport)
 		return
 	}
 
-	reportData, err := database.GetMovementsReportData(h.DB, startDate, endDate)
+	reportData, err := database.GetMovementsReportData(h.DB, startDate, endDate, supplierID)
 	if err != nil {
 		HandleError(w, NewAppErrorWithContext(
 			http.StatusInternalServerError,
 			"Erro ao gerar relatório de movimentações",
 			err,
 			map[string]interface{}{
-				"start_date": startDateStr,
-				"end_date":   endDateStr,
+				"start_date":  startDateStr,
+				"end_date":    endDateStr,
+				"supplier_id": supplierID,
 			},
 		), "Erro ao gerar relatório")
 		return
@@ -272,6 +330,53 @@ func (h *Handler) GetMovementsReport(w http.ResponseWriter, r *http.Request) {
 	RespondWithJSON(w, http.StatusOK, reportData)
 }
 
+// GetNfeItemsReport retorna os itens recebidos via NF-e no período, agregados por produto e tributos
+func (h *Handler) GetNfeItemsReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+	supplierID := r.URL.Query().Get("supplier_id")
+
+	if startDateStr == "" || endDateStr == "" {
+		RespondWithError(w, http.StatusBadRequest, "Parâmetros 'start_date' e 'end_date' são obrigatórios.")
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Formato de 'start_date' inválido. Use YYYY-MM-DD.")
+		return
+	}
+
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Formato de 'end_date' inválido. Use YYYY-MM-DD.")
+		return
+	}
+	endDate = endDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+
+	rows, err := database.GetNfeItemsReportData(h.DB, startDate, endDate, supplierID)
+	if err != nil {
+		HandleError(w, NewAppErrorWithContext(
+			http.StatusInternalServerError,
+			"Erro ao gerar relatório de itens de NF-e",
+			err,
+			map[string]interface{}{
+				"start_date":  startDateStr,
+				"end_date":    endDateStr,
+				"supplier_id": supplierID,
+			},
+		), "Erro ao gerar relatório")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, rows)
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
@@ -2,7 +2,6 @@ package api
 
 import (
 	"encoding/json"
-	"encoding/xml"
 	"errors"
 	"estoque/internal/events"
 	"estoque/internal/models"
@@ -504,6 +503,8 @@ func (h *Handler) CategoriesHandler(w http.ResponseWriter, r *http.Request) {
 
 // ===== NFe Handlers =====
 
+// ListNFesHandler lista as notas com filtros (status, fornecedor, número, emissão, valor,
+// produto), ordenação por qualquer coluna e os totais por status do conjunto filtrado
 func (h *Handler) ListNFesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
@@ -511,26 +512,75 @@ func (h *Handler) ListNFesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	params := ParsePaginationParams(r)
-	offset := (params.Page - 1) * params.Limit
-
-	db := h.DB.Model(&models.ProcessedNFe{})
-
-	// Contar total
-	var total int64
-	if err := db.Count(&total).Error; err != nil {
-		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar NF-es", err), "Erro ao buscar NF-es")
+	filter, err := parseNfeListFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Buscar com paginação
-	var nfes []models.ProcessedNFe
-	if err := db.Order("processed_at DESC").Offset(offset).Limit(params.Limit).Find(&nfes).Error; err != nil {
+	nfes, summary, err := h.NfeService.SearchNfes(filter, params.Page, params.Limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidNfeSort) {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar NF-es", err), "Erro ao buscar NF-es")
 		return
 	}
 
-	response := NewPaginatedResponse(nfes, total, params)
-	RespondWithJSON(w, http.StatusOK, response)
+	RespondWithJSON(w, http.StatusOK, struct {
+		PaginatedResponse
+		Summary services.NfeListSummary `json:"summary"`
+	}{NewPaginatedResponse(nfes, summary.Count, params), summary})
+}
+
+// parseNfeListFilter lê os filtros da query string de /api/nfes
+// (ex: ?status=PENDENTE,PARCIAL&supplier=acme&issued_from=2024-03-01&sort=total_value&order=desc)
+func parseNfeListFilter(r *http.Request) (services.NfeListFilter, error) {
+	q := r.URL.Query()
+	filter := services.NfeListFilter{
+		Supplier:   q.Get("supplier"),
+		SupplierID: q.Get("supplier_id"),
+		Number:     q.Get("number"),
+		Product:    q.Get("product"),
+		Direction:  strings.ToUpper(q.Get("direction")),
+		Sort:       q.Get("sort"),
+		Desc:       strings.EqualFold(q.Get("order"), "desc"),
+	}
+	for _, status := range strings.Split(q.Get("status"), ",") {
+		if status = strings.ToUpper(strings.TrimSpace(status)); status != "" {
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	dates := []struct {
+		param  string
+		target **time.Time
+	}{{"issued_from", &filter.IssuedFrom}, {"issued_to", &filter.IssuedTo}}
+	for _, d := range dates {
+		if value := q.Get(d.param); value != "" {
+			t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return filter, fmt.Errorf("Formato de '%s' inválido. Use YYYY-MM-DD.", d.param)
+			}
+			*d.target = &t
+		}
+	}
+
+	values := []struct {
+		param  string
+		target **float64
+	}{{"min_value", &filter.MinValue}, {"max_value", &filter.MaxValue}}
+	for _, v := range values {
+		if value := q.Get(v.param); value != "" {
+			f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+			if err != nil {
+				return filter, fmt.Errorf("Valor de '%s' inválido", v.param)
+			}
+			*v.target = &f
+		}
+	}
+	return filter, nil
 }
 
 func (h *Handler) GetNfeDetailHandler(w http.ResponseWriter, r *http.Request) {
@@ -557,25 +607,26 @@ func (h *Handler) GetNfeDetailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Decodificar XML armazenado
-	var proc models.NfeProc
-	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
-		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao decodificar XML", err), "Erro ao processar detalhes da nota")
+	items, err := h.NfeService.GetNfeItems(nfe.AccessKey)
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar itens da nota", err), "Erro ao processar detalhes da nota")
 		return
 	}
 
-	// Extrair itens
-	items := make([]models.Prod, 0, len(proc.NFe.InfNFe.Det))
-	for _, det := range proc.NFe.InfNFe.Det {
-		items = append(items, det.Prod)
+	events := []models.NFeEvent{}
+	if err := h.DB.Where("access_key = ?", services.NormalizeAccessKey(nfe.AccessKey)).Order("id ASC").Find(&events).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar eventos da nota", err), "Erro ao processar detalhes da nota")
+		return
 	}
 
 	response := models.NfeDetailResponse{
 		AccessKey:    nfe.AccessKey,
-		Number:       proc.NFe.InfNFe.Ide.NNF,
-		SupplierName: proc.NFe.InfNFe.Emit.XNome,
-		TotalValue:   proc.NFe.InfNFe.Total.ICMSTot.VNF,
+		Number:       getStringValue(nfe.Number),
+		SupplierName: getStringValue(nfe.SupplierName),
+		TotalValue:   nfe.TotalValue,
+		Status:       nfe.Status,
 		Items:        items,
+		Events:       events,
 	}
 
 	RespondWithJSON(w, http.StatusOK, response)
@@ -596,12 +647,16 @@ func (h *Handler) ProcessNfeHandler(w http.ResponseWriter, r *http.Request) {
 	accessKey := parts[3]
 
 	// Processar via Service
-	totalItems, err := h.NfeService.ProcessNfe(accessKey)
+	userID, _ := GetUserID(r)
+	totalItems, err := h.NfeService.ProcessNfe(accessKey, &userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
 			return
 		}
+		if respondNfeValidation(w, err, accessKey) {
+			return
+		}
 		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao processar nota", err), "Erro ao processar nota")
 		return
 	}
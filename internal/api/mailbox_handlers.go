@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/secrets"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Senha devolvida no lugar da real; recebida de volta mantém a senha gravada
+const maskedPassword = "********"
+
+// Limites do intervalo de verificação de cada caixa, em minutos
+const (
+	minPollInterval = 1
+	maxPollInterval = 1440
+)
+
+// ListMailboxesHandler lista as caixas de e-mail monitoradas com o status da última verificação
+func (h *Handler) ListMailboxesHandler(w http.ResponseWriter, r *http.Request) {
+	var mailboxes []models.EmailConfig
+	if err := h.DB.Preload("Status").Order("id").Find(&mailboxes).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar caixas de e-mail", err), "Erro ao buscar caixas de e-mail")
+		return
+	}
+	for i := range mailboxes {
+		mailboxes[i].IMAPPassword = maskedPassword
+	}
+	RespondWithJSON(w, http.StatusOK, mailboxes)
+}
+
+// GetMailboxHandler retorna uma caixa de e-mail
+func (h *Handler) GetMailboxHandler(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := h.findMailbox(w, r)
+	if !ok {
+		return
+	}
+	mailbox.IMAPPassword = maskedPassword
+	RespondWithJSON(w, http.StatusOK, mailbox)
+}
+
+// CreateMailboxHandler cadastra uma nova caixa de e-mail
+func (h *Handler) CreateMailboxHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+	if req.IMAPPassword == maskedPassword {
+		req.IMAPPassword = ""
+	}
+	if msg := normalizeMailbox(&req); msg != "" {
+		RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	mailbox := models.EmailConfig{
+		Name:               req.Name,
+		IMAPHost:           req.IMAPHost,
+		IMAPPort:           req.IMAPPort,
+		IMAPUser:           req.IMAPUser,
+		IMAPPassword:       req.IMAPPassword,
+		IMAPFolder:         req.IMAPFolder,
+		IMAPAllowedSenders: req.IMAPAllowedSenders,
+		IMAPSubjectFilter:  req.IMAPSubjectFilter,
+		UseTLS:             req.UseTLS,
+		Active:             req.Active,
+		PollInterval:       req.PollInterval,
+		ProcessedFolder:    req.ProcessedFolder,
+		ErrorFolder:        req.ErrorFolder,
+		IgnoredFolder:      req.IgnoredFolder,
+	}
+	if err := h.DB.Create(&mailbox).Error; err != nil {
+		if respondSecretsUnavailable(w, err) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao criar caixa de e-mail", err), "Erro ao criar caixa de e-mail")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "CREATE", "email_config", strconv.Itoa(int(mailbox.ID)),
+		"Caixa de e-mail cadastrada: "+mailbox.Name, nil, mailboxAudit(mailbox))
+
+	mailbox.IMAPPassword = maskedPassword
+	RespondWithJSON(w, http.StatusCreated, mailbox)
+}
+
+// UpdateMailboxHandler altera uma caixa de e-mail; a verificação em andamento é
+// reiniciada com a nova configuração pelo consumidor
+func (h *Handler) UpdateMailboxHandler(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := h.findMailbox(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.EmailConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+	if msg := normalizeMailbox(&req); msg != "" {
+		RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if req.IMAPPassword == maskedPassword && !reuseStoredPassword(&req, *mailbox) {
+		RespondWithError(w, http.StatusBadRequest, "Informe a senha ao alterar o servidor ou o usuário da caixa")
+		return
+	}
+
+	old := mailboxAudit(*mailbox)
+	updates := map[string]interface{}{
+		"name":                 req.Name,
+		"imap_host":            req.IMAPHost,
+		"imap_port":            req.IMAPPort,
+		"imap_user":            req.IMAPUser,
+		"imap_password":        req.IMAPPassword,
+		"imap_folder":          req.IMAPFolder,
+		"imap_allowed_senders": req.IMAPAllowedSenders,
+		"imap_subject_filter":  req.IMAPSubjectFilter,
+		"use_tls":              req.UseTLS,
+		"active":               req.Active,
+		"poll_interval":        req.PollInterval,
+		"processed_folder":     req.ProcessedFolder,
+		"error_folder":         req.ErrorFolder,
+		"ignored_folder":       req.IgnoredFolder,
+	}
+	if err := h.DB.Model(mailbox).Updates(updates).Error; err != nil {
+		if respondSecretsUnavailable(w, err) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao atualizar caixa de e-mail", err), "Erro ao atualizar caixa de e-mail")
+		return
+	}
+	if err := h.DB.Preload("Status").First(mailbox, mailbox.ID).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar caixa de e-mail", err), "Erro ao atualizar caixa de e-mail")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "UPDATE", "email_config", strconv.Itoa(int(mailbox.ID)),
+		"Caixa de e-mail atualizada: "+mailbox.Name, old, mailboxAudit(*mailbox))
+
+	mailbox.IMAPPassword = maskedPassword
+	RespondWithJSON(w, http.StatusOK, mailbox)
+}
+
+// DeleteMailboxHandler remove uma caixa de e-mail e o seu status
+func (h *Handler) DeleteMailboxHandler(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := h.findMailbox(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.EmailMailboxStatus{}, "email_config_id = ?", mailbox.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(mailbox).Error
+	})
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao remover caixa de e-mail", err), "Erro ao remover caixa de e-mail")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "DELETE", "email_config", strconv.Itoa(int(mailbox.ID)),
+		"Caixa de e-mail removida: "+mailbox.Name, mailboxAudit(*mailbox), nil)
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Caixa de e-mail removida"})
+}
+
+// findMailbox carrega a caixa do ID no fim da URL, respondendo 400/404 quando não encontrada
+func (h *Handler) findMailbox(w http.ResponseWriter, r *http.Request) (*models.EmailConfig, bool) {
+	id, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return nil, false
+	}
+
+	var mailbox models.EmailConfig
+	if err := h.DB.Preload("Status").First(&mailbox, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RespondWithError(w, http.StatusNotFound, "Caixa de e-mail não encontrada")
+			return nil, false
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar caixa de e-mail", err), "Erro ao buscar caixa de e-mail")
+		return nil, false
+	}
+	return &mailbox, true
+}
+
+// normalizeMailbox aplica os padrões da caixa e devolve a mensagem de erro de validação
+func normalizeMailbox(m *models.EmailConfig) string {
+	m.Name = strings.TrimSpace(m.Name)
+	m.IMAPHost = strings.TrimSpace(m.IMAPHost)
+	m.IMAPUser = strings.TrimSpace(m.IMAPUser)
+	m.IMAPFolder = strings.TrimSpace(m.IMAPFolder)
+
+	if m.IMAPHost == "" {
+		return "Servidor IMAP é obrigatório"
+	}
+	if m.IMAPUser == "" {
+		return "Usuário IMAP é obrigatório"
+	}
+	if m.IMAPPort < 1 || m.IMAPPort > 65535 {
+		return "Porta IMAP inválida"
+	}
+	if m.PollInterval == 0 {
+		m.PollInterval = 5
+	}
+	if m.PollInterval < minPollInterval || m.PollInterval > maxPollInterval {
+		return "Intervalo de verificação deve ficar entre 1 e 1440 minutos"
+	}
+	if m.IMAPFolder == "" {
+		m.IMAPFolder = "INBOX"
+	}
+	if m.Name == "" {
+		m.Name = m.IMAPUser
+	}
+	if len(m.Name) > 100 {
+		return "Nome da caixa deve ter no máximo 100 caracteres"
+	}
+
+	// Pastas de destino depois da leitura; vazio mantém o e-mail onde está
+	for _, folder := range []*string{&m.ProcessedFolder, &m.ErrorFolder, &m.IgnoredFolder} {
+		*folder = strings.TrimSpace(*folder)
+		if len(*folder) > 255 {
+			return "Pasta de destino deve ter no máximo 255 caracteres"
+		}
+		if strings.EqualFold(*folder, m.IMAPFolder) {
+			return "Pasta de destino não pode ser a pasta verificada"
+		}
+	}
+	return ""
+}
+
+// reuseStoredPassword troca a senha mascarada da requisição pela gravada na
+// caixa, só quando servidor e usuário não mudaram: a senha de uma caixa nunca
+// é enviada a outro servidor ou usada com outro login
+func reuseStoredPassword(req *models.EmailConfig, stored models.EmailConfig) bool {
+	if !strings.EqualFold(req.IMAPHost, stored.IMAPHost) || req.IMAPUser != stored.IMAPUser {
+		return false
+	}
+	req.IMAPPassword = stored.IMAPPassword
+	return true
+}
+
+// respondSecretsUnavailable responde 503 quando a senha não pôde ser gravada por
+// falta de SECRETS_KEY (senhas não são guardadas em texto puro)
+func respondSecretsUnavailable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, secrets.ErrNoKey) {
+		return false
+	}
+	RespondWithError(w, http.StatusServiceUnavailable, "Configure SECRETS_KEY no servidor para salvar senhas de e-mail")
+	return true
+}
+
+// mailboxAudit resume a caixa para o log de auditoria (sem a senha)
+func mailboxAudit(m models.EmailConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"name":            m.Name,
+		"imap_host":       m.IMAPHost,
+		"imap_port":       m.IMAPPort,
+		"imap_user":       m.IMAPUser,
+		"imap_folder":     m.IMAPFolder,
+		"allowed_senders": m.IMAPAllowedSenders,
+		"subject_filter":  m.IMAPSubjectFilter,
+		"use_tls":         m.UseTLS,
+		"active":          m.Active,
+		"poll_interval":   m.PollInterval,
+		"processed":       m.ProcessedFolder,
+		"errors":          m.ErrorFolder,
+		"ignored":         m.IgnoredFolder,
+	}
+}
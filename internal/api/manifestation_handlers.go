@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ListNfeManifestationsHandler lista os envios de manifestação do destinatário da nota
+func (h *Handler) ListNfeManifestationsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+
+	list, err := h.NfeService.ListManifestations(parts[3])
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar manifestações", err), "Erro ao buscar manifestações")
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":        services.ManifestationEnabled(),
+		"manifestations": list,
+	})
+}
+
+// ManifestNfeHandler envia ciência, confirmação, desconhecimento ou operação não realizada
+func (h *Handler) ManifestNfeHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+	accessKey := parts[3]
+
+	var req models.ManifestNfeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	manifestation, err := h.NfeService.Manifest(r.Context(), accessKey, req.EventType, req.Justification, services.ManifestationSourceManual, &userID)
+	if err != nil {
+		if respondManifestationError(w, err, accessKey) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao enviar manifestação", err), "Erro ao enviar manifestação")
+		return
+	}
+
+	// Rejeição ou falha de comunicação com a SEFAZ: o registro volta com o motivo
+	status := http.StatusCreated
+	if manifestation.Status != services.ManifestationRegistered {
+		status = http.StatusBadGateway
+	}
+	RespondWithJSON(w, status, manifestation)
+}
+
+// respondManifestationError trata os erros de validação e a falta de certificado
+func respondManifestationError(w http.ResponseWriter, err error, accessKey string) bool {
+	if errors.Is(err, services.ErrManifestationUnknownNfe) {
+		HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
+		return true
+	}
+	if errors.Is(err, services.ErrManifestationUnavailable) {
+		RespondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return true
+	}
+	return respondNfeValidation(w, err, accessKey)
+}
+
+// ListDfeSummariesHandler lista os resumos de NF-e recebidos pela distribuição DF-e
+// (ex: ?pending=true para os que ainda aguardam ciência/XML completo)
+func (h *Handler) ListDfeSummariesHandler(w http.ResponseWriter, r *http.Request) {
+	params := ParsePaginationParams(r)
+	pending, _ := strconv.ParseBool(r.URL.Query().Get("pending"))
+
+	list, total, err := h.NfeService.ListDfeSummaries(r.URL.Query().Get("cnpj"), pending, params.Page, params.Limit)
+	if err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar resumos DF-e", err), "Erro ao buscar resumos DF-e")
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, NewPaginatedResponse(list, total, params))
+}
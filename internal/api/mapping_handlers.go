@@ -0,0 +1,264 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// nfeItemFromPath extrai chave e número do item de /api/nfes/{accessKey}/items/{itemNumber}/...
+func nfeItemFromPath(path string) (string, int, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 6 || parts[3] == "" {
+		return "", 0, false
+	}
+	itemNumber, err := strconv.Atoi(parts[5])
+	if err != nil || itemNumber <= 0 {
+		return "", 0, false
+	}
+	return parts[3], itemNumber, true
+}
+
+// GetNfeItemMappingsHandler lista os itens da nota com o produto interno associado ou sugestões
+func (h *Handler) GetNfeItemMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+	accessKey := parts[3]
+
+	mappings, err := h.NfeService.GetItemMappings(accessKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar mapeamento dos itens", err), "Erro ao buscar mapeamento dos itens")
+		return
+	}
+
+	unmapped := 0
+	for _, m := range mappings {
+		if m.ProductCode == nil {
+			unmapped++
+		}
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"access_key": accessKey,
+		"items":      mappings,
+		"unmapped":   unmapped,
+	})
+}
+
+// MapNfeItemHandler associa o código do fornecedor de um item a um produto existente
+func (h *Handler) MapNfeItemHandler(w http.ResponseWriter, r *http.Request) {
+	accessKey, itemNumber, ok := nfeItemFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso ou item inválido")
+		return
+	}
+
+	var req models.MapNfeItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ProductCode) == "" {
+		RespondWithError(w, http.StatusBadRequest, "Informe o código do produto (product_code)")
+		return
+	}
+	if req.ConversionFactor < 0 {
+		RespondWithError(w, http.StatusBadRequest, "Fator de conversão deve ser maior que zero")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	mapping, err := h.NfeService.MapItem(accessKey, itemNumber, strings.TrimSpace(req.ProductCode), req.ConversionFactor, &userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, NewAppError(http.StatusNotFound, "Nota, item ou produto não encontrado", err), "Erro ao mapear item")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao mapear item", err), "Erro ao mapear item")
+		return
+	}
+
+	LogAuditAction(h.DB, r, &userID, "CREATE", "supplier_product_mapping", strconv.Itoa(int(mapping.ID)),
+		"Código do fornecedor mapeado para produto interno", nil, mapping)
+
+	slog.Info("Item de NF-e mapeado",
+		"access_key", accessKey,
+		"supplier_cnpj", mapping.SupplierCNPJ,
+		"supplier_code", mapping.SupplierCode,
+		"product_code", mapping.ProductCode,
+	)
+	RespondWithJSON(w, http.StatusOK, mapping)
+}
+
+// CreateProductFromNfeItemHandler cadastra um novo produto a partir do item e já o mapeia
+func (h *Handler) CreateProductFromNfeItemHandler(w http.ResponseWriter, r *http.Request) {
+	accessKey, itemNumber, ok := nfeItemFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso ou item inválido")
+		return
+	}
+
+	var req models.Product
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	mapping, err := h.NfeService.CreateProductForItem(accessKey, itemNumber, req, &userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			HandleError(w, NewAppError(http.StatusNotFound, "Nota ou item não encontrado", err), "Erro ao criar produto")
+		case errors.Is(err, gorm.ErrInvalidData):
+			RespondWithError(w, http.StatusBadRequest, "Informe o código interno do novo produto (code)")
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			RespondWithError(w, http.StatusConflict, "Já existe um produto com este código")
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao criar produto", err), "Erro ao criar produto")
+		}
+		return
+	}
+
+	LogAuditAction(h.DB, r, &userID, "CREATE", "product", mapping.ProductCode,
+		"Produto criado a partir de item de NF-e", nil, mapping)
+
+	InvalidateCacheByTag(TagStock)
+	RespondWithJSON(w, http.StatusCreated, mapping)
+}
+
+// ListProductMappingsHandler lista os mapeamentos fornecedor → produto interno
+func (h *Handler) ListProductMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	params := ParsePaginationParams(r)
+	offset := (params.Page - 1) * params.Limit
+
+	db := h.DB.Model(&models.SupplierProductMapping{})
+	if cnpj := r.URL.Query().Get("supplier_cnpj"); cnpj != "" {
+		db = db.Where("supplier_cnpj = ?", cnpj)
+	}
+	if code := r.URL.Query().Get("product_code"); code != "" {
+		db = db.Where("product_code = ?", code)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar mapeamentos", err), "Erro ao buscar mapeamentos")
+		return
+	}
+
+	var mappings []models.SupplierProductMapping
+	if err := db.Preload("Product").Order("supplier_cnpj, supplier_code").Offset(offset).Limit(params.Limit).Find(&mappings).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar mapeamentos", err), "Erro ao buscar mapeamentos")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, NewPaginatedResponse(mappings, total, params))
+}
+
+// DeleteProductMappingHandler remove um mapeamento; a próxima nota do fornecedor volta a exigir associação
+func (h *Handler) DeleteProductMappingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	var mapping models.SupplierProductMapping
+	if err := h.DB.First(&mapping, id).Error; err != nil {
+		RespondWithError(w, http.StatusNotFound, "Mapeamento não encontrado")
+		return
+	}
+	if err := h.DB.Delete(&mapping).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao remover mapeamento", err), "Erro ao remover mapeamento")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "DELETE", "supplier_product_mapping", strconv.Itoa(id),
+		"Mapeamento de produto do fornecedor removido", mapping, nil)
+
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Mapeamento removido"})
+}
+
+// ListUnitConversionsHandler lista os fatores de conversão de unidade de compra
+func (h *Handler) ListUnitConversionsHandler(w http.ResponseWriter, r *http.Request) {
+	db := h.DB.Model(&models.UnitConversion{})
+	if code := r.URL.Query().Get("product_code"); code != "" {
+		db = db.Where("product_code = ?", code)
+	}
+	if cnpj := r.URL.Query().Get("supplier_cnpj"); cnpj != "" {
+		db = db.Where("supplier_cnpj = ?", cnpj)
+	}
+
+	var conversions []models.UnitConversion
+	if err := db.Order("product_code, supplier_cnpj, purchase_unit").Find(&conversions).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar conversões de unidade", err), "Erro ao buscar conversões de unidade")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, conversions)
+}
+
+// SaveUnitConversionHandler cria ou atualiza o fator de um produto para uma unidade de compra
+func (h *Handler) SaveUnitConversionHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.UnitConversion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+	req.ID = 0
+
+	conversion, err := services.SaveUnitConversion(h.DB, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidConversion):
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			HandleError(w, ErrProductNotFound, "Produto não encontrado")
+		default:
+			HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao salvar conversão de unidade", err), "Erro ao salvar conversão de unidade")
+		}
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "UPDATE", "unit_conversion", conversion.ProductCode,
+		"Fator de conversão de unidade salvo", nil, conversion)
+
+	RespondWithJSON(w, http.StatusOK, conversion)
+}
+
+// DeleteUnitConversionHandler remove um fator de conversão
+func (h *Handler) DeleteUnitConversionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "ID inválido")
+		return
+	}
+
+	var conversion models.UnitConversion
+	if err := h.DB.First(&conversion, id).Error; err != nil {
+		RespondWithError(w, http.StatusNotFound, "Conversão não encontrada")
+		return
+	}
+	if err := h.DB.Delete(&conversion).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao remover conversão de unidade", err), "Erro ao remover conversão de unidade")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	LogAuditAction(h.DB, r, &userID, "DELETE", "unit_conversion", strconv.Itoa(id),
+		"Fator de conversão de unidade removido", conversion, nil)
+
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Conversão removida"})
+}
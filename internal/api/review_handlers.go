@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/dfe"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// respondNfeValidation responde 422 com o código de rejeição quando err vem das regras
+// da NF-e, ou 409 quando a nota mudou de status durante a operação
+func respondNfeValidation(w http.ResponseWriter, err error, accessKey string) bool {
+	code := services.NfeErrorCode(err)
+	if code == "" {
+		return false
+	}
+	status := http.StatusUnprocessableEntity
+	if code == services.ErrNfeStatusConflict.Code {
+		status = http.StatusConflict
+	}
+	RespondWithJSON(w, status, map[string]interface{}{
+		"error":      err.Error(),
+		"code":       code,
+		"access_key": accessKey,
+	})
+	return true
+}
+
+// StartNfeReviewHandler coloca a nota em conferência (EM_CONFERENCIA)
+func (h *Handler) StartNfeReviewHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+	accessKey := parts[3]
+
+	userID, _ := GetUserID(r)
+	if err := h.NfeService.StartReview(accessKey, &userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
+			return
+		}
+		if respondNfeValidation(w, err, accessKey) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao iniciar conferência", err), "Erro ao iniciar conferência")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Conferência iniciada", "status": services.NfeStatusInReview})
+}
+
+// ReviewNfeItemHandler ajusta quantidade recebida, exclusão e motivo de divergência de uma linha
+func (h *Handler) ReviewNfeItemHandler(w http.ResponseWriter, r *http.Request) {
+	accessKey, itemNumber, ok := nfeItemFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso ou item inválido")
+		return
+	}
+
+	var req models.ReviewNfeItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	item, err := h.NfeService.ReviewItem(accessKey, itemNumber, req, &userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, NewAppError(http.StatusNotFound, "Nota ou item não encontrado", err), "Erro na conferência do item")
+			return
+		}
+		if respondNfeValidation(w, err, accessKey) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro na conferência do item", err), "Erro na conferência do item")
+		return
+	}
+
+	slog.Info("Item de NF-e conferido",
+		"access_key", accessKey,
+		"item", itemNumber,
+		"excluded", item.Excluded,
+		"user_id", userID,
+	)
+	RespondWithJSON(w, http.StatusOK, item)
+}
+
+// RejectNfeHandler recusa a nota inteira com justificativa
+func (h *Handler) RejectNfeHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso inválida")
+		return
+	}
+	accessKey := parts[3]
+
+	var req models.RejectNfeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	// Valida a manifestação antes de rejeitar, para não rejeitar sem conseguir enviá-la
+	if req.SendManifestation {
+		if err := services.CheckManifestation(dfe.EventNaoRealizada, req.Reason); err != nil && respondManifestationError(w, err, accessKey) {
+			return
+		}
+	}
+
+	userID, _ := GetUserID(r)
+	if err := h.NfeService.RejectNfe(accessKey, req.Reason, &userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, ErrNfeNotFound, "Nota fiscal não encontrada")
+			return
+		}
+		if respondNfeValidation(w, err, accessKey) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao rejeitar nota", err), "Erro ao rejeitar nota")
+		return
+	}
+
+	slog.Info("NF-e rejeitada", "access_key", accessKey, "user_id", userID)
+	response := map[string]interface{}{"message": "Nota fiscal rejeitada", "status": services.NfeStatusRejected}
+
+	// A rejeição já está gravada; falha na manifestação é informada para reenvio manual
+	if req.SendManifestation {
+		manifestation, err := h.NfeService.Manifest(r.Context(), accessKey, dfe.EventNaoRealizada, req.Reason, services.ManifestationSourceReject, &userID)
+		if err != nil {
+			slog.Warn("Operação não realizada não enviada", "access_key", accessKey, "error", err)
+			response["manifestation_error"] = err.Error()
+		} else {
+			response["manifestation"] = manifestation
+		}
+	}
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// ApplyNfeEventHandler aplica um evento pendente (cancelamento sem assinatura
+// validada) depois da conferência do administrador
+func (h *Handler) ApplyNfeEventHandler(w http.ResponseWriter, r *http.Request) {
+	accessKey, eventID, ok := nfeItemFromPath(r.URL.Path)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "Chave de acesso ou evento inválido")
+		return
+	}
+
+	var req models.ApplyNfeEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Corpo da requisição inválido")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	event, err := h.NfeService.ApplyEvent(accessKey, int32(eventID), req.Reason, &userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			HandleError(w, NewAppError(http.StatusNotFound, "Evento não encontrado", err), "Erro ao aplicar evento")
+			return
+		}
+		if respondNfeValidation(w, err, accessKey) {
+			return
+		}
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao aplicar evento", err), "Erro ao aplicar evento")
+		return
+	}
+
+	slog.Info("Evento de NF-e aplicado manualmente",
+		"access_key", accessKey,
+		"event_id", event.ID,
+		"event_type", event.EventType,
+		"user_id", userID,
+	)
+	RespondWithJSON(w, http.StatusOK, event)
+}
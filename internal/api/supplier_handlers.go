@@ -0,0 +1,25 @@
+package api
+
+import (
+	"estoque/internal/models"
+	"net/http"
+)
+
+// ListSuppliersHandler lista os fornecedores cadastrados (inclusive os criados a partir das NF-es)
+func (h *Handler) ListSuppliersHandler(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Order("name ASC")
+	if search := r.URL.Query().Get("search"); search != "" {
+		query = query.Where("name LIKE ? OR trade_name LIKE ? OR cnpj LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	if r.URL.Query().Get("include_inactive") != "true" {
+		query = query.Where("active = ?", true)
+	}
+
+	var suppliers []models.Supplier
+	if err := query.Find(&suppliers).Error; err != nil {
+		HandleError(w, NewAppError(http.StatusInternalServerError, "Erro ao buscar fornecedores", err), "Erro ao buscar fornecedores")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, suppliers)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"estoque/internal/events"
+	"estoque/internal/services"
+	"estoque/internal/services/worker_pools"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+const (
+	maxBatchUploadSize = 200 << 20 // Corpo inteiro da requisição (vários XMLs/ZIPs)
+	batchUploadTimeout = 10 * time.Minute
+
+	// Intervalo mínimo entre eventos SSE de progresso de um lote
+	batchProgressInterval = time.Second
+)
+
+// BatchDocumentResult é a linha do relatório de um documento do lote
+type BatchDocumentResult struct {
+	File      string `json:"file"`
+	Status    string `json:"status"` // REGISTRADO, DUPLICADO, SUSPEITO, INVALIDO ou ERRO
+	Document  string `json:"document,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	EventType string `json:"event_type,omitempty"`
+	Items     int    `json:"items,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// BatchUploadResponse resume o lote e traz o resultado de cada documento
+type BatchUploadResponse struct {
+	BatchID string                `json:"batch_id"`
+	Total   int                   `json:"total"`
+	Summary map[string]int        `json:"summary"`
+	Results []BatchDocumentResult `json:"results"`
+}
+
+// BatchUploadHandler recebe vários XMLs e/ou ZIPs (campos "files" ou "file"),
+// inclusive ZIPs com pastas e ZIPs aninhados, e registra cada documento pelo
+// worker pool. O andamento é publicado via SSE (NFE_BATCH_PROGRESS/NFE_BATCH_DONE)
+// e a resposta traz o relatório por documento.
+func (h *Handler) BatchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Lotes grandes levam mais que o ReadTimeout padrão do servidor para chegar
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(batchUploadTimeout))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			HandleError(w, NewAppError(http.StatusRequestEntityTooLarge, "Lote muito grande. Tamanho máximo: 200MB", err), "Erro ao processar upload")
+			return
+		}
+		HandleError(w, NewAppError(http.StatusBadRequest, "Erro ao processar formulário", err), "Erro ao processar upload")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := append(r.MultipartForm.File["files"], r.MultipartForm.File["file"]...)
+	if len(headers) == 0 {
+		RespondWithError(w, http.StatusBadRequest, "Nenhum arquivo enviado (campo 'files' obrigatório)")
+		return
+	}
+
+	// Extrair os XMLs de todos os arquivos enviados. Os limites valem para o envio
+	// inteiro; o arquivo que os estoura entra no relatório como inválido
+	var docs []services.NfeDocument
+	batch := &services.NfeBatch{}
+	for _, fh := range headers {
+		data, err := readUploadedFile(fh)
+		if err != nil {
+			docs = append(docs, services.NfeDocument{Name: fh.Filename, Err: err})
+			continue
+		}
+		docs = append(docs, batch.Extract(fh.Filename, data)...)
+	}
+
+	user, _ := GetUserFromContext(r, h.DB)
+	var userID *int32
+	userEmail := "system"
+	if user != nil {
+		userID = &user.ID
+		userEmail = user.Email
+	}
+
+	response := BatchUploadResponse{
+		BatchID: newBatchID(),
+		Total:   len(docs),
+		Summary: map[string]int{
+			worker_pools.OutcomeRegistered: 0,
+			worker_pools.OutcomeDuplicate:  0,
+			worker_pools.OutcomeSuspicious: 0,
+			worker_pools.OutcomeInvalid:    0,
+			worker_pools.OutcomeError:      0,
+		},
+		Results: make([]BatchDocumentResult, len(docs)),
+	}
+
+	// Documentos ilegíveis entram direto no relatório; os demais vão para o pool
+	var jobs []worker_pools.NFeJob
+	var jobDocs []int
+	for i, doc := range docs {
+		if doc.Err != nil {
+			response.Results[i] = BatchDocumentResult{File: doc.Name, Status: worker_pools.OutcomeInvalid, Reason: doc.Err.Error()}
+			response.Summary[worker_pools.OutcomeInvalid]++
+			continue
+		}
+		jobs = append(jobs, worker_pools.NFeJob{XMLData: doc.Data, UserID: userID, UserEmail: userEmail})
+		jobDocs = append(jobDocs, i)
+	}
+
+	slog.Info("Lote de NF-e recebido",
+		"batch_id", response.BatchID,
+		"files", len(headers),
+		"documents", len(docs),
+		"user_email", userEmail,
+	)
+
+	progress := events.BatchProgress{BatchID: response.BatchID, Total: len(docs), Processed: len(docs) - len(jobs)}
+	countProgress(&progress, response.Summary)
+	events.NotifyBatchProgress(progress)
+	lastNotify := time.Now()
+
+	h.NFeWorkerPool.SubmitBatch(r.Context(), jobs, func(index int, result worker_pools.NFeResult) {
+		docIndex := jobDocs[index]
+		item := BatchDocumentResult{
+			File:      docs[docIndex].Name,
+			Status:    result.Outcome(),
+			Document:  result.Document,
+			AccessKey: result.AccessKey,
+			EventType: result.EventType,
+			Items:     result.Items,
+			Code:      result.ErrorCode,
+		}
+		if result.Error != nil {
+			item.Reason = result.Error.Error()
+		}
+		if item.Status == worker_pools.OutcomeDuplicate {
+			item.Reason = "Documento já registrado com o mesmo conteúdo"
+		}
+		response.Results[docIndex] = item
+		response.Summary[item.Status]++
+
+		progress.Processed++
+		countProgress(&progress, response.Summary)
+		if time.Since(lastNotify) >= batchProgressInterval {
+			events.NotifyBatchProgress(progress)
+			lastNotify = time.Now()
+		}
+	})
+
+	progress.Done = true
+	events.NotifyBatchProgress(progress)
+
+	if response.Summary[worker_pools.OutcomeRegistered] > 0 {
+		InvalidateCacheByTags(TagDashboard, TagStock)
+	}
+
+	slog.Info("Lote de NF-e concluído",
+		"batch_id", response.BatchID,
+		"registered", response.Summary[worker_pools.OutcomeRegistered],
+		"duplicates", response.Summary[worker_pools.OutcomeDuplicate],
+		"suspicious", response.Summary[worker_pools.OutcomeSuspicious],
+		"invalid", response.Summary[worker_pools.OutcomeInvalid],
+		"errors", response.Summary[worker_pools.OutcomeError],
+	)
+
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// readUploadedFile lê um arquivo do formulário (o tamanho total já é limitado pelo MaxBytesReader)
+func readUploadedFile(fh *multipart.FileHeader) ([]byte, error) {
+	if fh.Size == 0 {
+		return nil, errors.New("arquivo vazio")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func countProgress(progress *events.BatchProgress, summary map[string]int) {
+	progress.Registered = summary[worker_pools.OutcomeRegistered]
+	progress.Duplicates = summary[worker_pools.OutcomeDuplicate]
+	progress.Suspicious = summary[worker_pools.OutcomeSuspicious]
+	progress.Invalid = summary[worker_pools.OutcomeInvalid]
+	progress.Errors = summary[worker_pools.OutcomeError]
+}
+
+// newBatchID gera um identificador curto para correlacionar o lote com os eventos SSE
+func newBatchID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000")
+	}
+	return hex.EncodeToString(b)
+}
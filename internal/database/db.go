@@ -41,6 +41,7 @@ func InitDB(dsn string) (*gorm.DB, error) {
 
 	if runMigrations || env != "production" {
 		slog.Info("Running database migrations and seeds...")
+		removeDuplicateNfeItems(db)
 		// AutoMigrate irá criar as tabelas baseadas nas structs se elas não existirem
 		err = db.AutoMigrate(
 			&models.Category{},
@@ -50,8 +51,22 @@ func InitDB(dsn string) (*gorm.DB, error) {
 			&models.User{},
 			&models.Movement{},
 			&models.ProcessedNFe{},
+			&models.NFeItem{},
+			&models.NFeEvent{},
+			&models.NFeConflict{},
+			&models.WatchedFile{},
+			&models.DfeSummary{},
+			&models.DfeDistributionState{},
+			&models.DfeFailedDocument{},
+			&models.NFeManifestation{},
+			&models.DigitalCertificate{},
+			&models.EmailMailboxStatus{},
+			&models.EmailIngestion{},
+			&models.SupplierProductMapping{},
+			&models.UnitConversion{},
 			&models.AuditLog{},
 			&models.EmailConfig{},
+			&models.NfeConfig{},
 		)
 		if err != nil {
 			slog.Error("Failed to auto-migrate database", "error", err)
@@ -114,6 +129,24 @@ func stringPtr(s string) *string {
 	return &s
 }
 
+// removeDuplicateNfeItems apaga as linhas repetidas de nfe_items (mesma nota e
+// número de item) gravadas por preenchimentos concorrentes, mantendo a mais
+// antiga, para que o índice único idx_nfe_items_key_item possa ser criado
+func removeDuplicateNfeItems(db *gorm.DB) {
+	if !db.Migrator().HasTable(&models.NFeItem{}) {
+		return
+	}
+	result := db.Exec(`
+		DELETE i FROM nfe_items i
+		JOIN nfe_items d ON d.access_key = i.access_key AND d.item_number = i.item_number AND d.id < i.id
+	`)
+	if result.Error != nil {
+		slog.Warn("Failed to remove duplicate NF-e items", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		slog.Info("Duplicate NF-e items removed", "count", result.RowsAffected)
+	}
+}
+
 // createIndexes cria índices para melhorar performance das queries
 // MySQL 5.6 não suporta "IF NOT EXISTS", então verificamos se o índice existe antes de criar
 func createIndexes(db *gorm.DB) {
@@ -131,6 +164,8 @@ func createIndexes(db *gorm.DB) {
 		{"idx_products_active", "products", "active", false},
 		{"idx_products_name", "products", "name", false},
 		{"idx_products_active_name", "products", "active, name", false},
+		{"idx_nfe_items_code", "nfe_items", "code", false},
+		{"idx_processed_nfes_processed_at", "processed_nfes", "processed_at", false},
 	}
 
 	for _, idx := range indexes {
@@ -165,11 +200,17 @@ func createIndexes(db *gorm.DB) {
 	slog.Info("Database indexes created successfully")
 }
 
-func GetMovementsReportData(db *gorm.DB, startDate, endDate time.Time) (models.FullReportResponse, error) {
+// GetMovementsReportData monta o relatório de movimentações do período.
+// supplierID vazio considera todos os fornecedores.
+func GetMovementsReportData(db *gorm.DB, startDate, endDate time.Time, supplierID string) (models.FullReportResponse, error) {
 	var report models.FullReportResponse
 
 	// 1. Fetch Detailed Movements (for the list)
-	if err := db.Where("movements.created_at BETWEEN ? AND ?", startDate, endDate).
+	detailed := db.Where("movements.created_at BETWEEN ? AND ?", startDate, endDate)
+	if supplierID != "" {
+		detailed = detailed.Where("movements.product_code IN (SELECT code FROM products WHERE supplier_id = ?)", supplierID)
+	}
+	if err := detailed.
 		Preload("Product").
 		Preload("User").
 		Order("movements.created_at ASC").
@@ -190,7 +231,8 @@ func GetMovementsReportData(db *gorm.DB, startDate, endDate time.Time) (models.F
 		FROM movements m
 		JOIN products p ON m.product_code = p.code
 		WHERE m.created_at BETWEEN ? AND ?
-	`, startDate, endDate).Scan(&report.Summary).Error
+		  AND (? = '' OR p.supplier_id = ?)
+	`, startDate, endDate, supplierID, supplierID).Scan(&report.Summary).Error
 	if err != nil {
 		return report, err
 	}
@@ -218,9 +260,10 @@ func GetMovementsReportData(db *gorm.DB, startDate, endDate time.Time) (models.F
 		FROM movements m
 		JOIN products p ON m.product_code = p.code
 		WHERE m.created_at BETWEEN ? AND ?
+		  AND (? = '' OR p.supplier_id = ?)
 		GROUP BY DATE(m.created_at)
 		ORDER BY date ASC
-	`, startDate, endDate).Scan(&rows).Error
+	`, startDate, endDate, supplierID, supplierID).Scan(&rows).Error
 	if err != nil {
 		return report, err
 	}
@@ -238,3 +281,36 @@ func GetMovementsReportData(db *gorm.DB, startDate, endDate time.Time) (models.F
 
 	return report, nil
 }
+
+// GetNfeItemsReportData agrega os itens das NF-es de entrada efetivadas no período,
+// por fornecedor e código de produto do fornecedor (códigos iguais de fornecedores
+// diferentes são produtos diferentes). Notas pendentes, rejeitadas e canceladas
+// e as saídas emitidas por nós ficam de fora.
+func GetNfeItemsReportData(db *gorm.DB, startDate, endDate time.Time, supplierID string) ([]models.NfeItemsReportRow, error) {
+	rows := make([]models.NfeItemsReportRow, 0)
+	err := db.Raw(`
+		SELECT 
+			COALESCE(n.supplier_cnpj, '') as supplier_cnpj,
+			COALESCE(MAX(n.supplier_name), '') as supplier_name,
+			i.code,
+			MAX(i.name) as name,
+			COALESCE(MAX(i.ncm), '') as ncm,
+			COALESCE(SUM(i.quantity), 0) as quantity,
+			COALESCE(SUM(i.total_price), 0) as total_value,
+			COALESCE(SUM(i.icms_value), 0) as icms_value,
+			COALESCE(SUM(i.icms_st_value), 0) as icms_st_value,
+			COALESCE(SUM(i.ipi_value), 0) as ipi_value,
+			COALESCE(SUM(i.pis_value), 0) as pis_value,
+			COALESCE(SUM(i.cofins_value), 0) as cofins_value,
+			COUNT(DISTINCT i.access_key) as notes
+		FROM nfe_items i
+		JOIN processed_nfes n ON n.access_key = i.access_key
+		WHERE n.processed_at BETWEEN ? AND ?
+		  AND n.direction = 'ENTRADA'
+		  AND n.status IN ('PROCESSADA', 'PARCIAL')
+		  AND (? = '' OR n.supplier_id = ?)
+		GROUP BY n.supplier_cnpj, i.code
+		ORDER BY total_value DESC
+	`, startDate, endDate, supplierID, supplierID).Scan(&rows).Error
+	return rows, err
+}
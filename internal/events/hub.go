@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 )
 
 // NotificationEvent representa um evento de notificação para o frontend
@@ -94,3 +95,56 @@ func NotifyNewNFe(number, supplier string) {
 		"supplier": supplier,
 	})
 }
+
+// NotifyNfeConflict avisa que um XML divergente de uma nota já registrada foi retido para análise
+func NotifyNfeConflict(accessKey string, conflictID int32) {
+	msg := fmt.Sprintf("Documento suspeito: XML diferente recebido para a chave %s já registrada. Verifique antes de aceitar.", accessKey)
+	GetHub().Notify("NFE_CONFLICT", msg, map[string]interface{}{
+		"access_key":  accessKey,
+		"conflict_id": conflictID,
+	})
+}
+
+// BatchProgress resume o andamento de um lote de upload de NF-es
+type BatchProgress struct {
+	BatchID    string `json:"batch_id"`
+	Total      int    `json:"total"`
+	Processed  int    `json:"processed"`
+	Registered int    `json:"registered"`
+	Duplicates int    `json:"duplicates"`
+	Suspicious int    `json:"suspicious"` // Mesma chave com XML diferente, retidos para análise
+	Invalid    int    `json:"invalid"`
+	Errors     int    `json:"errors"`
+	Done       bool   `json:"done"`
+}
+
+// NotifyBatchProgress dispara o progresso de um lote (NFE_BATCH_PROGRESS) ou sua conclusão (NFE_BATCH_DONE)
+func NotifyBatchProgress(progress BatchProgress) {
+	eventType := "NFE_BATCH_PROGRESS"
+	msg := fmt.Sprintf("Processando lote de NF-e: %d de %d documentos.", progress.Processed, progress.Total)
+	if progress.Done {
+		eventType = "NFE_BATCH_DONE"
+		msg = fmt.Sprintf("Lote de NF-e concluído: %d registrados, %d duplicados, %d suspeitos, %d inválidos, %d com erro.",
+			progress.Registered, progress.Duplicates, progress.Suspicious, progress.Invalid, progress.Errors)
+	}
+	GetHub().Notify(eventType, msg, progress)
+}
+
+// NotifyCertificateExpiry avisa que o certificado digital ativo vence em breve (CERTIFICATE_EXPIRING)
+// ou já venceu (CERTIFICATE_EXPIRED)
+func NotifyCertificateExpiry(subject, cnpj string, notAfter time.Time, daysLeft int) {
+	eventType := "CERTIFICATE_EXPIRING"
+	msg := fmt.Sprintf("O certificado digital %s vence em %d dia(s), em %s. Envie o novo certificado para não interromper as integrações com a SEFAZ.",
+		subject, daysLeft, notAfter.Format("02/01/2006"))
+	if daysLeft < 0 {
+		eventType = "CERTIFICATE_EXPIRED"
+		msg = fmt.Sprintf("O certificado digital %s venceu em %s. As integrações com a SEFAZ estão paradas até o envio de um novo certificado.",
+			subject, notAfter.Format("02/01/2006"))
+	}
+	GetHub().Notify(eventType, msg, map[string]interface{}{
+		"subject":   subject,
+		"cnpj":      cnpj,
+		"not_after": notAfter,
+		"days_left": daysLeft,
+	})
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/xml"
+	"estoque/internal/secrets"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,39 +13,278 @@ import (
 type NfeProc struct {
 	XMLName xml.Name `xml:"nfeProc"`
 	NFe     NFe      `xml:"NFe"`
+	ProtNFe ProtNFe  `xml:"protNFe"`
+}
+
+// ProtNFe é o protocolo de autorização devolvido pela SEFAZ
+type ProtNFe struct {
+	InfProt InfProt `xml:"infProt"`
+}
+
+type InfProt struct {
+	TpAmb    string `xml:"tpAmb"`
+	VerAplic string `xml:"verAplic"`
+	ChNFe    string `xml:"chNFe"`
+	DhRecbto string `xml:"dhRecbto"`
+	NProt    string `xml:"nProt"`
+	DigVal   string `xml:"digVal"`
+	CStat    int    `xml:"cStat"`
+	XMotivo  string `xml:"xMotivo"`
+}
+
+// ProcEventoNFe é o evento vinculado a uma NF-e (cancelamento, carta de correção...)
+// com o retorno de registro da SEFAZ
+type ProcEventoNFe struct {
+	XMLName   xml.Name  `xml:"procEventoNFe"`
+	Evento    Evento    `xml:"evento"`
+	RetEvento RetEvento `xml:"retEvento"`
+}
+
+type Evento struct {
+	InfEvento InfEvento `xml:"infEvento"`
+}
+
+type InfEvento struct {
+	ID         string    `xml:"Id,attr"`
+	COrgao     string    `xml:"cOrgao"`
+	TpAmb      string    `xml:"tpAmb"`
+	CNPJ       string    `xml:"CNPJ"`
+	CPF        string    `xml:"CPF"`
+	ChNFe      string    `xml:"chNFe"`
+	DhEvento   string    `xml:"dhEvento"`
+	TpEvento   string    `xml:"tpEvento"`
+	NSeqEvento int       `xml:"nSeqEvento"`
+	VerEvento  string    `xml:"verEvento"`
+	DetEvento  DetEvento `xml:"detEvento"`
+}
+
+type DetEvento struct {
+	DescEvento string `xml:"descEvento"`
+	NProt      string `xml:"nProt"`     // Protocolo da NF-e cancelada
+	XJust      string `xml:"xJust"`     // Justificativa do cancelamento
+	XCorrecao  string `xml:"xCorrecao"` // Texto da carta de correção
+}
+
+type RetEvento struct {
+	InfEvento struct {
+		TpAmb       string `xml:"tpAmb"`
+		CStat       int    `xml:"cStat"`
+		XMotivo     string `xml:"xMotivo"`
+		ChNFe       string `xml:"chNFe"`
+		TpEvento    string `xml:"tpEvento"`
+		NSeqEvento  int    `xml:"nSeqEvento"`
+		DhRegEvento string `xml:"dhRegEvento"`
+		NProt       string `xml:"nProt"`
+	} `xml:"infEvento"`
 }
 
 type NFe struct {
-	InfNFe InfNFe `xml:"infNFe"`
+	InfNFe    InfNFe       `xml:"infNFe"`
+	Signature NFeSignature `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+}
+
+// NFeSignature traz da assinatura apenas o digest de infNFe, que o protocolo
+// de autorização repete em digVal
+type NFeSignature struct {
+	DigestValue string `xml:"SignedInfo>Reference>DigestValue"`
 }
 
 type InfNFe struct {
-	ID    string `xml:"Id,attr"`
-	Ide   Ide    `xml:"ide"`
-	Emit  Emit   `xml:"emit"`
-	Det   []Det  `xml:"det"`
-	Total Total  `xml:"total"`
+	ID      string  `xml:"Id,attr"`
+	Ide     Ide     `xml:"ide"`
+	Emit    Emit    `xml:"emit"`
+	Dest    Dest    `xml:"dest"`
+	Det     []Det   `xml:"det"`
+	Total   Total   `xml:"total"`
+	Transp  Transp  `xml:"transp"`
+	InfAdic InfAdic `xml:"infAdic"`
 }
 
 type Ide struct {
-	NNF string `xml:"nNF"`
+	CUF      string `xml:"cUF"`
+	CNF      string `xml:"cNF"`
+	NatOp    string `xml:"natOp"`
+	Mod      string `xml:"mod"`
+	Serie    string `xml:"serie"`
+	NNF      string `xml:"nNF"`
+	DhEmi    string `xml:"dhEmi"`
+	DEmi     string `xml:"dEmi"` // Layouts anteriores à versão 3.10
+	DhSaiEnt string `xml:"dhSaiEnt"`
+	TpNF     string `xml:"tpNF"`
+	TpEmis   string `xml:"tpEmis"`
+	TpAmb    string `xml:"tpAmb"` // 1 produção, 2 homologação
+	CDV      string `xml:"cDV"`
 }
 
 type Emit struct {
-	CNPJ  string `xml:"CNPJ"`
-	XNome string `xml:"xNome"`
+	CNPJ      string   `xml:"CNPJ"`
+	CPF       string   `xml:"CPF"`
+	XNome     string   `xml:"xNome"`
+	XFant     string   `xml:"xFant"`
+	EnderEmit Endereco `xml:"enderEmit"`
+	IE        string   `xml:"IE"`
+	IEST      string   `xml:"IEST"`
+	IM        string   `xml:"IM"`
+	CNAE      string   `xml:"CNAE"`
+	CRT       string   `xml:"CRT"` // Código de regime tributário
+}
+
+type Dest struct {
+	CNPJ      string   `xml:"CNPJ"`
+	CPF       string   `xml:"CPF"`
+	IDEstrang string   `xml:"idEstrangeiro"`
+	XNome     string   `xml:"xNome"`
+	EnderDest Endereco `xml:"enderDest"`
+	IE        string   `xml:"IE"`
+	Email     string   `xml:"email"`
+}
+
+// Endereco mapeia enderEmit/enderDest
+type Endereco struct {
+	XLgr    string `xml:"xLgr"`
+	Nro     string `xml:"nro"`
+	XCpl    string `xml:"xCpl"`
+	XBairro string `xml:"xBairro"`
+	CMun    string `xml:"cMun"`
+	XMun    string `xml:"xMun"`
+	UF      string `xml:"UF"`
+	CEP     string `xml:"CEP"`
+	CPais   string `xml:"cPais"`
+	XPais   string `xml:"xPais"`
+	Fone    string `xml:"fone"`
 }
 
 type Det struct {
-	Prod Prod `xml:"prod"`
+	NItem     int     `xml:"nItem,attr"`
+	Prod      Prod    `xml:"prod"`
+	Imposto   Imposto `xml:"imposto"`
+	InfAdProd string  `xml:"infAdProd"`
 }
 
 type Prod struct {
-	CProd  string  `xml:"cProd" json:"code"`
-	XProd  string  `xml:"xProd" json:"name"`
-	QCom   float64 `xml:"qCom" json:"quantity"`
-	VUnCom float64 `xml:"vUnCom" json:"unit_price"`
-	VProd  float64 `xml:"vProd" json:"total_price"`
+	CProd    string   `xml:"cProd" json:"code"`
+	CEAN     string   `xml:"cEAN" json:"ean,omitempty"`
+	XProd    string   `xml:"xProd" json:"name"`
+	NCM      string   `xml:"NCM" json:"ncm,omitempty"`
+	CEST     string   `xml:"CEST" json:"cest,omitempty"`
+	CFOP     string   `xml:"CFOP" json:"cfop,omitempty"`
+	UCom     string   `xml:"uCom" json:"unit,omitempty"`
+	QCom     float64  `xml:"qCom" json:"quantity"`
+	VUnCom   float64  `xml:"vUnCom" json:"unit_price"`
+	VProd    float64  `xml:"vProd" json:"total_price"`
+	CEANTrib string   `xml:"cEANTrib" json:"ean_trib,omitempty"`
+	UTrib    string   `xml:"uTrib" json:"tax_unit,omitempty"`
+	QTrib    float64  `xml:"qTrib" json:"tax_quantity,omitempty"`
+	VUnTrib  float64  `xml:"vUnTrib" json:"tax_unit_price,omitempty"`
+	VFrete   float64  `xml:"vFrete" json:"freight,omitempty"`
+	VSeg     float64  `xml:"vSeg" json:"insurance,omitempty"`
+	VDesc    float64  `xml:"vDesc" json:"discount,omitempty"`
+	VOutro   float64  `xml:"vOutro" json:"other_charges,omitempty"`
+	IndTot   string   `xml:"indTot" json:"-"`
+	Rastro   []Rastro `xml:"rastro" json:"lots,omitempty"`
+}
+
+// Rastro identifica um lote do item (det/prod/rastro), usado em medicamentos e alimentos
+type Rastro struct {
+	NLote  string  `xml:"nLote" json:"batch_number"`
+	QLote  float64 `xml:"qLote" json:"quantity"`
+	DFab   string  `xml:"dFab" json:"manufacturing_date"`
+	DVal   string  `xml:"dVal" json:"expiration_date"`
+	CAgreg string  `xml:"cAgreg" json:"aggregation_code,omitempty"`
+}
+
+// Imposto agrupa os tributos do item (det/imposto)
+type Imposto struct {
+	VTotTrib float64 `xml:"vTotTrib"`
+	ICMS     ICMS    `xml:"ICMS"`
+	IPI      IPI     `xml:"IPI"`
+	PIS      PIS     `xml:"PIS"`
+	COFINS   COFINS  `xml:"COFINS"`
+}
+
+// ICMS contém exatamente um dos grupos ICMS00, ICMS10, ..., ICMSSN101, ICMSSN900
+type ICMS struct {
+	Grupo ICMSGrupo `xml:",any"`
+}
+
+// ICMSGrupo une os campos de todos os grupos de ICMS; XMLName indica qual grupo veio no XML
+type ICMSGrupo struct {
+	XMLName    xml.Name
+	Orig       string  `xml:"orig"`
+	CST        string  `xml:"CST"`
+	CSOSN      string  `xml:"CSOSN"`
+	ModBC      string  `xml:"modBC"`
+	PRedBC     float64 `xml:"pRedBC"`
+	VBC        float64 `xml:"vBC"`
+	PICMS      float64 `xml:"pICMS"`
+	VICMS      float64 `xml:"vICMS"`
+	ModBCST    string  `xml:"modBCST"`
+	PMVAST     float64 `xml:"pMVAST"`
+	VBCST      float64 `xml:"vBCST"`
+	PICMSST    float64 `xml:"pICMSST"`
+	VICMSST    float64 `xml:"vICMSST"`
+	VICMSDeson float64 `xml:"vICMSDeson"`
+	PCredSN    float64 `xml:"pCredSN"`
+	VCredICMS  float64 `xml:"vCredICMSSN"`
+}
+
+// Situacao retorna o CST ou, para o Simples Nacional, o CSOSN
+func (g ICMSGrupo) Situacao() string {
+	if g.CSOSN != "" {
+		return g.CSOSN
+	}
+	return g.CST
+}
+
+type IPI struct {
+	CEnq    string  `xml:"cEnq"`
+	IPITrib IPITrib `xml:"IPITrib"`
+	IPINT   IPINT   `xml:"IPINT"`
+}
+
+type IPITrib struct {
+	CST  string  `xml:"CST"`
+	VBC  float64 `xml:"vBC"`
+	PIPI float64 `xml:"pIPI"`
+	VIPI float64 `xml:"vIPI"`
+}
+
+type IPINT struct {
+	CST string `xml:"CST"`
+}
+
+// CST retorna a situação tributária do IPI, seja tributado ou não tributado
+func (i IPI) CST() string {
+	if i.IPITrib.CST != "" {
+		return i.IPITrib.CST
+	}
+	return i.IPINT.CST
+}
+
+// PIS contém um dos grupos PISAliq, PISQtde, PISNT ou PISOutr
+type PIS struct {
+	Grupo PISGrupo `xml:",any"`
+}
+
+type PISGrupo struct {
+	XMLName xml.Name
+	CST     string  `xml:"CST"`
+	VBC     float64 `xml:"vBC"`
+	PPIS    float64 `xml:"pPIS"`
+	VPIS    float64 `xml:"vPIS"`
+}
+
+// COFINS contém um dos grupos COFINSAliq, COFINSQtde, COFINSNT ou COFINSOutr
+type COFINS struct {
+	Grupo COFINSGrupo `xml:",any"`
+}
+
+type COFINSGrupo struct {
+	XMLName xml.Name
+	CST     string  `xml:"CST"`
+	VBC     float64 `xml:"vBC"`
+	PCOFINS float64 `xml:"pCOFINS"`
+	VCOFINS float64 `xml:"vCOFINS"`
 }
 
 type Total struct {
@@ -52,7 +292,48 @@ type Total struct {
 }
 
 type ICMSTot struct {
-	VNF float64 `xml:"vNF"`
+	VBC        float64 `xml:"vBC"`
+	VICMS      float64 `xml:"vICMS"`
+	VICMSDeson float64 `xml:"vICMSDeson"`
+	VBCST      float64 `xml:"vBCST"`
+	VST        float64 `xml:"vST"`
+	VProd      float64 `xml:"vProd"`
+	VFrete     float64 `xml:"vFrete"`
+	VSeg       float64 `xml:"vSeg"`
+	VDesc      float64 `xml:"vDesc"`
+	VII        float64 `xml:"vII"`
+	VIPI       float64 `xml:"vIPI"`
+	VPIS       float64 `xml:"vPIS"`
+	VCOFINS    float64 `xml:"vCOFINS"`
+	VOutro     float64 `xml:"vOutro"`
+	VNF        float64 `xml:"vNF"`
+}
+
+// Transp mapeia o grupo de transporte (transp)
+type Transp struct {
+	ModFrete   string `xml:"modFrete"`
+	Transporta struct {
+		CNPJ   string `xml:"CNPJ"`
+		CPF    string `xml:"CPF"`
+		XNome  string `xml:"xNome"`
+		IE     string `xml:"IE"`
+		XEnder string `xml:"xEnder"`
+		XMun   string `xml:"xMun"`
+		UF     string `xml:"UF"`
+	} `xml:"transporta"`
+	Vol []struct {
+		QVol  float64 `xml:"qVol"`
+		Esp   string  `xml:"esp"`
+		Marca string  `xml:"marca"`
+		PesoL float64 `xml:"pesoL"`
+		PesoB float64 `xml:"pesoB"`
+	} `xml:"vol"`
+}
+
+// InfAdic traz as informações adicionais da nota
+type InfAdic struct {
+	InfAdFisco string `xml:"infAdFisco"`
+	InfCpl     string `xml:"infCpl"`
 }
 
 // ===== GORM Models =====
@@ -70,15 +351,20 @@ func (Category) TableName() string {
 }
 
 type Supplier struct {
-	ID        int32     `gorm:"primaryKey;type:int" json:"id"`
-	Name      string    `gorm:"size:191;not null" json:"name"`
-	CNPJ      *string   `gorm:"size:20;unique" json:"cnpj,omitempty"`
-	Email     *string   `gorm:"size:191" json:"email,omitempty"`
-	Phone     *string   `gorm:"size:20" json:"phone,omitempty"`
-	Address   *string   `gorm:"type:text" json:"address,omitempty"`
-	Active    bool      `gorm:"default:true" json:"active"`
-	CreatedAt time.Time `json:"created_at"`
-	Products  []Product `json:"-"`
+	ID                int32     `gorm:"primaryKey;type:int" json:"id"`
+	Name              string    `gorm:"size:191;not null" json:"name"`
+	TradeName         *string   `gorm:"size:191" json:"trade_name,omitempty"` // xFant
+	CNPJ              *string   `gorm:"size:20;unique" json:"cnpj,omitempty"`
+	StateRegistration *string   `gorm:"size:20" json:"state_registration,omitempty"` // IE
+	Email             *string   `gorm:"size:191" json:"email,omitempty"`
+	Phone             *string   `gorm:"size:20" json:"phone,omitempty"`
+	Address           *string   `gorm:"type:text" json:"address,omitempty"`
+	City              *string   `gorm:"size:100" json:"city,omitempty"`
+	State             *string   `gorm:"size:2" json:"state,omitempty"`
+	Active            bool      `gorm:"default:true" json:"active"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	Products          []Product `json:"-"`
 }
 
 func (Supplier) TableName() string {
@@ -135,20 +421,42 @@ func (User) TableName() string {
 }
 
 type Movement struct {
-	ID             int32      `gorm:"primaryKey;type:int" json:"id"`
-	ProductCode    string     `gorm:"size:191;not null;type:varchar(191)" json:"product_code"`
-	Product        *Product   `gorm:"foreignKey:ProductCode;references:Code" json:"product,omitempty"`
-	Type           string     `gorm:"size:20;not null" json:"type"` // ENTRADA ou SAIDA
-	Quantity       float64    `gorm:"type:decimal(19,4);not null" json:"quantity"`
-	UnitCost       float64    `gorm:"type:decimal(19,4)" json:"unit_cost,omitempty"` // Custo unitário no momento da entrada
-	BatchNumber    *string    `gorm:"size:100" json:"batch_number,omitempty"`        // Número do Lote
-	ExpirationDate *time.Time `gorm:"type:date" json:"expiration_date,omitempty"`    // Data de Validade
-	Origin         *string    `gorm:"size:191" json:"origin,omitempty"`
-	Reference      *string    `gorm:"size:191" json:"reference,omitempty"`
-	UserID         *int32     `gorm:"type:int" json:"user_id,omitempty"`
-	User           *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Notes          *string    `gorm:"type:text" json:"notes,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
+	ID                 int32         `gorm:"primaryKey;type:int" json:"id"`
+	ProductCode        string        `gorm:"size:191;not null;type:varchar(191)" json:"product_code"`
+	Product            *Product      `gorm:"foreignKey:ProductCode;references:Code" json:"product,omitempty"`
+	Type               string        `gorm:"size:20;not null" json:"type"` // ENTRADA ou SAIDA
+	Quantity           float64       `gorm:"type:decimal(19,4);not null" json:"quantity"`
+	UnitCost           float64       `gorm:"type:decimal(19,4)" json:"unit_cost,omitempty"`           // Custo unitário no momento da entrada
+	CommercialQuantity *float64      `gorm:"type:decimal(19,4)" json:"commercial_quantity,omitempty"` // Quantidade na unidade da NF-e (qCom)
+	CommercialUnit     *string       `gorm:"size:20" json:"commercial_unit,omitempty"`                // Unidade comercial da NF-e (uCom)
+	BatchNumber        *string       `gorm:"size:100" json:"batch_number,omitempty"`                  // Número do Lote
+	ManufacturingDate  *time.Time    `gorm:"type:date" json:"manufacturing_date,omitempty"`           // Data de Fabricação
+	ExpirationDate     *time.Time    `gorm:"type:date" json:"expiration_date,omitempty"`              // Data de Validade
+	Origin             *string       `gorm:"size:191" json:"origin,omitempty"`
+	Reference          *string       `gorm:"size:191" json:"reference,omitempty"`
+	UserID             *int32        `gorm:"type:int" json:"user_id,omitempty"`
+	User               *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Notes              *string       `gorm:"type:text" json:"notes,omitempty"`
+	CostBreakdown      CostBreakdown `gorm:"embedded;embeddedPrefix:cost_" json:"cost_breakdown"` // Composição do UnitCost (entradas por NF-e)
+	CreatedAt          time.Time     `json:"created_at"`
+}
+
+// CostBreakdown decompõe o custo unitário de entrada, por unidade de estoque.
+// Desconto e crédito de ICMS ficam positivos e são abatidos no total.
+type CostBreakdown struct {
+	Product      float64 `gorm:"type:decimal(19,4);default:0" json:"product"` // vUnCom convertido
+	Freight      float64 `gorm:"type:decimal(19,4);default:0" json:"freight"`
+	Insurance    float64 `gorm:"type:decimal(19,4);default:0" json:"insurance"`
+	Discount     float64 `gorm:"type:decimal(19,4);default:0" json:"discount"`
+	OtherCharges float64 `gorm:"type:decimal(19,4);default:0" json:"other_charges"`
+	IPI          float64 `gorm:"type:decimal(19,4);default:0" json:"ipi"`
+	ICMSST       float64 `gorm:"type:decimal(19,4);default:0" json:"icms_st"`
+	ICMSCredit   float64 `gorm:"type:decimal(19,4);default:0" json:"icms_credit"`
+}
+
+// Total soma os componentes no custo unitário final
+func (c CostBreakdown) Total() float64 {
+	return c.Product + c.Freight + c.Insurance - c.Discount + c.OtherCharges + c.IPI + c.ICMSST - c.ICMSCredit
 }
 
 func (Movement) TableName() string {
@@ -156,26 +464,403 @@ func (Movement) TableName() string {
 }
 
 type ProcessedNFe struct {
-	AccessKey    string    `gorm:"primaryKey;size:191;type:varchar(191)" json:"access_key"`
-	Number       *string   `gorm:"size:50" json:"number,omitempty"`
-	SupplierName *string   `gorm:"size:191" json:"supplier_name,omitempty"`
-	TotalItems   int32     `gorm:"type:int" json:"total_items"`
-	TotalValue   float64   `gorm:"type:decimal(10,2)" json:"total_value"`
-	Status       string    `gorm:"size:20;default:'PENDENTE'" json:"status"` // PENDENTE, PROCESSADA
-	XMLData      []byte    `gorm:"type:longblob" json:"-"`                   // Armazena o XML original
-	ProcessedAt  time.Time `json:"processed_at"`
+	AccessKey    string     `gorm:"primaryKey;size:191;type:varchar(191)" json:"access_key"`
+	Number       *string    `gorm:"size:50" json:"number,omitempty"`
+	SupplierName *string    `gorm:"size:191" json:"supplier_name,omitempty"`
+	SupplierCNPJ *string    `gorm:"size:20;index" json:"supplier_cnpj,omitempty"` // CNPJ (ou CPF) do emitente
+	SupplierID   *int32     `gorm:"type:int;index" json:"supplier_id,omitempty"`
+	TotalItems   int32      `gorm:"type:int" json:"total_items"`
+	TotalValue   float64    `gorm:"type:decimal(10,2)" json:"total_value"`
+	Status       string     `gorm:"size:20;default:'PENDENTE'" json:"status"`    // PENDENTE, EM_CONFERENCIA, PROCESSADA, PARCIAL, REJEITADA, CANCELADA
+	XMLData      []byte     `gorm:"type:longblob" json:"-"`                      // Armazena o XML original
+	ContentHash  *string    `gorm:"size:64;index" json:"content_hash,omitempty"` // SHA-256 (hex) do XML recebido
+	IssuedAt     *time.Time `gorm:"index" json:"issued_at,omitempty"`            // Data de emissão (dhEmi)
+	ProcessedAt  time.Time  `json:"processed_at"`
+
+	// DigestValue de infNFe conferido na verificação da assinatura: identifica o
+	// mesmo documento recebido com bytes diferentes (outro canal, outra formatação)
+	DocumentDigest *string `gorm:"size:64" json:"document_digest,omitempty"`
+
+	// Sentido da operação: notas emitidas por um dos nossos CNPJs podem ser saídas
+	IssuedByUs        bool    `gorm:"default:false" json:"issued_by_us"`
+	Direction         string  `gorm:"size:10;default:'ENTRADA';index" json:"direction"` // ENTRADA ou SAIDA
+	Operation         *string `gorm:"size:20" json:"operation,omitempty"`               // VENDA, TRANSFERENCIA, DEVOLUCAO, REMESSA...
+	RecipientName     *string `gorm:"size:191" json:"recipient_name,omitempty"`
+	RecipientDocument *string `gorm:"size:20" json:"recipient_document,omitempty"`
+
+	// Conferência
+	RejectionReason *string    `gorm:"type:text" json:"rejection_reason,omitempty"`
+	ReviewedBy      *int32     `gorm:"type:int" json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+
+	// Assinatura digital (XMLDSig) verificada no recebimento
+	SignatureStatus  string     `gorm:"size:20;default:'NAO_VERIFICADA'" json:"signature_status"` // VALIDA, INVALIDA, AUSENTE, NAO_VERIFICADA
+	SignatureError   *string    `gorm:"size:255" json:"signature_error,omitempty"`
+	SignerSubject    *string    `gorm:"size:255" json:"signer_subject,omitempty"`
+	SignerIssuer     *string    `gorm:"size:255" json:"signer_issuer,omitempty"`
+	SignerSerial     *string    `gorm:"size:100" json:"signer_serial,omitempty"`
+	SignerCNPJ       *string    `gorm:"size:20" json:"signer_cnpj,omitempty"`
+	SignerValidUntil *time.Time `json:"signer_valid_until,omitempty"`
+
+	// Protocolo de autorização da SEFAZ (protNFe)
+	AuthorizationState string     `gorm:"size:20;default:'SEM_PROTOCOLO';index" json:"authorization_state"` // AUTORIZADA, DENEGADA, NAO_AUTORIZADA, SEM_PROTOCOLO
+	ProtocolNumber     *string    `gorm:"size:20" json:"protocol_number,omitempty"`
+	ProtocolStatus     *int32     `gorm:"type:int" json:"protocol_status,omitempty"`  // cStat
+	ProtocolMessage    *string    `gorm:"size:255" json:"protocol_message,omitempty"` // xMotivo
+	AuthorizedAt       *time.Time `json:"authorized_at,omitempty"`
+
+	// Último evento de manifestação do destinatário registrado na SEFAZ (tpEvento)
+	Manifestation *string `gorm:"size:6" json:"manifestation,omitempty"`
 }
 
 func (ProcessedNFe) TableName() string {
 	return "processed_nfes"
 }
 
+// NFeEvent registra um evento da NF-e (procEventoNFe) recebido por upload ou e-mail
+type NFeEvent struct {
+	ID            int32      `gorm:"primaryKey;type:int" json:"id"`
+	AccessKey     string     `gorm:"size:191;not null;type:varchar(191);uniqueIndex:idx_nfe_events_key_type_seq" json:"access_key"`
+	EventType     string     `gorm:"size:6;not null;uniqueIndex:idx_nfe_events_key_type_seq" json:"event_type"` // tpEvento (110111 = cancelamento)
+	Sequence      int        `gorm:"type:int;not null;uniqueIndex:idx_nfe_events_key_type_seq" json:"sequence"`
+	Description   string     `gorm:"size:100" json:"description"`
+	Justification *string    `gorm:"type:text" json:"justification,omitempty"`
+	Protocol      *string    `gorm:"size:20" json:"protocol,omitempty"` // nProt do registro do evento
+	StatusCode    int32      `gorm:"type:int" json:"status_code"`       // cStat do retEvento
+	EventAt       *time.Time `json:"event_at,omitempty"`
+	RegisteredAt  *time.Time `json:"registered_at,omitempty"`
+	Applied       bool       `gorm:"default:false" json:"applied"` // Efeito já aplicado na nota (ex: estorno)
+	// Assinatura do autor sobre infEvento; cancelamentos sem assinatura VALIDA
+	// (cadeia ICP-Brasil verificada) só são aplicados manualmente
+	SignatureStatus string     `gorm:"size:20;default:'NAO_VERIFICADA'" json:"signature_status"`
+	SignatureError  *string    `gorm:"size:255" json:"signature_error,omitempty"`
+	AppliedBy       *int32     `gorm:"type:int" json:"applied_by,omitempty"` // Administrador que aplicou o evento manualmente
+	AppliedAt       *time.Time `json:"applied_at,omitempty"`
+	XMLData         []byte     `gorm:"type:longblob" json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func (NFeEvent) TableName() string {
+	return "nfe_events"
+}
+
+// NFeConflict retém para análise manual um XML recebido com a chave de acesso de
+// uma nota já registrada, mas com conteúdo diferente do original
+type NFeConflict struct {
+	ID           int32      `gorm:"primaryKey;type:int" json:"id"`
+	AccessKey    string     `gorm:"size:191;not null;type:varchar(191);uniqueIndex:idx_nfe_conflicts_key_hash" json:"access_key"`
+	ContentHash  string     `gorm:"size:64;not null;uniqueIndex:idx_nfe_conflicts_key_hash" json:"content_hash"`
+	ExistingHash string     `gorm:"size:64" json:"existing_hash"`                   // Hash da nota registrada no momento do conflito
+	Source       string     `gorm:"size:191" json:"source"`                         // Usuário ou canal que enviou o documento
+	Attempts     int32      `gorm:"type:int;default:1" json:"attempts"`             // Reenvios do mesmo conteúdo divergente
+	Status       string     `gorm:"size:20;default:'PENDENTE';index" json:"status"` // PENDENTE, ANALISADO
+	Resolution   *string    `gorm:"type:text" json:"resolution,omitempty"`
+	ReviewedBy   *int32     `gorm:"type:int" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	XMLData      []byte     `gorm:"type:longblob" json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (NFeConflict) TableName() string {
+	return "nfe_conflicts"
+}
+
+// WatchedFile registra cada arquivo consumido da pasta monitorada pelo hash do
+// conteúdo, para que uma reinicialização não importe o mesmo arquivo de novo
+type WatchedFile struct {
+	ID          int32     `gorm:"primaryKey;type:int" json:"id"`
+	ContentHash string    `gorm:"size:64;not null;uniqueIndex" json:"content_hash"`
+	FileName    string    `gorm:"size:255" json:"file_name"`
+	Folder      string    `gorm:"size:20" json:"folder"`             // Subpasta de destino: processed, duplicate ou failed
+	Detail      *string   `gorm:"type:text" json:"detail,omitempty"` // Resultado de cada documento do arquivo
+	Moved       bool      `gorm:"default:false" json:"moved"`        // Arquivo já movido para a subpasta
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (WatchedFile) TableName() string {
+	return "watched_files"
+}
+
+// DfeSummary é o resumo (resNFe) de uma nota emitida contra um dos nossos CNPJs,
+// recebido pela distribuição DF-e da SEFAZ antes do XML completo
+type DfeSummary struct {
+	AccessKey      string     `gorm:"primaryKey;size:44;type:varchar(44)" json:"access_key"`
+	RecipientCNPJ  string     `gorm:"size:14;index" json:"recipient_cnpj"` // Nosso CNPJ consultado
+	NSU            string     `gorm:"size:15" json:"nsu"`
+	IssuerDocument string     `gorm:"size:14" json:"issuer_document"`
+	IssuerName     string     `gorm:"size:191" json:"issuer_name"`
+	IssuedAt       *time.Time `json:"issued_at,omitempty"`
+	TotalValue     float64    `gorm:"type:decimal(15,2)" json:"total_value"`
+	OperationType  string     `gorm:"size:1" json:"operation_type"` // tpNF: 0 entrada, 1 saída
+	Situation      string     `gorm:"size:1" json:"situation"`      // cSitNFe: 1 autorizada, 2 denegada, 3 cancelada
+	ProtocolNumber string     `gorm:"size:20" json:"protocol_number"`
+	HasFullXML     bool       `gorm:"default:false;index" json:"has_full_xml"` // procNFe já recebido e registrado
+	Manifestation  *string    `gorm:"size:6" json:"manifestation,omitempty"`   // Último evento de manifestação registrado
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (DfeSummary) TableName() string {
+	return "dfe_summaries"
+}
+
+// NFeManifestation registra cada envio de manifestação do destinatário (ciência,
+// confirmação, desconhecimento ou operação não realizada) e o retorno da SEFAZ
+type NFeManifestation struct {
+	ID             int32      `gorm:"primaryKey;type:int" json:"id"`
+	AccessKey      string     `gorm:"size:44;not null;index" json:"access_key"`
+	RecipientCNPJ  string     `gorm:"size:14" json:"recipient_cnpj"`
+	EventType      string     `gorm:"size:6;not null" json:"event_type"` // 210200, 210210, 210220 ou 210240
+	Sequence       int        `gorm:"type:int;default:1" json:"sequence"`
+	Justification  *string    `gorm:"type:text" json:"justification,omitempty"`
+	Status         string     `gorm:"size:20;default:'PENDENTE';index" json:"status"` // PENDENTE, REGISTRADA, REJEITADA, ERRO
+	StatusCode     int32      `gorm:"type:int" json:"status_code"`                    // cStat do retEvento
+	StatusMessage  *string    `gorm:"size:255" json:"status_message,omitempty"`
+	ProtocolNumber *string    `gorm:"size:20" json:"protocol_number,omitempty"`
+	RegisteredAt   *time.Time `json:"registered_at,omitempty"`
+	Source         string     `gorm:"size:20" json:"source"` // MANUAL, REJEICAO, EFETIVACAO, DFE
+	UserID         *int32     `gorm:"type:int" json:"user_id,omitempty"`
+	XMLData        []byte     `gorm:"type:longblob" json:"-"` // Evento assinado enviado
+	ResponseXML    []byte     `gorm:"type:longblob" json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (NFeManifestation) TableName() string {
+	return "nfe_manifestations"
+}
+
+// DfeDistributionState guarda o último NSU consultado na distribuição DF-e de cada CNPJ
+type DfeDistributionState struct {
+	CNPJ        string     `gorm:"primaryKey;size:14;type:varchar(14)" json:"cnpj"`
+	LastNSU     string     `gorm:"size:15;not null" json:"last_nsu"`
+	MaxNSU      string     `gorm:"size:15" json:"max_nsu"`
+	LastStatus  int32      `gorm:"type:int" json:"last_status"` // cStat da última consulta
+	LastMessage string     `gorm:"size:255" json:"last_message"`
+	LastQueryAt *time.Time `json:"last_query_at,omitempty"`
+	NextQueryAt *time.Time `json:"next_query_at,omitempty"` // A SEFAZ exige 1 hora de espera quando não há documentos novos
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Documento que falhou no processamento e segura o NSU; depois de algumas
+	// tentativas ele é guardado em dfe_failed_documents e o NSU avança
+	FailedNSU      string `gorm:"size:15" json:"failed_nsu,omitempty"`
+	FailedAttempts int    `gorm:"type:int;default:0" json:"failed_attempts"`
+}
+
+func (DfeDistributionState) TableName() string {
+	return "dfe_distribution_states"
+}
+
+// DfeFailedDocument guarda o documento da distribuição DF-e que falhou em todas
+// as tentativas, com o conteúdo original para análise e reprocessamento
+type DfeFailedDocument struct {
+	ID        int32     `gorm:"primaryKey;type:int" json:"id"`
+	CNPJ      string    `gorm:"size:14;not null;uniqueIndex:idx_dfe_failed_cnpj_nsu" json:"cnpj"`
+	NSU       string    `gorm:"size:15;not null;uniqueIndex:idx_dfe_failed_cnpj_nsu" json:"nsu"`
+	Schema    string    `gorm:"size:50" json:"schema"`
+	Attempts  int       `gorm:"type:int" json:"attempts"`
+	Error     string    `gorm:"type:text" json:"error"`
+	Content   []byte    `gorm:"type:longblob" json:"-"` // Documento descompactado
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (DfeFailedDocument) TableName() string {
+	return "dfe_failed_documents"
+}
+
+// DigitalCertificate é o certificado A1 da empresa usado nas integrações com a
+// SEFAZ; cadeia e chave privada ficam cifradas (AES-GCM) em EncryptedData
+type DigitalCertificate struct {
+	ID               int32      `gorm:"primaryKey;type:int" json:"id"`
+	Subject          string     `gorm:"size:255" json:"subject"`
+	Issuer           string     `gorm:"size:255" json:"issuer"`
+	SerialNumber     string     `gorm:"size:100" json:"serial_number"`
+	CNPJ             string     `gorm:"size:14;index" json:"cnpj"`
+	Fingerprint      string     `gorm:"size:64;not null;uniqueIndex" json:"fingerprint"` // SHA-256 (hex) do certificado
+	NotBefore        time.Time  `json:"not_before"`
+	NotAfter         time.Time  `gorm:"index" json:"not_after"`
+	Active           bool       `gorm:"default:false;index" json:"active"` // Só um certificado ativo por vez
+	EncryptedData    []byte     `gorm:"type:longblob" json:"-"`
+	UploadedBy       *int32     `gorm:"type:int" json:"uploaded_by,omitempty"`
+	ExpiryNotifiedAt *time.Time `json:"expiry_notified_at,omitempty"` // Último aviso de vencimento enviado
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (DigitalCertificate) TableName() string {
+	return "digital_certificates"
+}
+
+// SupplierProductMapping associa o código do produto no fornecedor (cProd) ao nosso código interno
+type SupplierProductMapping struct {
+	ID           int32     `gorm:"primaryKey;type:int" json:"id"`
+	SupplierCNPJ string    `gorm:"size:20;not null;uniqueIndex:idx_supplier_product_mapping" json:"supplier_cnpj"`
+	SupplierCode string    `gorm:"size:191;not null;type:varchar(191);uniqueIndex:idx_supplier_product_mapping" json:"supplier_code"`
+	SupplierName *string   `gorm:"size:191" json:"supplier_name,omitempty"` // xProd no momento do mapeamento
+	ProductCode  string    `gorm:"size:191;not null;type:varchar(191);index" json:"product_code"`
+	Product      *Product  `gorm:"foreignKey:ProductCode;references:Code" json:"product,omitempty"`
+	CreatedBy    *int32    `gorm:"type:int" json:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (SupplierProductMapping) TableName() string {
+	return "supplier_product_mappings"
+}
+
+// UnitConversion define quantas unidades de estoque equivalem a uma unidade de
+// compra (uCom). Sem CNPJ, o fator vale para qualquer fornecedor do produto.
+type UnitConversion struct {
+	ID           int32     `gorm:"primaryKey;type:int" json:"id"`
+	ProductCode  string    `gorm:"size:191;not null;type:varchar(191);uniqueIndex:idx_unit_conversion" json:"product_code"`
+	SupplierCNPJ string    `gorm:"size:20;not null;default:'';uniqueIndex:idx_unit_conversion" json:"supplier_cnpj"`
+	PurchaseUnit string    `gorm:"size:20;not null;uniqueIndex:idx_unit_conversion" json:"purchase_unit"`
+	Factor       float64   `gorm:"type:decimal(19,6);not null" json:"factor"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (UnitConversion) TableName() string {
+	return "unit_conversions"
+}
+
+// NFeItem armazena cada item (det) de uma NF-e de forma normalizada
+type NFeItem struct {
+	ID                  int32    `gorm:"primaryKey;type:int" json:"id"`
+	AccessKey           string   `gorm:"size:191;not null;type:varchar(191);uniqueIndex:idx_nfe_items_key_item" json:"access_key"`
+	ItemNumber          int      `gorm:"type:int;not null;uniqueIndex:idx_nfe_items_key_item" json:"item_number"`
+	Code                string   `gorm:"size:191;not null" json:"code"`
+	EAN                 *string  `gorm:"size:20" json:"ean,omitempty"`
+	Name                string   `gorm:"size:191;not null" json:"name"`
+	NCM                 *string  `gorm:"size:10;index" json:"ncm,omitempty"`
+	CEST                *string  `gorm:"size:10" json:"cest,omitempty"`
+	CFOP                string   `gorm:"size:4" json:"cfop"`
+	Unit                string   `gorm:"size:20" json:"unit"`
+	Quantity            float64  `gorm:"type:decimal(19,4)" json:"quantity"`
+	UnitPrice           float64  `gorm:"type:decimal(19,10)" json:"unit_price"`
+	TotalPrice          float64  `gorm:"type:decimal(19,4)" json:"total_price"`
+	TaxEAN              *string  `gorm:"size:20" json:"tax_ean,omitempty"`
+	TaxUnit             string   `gorm:"size:20" json:"tax_unit"`
+	TaxQuantity         float64  `gorm:"type:decimal(19,4)" json:"tax_quantity"`
+	TaxUnitPrice        float64  `gorm:"type:decimal(19,10)" json:"tax_unit_price"`
+	Freight             float64  `gorm:"type:decimal(19,4);default:0" json:"freight"`
+	Insurance           float64  `gorm:"type:decimal(19,4);default:0" json:"insurance"`
+	Discount            float64  `gorm:"type:decimal(19,4);default:0" json:"discount"`
+	OtherCharges        float64  `gorm:"type:decimal(19,4);default:0" json:"other_charges"`
+	ICMSGroup           string   `gorm:"size:20" json:"icms_group"`
+	ICMSOrigin          string   `gorm:"size:1" json:"icms_origin"`
+	ICMSCST             string   `gorm:"size:3" json:"icms_cst"`
+	ICMSBase            float64  `gorm:"type:decimal(19,4);default:0" json:"icms_base"`
+	ICMSRate            float64  `gorm:"type:decimal(7,4);default:0" json:"icms_rate"`
+	ICMSValue           float64  `gorm:"type:decimal(19,4);default:0" json:"icms_value"`
+	ICMSSTBase          float64  `gorm:"type:decimal(19,4);default:0" json:"icms_st_base"`
+	ICMSSTValue         float64  `gorm:"type:decimal(19,4);default:0" json:"icms_st_value"`
+	IPICST              string   `gorm:"size:2" json:"ipi_cst"`
+	IPIBase             float64  `gorm:"type:decimal(19,4);default:0" json:"ipi_base"`
+	IPIRate             float64  `gorm:"type:decimal(7,4);default:0" json:"ipi_rate"`
+	IPIValue            float64  `gorm:"type:decimal(19,4);default:0" json:"ipi_value"`
+	PISCST              string   `gorm:"size:2" json:"pis_cst"`
+	PISBase             float64  `gorm:"type:decimal(19,4);default:0" json:"pis_base"`
+	PISRate             float64  `gorm:"type:decimal(7,4);default:0" json:"pis_rate"`
+	PISValue            float64  `gorm:"type:decimal(19,4);default:0" json:"pis_value"`
+	COFINSCST           string   `gorm:"size:2" json:"cofins_cst"`
+	COFINSBase          float64  `gorm:"type:decimal(19,4);default:0" json:"cofins_base"`
+	COFINSRate          float64  `gorm:"type:decimal(7,4);default:0" json:"cofins_rate"`
+	COFINSValue         float64  `gorm:"type:decimal(19,4);default:0" json:"cofins_value"`
+	ApproximateTaxTotal float64  `gorm:"type:decimal(19,4);default:0" json:"approximate_tax_total"`
+	AdditionalInfo      *string  `gorm:"type:text" json:"additional_info,omitempty"`
+	ProductCode         *string  `gorm:"size:191" json:"product_code,omitempty"`                // Produto interno movimentado na efetivação
+	ConversionFactor    *float64 `gorm:"type:decimal(19,6)" json:"conversion_factor,omitempty"` // Unidades de estoque por unidade comercial
+
+	// Conferência linha a linha (quantidades na unidade comercial)
+	ReceivedQuantity *float64   `gorm:"type:decimal(19,4)" json:"received_quantity,omitempty"` // nil = recebido conforme faturado
+	Excluded         bool       `gorm:"default:false" json:"excluded"`
+	DivergenceReason *string    `gorm:"type:text" json:"divergence_reason,omitempty"`
+	ReviewedBy       *int32     `gorm:"type:int" json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+}
+
+func (NFeItem) TableName() string {
+	return "nfe_items"
+}
+
 type NfeDetailResponse struct {
-	AccessKey    string  `json:"access_key"`
-	Number       string  `json:"number"`
+	AccessKey    string     `json:"access_key"`
+	Number       string     `json:"number"`
+	SupplierName string     `json:"supplier_name"`
+	TotalValue   float64    `json:"total_value"`
+	Status       string     `json:"status"`
+	Items        []NFeItem  `json:"items"`
+	Events       []NFeEvent `json:"events"`
+}
+
+// ProductSuggestion é um produto do catálogo candidato a receber um item de NF-e sem mapeamento
+type ProductSuggestion struct {
+	ProductCode string  `json:"product_code"`
+	Name        string  `json:"name"`
+	Barcode     *string `json:"barcode,omitempty"`
+	MatchedBy   string  `json:"matched_by"` // EAN ou NOME
+	Score       float64 `json:"score"`
+}
+
+// NfeItemMapping descreve a situação de mapeamento de um item da nota
+type NfeItemMapping struct {
+	Item             NFeItem             `json:"item"`
+	ProductCode      *string             `json:"product_code"` // nil quando o item ainda não foi mapeado
+	StockUnit        *string             `json:"stock_unit,omitempty"`
+	ConversionFactor *float64            `json:"conversion_factor"` // nil quando falta fator entre uCom e a unidade de estoque
+	Suggestions      []ProductSuggestion `json:"suggestions,omitempty"`
+}
+
+// MapNfeItemRequest associa um item da nota a um produto existente. Um fator
+// de conversão opcional é gravado para a unidade comercial do item e o fornecedor.
+type MapNfeItemRequest struct {
+	ProductCode      string  `json:"product_code"`
+	ConversionFactor float64 `json:"conversion_factor,omitempty"`
+}
+
+// ReviewNfeItemRequest ajusta a conferência de uma linha da nota
+type ReviewNfeItemRequest struct {
+	ReceivedQuantity *float64 `json:"received_quantity"`
+	Excluded         bool     `json:"excluded"`
+	DivergenceReason string   `json:"divergence_reason"`
+}
+
+// RejectNfeRequest rejeita a nota inteira
+type RejectNfeRequest struct {
+	Reason string `json:"reason"`
+	// Envia "operação não realizada" à SEFAZ com a mesma justificativa
+	SendManifestation bool `json:"send_manifestation"`
+}
+
+// ApplyNfeEventRequest aplica manualmente um evento que ficou pendente
+type ApplyNfeEventRequest struct {
+	Reason string `json:"reason"` // Como o cancelamento foi confirmado (ex: consulta na SEFAZ)
+}
+
+// ManifestNfeRequest envia uma manifestação do destinatário
+type ManifestNfeRequest struct {
+	EventType     string `json:"event_type"`
+	Justification string `json:"justification"`
+}
+
+// NfeItemsReportRow agrega os itens recebidos via NF-e por produto do fornecedor
+type NfeItemsReportRow struct {
+	SupplierCNPJ string  `json:"supplier_cnpj"`
 	SupplierName string  `json:"supplier_name"`
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	NCM          string  `json:"ncm"`
+	Quantity     float64 `json:"quantity"`
 	TotalValue   float64 `json:"total_value"`
-	Items        []Prod  `json:"items"`
+	ICMSValue    float64 `json:"icms_value"`
+	ICMSSTValue  float64 `json:"icms_st_value"`
+	IPIValue     float64 `json:"ipi_value"`
+	PISValue     float64 `json:"pis_value"`
+	COFINSValue  float64 `json:"cofins_value"`
+	Notes        int64   `json:"notes"`
 }
 
 // ===== Auxiliar Types (Request/Response) =====
@@ -271,15 +956,101 @@ type ReportTimelineItem struct {
 
 type EmailConfig struct {
 	gorm.Model
-	IMAPHost           string `json:"imap_host"`
-	IMAPPort           int    `json:"imap_port"`
-	IMAPUser           string `json:"imap_user"`
-	IMAPPassword       string `json:"imap_password"` // Nota: Em produção, usar criptografia
-	IMAPFolder         string `json:"imap_folder"`
-	IMAPAllowedSenders string `json:"imap_allowed_senders"` // Lista separada por vírgula
-	IMAPSubjectFilter  string `json:"imap_subject_filter"`  // Termo contido no assunto
-	UseTLS             bool   `json:"use_tls"`
-	Active             bool   `json:"active"`
+	Name               string         `gorm:"size:100" json:"name"` // Identificação da caixa (ex: Compras Filial SP)
+	IMAPHost           string         `json:"imap_host"`
+	IMAPPort           int            `json:"imap_port"`
+	IMAPUser           string         `json:"imap_user"`
+	IMAPPassword       secrets.String `json:"imap_password"` // Cifrada no banco com SECRETS_KEY
+	IMAPFolder         string         `json:"imap_folder"`
+	IMAPAllowedSenders string         `json:"imap_allowed_senders"` // Lista separada por vírgula
+	IMAPSubjectFilter  string         `json:"imap_subject_filter"`  // Termo contido no assunto
+	UseTLS             bool           `json:"use_tls"`
+	Active             bool           `json:"active"`
+	PollInterval       int            `gorm:"default:5" json:"poll_interval"` // Minutos entre as verificações
+
+	// Pastas para onde o e-mail é movido depois de lido, conforme o resultado dos
+	// anexos; vazio mantém o e-mail na pasta verificada, marcado como lido
+	ProcessedFolder string `gorm:"size:255" json:"processed_folder"` // Anexos importados (ex: Processadas)
+	ErrorFolder     string `gorm:"size:255" json:"error_folder"`     // Algum anexo com erro ou rejeitado (ex: Erros)
+	IgnoredFolder   string `gorm:"size:255" json:"ignored_folder"`   // Sem anexo de NF-e (ex: Ignoradas)
+
+	Status *EmailMailboxStatus `gorm:"foreignKey:EmailConfigID" json:"status,omitempty"`
+}
+
+// EncryptedColumns lista as colunas gravadas com secrets.String, recifradas na
+// troca da chave; novos campos de credencial devem ser incluídos aqui
+var EncryptedColumns = []secrets.Column{
+	{Table: "email_configs", Column: "imap_password"},
+}
+
+// EmailMailboxStatus acompanha a última verificação de cada caixa de e-mail
+type EmailMailboxStatus struct {
+	EmailConfigID     uint       `gorm:"primaryKey;autoIncrement:false" json:"email_config_id"`
+	LastRunAt         *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt     *time.Time `json:"last_success_at,omitempty"`
+	LastError         *string    `gorm:"type:text" json:"last_error,omitempty"`
+	LastErrorAt       *time.Time `json:"last_error_at,omitempty"`
+	LastRunMessages   int        `gorm:"type:int" json:"last_run_messages"` // E-mails lidos na última verificação
+	Mode              string     `gorm:"size:10" json:"mode"`               // IDLE ou POLLING; vazio quando a conexão falhou
+	MessagesImported  int64      `json:"messages_imported"`                 // E-mails lidos desde o cadastro
+	DocumentsImported int64      `json:"documents_imported"`                // NF-es e eventos registrados a partir deles
+	Folder            string     `gorm:"size:255" json:"folder"`            // Pasta a que UIDValidity e LastUID se referem
+	UIDValidity       uint32     `json:"uid_validity"`                      // UIDVALIDITY da pasta na última leitura
+	LastUID           uint32     `json:"last_uid"`                          // Maior UID já lido; a verificação seguinte começa no próximo
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func (EmailMailboxStatus) TableName() string {
+	return "email_mailbox_statuses"
+}
+
+// EmailIngestion registra cada anexo de NF-e lido pelo consumidor de e-mail (ou
+// o e-mail, quando não tinha anexo) com o resultado e o conteúdo original, para
+// consulta e reprocessamento
+type EmailIngestion struct {
+	ID            int32      `gorm:"primaryKey;type:int" json:"id"`
+	EmailConfigID uint       `gorm:"index" json:"email_config_id"`
+	MailboxName   string     `gorm:"size:100" json:"mailbox_name"`
+	UIDValidity   uint32     `json:"uid_validity"`
+	UID           uint32     `json:"uid"`
+	MessageID     string     `gorm:"size:255" json:"message_id"`
+	Sender        string     `gorm:"size:255;index" json:"sender"`
+	Subject       string     `gorm:"size:500" json:"subject"`
+	EmailDate     *time.Time `json:"email_date,omitempty"`
+	Filename      string     `gorm:"size:255" json:"filename"`            // XMLs de um ZIP: arquivo.zip/nota.xml
+	Outcome       string     `gorm:"size:20;index" json:"outcome"`        // REGISTRADO, DUPLICADO, SUSPEITO, INVALIDO, ERRO ou IGNORADO
+	ErrorCode     string     `gorm:"size:50" json:"error_code,omitempty"` // Código da validação (ex: CHAVE_DV_INVALIDO)
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	AccessKey     string     `gorm:"size:50;index" json:"access_key,omitempty"`
+	Content       []byte     `gorm:"type:longblob" json:"-"` // Anexo como recebido
+	ContentSize   int        `json:"content_size"`
+	Attempts      int        `gorm:"default:1" json:"attempts"`
+	RetriedAt     *time.Time `json:"retried_at,omitempty"`
+	RetriedBy     *int32     `gorm:"type:int" json:"retried_by,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (EmailIngestion) TableName() string {
+	return "email_ingestions"
+}
+
+// NfeConfig guarda as regras de recebimento de NF-e definidas pelo administrador
+type NfeConfig struct {
+	gorm.Model
+	SignaturePolicy string `gorm:"size:20;default:'SINALIZAR'" json:"signature_policy"` // REJEITAR ou SINALIZAR notas sem assinatura válida
+	OwnCNPJs        string `gorm:"type:text" json:"own_cnpjs"`                          // CNPJs da própria empresa, separados por vírgula
+
+	// Custo de aquisição: despesas só no total da nota são rateadas por VALOR ou QUANTIDADE;
+	// IPI e ICMS-ST entram no custo e o ICMS não é abatido, salvo quando indicado abaixo
+	CostProration     string `gorm:"size:20;default:'VALOR'" json:"cost_proration"`
+	CostExcludeIPI    bool   `gorm:"default:false" json:"cost_exclude_ipi"`     // IPI recuperável (ex: indústria)
+	CostExcludeICMSST bool   `gorm:"default:false" json:"cost_exclude_icms_st"` // ICMS-ST fora do custo
+	CostCreditICMS    bool   `gorm:"default:false" json:"cost_credit_icms"`     // ICMS próprio é creditado e abatido do custo
+
+	// Manifestação do destinatário enviada automaticamente
+	AutoCiencia      bool `gorm:"default:false" json:"auto_ciencia"`      // Ciência ao receber o resumo pela distribuição DF-e
+	AutoConfirmation bool `gorm:"default:false" json:"auto_confirmation"` // Confirmação ao efetivar a entrada
 }
 
 type CreateUserRequest struct {
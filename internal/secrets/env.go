@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadKeyring monta o keyring a partir do ambiente:
+//
+//   - SECRETS_KEY ou SECRETS_KEY_FILE (arquivo com a chave): chave atual
+//   - SECRETS_PREVIOUS_KEYS: chaves anteriores separadas por vírgula, mantidas
+//     até que Rotate recifre os registros
+//   - CERT_ENCRYPTION_KEY: chave usada pelos certificados antes deste pacote;
+//     vira a chave atual quando SECRETS_KEY não é informada
+//
+// Sem nenhuma chave devolve nil e nenhum erro: as credenciais não são gravadas
+// (ver AllowPlaintext).
+func LoadKeyring() (*Keyring, error) {
+	value := os.Getenv("SECRETS_KEY")
+	if file := os.Getenv("SECRETS_KEY_FILE"); value == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_KEY_FILE: %w", err)
+		}
+		value = string(data)
+	}
+
+	var previous []string
+	if legacy := os.Getenv("CERT_ENCRYPTION_KEY"); legacy != "" {
+		if value == "" {
+			value = legacy
+		} else {
+			previous = append(previous, legacy)
+		}
+	}
+	for _, v := range strings.Split(os.Getenv("SECRETS_PREVIOUS_KEYS"), ",") {
+		if strings.TrimSpace(v) != "" {
+			previous = append(previous, v)
+		}
+	}
+
+	if strings.TrimSpace(value) == "" {
+		if len(previous) > 0 {
+			return nil, fmt.Errorf("SECRETS_PREVIOUS_KEYS informada sem SECRETS_KEY")
+		}
+		return nil, nil
+	}
+
+	primary, err := ParseKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("SECRETS_KEY: %w", err)
+	}
+	var old [][]byte
+	for i, v := range previous {
+		k, err := ParseKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("chave anterior %d: %w", i+1, err)
+		}
+		old = append(old, k)
+	}
+	return NewKeyring(primary, old...)
+}
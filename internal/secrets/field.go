@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sync"
+)
+
+var (
+	defaultMu      sync.RWMutex
+	defaultKeyring *Keyring
+	allowPlaintext bool
+)
+
+// Configure define o keyring usado pelos campos String. Sem keyring (nil) os
+// campos não são gravados, a menos que AllowPlaintext tenha sido habilitado.
+func Configure(k *Keyring) {
+	defaultMu.Lock()
+	defaultKeyring = k
+	defaultMu.Unlock()
+}
+
+// AllowPlaintext permite gravar os campos String em texto puro quando não há
+// keyring (SECRETS_ALLOW_PLAINTEXT, só para desenvolvimento). Os registros são
+// cifrados por Rotate assim que uma chave for configurada.
+func AllowPlaintext(allow bool) {
+	defaultMu.Lock()
+	allowPlaintext = allow
+	defaultMu.Unlock()
+}
+
+func plaintextAllowed() bool {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return allowPlaintext
+}
+
+// Default devolve o keyring configurado (nil sem chave)
+func Default() *Keyring {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultKeyring
+}
+
+// String é um campo de modelo cifrado no banco com o keyring padrão e em claro
+// na memória. Ex: IMAPPassword secrets.String `json:"imap_password"`
+type String string
+
+// Value cifra o campo ao gravar; sem chave configurada recusa com ErrNoKey
+func (s String) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	k := Default()
+	if k == nil {
+		if plaintextAllowed() {
+			return string(s), nil
+		}
+		return nil, ErrNoKey
+	}
+	return k.EncryptString(string(s))
+}
+
+// Scan decifra o campo ao ler
+func (s *String) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("secrets.String: tipo não suportado %T", value)
+	}
+
+	if !IsEncrypted(raw) {
+		*s = String(raw)
+		return nil
+	}
+	k := Default()
+	if k == nil {
+		return ErrNoKey
+	}
+	plain, err := k.DecryptString(raw)
+	if err != nil {
+		return err
+	}
+	*s = String(plain)
+	return nil
+}
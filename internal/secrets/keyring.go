@@ -0,0 +1,204 @@
+// Package secrets cifra as credenciais guardadas no banco (senhas de e-mail,
+// certificados, tokens de integração) com AES-256-GCM. O valor cifrado leva o
+// identificador da chave usada, o que permite trocar a chave e recifrar os
+// registros existentes sem perder os antigos.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidKey = errors.New("chave de criptografia deve ter 32 bytes (64 caracteres hex ou base64)")
+	ErrNoKey      = errors.New("chave de criptografia não configurada (SECRETS_KEY)")
+	ErrUnknownKey = errors.New("valor cifrado com uma chave desconhecida; informe-a em SECRETS_PREVIOUS_KEYS")
+	ErrDecrypt    = errors.New("não foi possível decifrar o valor; a chave de criptografia mudou?")
+)
+
+// Prefixo dos valores cifrados: enc:v1:<id da chave>:
+const prefix = "enc:v1:"
+
+// Keyring guarda a chave atual, usada para cifrar, e as anteriores, aceitas só para decifrar
+type Keyring struct {
+	primary *key
+	keys    []*key // A atual primeiro
+}
+
+type key struct {
+	id   string // 8 primeiros caracteres hex do SHA-256 da chave
+	aead cipher.AEAD
+}
+
+// ParseKey lê a chave de 32 bytes em hex ou base64 (ex: openssl rand -hex 32)
+func ParseKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if k, err := hex.DecodeString(value); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(value); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// NewKeyring cria o keyring com a chave atual e as chaves anteriores ainda em uso
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{}
+	for i, raw := range append([][]byte{primary}, previous...) {
+		entry, err := newKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if k.find(entry.id) != nil {
+			continue
+		}
+		if i == 0 {
+			k.primary = entry
+		}
+		k.keys = append(k.keys, entry)
+	}
+	return k, nil
+}
+
+func newKey(raw []byte) (*key, error) {
+	if len(raw) != 32 {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &key{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func (k *Keyring) find(id string) *key {
+	for _, entry := range k.keys {
+		if entry.id == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Seal cifra com a chave atual; additional amarra o valor ao registro (ex:
+// fingerprint do certificado) e precisa ser o mesmo em Open
+func (k *Keyring) Seal(plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, k.primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := []byte(prefix + k.primary.id + ":")
+	out = append(out, nonce...)
+	return k.primary.aead.Seal(out, nonce, plaintext, additional), nil
+}
+
+// Open decifra um valor de Seal com a chave indicada nele. Valores sem o
+// prefixo (gravados pelo store de certificados antes do keyring) são testados
+// com todas as chaves.
+func (k *Keyring) Open(sealed, additional []byte) ([]byte, error) {
+	id, body, ok := splitSealed(sealed)
+	if !ok {
+		for _, entry := range k.keys {
+			if plain, err := open(entry, sealed, additional); err == nil {
+				return plain, nil
+			}
+		}
+		return nil, ErrDecrypt
+	}
+	entry := k.find(id)
+	if entry == nil {
+		return nil, ErrUnknownKey
+	}
+	plain, err := open(entry, body, additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func open(entry *key, body, additional []byte) ([]byte, error) {
+	n := entry.aead.NonceSize()
+	if len(body) < n {
+		return nil, errors.New("conteúdo cifrado truncado")
+	}
+	return entry.aead.Open(nil, body[:n], body[n:], additional)
+}
+
+// Current indica se o valor já está cifrado com a chave atual
+func (k *Keyring) Current(sealed []byte) bool {
+	id, _, ok := splitSealed(sealed)
+	return ok && id == k.primary.id
+}
+
+// EncryptString cifra um texto e devolve a forma textual (prefixo + base64),
+// própria para colunas de texto
+func (k *Keyring) EncryptString(plaintext string) (string, error) {
+	sealed, err := k.Seal([]byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	head := len(prefix) + len(k.primary.id) + 1
+	return string(sealed[:head]) + base64.StdEncoding.EncodeToString(sealed[head:]), nil
+}
+
+// DecryptString decifra um valor de EncryptString; textos sem o prefixo são
+// devolvidos como estão (gravados antes da criptografia)
+func (k *Keyring) DecryptString(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := decodeString(value)
+	if err != nil {
+		return "", err
+	}
+	plain, err := k.Open(sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// IsEncrypted indica se o texto está na forma de EncryptString
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// decodeString converte a forma textual de volta para a forma de Seal
+func decodeString(value string) ([]byte, error) {
+	rest := strings.TrimPrefix(value, prefix)
+	id, body, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: formato inválido", ErrDecrypt)
+	}
+	raw, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return append([]byte(prefix+id+":"), raw...), nil
+}
+
+func splitSealed(sealed []byte) (id string, body []byte, ok bool) {
+	if !bytes.HasPrefix(sealed, []byte(prefix)) {
+		return "", nil, false
+	}
+	rest := sealed[len(prefix):]
+	i := bytes.IndexByte(rest, ':')
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(rest[:i]), rest[i+1:], true
+}
@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newTestKeyring(t *testing.T, primary []byte, previous ...[]byte) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(primary, previous...)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return k
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"hex", strings.Repeat("0a", 32), false},
+		{"base64", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", false},
+		{"com espaços e quebra de linha", "  " + strings.Repeat("0a", 32) + "\n", false},
+		{"curta", strings.Repeat("0a", 16), true},
+		{"vazia", "", true},
+		{"texto qualquer", "minha-senha-secreta", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(key) != 32 {
+				t.Errorf("len(key) = %d, want 32", len(key))
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	current := newTestKeyring(t, testKey(1))
+	sealed, err := current.Seal([]byte("conteúdo"), []byte("registro-1"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !current.Current(sealed) {
+		t.Error("Current() = false para valor recém cifrado")
+	}
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		additional string
+		wantErr    error
+	}{
+		{"mesma chave", current, "registro-1", nil},
+		{"chave atual nova com a anterior", newTestKeyring(t, testKey(2), testKey(1)), "registro-1", nil},
+		{"outro registro", current, "registro-2", ErrDecrypt},
+		{"chave desconhecida", newTestKeyring(t, testKey(2)), "registro-1", ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := tt.keyring.Open(sealed, []byte(tt.additional))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(plain) != "conteúdo" {
+				t.Errorf("Open() = %q", plain)
+			}
+		})
+	}
+
+	if newTestKeyring(t, testKey(2), testKey(1)).Current(sealed) {
+		t.Error("Current() = true para valor cifrado com a chave anterior")
+	}
+}
+
+// Certificados gravados antes do keyring: nonce + texto cifrado, sem prefixo
+func TestOpenUnversioned(t *testing.T) {
+	block, _ := aes.NewCipher(testKey(1))
+	aead, _ := cipher.NewGCM(block)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	legacy := aead.Seal(nonce, nonce, []byte("PEM"), []byte("fingerprint"))
+
+	k := newTestKeyring(t, testKey(2), testKey(1))
+	plain, err := k.Open(legacy, []byte("fingerprint"))
+	if err != nil || string(plain) != "PEM" {
+		t.Fatalf("Open() = %q, %v", plain, err)
+	}
+	if k.Current(legacy) {
+		t.Error("Current() = true para valor sem prefixo")
+	}
+	if _, err := newTestKeyring(t, testKey(3)).Open(legacy, []byte("fingerprint")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open() com outra chave error = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestEncryptString(t *testing.T) {
+	k := newTestKeyring(t, testKey(1))
+	enc, err := k.EncryptString("senha-do-imap")
+	if err != nil {
+		t.Fatalf("EncryptString() error = %v", err)
+	}
+	if !IsEncrypted(enc) || strings.Contains(enc, "senha-do-imap") {
+		t.Fatalf("EncryptString() = %q", enc)
+	}
+	if again, _ := k.EncryptString("senha-do-imap"); again == enc {
+		t.Error("EncryptString() repetiu o nonce")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"cifrado", enc, "senha-do-imap", false},
+		{"texto puro anterior à criptografia", "senha-antiga", "senha-antiga", false},
+		{"base64 corrompido", enc[:len(enc)-4] + "!!!!", "", true},
+		{"sem id da chave", "enc:v1:semid", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := k.DecryptString(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DecryptString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	hexKey := func(b byte) string { return hex.EncodeToString(testKey(b)) }
+	keyFile := filepath.Join(t.TempDir(), "chave")
+	if err := os.WriteFile(keyFile, []byte(hexKey(3)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantNil     bool
+		wantErr     bool
+		wantKeys    int
+		wantPrimary string
+	}{
+		{"sem chave", nil, true, false, 0, ""},
+		{"SECRETS_KEY", map[string]string{"SECRETS_KEY": hexKey(1)}, false, false, 1, hexKey(1)},
+		{"arquivo", map[string]string{"SECRETS_KEY_FILE": keyFile}, false, false, 1, hexKey(3)},
+		{"CERT_ENCRYPTION_KEY sozinha", map[string]string{"CERT_ENCRYPTION_KEY": hexKey(2)}, false, false, 1, hexKey(2)},
+		{"CERT_ENCRYPTION_KEY vira anterior", map[string]string{"SECRETS_KEY": hexKey(1), "CERT_ENCRYPTION_KEY": hexKey(2)}, false, false, 2, hexKey(1)},
+		{"rotação", map[string]string{"SECRETS_KEY": hexKey(1), "SECRETS_PREVIOUS_KEYS": hexKey(2) + ", " + hexKey(3)}, false, false, 3, hexKey(1)},
+		{"anterior sem atual", map[string]string{"SECRETS_PREVIOUS_KEYS": hexKey(2)}, false, true, 0, ""},
+		{"chave inválida", map[string]string{"SECRETS_KEY": "curta"}, false, true, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SECRETS_KEY", "SECRETS_KEY_FILE", "SECRETS_PREVIOUS_KEYS", "CERT_ENCRYPTION_KEY"} {
+				t.Setenv(name, tt.env[name])
+			}
+			k, err := LoadKeyring()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (k == nil) != tt.wantNil {
+				t.Fatalf("LoadKeyring() = %v, wantNil %v", k, tt.wantNil)
+			}
+			if k == nil {
+				return
+			}
+			primary, _ := ParseKey(tt.wantPrimary)
+			if len(k.keys) != tt.wantKeys || k.primary.id != newTestKeyring(t, primary).primary.id {
+				t.Errorf("LoadKeyring() = %d chaves, atual %s", len(k.keys), k.primary.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Column identifica uma coluna de texto gravada com String
+type Column struct {
+	Table  string
+	Column string
+}
+
+// Rotate recifra com a chave atual os valores das colunas gravados com uma
+// chave anterior ou ainda em texto puro e devolve quantos foram alterados.
+// updated_at não é tocado: para o resto do sistema o registro não mudou.
+func Rotate(db *gorm.DB, k *Keyring, columns ...Column) (int, error) {
+	total := 0
+	for _, c := range columns {
+		n, err := rotateColumn(db, k, c)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%s.%s: %w", c.Table, c.Column, err)
+		}
+	}
+	return total, nil
+}
+
+func rotateColumn(db *gorm.DB, k *Keyring, c Column) (int, error) {
+	var rows []struct {
+		ID    uint
+		Value string
+	}
+	if err := db.Table(c.Table).Select("id, "+c.Column+" AS value").Where(c.Column+" <> ?", "").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, row := range rows {
+		if k.currentString(row.Value) {
+			continue
+		}
+		plain, err := k.DecryptString(row.Value)
+		if err != nil {
+			return rotated, fmt.Errorf("id %d: %w", row.ID, err)
+		}
+		sealed, err := k.EncryptString(plain)
+		if err != nil {
+			return rotated, err
+		}
+		if err := db.Table(c.Table).Where("id = ?", row.ID).UpdateColumn(c.Column, sealed).Error; err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// Plaintext conta os valores das colunas ainda gravados em texto puro, que
+// Rotate cifrará quando houver uma chave
+func Plaintext(db *gorm.DB, columns ...Column) (int, error) {
+	total := 0
+	for _, c := range columns {
+		var n int64
+		err := db.Table(c.Table).Where(c.Column+" <> ? AND "+c.Column+" NOT LIKE ?", "", prefix+"%").Count(&n).Error
+		if err != nil {
+			return total, fmt.Errorf("%s.%s: %w", c.Table, c.Column, err)
+		}
+		total += int(n)
+	}
+	return total, nil
+}
+
+// currentString indica se o texto já está cifrado com a chave atual
+func (k *Keyring) currentString(value string) bool {
+	id, _, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return ok && IsEncrypted(value) && id == k.primary.id
+}
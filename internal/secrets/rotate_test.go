@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testMailbox struct {
+	ID        uint
+	Password  String
+	UpdatedAt time.Time
+}
+
+func TestStringFieldAndRotate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&testMailbox{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	t.Cleanup(func() { Configure(nil) })
+
+	// Sem chave a senha não é gravada...
+	Configure(nil)
+	if err := db.Create(&testMailbox{Password: "sem-chave"}).Error; !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Create() sem chave error = %v, want %v", err, ErrNoKey)
+	}
+
+	// ...a não ser com SECRETS_ALLOW_PLAINTEXT: fica em texto puro até a rotação
+	AllowPlaintext(true)
+	t.Cleanup(func() { AllowPlaintext(false) })
+	legacy := testMailbox{Password: "senha-antiga"}
+	db.Create(&legacy)
+	AllowPlaintext(false)
+	cols := []Column{{Table: "test_mailboxes", Column: "password"}}
+	if n, err := Plaintext(db, cols...); n != 1 || err != nil {
+		t.Fatalf("Plaintext() = %d, %v; want 1", n, err)
+	}
+
+	old := newTestKeyring(t, testKey(1))
+	Configure(old)
+	current := testMailbox{Password: "senha-nova"}
+	db.Create(&current)
+
+	raw := func(id uint) string {
+		var v string
+		db.Table("test_mailboxes").Select("password").Where("id = ?", id).Scan(&v)
+		return v
+	}
+	if v := raw(current.ID); !IsEncrypted(v) {
+		t.Fatalf("senha gravada em texto puro: %q", v)
+	}
+
+	var loaded testMailbox
+	db.First(&loaded, current.ID)
+	if loaded.Password != "senha-nova" {
+		t.Errorf("Password lida = %q", loaded.Password)
+	}
+
+	// Troca de chave: a anterior continua aceita até a rotação
+	rotated := newTestKeyring(t, testKey(2), testKey(1))
+	Configure(rotated)
+	if n, err := Rotate(db, rotated, cols...); n != 2 || err != nil {
+		t.Fatalf("Rotate() = %d, %v; want 2", n, err)
+	}
+	if n, err := Rotate(db, rotated, cols...); n != 0 || err != nil {
+		t.Errorf("Rotate() repetido = %d, %v; want 0", n, err)
+	}
+	if n, err := Plaintext(db, cols...); n != 0 || err != nil {
+		t.Errorf("Plaintext() após a rotação = %d, %v; want 0", n, err)
+	}
+
+	Configure(newTestKeyring(t, testKey(2)))
+	var all []testMailbox
+	if err := db.Order("id").Find(&all).Error; err != nil {
+		t.Fatalf("Find() após a rotação error = %v", err)
+	}
+	if all[0].Password != "senha-antiga" || all[1].Password != "senha-nova" {
+		t.Errorf("senhas após a rotação = %q, %q", all[0].Password, all[1].Password)
+	}
+	if !all[1].UpdatedAt.Equal(current.UpdatedAt) {
+		t.Error("UpdatedAt alterado pela rotação")
+	}
+
+	// Sem a chave o valor cifrado não é devolvido em branco nem como texto cifrado
+	Configure(nil)
+	if err := db.First(&loaded, current.ID).Error; err == nil {
+		t.Error("First() sem chave error = nil")
+	}
+}
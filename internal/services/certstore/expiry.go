@@ -0,0 +1,55 @@
+package certstore
+
+import (
+	"context"
+	"errors"
+	"estoque/internal/events"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// ExpiryWarningPeriod é a antecedência dos avisos de vencimento do certificado ativo
+const ExpiryWarningPeriod = 30 * 24 * time.Hour
+
+// CheckExpiry avisa pelo hub de notificações, no máximo uma vez por dia, que o
+// certificado ativo vence em breve ou já venceu. Devolve se o aviso foi enviado.
+func (s *Store) CheckExpiry(now time.Time) (bool, error) {
+	active, err := s.Active()
+	if errors.Is(err, ErrNoCertificate) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if active.NotAfter.Sub(now) > ExpiryWarningPeriod {
+		return false, nil
+	}
+	if active.ExpiryNotifiedAt != nil && now.Sub(*active.ExpiryNotifiedAt) < 24*time.Hour {
+		return false, nil
+	}
+
+	daysLeft := int(math.Floor(active.NotAfter.Sub(now).Hours() / 24))
+	events.NotifyCertificateExpiry(active.Subject, active.CNPJ, active.NotAfter, daysLeft)
+	slog.Warn("Certificado digital próximo do vencimento", "subject", active.Subject, "not_after", active.NotAfter, "days_left", daysLeft)
+
+	// UpdateColumn não altera updated_at, que controla o cache do certificado decifrado
+	return true, s.DB.Model(active).UpdateColumn("expiry_notified_at", now).Error
+}
+
+// WatchExpiry verifica o vencimento periodicamente até o contexto ser cancelado
+func (s *Store) WatchExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.CheckExpiry(time.Now()); err != nil {
+			slog.Error("Erro ao verificar vencimento do certificado digital", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
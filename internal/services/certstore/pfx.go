@@ -0,0 +1,123 @@
+package certstore
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+var (
+	ErrInvalidPFX      = errors.New("arquivo não é um certificado PFX válido")
+	ErrInvalidPassword = errors.New("senha do certificado incorreta")
+	// Exportações recentes do OpenSSL 3 usam AES/PBKDF2 e MAC SHA-256, que o decodificador não suporta
+	ErrUnsupportedPFX = errors.New("formato do PFX não suportado; exporte novamente com criptografia 3DES (openssl pkcs12 -export -legacy)")
+	ErrNoPrivateKey   = errors.New("PFX sem a chave privada RSA do certificado")
+)
+
+// Parsed é o conteúdo de um PFX já decodificado
+type Parsed struct {
+	Certificate tls.Certificate // Folha primeiro, seguida da cadeia
+	Leaf        *x509.Certificate
+	Fingerprint string // SHA-256 (hex) do certificado
+}
+
+// ParsePFX decodifica o PFX (PKCS#12) do certificado A1 e localiza o certificado
+// que corresponde à chave privada; os demais certificados formam a cadeia
+func ParsePFX(data []byte, password string) (*Parsed, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		var notImplemented pkcs12.NotImplementedError
+		switch {
+		case errors.Is(err, pkcs12.ErrIncorrectPassword), errors.Is(err, pkcs12.ErrDecryption):
+			return nil, ErrInvalidPassword
+		case errors.As(err, &notImplemented):
+			return nil, ErrUnsupportedPFX
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPFX, err)
+	}
+
+	var key *rsa.PrivateKey
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "PRIVATE KEY":
+			if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				key = k
+			}
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidPFX, err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if key == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	leafIndex := -1
+	for i, cert := range certs {
+		if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok && pub.Equal(&key.PublicKey) {
+			leafIndex = i
+			break
+		}
+	}
+	if leafIndex < 0 {
+		return nil, ErrNoPrivateKey
+	}
+
+	leaf := certs[leafIndex]
+	chain := [][]byte{leaf.Raw}
+	for i, cert := range certs {
+		if i != leafIndex {
+			chain = append(chain, cert.Raw)
+		}
+	}
+	sum := sha256.Sum256(leaf.Raw)
+	return &Parsed{
+		Certificate: tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: leaf},
+		Leaf:        leaf,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// encodePEM serializa cadeia e chave (PKCS#8) para guardar cifrado no banco
+func encodePEM(cert tls.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, der := range cert.Certificate {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, err
+		}
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodePEM reconstrói o certificado gravado por encodePEM
+func decodePEM(data []byte) (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return cert, nil
+}
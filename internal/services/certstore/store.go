@@ -0,0 +1,254 @@
+// Package certstore guarda o certificado digital A1 da empresa, cifrado no banco,
+// e o disponibiliza aos pacotes fiscais para o TLS mútuo com a SEFAZ e para a
+// assinatura de XML (eventos, manifestações).
+package certstore
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/secrets"
+	"estoque/internal/services/xmldsig"
+	"estoque/internal/utils"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoCertificate = errors.New("nenhum certificado digital ativo")
+	ErrExpired       = errors.New("certificado digital vencido")
+	ErrNoEncryption  = errors.New("chave de criptografia dos certificados não configurada (SECRETS_KEY)")
+)
+
+// Store mantém os certificados enviados e carrega o ativo sob demanda
+type Store struct {
+	DB   *gorm.DB
+	keys *secrets.Keyring
+
+	mu       sync.Mutex
+	cached   *tls.Certificate
+	cachedID int32
+	cachedAt time.Time // UpdatedAt do registro carregado
+}
+
+// New cria o store; keys nil deixa o envio de certificados indisponível
+func New(db *gorm.DB, keys *secrets.Keyring) *Store {
+	return &Store{DB: db, keys: keys}
+}
+
+// Enabled indica se há chave para cifrar e ler os certificados
+func (s *Store) Enabled() bool {
+	return s.keys != nil
+}
+
+// Upload valida o PFX, grava cadeia e chave cifradas e torna o certificado o
+// ativo. Reenviar um certificado já cadastrado apenas o reativa.
+func (s *Store) Upload(pfx []byte, password string, userID *int32) (*models.DigitalCertificate, error) {
+	if s.keys == nil {
+		return nil, ErrNoEncryption
+	}
+	parsed, err := ParsePFX(pfx, password)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(parsed.Leaf.NotAfter) {
+		return nil, ErrExpired
+	}
+
+	plain, err := encodePEM(parsed.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.keys.Seal(plain, []byte(parsed.Fingerprint))
+	if err != nil {
+		return nil, err
+	}
+
+	info := xmldsig.DescribeCertificate(parsed.Leaf)
+	record := models.DigitalCertificate{
+		Subject:       utils.Truncate(info.Subject, 255),
+		Issuer:        utils.Truncate(info.Issuer, 255),
+		SerialNumber:  utils.Truncate(info.SerialNumber, 100),
+		CNPJ:          info.CNPJ,
+		Fingerprint:   parsed.Fingerprint,
+		NotBefore:     info.NotBefore,
+		NotAfter:      info.NotAfter,
+		Active:        true,
+		EncryptedData: encrypted,
+		UploadedBy:    userID,
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.DigitalCertificate
+		if err := tx.Where("fingerprint = ?", parsed.Fingerprint).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if err := deactivateAll(tx); err != nil {
+			return err
+		}
+		if existing.ID != 0 {
+			record.ID = existing.ID
+			record.CreatedAt = existing.CreatedAt
+			record.ExpiryNotifiedAt = existing.ExpiryNotifiedAt
+		}
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &record, nil
+}
+
+// List devolve os certificados cadastrados, o ativo primeiro
+func (s *Store) List() ([]models.DigitalCertificate, error) {
+	var list []models.DigitalCertificate
+	err := s.DB.Order("active DESC, not_after DESC").Find(&list).Error
+	return list, err
+}
+
+// Active devolve os dados do certificado ativo (sem a chave)
+func (s *Store) Active() (*models.DigitalCertificate, error) {
+	var list []models.DigitalCertificate
+	if err := s.DB.Omit("encrypted_data").Where("active = ?", true).Limit(1).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return &list[0], nil
+}
+
+// Activate volta a usar um certificado já cadastrado
+func (s *Store) Activate(id int32) (*models.DigitalCertificate, error) {
+	var record models.DigitalCertificate
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("encrypted_data").First(&record, id).Error; err != nil {
+			return err
+		}
+		if time.Now().After(record.NotAfter) {
+			return ErrExpired
+		}
+		if err := deactivateAll(tx); err != nil {
+			return err
+		}
+		record.Active = true
+		return tx.Model(&record).Update("active", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &record, nil
+}
+
+// Delete remove o certificado; removendo o ativo, as integrações ficam sem certificado
+func (s *Store) Delete(id int32) (*models.DigitalCertificate, error) {
+	var record models.DigitalCertificate
+	if err := s.DB.Omit("encrypted_data").First(&record, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Delete(&record).Error; err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	return &record, nil
+}
+
+// TLSCertificate devolve o certificado ativo com a chave privada (dfe.Certificate).
+// A versão decifrada fica em memória enquanto o registro ativo não mudar.
+func (s *Store) TLSCertificate() (tls.Certificate, error) {
+	if s.keys == nil {
+		return tls.Certificate{}, ErrNoEncryption
+	}
+	active, err := s.Active()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if time.Now().After(active.NotAfter) {
+		return tls.Certificate{}, ErrExpired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil && s.cachedID == active.ID && s.cachedAt.Equal(active.UpdatedAt) {
+		return *s.cached, nil
+	}
+
+	var record models.DigitalCertificate
+	if err := s.DB.Select("id", "fingerprint", "encrypted_data").First(&record, active.ID).Error; err != nil {
+		return tls.Certificate{}, err
+	}
+	plain, err := s.keys.Open(record.EncryptedData, []byte(record.Fingerprint))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("certificado digital: %w", err)
+	}
+	cert, err := decodePEM(plain)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	s.cached, s.cachedID, s.cachedAt = &cert, active.ID, active.UpdatedAt
+	return cert, nil
+}
+
+// Sign assina o elemento com o Id informado usando o certificado ativo (dfe.Signer)
+func (s *Store) Sign(data []byte, referenceID string) ([]byte, error) {
+	cert, err := s.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := cert.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrNoPrivateKey
+	}
+	return xmldsig.SignEnveloped(data, referenceID, key, cert.Leaf)
+}
+
+// Rotate recifra com a chave atual os certificados gravados com uma chave
+// anterior e devolve quantos foram alterados
+func (s *Store) Rotate() (int, error) {
+	if s.keys == nil {
+		return 0, nil
+	}
+	var list []models.DigitalCertificate
+	if err := s.DB.Select("id", "fingerprint", "encrypted_data").Find(&list).Error; err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, record := range list {
+		if s.keys.Current(record.EncryptedData) {
+			continue
+		}
+		plain, err := s.keys.Open(record.EncryptedData, []byte(record.Fingerprint))
+		if err != nil {
+			return rotated, fmt.Errorf("certificado %d: %w", record.ID, err)
+		}
+		sealed, err := s.keys.Seal(plain, []byte(record.Fingerprint))
+		if err != nil {
+			return rotated, err
+		}
+		if err := s.DB.Model(&record).UpdateColumn("encrypted_data", sealed).Error; err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	if rotated > 0 {
+		s.invalidate()
+	}
+	return rotated, nil
+}
+
+func (s *Store) invalidate() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+func deactivateAll(tx *gorm.DB) error {
+	return tx.Model(&models.DigitalCertificate{}).Where("active = ?", true).Update("active", false).Error
+}
@@ -0,0 +1,286 @@
+package certstore
+
+import (
+	"encoding/base64"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/secrets"
+	"estoque/internal/services/xmldsig"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// PFX autoassinado (CN "EMPRESA TESTE LTDA:12345678000195", senha "senha123"),
+// exportado com e sem a opção -legacy do OpenSSL 3
+const (
+	testPFXLegacy = "" +
+		"MIIJ9AIBAzCCCboGCSqGSIb3DQEHAaCCCasEggmnMIIJozCCBD8GCSqGSIb3DQEHBqCCBDAwggQsAgEAMIIEJQYJKoZIhvcNAQcB" +
+		"MBwGCiqGSIb3DQEMAQYwDgQI3QH91fgdjSYCAggAgIID+Dn7ZTHZT5UDHJL09htEjzz9AeSpUmTUCNMVqZ76+vLjrm6gjR85aDnx" +
+		"gfU572XcumjYctSoYmjNumnqvxLsNtsa5KXElN1KNexYTWTcJM/cZQvdl4WQ5t6gP8C4oYyJjUPcAen0OD4WogEB/J/qsZdPxbMk" +
+		"YUCEXodlowp1ivJmYxnNiVOlXHPu4PopQmQVnG3QVtuqyjk5LO2cqYkUTVKQNiI+w+QWe0GcqgHiIzfd9V8HjLGltFQyTIHh9b2f" +
+		"nK8rrEpMXcQaF4laMJnYpG0tXUgAPsimQPJrWvV1fIPQGTeQzUSfFbxh63LnpWexy9CqWwo/XDiGrkUT/9yYMlCD0WuZn1+KwEQi" +
+		"1oQACX20uh1Dt6qzyI4dVr0awFM3TI1/d0HC3BE9rXmLLe6/rdnYpXAvc8i0jMF4wVwBqAJFx5N4zh+Aogr5s3sBAQ0p3B/utv8b" +
+		"nUTpGC1RARDQZDiPbA+gz2+RueJbsJttcyAnX4bABJAqhhdz8b8RBL8q/2wEJUdGSQy7nUwDVrmQFnlLWrvIcKg4uQSVOnF7Rd2F" +
+		"gw0XcZOtj3Cub/8tKOsVxHYEw9Le0h3+EEC/kF0YsDhBXMAL6F0tsF6k9nh35iPb8O71kPClJlIurCdCYlfYA4Ii+F1KWXCNl3OB" +
+		"wFA1HLOWhA3VP3y3pqMrOjzcrUM4r2konkDzBO69W/cRKQyreypX8JJFS5RFqdeAKvQd+V9ooxPMrRmJQWa2+flNrQOM7LdIqlj5" +
+		"lwjO+MpBsK2JSDMwzO6WfwJplUDihaXlON4+sGLMbmIi6KQ/3QemS6UlewUayB3K6BD9E5Ufdk+dTCr9ZG/g3CqrHbzLVaPjra4s" +
+		"BaZZd7mYdKg4pKIgemL6xNQ0LBZFczQ7m0xLL+cmDDWfY+RMs+qYs5QP35kJ9YhYm8QetxNr+dWC1L5TlhGup+dBZYuSe6BV0htt" +
+		"e6iySCSYfqo7DHjtBB6HNFcT+GbgzpJOZsPCiH8gHV0VGrvyD/Rqq/tCJfCpLm2kDeZTjC2uskTBcRaTHFFphjkbZi83/99WB23c" +
+		"skV1W4/AkBG8+ZyaPaPJn8wUSJbhZRc9y8ucI+pvFaEHtmKsFz7fkI2ymPbMNo3UmdG4cL7MWttB9Q0r8Ma2KejYAJd2hswzthDo" +
+		"siiV+ILVY+9ygjpEsjsBQ60x8ibo9ESJEaqaIZJu3xCtLxa36v+SWpDFtI0MQJ/K7HcjUUvXraXdEHf3c5wevGnakkdFtWcphomv" +
+		"lxhN0QS7AQ+UUmWLfCyh2eiMAth+wqcMeKVUTomGUjxmhJ8E6GVMnIVWqOqbSkMbtzn5ox7GGt9tDR3W49O+uq2jJ8BopME+riO5" +
+		"MIIFXAYJKoZIhvcNAQcBoIIFTQSCBUkwggVFMIIFQQYLKoZIhvcNAQwKAQKgggTuMIIE6jAcBgoqhkiG9w0BDAEDMA4ECPvtH5a2" +
+		"n/qyAgIIAASCBMjjL/V+fDJMHJEC/dR5XCaKItU0Vyct7WAbkXkbEwF4F1KgBbfkFg/05kdQVb8tzddqYYgxNfntb8a8CPKmrJB1" +
+		"yo0OnyhU/cuE3/1yUonjOPJz4G2i1to16QGakYE7eFUi47ZPTlO6XaHLWkYCdWA5ER5tnFu3q9+YozHIzBOq73CYS+Uzd0Z9TFH0" +
+		"q3eVasvmltKdUD1OjMh+nj7bwNuzxEaLzRZMKoD5cF6iun/ZHvoHA1JtW31mg+ovYbUINa6sZqCMPExOvSzYwvFWAmi9d9opj87G" +
+		"V4qUukqc8UEf0wa5UhNjK99uvrqrof6LSh5K3wHqC/kJDPyc6Uwe8e25CnA6zb8kcG/0LJR9kcDHuLsYclRTpjPrjVw8Li5FmTG6" +
+		"ldM/tlm/W7BbyQdhqoPLcILH28e/LlVr90T5WcxN/QVzl1YR6cnkWvBpX02tUEruB9tpbuaKImcZc8qc1X6Xqr/hOlS9injrINcw" +
+		"FpeIMLdwfmdjnn//9fMwYw+qUCl5GQ8HIXqvQy3DBSADZT+UIIq9rKclgqorxgAexAsgkK1wMbFKGFabIKObMnCAh2lYsxngZJkd" +
+		"83Fxg5SJz1JQIb03UjnPQ1OX5aVT5n1HaXA2zW+6qVcDNY8IH47ZezxaTtpmYeQzPaRFa6qzAjkLKvvnADwNGfC+vjej9lf5mT6f" +
+		"1V9acY14gqoLNYKpUec/7xPA0qYPUWEZg42p81KJTNTFZpLRxobUo7PIJSGHWGH5mBCWW4SUcQWeXQFv0lUcuOrCbL0Xd1BpiEba" +
+		"PSnOZnaa+nrATUvGI4dqDiZLZBe4Axr7UnQjDPhhaMli2HHkA1ug1hODvFe5pDNIsfKn6QtqzHVNubgXOrZF0NKKR816kWAuU0B1" +
+		"jaz7Cdyg4vKDajYRcz8vw7KD381DD4yjm2mzi+4IjFRoxpLwILQBdqME5WuUENXZiE9UDVDRPTBE/a2AVCEfnJ8VQii0Cs26JgOz" +
+		"sa9oNK45wi9iUaoFLh3H+Y1xG1Tk6+u4yoMFMXtPSjxOM8CQ4IA7dCMxQHLhlWda49a8ZLgYTl239Kx4BpWVFp45v0oCpABDm12b" +
+		"NfdaZpLL8uIlq4ngsrtGq5Sa6YKPbBFpIsI6V+WXHWYI6kweH/1ByBbuvVINMOR0rqgsimJMmtqZmCpgYIBreasgK4ogN0Nx1OPb" +
+		"FJozcPZ6xTECkOEdix46Bp7bKktWowXauFiSjvS0QyFeFkMkgjb079EidPP8Z4RZzzAQjVGcpp3zThd8UiZZjgzd8EyYDMAsUn4f" +
+		"NPKlT1MvV17V4AVKS7KvaV2hvPTyavu6mTy3w4v/T+OWuFNXqMKX+uOMhniMc7z3oB4q0Xs/o3STgxTmJVBO29Banpx0V6j/BQjr" +
+		"vp9YwRt85PLKWmrhOLbT/mX446WDnpK24wy+vCjS7bQ7hI2ZZc4FNX9NulYT6Yw5A6tuzl/bFrWiffo4u3PQoJb6pOIZ6ka1eitr" +
+		"nIw9+Di/61kReyFJarVjZHFeexh2RBB4qquFznZWHdwh9+17b+aotJzZb3lrKOy+JYZEMGNJSfDn7+dnM63Zje9hA5et0xRCSkvw" +
+		"dksFthh0uufTfgevsZq1CBQnMBq9uWQsWAcACd5xkVh+u0IxQDAZBgkqhkiG9w0BCRQxDB4KAHQAZQBzAHQAZTAjBgkqhkiG9w0B" +
+		"CRUxFgQUXTi6Y156D8/zptgXWO4jhJr0mhcwMTAhMAkGBSsOAwIaBQAEFAgkd9D5oenTMfVkm5Q2FGrYxDE7BAgMdPneZqK4RAIC" +
+		"CAA="
+
+	testPFXModern = "" +
+		"MIIKTwIBAzCCCgUGCSqGSIb3DQEHAaCCCfYEggnyMIIJ7jCCBGIGCSqGSIb3DQEHBqCCBFMwggRPAgEAMIIESAYJKoZIhvcNAQcB" +
+		"MFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAi/hxNzWn9+HQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEECc/" +
+		"AdUHZYt9iYG6yZ+OUX2AggPgFM51LZhgRMetzakP+dRNsb70uXZYr0H1186vWQNiry3WY63vyCAjw6tAg+8vKufeUo83lw8xHqoz" +
+		"aOoAYPAVsQBttekwYEuu+RMET0wHnss9/7MDjvRI1ssel7oI4+aLMm6kR8r9jiChnZ/OifavEs/h4MV8LYmWGIxsa1oloeJwPdnq" +
+		"wRjau6RslpSHNB6dvWH3au6VgXVdwkNiJ6v4Ni5lunFKy8vwnqGNxySETm6DYuhWfPaBC5JXk8fxp2FcUt3vHmwmiuUTBVq61BER" +
+		"wfsVIg7X2KZ2CkAmXikIBRzCNUfkx+6it1XZpNp2y3HVdEstjTZHVtJ343rGG3hGv6ax1yALo+tkCZKOSFF8iUek1eq+6dk2eA7E" +
+		"1UmH9vORmlzxKsaHhY8gNCVMt62I0rZRv+Oj2FhQkLIYaJmfzj+OGz3Y9ybE2j6vKh8LfvypRyBHhIJl0uYPHp/RB1qUDH9SaD8c" +
+		"5PeEcJjAKvPR5+GYpfNSTnw9pMV6YtHVkTw95c0l35hpqsgI0CJbNo+efCGfggkc89bldY7apND0DX8ThlYoMoZ3pXSp2wDTvSlu" +
+		"neQRPExz8bfS8OMyCdc5onjiY5RINWPD2pCKqyoSAOn0OI15WQOPaAzpD7/oD1y2XMTLlse5l5HnRlBsDXIdR9iF0bhNXsxnvFDL" +
+		"7BeWZI+QM3pu1wueIr0Y/PAaJsmUMmA1Qk0w1x6qmnPJmkcIB0XxduU5qeBqMyfytDSmrf7RcrPvuS8gf7LWlI4JvQ5Bgk++6rMg" +
+		"jjTKK81jsbvdIJGYuQSBkzX7eEw9HyXxnMWcDEm7AezZYSfidCFdvzsICVdS5BE6JI+C4vQtAe9HgyH96vViWOI4Pe7xyFq4MV5U" +
+		"EEDccfNypluPCRhZjVtePJvcBxTygbziE07lQ64c7tB6/Da1xr8btD01KkJhtBh61n33VQZ+lqRTJTbnpkn7tta5I2DvZclD7tva" +
+		"4ZaFZIdZ2C9BXsvXAPKanlFTYfoTmQ9Xy9p8PYfLnTv1yRfk5QfEQHPIv/i3nOvr8C2wbf5HscuiIwbcCgCFgEFkEi6RqiGVF0Fb" +
+		"mkrrP0dvY8y6sSBO2rDLn2x/INXbKdY6k6ODqfXk+gjYQj5NZoouz0cRJvOOHWz2slMsZd60Httdjcb/ZSYzmTUp9/49QeMl0QZY" +
+		"HDaFA8mD/hZE6aLJ8eiN7qwCAdqDadMo/LPFOlj9qRGZZuxug+iThmEQBe3rG/gYgjIFnzdMZen27FpRhdLrupjKRY1722ZNGPWw" +
+		"PWYwRwYaaSeH94j7tttOZpvDco4ycrt4qk+9NMy5tEE2mIEwggWEBgkqhkiG9w0BBwGgggV1BIIFcTCCBW0wggVpBgsqhkiG9w0B" +
+		"DAoBAqCCBTEwggUtMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAidv8vjSefk2AICCAAwDAYIKoZIhvcNAgkFADAdBglg" +
+		"hkgBZQMEASoEEPr9Ov8V4Rn9lWeKt+mqO4oEggTQyieMXPcPxS0Y9DkmfABTKaxwngUGiAX+r+LBHeRleKb7gQKmOiVWhPKfnYk/" +
+		"lPxbqfCzy4+aOBtF7xtUKOjA32amWMdsX3Fg411ix2u7woORL2sbG8nlGX6Fs5LNE63DLvstKgp0XFKTNJBhU4qWPc2+1+SA5Id3" +
+		"+fP+2VLA1Jmjnuh1qflW80XN9+dwH/e2ISb37e1Zg18AeW2vk8/a2i8lWeCEn8aZg+lwg+bvB8X4cmixNwe2jEiLcTu5zXOtlZk7" +
+		"zNLkhydYB5DhnK7k8l8jW7pKoBZu2/Zxx2MPulsX0hK9FmTpgGctzOuhXXx+xJVzU873Yjd0pbdjp9J8wbTfPYUSg0/igdLdzR50" +
+		"7K7Q/gFwwxMju18/h6GxvubAtauaGRqfD4O8zx5fHbrvZ8g8mKSwmh0Qzu4cEejHULryxN5Suw+9LUZtrHiuBYjogQG6cDzkFWAt" +
+		"mViznXrxgkLRv/Gu+v7IvK2ZirDXu4P5dxiEg93wEjMegP6LFww5PZAHdCDrWzVN1AALwYHCF5iPkKPDjJJc+CWglw7n5H6nZmPm" +
+		"Fo5UZsRtnucECRELiBMwpTUtaP3LvtmKUkGIpRJIvsMgoIdCAHkmmstd4F2l0c6cf2QlaWaCq+iqEz9ML8hlWnIk0en+mNg6hRM5" +
+		"BOxaDuNa1dk21M/JX/txsXAD143aD/FTl4G+5bGAzoXnaNBjgQdvDXupKsZa/5lCQ6mR/nvs/Bt+pvEpXjeQCuXHVb1/0dhe2xRC" +
+		"5daQJDdPCkZXXhPCMobSbO/4NfhZY3SrbVx9gHSl8H72f/ObfrOcHtGFwd+ciU9bO5JrzCYu+6HZFsiZ2Dsj/GpoX8lK6hsHRpWp" +
+		"MVZqKGOAO4OnEi0/b0Of9rImId8zL2jENyltg22wC1Gi7md0j2S4m+hJL1E3BqpWFO3rkdUORr8WYHctzL/PitbzDugAvYgOO08u" +
+		"vfUVwUJLG4y+3Vq/Sd01O3kAqn8WUodyMygcDOSQbARYv5OKn5TIM08FKo2YJZELicswRMqWIq1HRHsepoLI3C2tBSXAl6gQyuWn" +
+		"H4/stHj7V1RAc3NPnz30CwCAzTtTxJke8XQ3+7U4BRpYmzxXJR1KZdXBTZiLhIbSLRFJyddlKz/CY0nb6u+UlTl+a2vx5PwZ0FVa" +
+		"9zemA5K1ga0anff+naAev4tTsdsljM/UbNkDGb9WQ+GKIeFtDcj6uxl0kvNloADn3Gw+nEb6t9log6Kkbj2ME3kJ2MgyqMSyM8UC" +
+		"AS6O9VXhpfS4DguByRNYv7eaAZQ6pV9LHZo65FrlPYu85oPFnYfVf8wUIEbwHebGYTb+pw7DxzG1I/8piK3/cpy9q0iWiWHm9SHP" +
+		"KDse1T+PSmehysOtWpiWmN8SgCjWJ0p7k1lW68WkXunHAgvGVjQrKyzsj5w7q107NPsBbji27qRxDvzlSjn1S6YGnTeDu5oK3++Z" +
+		"kFohMXZ6ofy60lJqDln2B35DAyExhhl07h5jw5n28fAzptCpfxtTw2lM6vAuRJszh6+ewZeGGf8C9usjwqRQe6145+UMEo7qMjI7" +
+		"rltk0VhlW5AfDge8bzsd+Ij/Hom5++4xZRY1naxov3PpGh89wRvobG0zruaiN1Cl87/8g2dinlr1wSnVQYAxJTAjBgkqhkiG9w0B" +
+		"CRUxFgQUXTi6Y156D8/zptgXWO4jhJr0mhcwQTAxMA0GCWCGSAFlAwQCAQUABCB/yBuU9jDvfwpDrua5XMwaaQ2u2uJa+5n1wDXp" +
+		"jnnd6QQIcKUj3bW5YKUCAggA"
+)
+
+func decodePFX(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func setupStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.DigitalCertificate{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return New(db, testKeyring(t, testKey))
+}
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func testKeyring(t *testing.T, keys ...string) *secrets.Keyring {
+	t.Helper()
+	var raw [][]byte
+	for _, k := range keys {
+		key, err := secrets.ParseKey(k)
+		if err != nil {
+			t.Fatalf("ParseKey() error = %v", err)
+		}
+		raw = append(raw, key)
+	}
+	keyring, err := secrets.NewKeyring(raw[0], raw[1:]...)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return keyring
+}
+
+func TestParsePFX(t *testing.T) {
+	tests := []struct {
+		name     string
+		pfx      string
+		password string
+		wantErr  error
+	}{
+		{"PFX 3DES", testPFXLegacy, "senha123", nil},
+		{"senha errada", testPFXLegacy, "errada", ErrInvalidPassword},
+		{"PFX AES do OpenSSL 3", testPFXModern, "senha123", ErrUnsupportedPFX},
+		{"arquivo qualquer", base64.StdEncoding.EncodeToString([]byte("não é um PFX")), "senha123", ErrInvalidPFX},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParsePFX(decodePFX(t, tt.pfx), tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePFX() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && xmldsig.CertificateCNPJ(parsed.Leaf) != "12345678000195" {
+				t.Errorf("CNPJ = %q", xmldsig.CertificateCNPJ(parsed.Leaf))
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := setupStore(t)
+
+	if _, err := s.TLSCertificate(); !errors.Is(err, ErrNoCertificate) {
+		t.Fatalf("TLSCertificate() sem certificado error = %v, want %v", err, ErrNoCertificate)
+	}
+
+	cert, err := s.Upload(decodePFX(t, testPFXLegacy), "senha123", nil)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if cert.CNPJ != "12345678000195" || !cert.Active || len(cert.Fingerprint) != 64 {
+		t.Errorf("Upload() = %+v", cert)
+	}
+
+	// Reenviar o mesmo PFX reativa o registro em vez de duplicar
+	if again, err := s.Upload(decodePFX(t, testPFXLegacy), "senha123", nil); err != nil || again.ID != cert.ID {
+		t.Errorf("Upload() repetido = %v, %v; want ID %d", again, err, cert.ID)
+	}
+
+	var stored models.DigitalCertificate
+	s.DB.First(&stored, cert.ID)
+	if len(stored.EncryptedData) == 0 {
+		t.Fatal("certificado gravado sem conteúdo cifrado")
+	}
+
+	id := "ID2102103524011234567800019555001000001234112345678501"
+	signed, err := s.Sign([]byte(`<evento xmlns="http://www.portalfiscal.inf.br/nfe"><infEvento Id="`+id+`"><tpEvento>210210</tpEvento></infEvento></evento>`), id)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	result, err := xmldsig.VerifyEnveloped(signed, id)
+	if err != nil || result.Signer.CNPJ != "12345678000195" {
+		t.Errorf("VerifyEnveloped() = %+v, %v", result, err)
+	}
+
+	// Outra chave não decifra o conteúdo gravado
+	other := New(s.DB, testKeyring(t, strings.Repeat("ff", 32)))
+	if _, err := other.TLSCertificate(); err == nil {
+		t.Error("TLSCertificate() com outra chave error = nil")
+	}
+
+	if _, err := s.Delete(cert.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.TLSCertificate(); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("TLSCertificate() após remoção error = %v, want %v", err, ErrNoCertificate)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s := setupStore(t)
+	cert, err := s.Upload(decodePFX(t, testPFXLegacy), "senha123", nil)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	// Nova chave atual, com a anterior mantida só para leitura
+	newKey := strings.Repeat("ab", 32)
+	rotated := New(s.DB, testKeyring(t, newKey, testKey))
+	if n, err := rotated.Rotate(); n != 1 || err != nil {
+		t.Fatalf("Rotate() = %d, %v; want 1", n, err)
+	}
+	if n, err := rotated.Rotate(); n != 0 || err != nil {
+		t.Errorf("Rotate() repetido = %d, %v; want 0", n, err)
+	}
+
+	// Depois da rotação a chave anterior pode ser descartada
+	onlyNew := New(s.DB, testKeyring(t, newKey))
+	if _, err := onlyNew.TLSCertificate(); err != nil {
+		t.Errorf("TLSCertificate() com a nova chave error = %v", err)
+	}
+	if _, err := s.TLSCertificate(); err == nil {
+		t.Error("TLSCertificate() com a chave antiga após a rotação error = nil")
+	}
+
+	var stored models.DigitalCertificate
+	s.DB.First(&stored, cert.ID)
+	if !stored.UpdatedAt.Equal(cert.UpdatedAt) {
+		t.Errorf("UpdatedAt alterado pela rotação: %v -> %v", cert.UpdatedAt, stored.UpdatedAt)
+	}
+}
+
+func TestUploadWithoutKey(t *testing.T) {
+	s := setupStore(t)
+	s.keys = nil
+	if _, err := s.Upload(decodePFX(t, testPFXLegacy), "senha123", nil); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("Upload() sem chave error = %v, want %v", err, ErrNoEncryption)
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	s := setupStore(t)
+	if sent, err := s.CheckExpiry(time.Now()); sent || err != nil {
+		t.Fatalf("CheckExpiry() sem certificado = %v, %v", sent, err)
+	}
+
+	cert, err := s.Upload(decodePFX(t, testPFXLegacy), "senha123", nil)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"longe do vencimento", cert.NotAfter.Add(-90 * 24 * time.Hour), false},
+		{"dentro do prazo de aviso", cert.NotAfter.Add(-10 * 24 * time.Hour), true},
+		{"mesmo dia do último aviso", cert.NotAfter.Add(-10*24*time.Hour + time.Hour), false},
+		{"dia seguinte", cert.NotAfter.Add(-9 * 24 * time.Hour), true},
+		{"vencido", cert.NotAfter.Add(24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent, err := s.CheckExpiry(tt.now)
+			if err != nil {
+				t.Fatalf("CheckExpiry() error = %v", err)
+			}
+			if sent != tt.want {
+				t.Errorf("CheckExpiry() = %v, want %v", sent, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package danfe
+
+import "errors"
+
+// Larguras de barra/espaço (em módulos) dos 107 símbolos do Code 128; o último é o stop
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128CodeB  = 100
+	code128CodeC  = 99
+	code128Stop   = 106
+)
+
+var (
+	ErrBarcodeCharset = errors.New("caractere não suportado pelo Code 128 (conjuntos B/C)")
+	ErrBarcodeEmpty   = errors.New("conteúdo do código de barras vazio")
+)
+
+// code128Symbols codifica o texto em valores de símbolo (start, dados, checksum e stop).
+// Sequências de quatro ou mais dígitos usam o conjunto C (dois dígitos por símbolo),
+// o que deixa a chave de acesso de 44 dígitos com apenas 22 símbolos de dados.
+func code128Symbols(data string) ([]int, error) {
+	for _, c := range []byte(data) {
+		if c < 32 || c > 126 {
+			return nil, ErrBarcodeCharset
+		}
+	}
+
+	var symbols []int
+	set := 0
+	for i := 0; i < len(data); {
+		run := digitRun(data, i)
+		if run >= 4 || (set == code128CodeC && run >= 2) {
+			if run%2 == 1 && set != code128CodeC {
+				// O dígito ímpar fica no conjunto B para o restante entrar em pares
+				set = switchSet(&symbols, set, code128CodeB, code128StartB)
+				symbols = append(symbols, int(data[i])-32)
+				i++
+				run--
+			}
+			set = switchSet(&symbols, set, code128CodeC, code128StartC)
+			for ; run >= 2; run -= 2 {
+				symbols = append(symbols, int(data[i]-'0')*10+int(data[i+1]-'0'))
+				i += 2
+			}
+			continue
+		}
+
+		set = switchSet(&symbols, set, code128CodeB, code128StartB)
+		symbols = append(symbols, int(data[i])-32)
+		i++
+	}
+	if len(symbols) == 0 {
+		return nil, ErrBarcodeEmpty
+	}
+
+	checksum := symbols[0]
+	for i, s := range symbols[1:] {
+		checksum += s * (i + 1)
+	}
+	symbols = append(symbols, checksum%103, code128Stop)
+	return symbols, nil
+}
+
+// switchSet emite o start (no início) ou a troca de conjunto necessária
+func switchSet(symbols *[]int, current, target, start int) int {
+	if current == target {
+		return current
+	}
+	if current == 0 {
+		*symbols = append(*symbols, start)
+	} else {
+		*symbols = append(*symbols, target)
+	}
+	return target
+}
+
+func digitRun(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// code128Modules devolve as larguras alternadas barra/espaço (começando por barra),
+// já com o stop, em módulos
+func code128Modules(data string) ([]int, error) {
+	symbols, err := code128Symbols(data)
+	if err != nil {
+		return nil, err
+	}
+	var modules []int
+	for _, s := range symbols {
+		for _, c := range code128Patterns[s] {
+			modules = append(modules, int(c-'0'))
+		}
+	}
+	return modules, nil
+}
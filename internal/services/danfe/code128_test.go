@@ -0,0 +1,86 @@
+package danfe
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	seen := make(map[string]int)
+	for i, p := range code128Patterns {
+		want := 11
+		if i == code128Stop {
+			want = 13
+		}
+		sum := 0
+		for _, c := range p {
+			sum += int(c - '0')
+		}
+		if sum != want {
+			t.Errorf("padrão %d (%s) soma %d módulos, esperado %d", i, p, sum, want)
+		}
+		if prev, ok := seen[p]; ok {
+			t.Errorf("padrão %d repete o padrão %d", i, prev)
+		}
+		seen[p] = i
+	}
+}
+
+func TestCode128Symbols(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []int
+	}{
+		{"somente dígitos em pares", "1234", []int{105, 12, 34, 82, 106}},
+		{"texto curto no conjunto B", "AB", []int{104, 33, 34, 102, 106}},
+		{"dígito ímpar antes do conjunto C", "12345", []int{104, 17, 99, 23, 45, 53, 106}},
+		{"poucos dígitos ficam no conjunto B", "A12", []int{104, 33, 17, 18, 19, 106}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := code128Symbols(tt.data)
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("code128Symbols(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCode128AccessKey(t *testing.T) {
+	key := "35240112345678000195550010000012341000012345"
+	symbols, err := code128Symbols(key)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	// Start C + 22 pares + checksum + stop
+	if len(symbols) != 25 || symbols[0] != code128StartC || symbols[24] != code128Stop {
+		t.Errorf("símbolos = %v", symbols)
+	}
+
+	modules, err := code128Modules(key)
+	if err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	total := 0
+	for _, m := range modules {
+		total += m
+	}
+	if total != 24*11+13 {
+		t.Errorf("total de módulos = %d, esperado %d", total, 24*11+13)
+	}
+}
+
+func TestCode128Errors(t *testing.T) {
+	if _, err := code128Symbols(""); !errors.Is(err, ErrBarcodeEmpty) {
+		t.Errorf("vazio: err = %v", err)
+	}
+	if _, err := code128Symbols("chave\n"); !errors.Is(err, ErrBarcodeCharset) {
+		t.Errorf("controle: err = %v", err)
+	}
+}
@@ -0,0 +1,573 @@
+// Package danfe gera o DANFE (Documento Auxiliar da NF-e) em PDF a partir do
+// XML autorizado, sem dependências externas nem acesso à rede.
+package danfe
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"fmt"
+	"strings"
+)
+
+// Medidas do layout retrato, em pontos
+const (
+	margin       = 14.0
+	contentWidth = pageWidth - 2*margin
+
+	stubHeight       = 50.0  // Canhoto de recebimento
+	headerHeight     = 160.0 // Emitente, DANFE, chave e linhas de natureza/IE
+	sectionTitle     = 9.0
+	fieldHeight      = 20.0
+	tableHeader      = 18.0
+	itemLineHeight   = 7.0
+	additionalHeight = 80.0
+)
+
+var ErrInvalidNfe = errors.New("XML sem chave de acesso ou identificação da NF-e")
+
+// Options ajusta a impressão
+type Options struct {
+	Cancelled bool // Imprime a tarja de NF-e cancelada
+}
+
+// Render gera o PDF do DANFE em A4 retrato. Os itens que não cabem na primeira
+// folha continuam nas seguintes, que repetem o cabeçalho e o título da tabela.
+func Render(proc *models.NfeProc, opts Options) ([]byte, error) {
+	r := &renderer{pdf: newPDFWriter(), proc: proc, inf: &proc.NFe.InfNFe, opts: opts}
+	r.key = digits(proc.ProtNFe.InfProt.ChNFe)
+	if len(r.key) != 44 {
+		r.key = digits(strings.TrimPrefix(r.inf.ID, "NFe"))
+	}
+	if len(r.key) != 44 || r.inf.Ide.NNF == "" {
+		return nil, ErrInvalidNfe
+	}
+
+	r.prepareItems()
+	pages := r.paginate()
+
+	for i, rows := range pages {
+		r.pdf.addPage()
+		y := margin
+		if i == 0 {
+			r.drawStub(y)
+			y += stubHeight + 12
+		}
+		y = r.drawHeader(y, i+1, len(pages))
+		if i == 0 {
+			y = r.drawRecipient(y)
+			y = r.drawTotals(y)
+			y = r.drawCarrier(y)
+			r.drawItems(y, rows, firstPageItemsBottom())
+			r.drawAdditional()
+		} else {
+			r.drawItems(y, rows, pageHeight-margin)
+		}
+		r.drawWatermark()
+	}
+	return r.pdf.bytes()
+}
+
+type renderer struct {
+	pdf  *pdfWriter
+	proc *models.NfeProc
+	inf  *models.InfNFe
+	opts Options
+	key  string
+	rows []itemRow
+}
+
+// itemRow é um item já formatado, com a descrição quebrada em linhas
+type itemRow struct {
+	cells []string
+	desc  []string
+}
+
+func (r itemRow) height() float64 {
+	return float64(len(r.desc))*itemLineHeight + 3
+}
+
+type column struct {
+	title string
+	width float64
+	align byte
+}
+
+// Colunas da tabela de produtos (somam a largura útil da página)
+var itemColumns = []column{
+	{"CÓDIGO", 50, 'L'},
+	{"DESCRIÇÃO DO PRODUTO / SERVIÇO", 0, 'L'}, // Ocupa o espaço restante
+	{"NCM/SH", 38, 'C'},
+	{"CST", 22, 'C'},
+	{"CFOP", 24, 'C'},
+	{"UN", 22, 'C'},
+	{"QUANT.", 40, 'R'},
+	{"V. UNIT.", 42, 'R'},
+	{"V. TOTAL", 45, 'R'},
+	{"BC ICMS", 40, 'R'},
+	{"V. ICMS", 34, 'R'},
+	{"V. IPI", 30, 'R'},
+	{"ALÍQ. ICMS", 20, 'R'},
+	{"ALÍQ. IPI", 20, 'R'},
+}
+
+const descColumn = 1
+
+func columnWidths() []float64 {
+	widths := make([]float64, len(itemColumns))
+	used := 0.0
+	for i, c := range itemColumns {
+		widths[i] = c.width
+		used += c.width
+	}
+	widths[descColumn] = contentWidth - used
+	return widths
+}
+
+func (r *renderer) prepareItems() {
+	widths := columnWidths()
+	r.pdf.setFont(false, 6)
+	for _, det := range r.inf.Det {
+		icms := det.Imposto.ICMS.Grupo
+		ipi := det.Imposto.IPI.IPITrib
+		cst := icms.Situacao()
+		if cst != "" {
+			cst = icms.Orig + cst
+		}
+
+		desc := r.pdf.wrap(joinNonEmpty("\n", det.Prod.XProd, det.InfAdProd), widths[descColumn]-4)
+		if len(desc) == 0 {
+			desc = []string{""}
+		}
+		r.rows = append(r.rows, itemRow{
+			desc: desc,
+			cells: []string{
+				det.Prod.CProd,
+				"",
+				det.Prod.NCM,
+				cst,
+				det.Prod.CFOP,
+				det.Prod.UCom,
+				formatDecimal(det.Prod.QCom, 4),
+				formatUnitPrice(det.Prod.VUnCom),
+				formatMoney(det.Prod.VProd),
+				formatMoney(icms.VBC),
+				formatMoney(icms.VICMS),
+				formatMoney(ipi.VIPI),
+				formatDecimal(icms.PICMS, 2),
+				formatDecimal(ipi.PIPI, 2),
+			},
+		})
+	}
+}
+
+// firstPageItemsTop é onde começam as linhas de itens na primeira folha
+func firstPageItemsTop() float64 {
+	return margin + stubHeight + 12 + headerHeight + 3*sectionTitle + 3*fieldHeight + 2*fieldHeight + 2*fieldHeight + sectionTitle + tableHeader
+}
+
+// firstPageItemsBottom deixa espaço para os dados adicionais no pé da primeira folha
+func firstPageItemsBottom() float64 {
+	return pageHeight - margin - additionalHeight - sectionTitle - 2
+}
+
+// paginate distribui os itens pelas folhas de acordo com a altura de cada linha
+func (r *renderer) paginate() [][]itemRow {
+	nextTop := margin + headerHeight + sectionTitle + tableHeader
+	nextBottom := pageHeight - margin
+
+	var pages [][]itemRow
+	var current []itemRow
+	y, bottom := firstPageItemsTop(), firstPageItemsBottom()
+	for _, row := range r.rows {
+		if y+row.height() > bottom && len(current) > 0 {
+			pages = append(pages, current)
+			current = nil
+			y, bottom = nextTop, nextBottom
+		}
+		current = append(current, row)
+		y += row.height()
+	}
+	return append(pages, current)
+}
+
+// field desenha uma caixa com o rótulo no topo e o valor embaixo
+func (r *renderer) field(x, y, w, h float64, label, value string, align byte) {
+	r.pdf.rect(x, y, w, h)
+	r.pdf.setFont(false, 5)
+	r.pdf.textAligned(x+2, y+6, w-4, label, 'L')
+	r.pdf.setFont(true, 7.5)
+	r.pdf.textAligned(x+2, y+h-4, w-4, value, align)
+}
+
+type cell struct {
+	label  string
+	value  string
+	weight float64
+	align  byte
+}
+
+// fieldRow desenha uma linha de campos com larguras proporcionais aos pesos
+func (r *renderer) fieldRow(y float64, cells ...cell) float64 {
+	total := 0.0
+	for _, c := range cells {
+		total += c.weight
+	}
+	x := margin
+	for _, c := range cells {
+		w := contentWidth * c.weight / total
+		r.field(x, y, w, fieldHeight, c.label, c.value, c.align)
+		x += w
+	}
+	return y + fieldHeight
+}
+
+func (r *renderer) section(y float64, title string) float64 {
+	r.pdf.setFont(true, 6.5)
+	r.pdf.text(margin, y+7, title)
+	return y + sectionTitle
+}
+
+func (r *renderer) drawStub(y float64) {
+	ide := r.inf.Ide
+	emissao, _ := splitDateTime(emissionDate(ide))
+	r.pdf.rect(margin, y, contentWidth, stubHeight)
+
+	numberWidth := 100.0
+	textWidth := contentWidth - numberWidth
+	r.pdf.setFont(false, 6)
+	lines := r.pdf.wrap(fmt.Sprintf("RECEBEMOS DE %s OS PRODUTOS E/OU SERVIÇOS CONSTANTES DA NOTA FISCAL ELETRÔNICA INDICADA AO LADO. "+
+		"EMISSÃO: %s VALOR TOTAL: R$ %s DESTINATÁRIO: %s",
+		strings.ToUpper(r.inf.Emit.XNome), emissao, formatMoney(r.inf.Total.ICMSTot.VNF), r.inf.Dest.XNome), textWidth-4)
+	for i, l := range lines {
+		if i == 2 {
+			break
+		}
+		r.pdf.text(margin+2, y+8+float64(i)*7, l)
+	}
+	r.pdf.line(margin, y+22, margin+textWidth, y+22)
+	r.field(margin, y+22, 120, stubHeight-22, "DATA DE RECEBIMENTO", "", 'L')
+	r.field(margin+120, y+22, textWidth-120, stubHeight-22, "IDENTIFICAÇÃO E ASSINATURA DO RECEBEDOR", "", 'L')
+
+	x := margin + textWidth
+	r.pdf.rect(x, y, numberWidth, stubHeight)
+	r.pdf.setFont(true, 10)
+	r.pdf.textAligned(x, y+14, numberWidth, "NF-e", 'C')
+	r.pdf.setFont(true, 8)
+	r.pdf.textAligned(x, y+28, numberWidth, "Nº "+formatNumber(ide.NNF), 'C')
+	r.pdf.textAligned(x, y+40, numberWidth, "SÉRIE "+ide.Serie, 'C')
+
+	// Linha de corte
+	r.pdf.setDash(3, 2)
+	r.pdf.line(margin, y+stubHeight+6, margin+contentWidth, y+stubHeight+6)
+	r.pdf.setDash(0, 0)
+}
+
+func (r *renderer) drawHeader(y float64, page, pages int) float64 {
+	emit := r.inf.Emit
+	ide := r.inf.Ide
+	const boxHeight = 120.0
+	emitWidth, danfeWidth := 227.0, 100.0
+	keyWidth := contentWidth - emitWidth - danfeWidth
+
+	// Identificação do emitente
+	r.pdf.rect(margin, y, emitWidth, boxHeight)
+	r.pdf.setFont(false, 5)
+	r.pdf.text(margin+2, y+6, "IDENTIFICAÇÃO DO EMITENTE")
+	r.pdf.setFont(true, 9)
+	ly := y + 24
+	for i, l := range r.pdf.wrap(emit.XNome, emitWidth-8) {
+		if i == 2 {
+			break
+		}
+		r.pdf.textAligned(margin+4, ly, emitWidth-8, l, 'C')
+		ly += 11
+	}
+	addr := emit.EnderEmit
+	r.pdf.setFont(false, 7)
+	ly += 6
+	for _, l := range []string{
+		joinNonEmpty(", ", addr.XLgr, addr.Nro, addr.XCpl),
+		joinNonEmpty(" - ", addr.XBairro, formatCEP(addr.CEP)),
+		joinNonEmpty(" - ", addr.XMun, addr.UF),
+		joinNonEmpty(" ", "Fone:", addr.Fone),
+	} {
+		if l == "Fone:" {
+			continue
+		}
+		r.pdf.textAligned(margin+4, ly, emitWidth-8, l, 'C')
+		ly += 9
+	}
+
+	// Quadro DANFE
+	x := margin + emitWidth
+	r.pdf.rect(x, y, danfeWidth, boxHeight)
+	r.pdf.setFont(true, 14)
+	r.pdf.textAligned(x, y+18, danfeWidth, "DANFE", 'C')
+	r.pdf.setFont(false, 6.5)
+	r.pdf.textAligned(x, y+28, danfeWidth, "Documento Auxiliar da", 'C')
+	r.pdf.textAligned(x, y+36, danfeWidth, "Nota Fiscal Eletrônica", 'C')
+	r.pdf.text(x+8, y+52, "0 - ENTRADA")
+	r.pdf.text(x+8, y+61, "1 - SAÍDA")
+	r.pdf.rect(x+70, y+46, 18, 18)
+	r.pdf.setFont(true, 11)
+	r.pdf.textAligned(x+70, y+59, 18, ide.TpNF, 'C')
+	r.pdf.setFont(true, 8)
+	r.pdf.textAligned(x, y+82, danfeWidth, "Nº "+formatNumber(ide.NNF), 'C')
+	r.pdf.textAligned(x, y+93, danfeWidth, "SÉRIE "+ide.Serie, 'C')
+	r.pdf.textAligned(x, y+104, danfeWidth, fmt.Sprintf("FOLHA %d/%d", page, pages), 'C')
+
+	// Código de barras, chave e consulta
+	x += danfeWidth
+	r.pdf.rect(x, y, keyWidth, 45)
+	r.drawBarcode(x+8, y+5, keyWidth-16, 35)
+	r.field(x, y+45, keyWidth, 22, "CHAVE DE ACESSO", formatKey(r.key), 'C')
+	r.pdf.rect(x, y+67, keyWidth, boxHeight-67)
+	r.pdf.setFont(false, 7)
+	r.pdf.textAligned(x, y+84, keyWidth, "Consulta de autenticidade no portal nacional da NF-e", 'C')
+	r.pdf.setFont(true, 7)
+	r.pdf.textAligned(x, y+94, keyWidth, "www.nfe.fazenda.gov.br/portal", 'C')
+	r.pdf.setFont(false, 7)
+	r.pdf.textAligned(x, y+104, keyWidth, "ou no site da Sefaz Autorizadora", 'C')
+	y += boxHeight
+
+	prot := r.proc.ProtNFe.InfProt
+	protDate, protTime := splitDateTime(prot.DhRecbto)
+	y = r.fieldRow(y,
+		cell{"NATUREZA DA OPERAÇÃO", ide.NatOp, emitWidth + danfeWidth, 'L'},
+		cell{"PROTOCOLO DE AUTORIZAÇÃO DE USO", joinNonEmpty(" - ", prot.NProt, joinNonEmpty(" ", protDate, protTime)), keyWidth, 'C'},
+	)
+	return r.fieldRow(y,
+		cell{"INSCRIÇÃO ESTADUAL", emit.IE, 1, 'L'},
+		cell{"INSCRIÇÃO ESTADUAL DO SUBST. TRIB.", emit.IEST, 1, 'L'},
+		cell{"CNPJ / CPF", formatDocument(joinNonEmpty("", emit.CNPJ, emit.CPF)), 1, 'L'},
+	)
+}
+
+// drawBarcode desenha a chave de acesso em Code 128 ocupando a largura w
+func (r *renderer) drawBarcode(x, y, w, h float64) {
+	modules, err := code128Modules(r.key)
+	if err != nil {
+		return
+	}
+	total := 0
+	for _, m := range modules {
+		total += m
+	}
+	unit := w / float64(total)
+	r.pdf.setGray(0)
+	for i, m := range modules {
+		width := float64(m) * unit
+		if i%2 == 0 {
+			r.pdf.fillRect(x, y, width, h)
+		}
+		x += width
+	}
+}
+
+func (r *renderer) drawRecipient(y float64) float64 {
+	dest := r.inf.Dest
+	addr := dest.EnderDest
+	ide := r.inf.Ide
+	emissao, _ := splitDateTime(emissionDate(ide))
+	saiEnt, saiEntTime := splitDateTime(ide.DhSaiEnt)
+
+	y = r.section(y, "DESTINATÁRIO / REMETENTE")
+	y = r.fieldRow(y,
+		cell{"NOME / RAZÃO SOCIAL", dest.XNome, 6, 'L'},
+		cell{"CNPJ / CPF", formatDocument(joinNonEmpty("", dest.CNPJ, dest.CPF, dest.IDEstrang)), 2.5, 'L'},
+		cell{"DATA DA EMISSÃO", emissao, 1.5, 'C'},
+	)
+	y = r.fieldRow(y,
+		cell{"ENDEREÇO", joinNonEmpty(", ", addr.XLgr, addr.Nro, addr.XCpl), 5, 'L'},
+		cell{"BAIRRO / DISTRITO", addr.XBairro, 2.5, 'L'},
+		cell{"CEP", formatCEP(addr.CEP), 1, 'C'},
+		cell{"DATA DA SAÍDA/ENTRADA", saiEnt, 1.5, 'C'},
+	)
+	return r.fieldRow(y,
+		cell{"MUNICÍPIO", addr.XMun, 4, 'L'},
+		cell{"UF", addr.UF, 0.6, 'C'},
+		cell{"FONE / FAX", addr.Fone, 1.9, 'L'},
+		cell{"INSCRIÇÃO ESTADUAL", dest.IE, 2, 'L'},
+		cell{"HORA DA SAÍDA/ENTRADA", saiEntTime, 1.5, 'C'},
+	)
+}
+
+func (r *renderer) drawTotals(y float64) float64 {
+	t := r.inf.Total.ICMSTot
+	y = r.section(y, "CÁLCULO DO IMPOSTO")
+	y = r.fieldRow(y,
+		cell{"BASE DE CÁLC. DO ICMS", formatMoney(t.VBC), 1, 'R'},
+		cell{"VALOR DO ICMS", formatMoney(t.VICMS), 1, 'R'},
+		cell{"BASE DE CÁLC. ICMS S.T.", formatMoney(t.VBCST), 1, 'R'},
+		cell{"VALOR DO ICMS SUBST.", formatMoney(t.VST), 1, 'R'},
+		cell{"V. TOTAL PRODUTOS", formatMoney(t.VProd), 1, 'R'},
+	)
+	return r.fieldRow(y,
+		cell{"VALOR DO FRETE", formatMoney(t.VFrete), 1, 'R'},
+		cell{"VALOR DO SEGURO", formatMoney(t.VSeg), 1, 'R'},
+		cell{"DESCONTO", formatMoney(t.VDesc), 1, 'R'},
+		cell{"OUTRAS DESPESAS", formatMoney(t.VOutro), 1, 'R'},
+		cell{"VALOR TOTAL IPI", formatMoney(t.VIPI), 1, 'R'},
+		cell{"V. TOTAL DA NOTA", formatMoney(t.VNF), 1, 'R'},
+	)
+}
+
+func (r *renderer) drawCarrier(y float64) float64 {
+	tr := r.inf.Transp
+	carrier := tr.Transporta
+
+	var qVol float64
+	var esp, marca string
+	var pesoL, pesoB float64
+	for _, v := range tr.Vol {
+		qVol += v.QVol
+		pesoL += v.PesoL
+		pesoB += v.PesoB
+		if esp == "" {
+			esp = v.Esp
+		}
+		if marca == "" {
+			marca = v.Marca
+		}
+	}
+
+	y = r.section(y, "TRANSPORTADOR / VOLUMES TRANSPORTADOS")
+	y = r.fieldRow(y,
+		cell{"NOME / RAZÃO SOCIAL", carrier.XNome, 4, 'L'},
+		cell{"FRETE POR CONTA", freightLabel(tr.ModFrete), 2, 'L'},
+		cell{"CNPJ / CPF", formatDocument(joinNonEmpty("", carrier.CNPJ, carrier.CPF)), 2, 'L'},
+		cell{"INSCRIÇÃO ESTADUAL", carrier.IE, 1.6, 'L'},
+		cell{"UF", carrier.UF, 0.6, 'C'},
+	)
+	return r.fieldRow(y,
+		cell{"ENDEREÇO / MUNICÍPIO", joinNonEmpty(" - ", carrier.XEnder, carrier.XMun), 3.4, 'L'},
+		cell{"QUANTIDADE", formatDecimal(qVol, 0), 1, 'R'},
+		cell{"ESPÉCIE", esp, 1.4, 'L'},
+		cell{"MARCA", marca, 1.4, 'L'},
+		cell{"PESO BRUTO", formatDecimal(pesoB, 3), 1.5, 'R'},
+		cell{"PESO LÍQUIDO", formatDecimal(pesoL, 3), 1.5, 'R'},
+	)
+}
+
+func (r *renderer) drawItems(y float64, rows []itemRow, bottom float64) {
+	widths := columnWidths()
+	y = r.section(y, "DADOS DOS PRODUTOS / SERVIÇOS")
+
+	// Título das colunas, em até duas linhas
+	r.pdf.setFont(false, 5)
+	x := margin
+	for i, c := range itemColumns {
+		r.pdf.rect(x, y, widths[i], tableHeader)
+		lines := r.pdf.wrap(c.title, widths[i]-2)
+		ly := y + 8
+		if len(lines) == 1 {
+			ly = y + 11
+		}
+		for _, l := range lines {
+			r.pdf.textAligned(x+1, ly, widths[i]-2, l, 'C')
+			ly += 6
+		}
+		x += widths[i]
+	}
+	y += tableHeader
+
+	top := y
+	r.pdf.setFont(false, 6)
+	for _, row := range rows {
+		x = margin
+		for i, c := range itemColumns {
+			if i == descColumn {
+				for j, l := range row.desc {
+					r.pdf.text(x+2, y+7+float64(j)*itemLineHeight, l)
+				}
+			} else {
+				r.pdf.textAligned(x+1, y+7, widths[i]-2, row.cells[i], c.align)
+			}
+			x += widths[i]
+		}
+		y += row.height()
+		r.pdf.setLineWidth(0.2)
+		r.pdf.line(margin, y, margin+contentWidth, y)
+		r.pdf.setLineWidth(0.5)
+	}
+
+	// Moldura e divisórias até o fim da área de itens
+	r.pdf.rect(margin, top, contentWidth, bottom-top)
+	x = margin
+	for _, w := range widths[:len(widths)-1] {
+		x += w
+		r.pdf.line(x, top, x, bottom)
+	}
+}
+
+func (r *renderer) drawAdditional() {
+	y := pageHeight - margin - additionalHeight - sectionTitle
+	y = r.section(y, "DADOS ADICIONAIS")
+	infoWidth := contentWidth * 0.65
+
+	r.pdf.rect(margin, y, infoWidth, additionalHeight)
+	r.pdf.setFont(false, 5)
+	r.pdf.text(margin+2, y+6, "INFORMAÇÕES COMPLEMENTARES")
+	r.pdf.setFont(false, 6)
+	adic := r.inf.InfAdic
+	lines := r.pdf.wrap(joinNonEmpty("\n", adic.InfAdFisco, adic.InfCpl), infoWidth-4)
+	maxLines := int((additionalHeight - 10) / itemLineHeight)
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] = r.pdf.fit(lines[maxLines-1]+" ...", infoWidth-4)
+	}
+	for i, l := range lines {
+		r.pdf.text(margin+2, y+14+float64(i)*itemLineHeight, l)
+	}
+
+	r.pdf.rect(margin+infoWidth, y, contentWidth-infoWidth, additionalHeight)
+	r.pdf.setFont(false, 5)
+	r.pdf.text(margin+infoWidth+2, y+6, "RESERVADO AO FISCO")
+}
+
+// drawWatermark marca notas de homologação e notas canceladas
+func (r *renderer) drawWatermark() {
+	var marks []string
+	if r.opts.Cancelled {
+		marks = append(marks, "NF-e CANCELADA")
+	}
+	if r.inf.Ide.TpAmb == "2" || r.proc.ProtNFe.InfProt.TpAmb == "2" {
+		marks = append(marks, "SEM VALOR FISCAL")
+	}
+	if len(marks) == 0 {
+		return
+	}
+	r.pdf.setGray(0.75)
+	r.pdf.setFont(true, 40)
+	y := pageHeight / 2
+	for _, m := range marks {
+		r.pdf.textAligned(margin, y, contentWidth, m, 'C')
+		y += 50
+	}
+	r.pdf.setGray(0)
+}
+
+func emissionDate(ide models.Ide) string {
+	if ide.DhEmi != "" {
+		return ide.DhEmi
+	}
+	return ide.DEmi
+}
+
+func freightLabel(mod string) string {
+	switch mod {
+	case "0":
+		return "0 - Emitente"
+	case "1":
+		return "1 - Destinatário"
+	case "2":
+		return "2 - Terceiros"
+	case "3":
+		return "3 - Próprio Remetente"
+	case "4":
+		return "4 - Próprio Destinatário"
+	case "9":
+		return "9 - Sem Frete"
+	}
+	return mod
+}
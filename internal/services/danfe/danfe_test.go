@@ -0,0 +1,98 @@
+package danfe
+
+import (
+	"bytes"
+	"errors"
+	"estoque/internal/models"
+	"fmt"
+	"testing"
+)
+
+func sampleProc(items int) *models.NfeProc {
+	proc := &models.NfeProc{}
+	proc.ProtNFe.InfProt.ChNFe = "35240112345678000195550010000012341000012345"
+	proc.ProtNFe.InfProt.NProt = "135240000000001"
+	proc.ProtNFe.InfProt.DhRecbto = "2024-01-15T10:30:00-03:00"
+
+	inf := &proc.NFe.InfNFe
+	inf.ID = "NFe" + proc.ProtNFe.InfProt.ChNFe
+	inf.Ide = models.Ide{NatOp: "Venda de mercadoria", Serie: "1", NNF: "1234", DhEmi: "2024-01-15T10:00:00-03:00", TpNF: "1", TpAmb: "1"}
+	inf.Emit = models.Emit{CNPJ: "12345678000195", XNome: "Fornecedor Exemplo Ltda", IE: "111222333444"}
+	inf.Dest = models.Dest{CNPJ: "98765432000110", XNome: "Cliente Ação & Cia (Matriz)"}
+	for i := 1; i <= items; i++ {
+		det := models.Det{NItem: i}
+		det.Prod = models.Prod{CProd: fmt.Sprintf("P%03d", i), XProd: "Parafuso sextavado aço inox M8 x 40mm com porca e arruela", NCM: "73181500", CFOP: "5102", UCom: "UN", QCom: 10, VUnCom: 1.5, VProd: 15}
+		inf.Det = append(inf.Det, det)
+	}
+	inf.Total.ICMSTot.VProd = 15 * float64(items)
+	inf.Total.ICMSTot.VNF = inf.Total.ICMSTot.VProd
+	return proc
+}
+
+func pageCount(pdf []byte) int {
+	return bytes.Count(pdf, []byte("/Type /Page "))
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		items int
+		pages int
+	}{
+		{"um item", 1, 1},
+		{"itens que cabem na primeira folha", 15, 1},
+		{"itens em várias folhas", 60, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf, err := Render(sampleProc(tt.items), Options{})
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+				t.Errorf("PDF sem cabeçalho ou trailer")
+			}
+			if got := pageCount(pdf); got != tt.pages {
+				t.Errorf("páginas = %d, esperado %d", got, tt.pages)
+			}
+		})
+	}
+}
+
+func TestRenderInvalid(t *testing.T) {
+	proc := sampleProc(1)
+	proc.ProtNFe.InfProt.ChNFe = ""
+	proc.NFe.InfNFe.ID = ""
+	if _, err := Render(proc, Options{}); !errors.Is(err, ErrInvalidNfe) {
+		t.Errorf("err = %v, esperado ErrInvalidNfe", err)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"dinheiro", formatMoney(1234567.891), "1.234.567,89"},
+		{"negativo", formatMoney(-10.5), "-10,50"},
+		{"zero negativo", formatMoney(-0.001), "0,00"},
+		{"quantidade", formatDecimal(2.5, 4), "2,5000"},
+		{"unitário com fração de centavo", formatUnitPrice(0.1234), "0,1234"},
+		{"unitário", formatUnitPrice(12.3), "12,30"},
+		{"CNPJ", formatDocument("12345678000195"), "12.345.678/0001-95"},
+		{"CPF", formatDocument("12345678901"), "123.456.789-01"},
+		{"CEP", formatCEP("01001000"), "01001-000"},
+		{"número", formatNumber("1234"), "000.001.234"},
+		{"chave", formatKey("12345678"), "1234 5678"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
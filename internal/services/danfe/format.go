@@ -0,0 +1,115 @@
+package danfe
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// formatDecimal formata no padrão brasileiro: 1.234,56
+func formatDecimal(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteByte(',')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+func formatMoney(v float64) string {
+	return formatDecimal(v, 2)
+}
+
+// formatUnitPrice usa duas casas, ou quatro quando o valor unitário tem frações de centavo
+func formatUnitPrice(v float64) string {
+	cents := v * 100
+	if math.Abs(cents-math.Round(cents)) > 1e-6 {
+		return formatDecimal(v, 4)
+	}
+	return formatDecimal(v, 2)
+}
+
+// formatDocument formata CNPJ (14 dígitos) ou CPF (11 dígitos); outros valores ficam como estão
+func formatDocument(doc string) string {
+	switch d := digits(doc); len(d) {
+	case 14:
+		return d[0:2] + "." + d[2:5] + "." + d[5:8] + "/" + d[8:12] + "-" + d[12:]
+	case 11:
+		return d[0:3] + "." + d[3:6] + "." + d[6:9] + "-" + d[9:]
+	}
+	return doc
+}
+
+func formatCEP(cep string) string {
+	if d := digits(cep); len(d) == 8 {
+		return d[:5] + "-" + d[5:]
+	}
+	return cep
+}
+
+// formatNumber completa o número da nota com zeros e agrupa: 000.001.234
+func formatNumber(n string) string {
+	d := digits(n)
+	if d == "" || len(d) > 9 {
+		return n
+	}
+	d = strings.Repeat("0", 9-len(d)) + d
+	return d[0:3] + "." + d[3:6] + "." + d[6:]
+}
+
+// formatKey separa a chave de acesso em grupos de quatro dígitos
+func formatKey(key string) string {
+	var groups []string
+	for len(key) > 4 {
+		groups = append(groups, key[:4])
+		key = key[4:]
+	}
+	groups = append(groups, key)
+	return strings.Join(groups, " ")
+}
+
+// splitDateTime separa data (dd/mm/aaaa) e hora de um valor ISO 8601 do XML
+func splitDateTime(s string) (date, clock string) {
+	s = strings.TrimSpace(s)
+	if len(s) < 10 {
+		return s, ""
+	}
+	date = s[8:10] + "/" + s[5:7] + "/" + s[0:4]
+	if len(s) >= 19 && s[10] == 'T' {
+		clock = s[11:19]
+	}
+	return date, clock
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// joinNonEmpty junta as partes preenchidas com o separador
+func joinNonEmpty(sep string, parts ...string) string {
+	filled := parts[:0:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			filled = append(filled, p)
+		}
+	}
+	return strings.Join(filled, sep)
+}
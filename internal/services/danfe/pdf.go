@@ -0,0 +1,245 @@
+package danfe
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+)
+
+// Página A4 em pontos (1/72 polegada)
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+)
+
+// Fontes padrão do PDF (base 14), que dispensam embutir arquivos de fonte
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// pdfWriter monta um PDF mínimo com texto, linhas e retângulos. As coordenadas
+// recebidas têm origem no canto superior esquerdo da página e y crescendo para
+// baixo, como no layout do DANFE; a conversão para o sistema do PDF é interna.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	font  string
+	size  float64
+}
+
+func newPDFWriter() *pdfWriter {
+	return &pdfWriter{}
+}
+
+func (p *pdfWriter) addPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.page.WriteString("0.5 w 0 G 0 g\n")
+	p.font = ""
+}
+
+func (p *pdfWriter) setFont(bold bool, size float64) {
+	p.font = fontRegular
+	if bold {
+		p.font = fontBold
+	}
+	p.size = size
+}
+
+func (p *pdfWriter) setLineWidth(w float64) {
+	fmt.Fprintf(p.page, "%.2f w\n", w)
+}
+
+func (p *pdfWriter) setDash(on, off float64) {
+	if on == 0 {
+		p.page.WriteString("[] 0 d\n")
+		return
+	}
+	fmt.Fprintf(p.page, "[%.2f %.2f] 0 d\n", on, off)
+}
+
+// setGray define a cor de preenchimento (0 = preto, 1 = branco)
+func (p *pdfWriter) setGray(g float64) {
+	fmt.Fprintf(p.page, "%.2f g\n", g)
+}
+
+func (p *pdfWriter) rect(x, y, w, h float64) {
+	fmt.Fprintf(p.page, "%.2f %.2f %.2f %.2f re S\n", x, pageHeight-y-h, w, h)
+}
+
+func (p *pdfWriter) fillRect(x, y, w, h float64) {
+	fmt.Fprintf(p.page, "%.2f %.2f %.2f %.2f re f\n", x, pageHeight-y-h, w, h)
+}
+
+func (p *pdfWriter) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(p.page, "%.2f %.2f m %.2f %.2f l S\n", x1, pageHeight-y1, x2, pageHeight-y2)
+}
+
+// text escreve s com a linha de base em y
+func (p *pdfWriter) text(x, y float64, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(p.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", p.font, p.size, x, pageHeight-y, escapePDFString(encodeWinAnsi(s)))
+}
+
+// textAligned escreve s dentro da largura w: align 'L', 'C' ou 'R'. Textos que
+// não cabem são cortados com reticências.
+func (p *pdfWriter) textAligned(x, y, w float64, s string, align byte) {
+	s = p.fit(s, w)
+	tw := p.width(s)
+	switch align {
+	case 'C':
+		x += (w - tw) / 2
+	case 'R':
+		x += w - tw
+	}
+	p.text(x, y, s)
+}
+
+// width mede o texto na fonte e tamanho atuais
+func (p *pdfWriter) width(s string) float64 {
+	return textWidth(s, p.font == fontBold, p.size)
+}
+
+// fit corta o texto para caber em w, terminando com "..."
+func (p *pdfWriter) fit(s string, w float64) string {
+	if p.width(s) <= w {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimRight(string(runes), " ") + "..."
+		if p.width(candidate) <= w {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// wrap quebra o texto em linhas que caibam em w, respeitando quebras explícitas
+func (p *pdfWriter) wrap(s string, w float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			continue
+		}
+		current := ""
+		for _, word := range words {
+			candidate := word
+			if current != "" {
+				candidate = current + " " + word
+			}
+			if p.width(candidate) <= w || current == "" {
+				current = candidate
+				continue
+			}
+			lines = append(lines, p.fit(current, w))
+			current = word
+		}
+		lines = append(lines, p.fit(current, w))
+	}
+	return lines
+}
+
+// bytes serializa o documento
+func (p *pdfWriter) bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catálogo, 2 árvore de páginas, 3 e 4 fontes; depois página e conteúdo alternados
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// encodeWinAnsi converte UTF-8 para a codificação das fontes padrão (cp1252)
+func encodeWinAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		case r == '…':
+			b.WriteByte(0x85)
+		case r == '‘':
+			b.WriteByte(0x91)
+		case r == '’':
+			b.WriteByte(0x92)
+		case r == '“':
+			b.WriteByte(0x93)
+		case r == '”':
+			b.WriteByte(0x94)
+		case r == '•':
+			b.WriteByte(0x95)
+		case r == '–':
+			b.WriteByte(0x96)
+		case r == '—':
+			b.WriteByte(0x97)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func escapePDFString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n', '\r', '\t':
+			b.WriteByte(' ')
+		case 0x7F:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
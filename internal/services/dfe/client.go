@@ -0,0 +1,222 @@
+// Package dfe implementa o cliente do web service NFeDistribuicaoDFe (Ambiente
+// Nacional), que entrega os documentos fiscais em que um CNPJ é interessado.
+package dfe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	URLProduction   = "https://www1.nfe.fazenda.gov.br/NFeDistribuicaoDFe/NFeDistribuicaoDFe.asmx"
+	URLHomologation = "https://hom1.nfe.fazenda.gov.br/NFeDistribuicaoDFe/NFeDistribuicaoDFe.asmx"
+
+	soapAction = "http://www.portalfiscal.inf.br/nfe/wsdl/NFeDistribuicaoDFe/nfeDistDFeInteresse"
+
+	maxResponseSize = 50 << 20
+	maxDocumentSize = 20 << 20
+)
+
+// Códigos de retorno (cStat) da distribuição
+const (
+	StatusNoDocuments    = 137 // Nenhum documento localizado: aguardar 1 hora
+	StatusDocumentsFound = 138
+	StatusExcessiveUse   = 656 // Consumo indevido: consultas bloqueadas por 1 hora
+)
+
+// Tipos de documento do lote, pelo schema informado em docZip
+const (
+	KindResNFe    = "resNFe"
+	KindProcNFe   = "procNFe"
+	KindResEvento = "resEvento"
+	KindProcEvent = "procEventoNFe"
+)
+
+var ErrInvalidResponse = errors.New("resposta inválida do web service de distribuição")
+
+// ErrDocumentTooLarge rejeita o lote inteiro: truncar o XML e seguir adiante
+// avançaria o NSU sobre um documento perdido
+var ErrDocumentTooLarge = fmt.Errorf("documento descompactado excede %d MB", maxDocumentSize>>20)
+
+// Client consulta a distribuição de DF-e por NSU
+type Client struct {
+	Transport Transport
+	URL       string
+	TpAmb     string // 1 produção, 2 homologação
+	CUFAutor  string // Código IBGE da UF do interessado
+}
+
+// Response é o retorno da consulta (retDistDFeInt)
+type Response struct {
+	CStat     int
+	XMotivo   string
+	UltNSU    string
+	MaxNSU    string
+	Documents []Document
+}
+
+// Document é um documento do lote já descompactado
+type Document struct {
+	NSU    string
+	Schema string // ex: procNFe_v4.00.xsd
+	Data   []byte
+}
+
+// Kind devolve o tipo do documento a partir do schema (resNFe, procNFe, resEvento, procEventoNFe)
+func (d Document) Kind() string {
+	kind, _, _ := strings.Cut(d.Schema, "_v")
+	return kind
+}
+
+type retDistDFeInt struct {
+	CStat   int    `xml:"cStat"`
+	XMotivo string `xml:"xMotivo"`
+	UltNSU  string `xml:"ultNSU"`
+	MaxNSU  string `xml:"maxNSU"`
+	DocZip  []struct {
+		NSU    string `xml:"NSU,attr"`
+		Schema string `xml:"schema,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"loteDistDFeInt>docZip"`
+}
+
+type soapEnvelope struct {
+	Body struct {
+		Result *struct {
+			Ret retDistDFeInt `xml:"retDistDFeInt"`
+		} `xml:"nfeDistDFeInteresseResponse>nfeDistDFeInteresseResult"`
+		Fault *struct {
+			Reason string `xml:"Reason>Text"`
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// DistNSU pede os documentos posteriores a ultNSU para o CNPJ interessado
+func (c *Client) DistNSU(ctx context.Context, cnpj, ultNSU string) (*Response, error) {
+	body, err := c.Transport.Post(ctx, c.URL, soapAction, c.envelope(cnpj, ultNSU))
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(body)
+}
+
+func (c *Client) envelope(cnpj, ultNSU string) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body>`)
+	b.WriteString(`<nfeDistDFeInteresse xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeDistribuicaoDFe"><nfeDadosMsg>`)
+	fmt.Fprintf(&b, `<distDFeInt xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.01"><tpAmb>%s</tpAmb><cUFAutor>%s</cUFAutor><CNPJ>%s</CNPJ><distNSU><ultNSU>%s</ultNSU></distNSU></distDFeInt>`,
+		escape(c.TpAmb), escape(c.CUFAutor), escape(digits(cnpj)), PadNSU(ultNSU))
+	b.WriteString(`</nfeDadosMsg></nfeDistDFeInteresse></soap12:Body></soap12:Envelope>`)
+	return b.Bytes()
+}
+
+func parseResponse(body []byte) (*Response, error) {
+	var env soapEnvelope
+	if err := xml.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if f := env.Body.Fault; f != nil {
+		return nil, fmt.Errorf("falha SOAP: %s", strings.TrimSpace(f.Reason+f.String))
+	}
+	if env.Body.Result == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	ret := env.Body.Result.Ret
+	resp := &Response{
+		CStat:   ret.CStat,
+		XMotivo: ret.XMotivo,
+		UltNSU:  ret.UltNSU,
+		MaxNSU:  ret.MaxNSU,
+	}
+	for _, doc := range ret.DocZip {
+		data, err := unzipDocument(doc.Value)
+		if err != nil {
+			return nil, fmt.Errorf("docZip NSU %s: %w", doc.NSU, err)
+		}
+		resp.Documents = append(resp.Documents, Document{NSU: doc.NSU, Schema: doc.Schema, Data: data})
+	}
+	return resp, nil
+}
+
+// unzipDocument decodifica o conteúdo de docZip: XML compactado em gzip e codificado em base64
+func unzipDocument(value string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDocumentSize {
+		return nil, ErrDocumentTooLarge
+	}
+	return data, nil
+}
+
+// ResNFe é o resumo de uma NF-e em que o CNPJ é destinatário, entregue antes do
+// XML completo (que só vem após a manifestação do destinatário)
+type ResNFe struct {
+	ChNFe    string  `xml:"chNFe"`
+	CNPJ     string  `xml:"CNPJ"`
+	CPF      string  `xml:"CPF"`
+	XNome    string  `xml:"xNome"`
+	IE       string  `xml:"IE"`
+	DhEmi    string  `xml:"dhEmi"`
+	TpNF     string  `xml:"tpNF"`
+	VNF      float64 `xml:"vNF"`
+	DigVal   string  `xml:"digVal"`
+	DhRecbto string  `xml:"dhRecbto"`
+	NProt    string  `xml:"nProt"`
+	CSitNFe  string  `xml:"cSitNFe"` // 1 autorizada, 2 denegada, 3 cancelada
+}
+
+func ParseResNFe(data []byte) (*ResNFe, error) {
+	var res ResNFe
+	if err := xml.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	if len(res.ChNFe) != 44 {
+		return nil, fmt.Errorf("resNFe sem chave de acesso válida")
+	}
+	return &res, nil
+}
+
+// PadNSU completa o NSU com zeros à esquerda (15 dígitos)
+func PadNSU(nsu string) string {
+	nsu = digits(nsu)
+	if len(nsu) >= 15 {
+		return nsu
+	}
+	return strings.Repeat("0", 15-len(nsu)) + nsu
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package dfe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const resNFeXML = `<resNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.01"><chNFe>35240112345678000195550010000012341123456785</chNFe><CNPJ>12345678000195</CNPJ><xNome>Fornecedor Exemplo LTDA</xNome><IE>123456789</IE><dhEmi>2024-01-15T10:30:00-03:00</dhEmi><tpNF>1</tpNF><vNF>255.00</vNF><digVal>abc=</digVal><dhRecbto>2024-01-15T10:31:00-03:00</dhRecbto><nProt>135240000012345</nProt><cSitNFe>1</cSitNFe></resNFe>`
+
+const procNFeXML = `<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><NFe/></nfeProc>`
+
+func docZip(t *testing.T, xmlData string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(xmlData)); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func soapResponse(ret string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>` +
+		`<nfeDistDFeInteresseResponse xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeDistribuicaoDFe"><nfeDistDFeInteresseResult>` +
+		ret + `</nfeDistDFeInteresseResult></nfeDistDFeInteresseResponse></soap:Body></soap:Envelope>`
+}
+
+// standIn sobe um servidor local no lugar do web service da SEFAZ
+func standIn(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	transport := NewHTTPTransport(nil, 5*time.Second)
+	return &Client{Transport: transport, URL: server.URL, TpAmb: "2", CUFAutor: "35"}
+}
+
+func TestDistNSU(t *testing.T) {
+	var request string
+	client := standIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/soap+xml") || !strings.Contains(ct, soapAction) {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		request = string(body)
+		fmt.Fprint(w, soapResponse(`<retDistDFeInt xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.01"><tpAmb>2</tpAmb><cStat>138</cStat><xMotivo>Documento localizado</xMotivo>`+
+			`<ultNSU>000000000000125</ultNSU><maxNSU>000000000000130</maxNSU><loteDistDFeInt>`+
+			`<docZip NSU="000000000000124" schema="resNFe_v1.01.xsd">`+docZip(t, resNFeXML)+`</docZip>`+
+			`<docZip NSU="000000000000125" schema="procNFe_v4.00.xsd">`+docZip(t, procNFeXML)+`</docZip>`+
+			`</loteDistDFeInt></retDistDFeInt>`))
+	})
+
+	resp, err := client.DistNSU(context.Background(), "12.345.678/0001-95", "123")
+	if err != nil {
+		t.Fatalf("DistNSU() error = %v", err)
+	}
+
+	for _, want := range []string{"<tpAmb>2</tpAmb>", "<cUFAutor>35</cUFAutor>", "<CNPJ>12345678000195</CNPJ>", "<ultNSU>000000000000123</ultNSU>"} {
+		if !strings.Contains(request, want) {
+			t.Errorf("requisição sem %s: %s", want, request)
+		}
+	}
+	if resp.CStat != StatusDocumentsFound || resp.UltNSU != "000000000000125" || resp.MaxNSU != "000000000000130" {
+		t.Errorf("resp = %d %s/%s", resp.CStat, resp.UltNSU, resp.MaxNSU)
+	}
+	if len(resp.Documents) != 2 {
+		t.Fatalf("documentos = %d, want 2", len(resp.Documents))
+	}
+	if resp.Documents[0].Kind() != KindResNFe || resp.Documents[1].Kind() != KindProcNFe {
+		t.Errorf("tipos = %s, %s", resp.Documents[0].Kind(), resp.Documents[1].Kind())
+	}
+	if string(resp.Documents[1].Data) != procNFeXML {
+		t.Errorf("procNFe descompactado = %s", resp.Documents[1].Data)
+	}
+
+	res, err := ParseResNFe(resp.Documents[0].Data)
+	if err != nil {
+		t.Fatalf("ParseResNFe() error = %v", err)
+	}
+	if res.ChNFe != "35240112345678000195550010000012341123456785" || res.CNPJ != "12345678000195" || res.VNF != 255 || res.CSitNFe != "1" {
+		t.Errorf("resNFe = %+v", res)
+	}
+}
+
+func TestDistNSUErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"falha SOAP", http.StatusInternalServerError,
+			`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body><soap:Fault><soap:Reason><soap:Text>Certificado não informado</soap:Text></soap:Reason></soap:Fault></soap:Body></soap:Envelope>`,
+			"Certificado não informado"},
+		{"HTTP 403", http.StatusForbidden, "", "HTTP 403"},
+		{"corpo inválido", http.StatusOK, "<html>manutenção</html>", "resposta inválida"},
+		{"docZip corrompido", http.StatusOK, soapResponse(`<retDistDFeInt><cStat>138</cStat><loteDistDFeInt><docZip NSU="1" schema="resNFe_v1.01.xsd">não é base64</docZip></loteDistDFeInt></retDistDFeInt>`), "docZip NSU 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := standIn(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := client.DistNSU(context.Background(), "12345678000195", "0")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DistNSU() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDistNSUNoDocuments(t *testing.T) {
+	client := standIn(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, soapResponse(`<retDistDFeInt><cStat>137</cStat><xMotivo>Nenhum documento localizado</xMotivo><ultNSU>000000000000130</ultNSU><maxNSU>000000000000130</maxNSU></retDistDFeInt>`))
+	})
+	resp, err := client.DistNSU(context.Background(), "12345678000195", "130")
+	if err != nil {
+		t.Fatalf("DistNSU() error = %v", err)
+	}
+	if resp.CStat != StatusNoDocuments || len(resp.Documents) != 0 {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestPadNSU(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "000000000000000"},
+		{"0", "000000000000000"},
+		{"123", "000000000000123"},
+		{"000000000000456", "000000000000456"},
+	}
+	for _, tt := range tests {
+		if got := PadNSU(tt.in); got != tt.want {
+			t.Errorf("PadNSU(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnzipDocumentLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{"no limite", maxDocumentSize, nil},
+		{"acima do limite", maxDocumentSize + 1, ErrDocumentTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := unzipDocument(docZip(t, strings.Repeat(" ", tt.size)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("unzipDocument() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(data) != tt.size {
+				t.Errorf("unzipDocument() = %d bytes, want %d", len(data), tt.size)
+			}
+		})
+	}
+}
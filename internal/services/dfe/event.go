@@ -0,0 +1,240 @@
+package dfe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"estoque/internal/services/xmldsig"
+)
+
+const (
+	// Eventos de manifestação do destinatário são sempre enviados ao Ambiente Nacional
+	URLEventProduction   = "https://www.nfe.fazenda.gov.br/NFeRecepcaoEvento4/NFeRecepcaoEvento4.asmx"
+	URLEventHomologation = "https://hom1.nfe.fazenda.gov.br/NFeRecepcaoEvento4/NFeRecepcaoEvento4.asmx"
+
+	eventSoapAction = "http://www.portalfiscal.inf.br/nfe/wsdl/NFeRecepcaoEvento4/nfeRecepcaoEvento"
+
+	// Código do órgão para eventos registrados no Ambiente Nacional
+	orgaoAmbienteNacional = "91"
+)
+
+// Tipos de evento da manifestação do destinatário
+const (
+	EventConfirmacao     = "210200"
+	EventCiencia         = "210210"
+	EventDesconhecimento = "210220"
+	EventNaoRealizada    = "210240"
+)
+
+// Códigos de retorno (cStat) da recepção de eventos
+const (
+	StatusBatchProcessed       = 128
+	StatusEventRegistered      = 135
+	StatusEventRegisteredNoNFe = 136 // Registrado, mas ainda não vinculado à NF-e
+	StatusEventDuplicate       = 573 // Duplicidade: o evento já estava registrado
+)
+
+var eventDescriptions = map[string]string{
+	EventConfirmacao:     "Confirmacao da Operacao",
+	EventCiencia:         "Ciencia da Operacao",
+	EventDesconhecimento: "Desconhecimento da Operacao",
+	EventNaoRealizada:    "Operacao nao Realizada",
+}
+
+// EventDescription devolve a descEvento do tipo; vazio para tipos que não são manifestação
+func EventDescription(eventType string) string {
+	return eventDescriptions[eventType]
+}
+
+// Signer assina o XML no elemento com o Id informado (certificado A1 do destinatário)
+type Signer interface {
+	Sign(data []byte, referenceID string) ([]byte, error)
+}
+
+// CertificateSigner assina com a chave do mesmo certificado usado no TLS
+type CertificateSigner struct {
+	Certificate Certificate
+}
+
+func (s CertificateSigner) Sign(data []byte, referenceID string) ([]byte, error) {
+	c, err := s.Certificate.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := c.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("certificado sem chave privada RSA")
+	}
+	leaf := c.Leaf
+	if leaf == nil {
+		if len(c.Certificate) == 0 {
+			return nil, errors.New("certificado vazio")
+		}
+		if leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return xmldsig.SignEnveloped(data, referenceID, key, leaf)
+}
+
+// Event é a manifestação a enviar
+type Event struct {
+	AccessKey     string
+	CNPJ          string // Autor do evento: o destinatário da nota
+	Type          string
+	Sequence      int
+	Justification string // Obrigatória só em operação não realizada
+	IssuedAt      time.Time
+}
+
+// EventResult é o retorno do evento (retEvento), com os XMLs enviado e recebido
+type EventResult struct {
+	CStat        int
+	XMotivo      string
+	Protocol     string
+	RegisteredAt *time.Time
+	Request      []byte
+	Response     []byte
+}
+
+// Registered indica se a SEFAZ aceitou o evento (inclusive duplicidade)
+func (r *EventResult) Registered() bool {
+	switch r.CStat {
+	case StatusEventRegistered, StatusEventRegisteredNoNFe, StatusEventDuplicate:
+		return true
+	}
+	return false
+}
+
+// EventClient envia eventos de manifestação ao web service NFeRecepcaoEvento4
+type EventClient struct {
+	Transport Transport
+	URL       string
+	TpAmb     string // 1 produção, 2 homologação
+	Signer    Signer
+}
+
+type retEnvEvento struct {
+	CStat    int    `xml:"cStat"`
+	XMotivo  string `xml:"xMotivo"`
+	RetEvent []struct {
+		CStat       int    `xml:"infEvento>cStat"`
+		XMotivo     string `xml:"infEvento>xMotivo"`
+		ChNFe       string `xml:"infEvento>chNFe"`
+		NProt       string `xml:"infEvento>nProt"`
+		DhRegEvento string `xml:"infEvento>dhRegEvento"`
+	} `xml:"retEvento"`
+}
+
+type eventSoapEnvelope struct {
+	Body struct {
+		Result *struct {
+			Ret retEnvEvento `xml:"retEnvEvento"`
+		} `xml:"nfeResultMsg"`
+		Fault *struct {
+			Reason string `xml:"Reason>Text"`
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// Send assina e envia o evento. Rejeições da SEFAZ voltam no resultado (cStat);
+// o erro fica para falhas de assinatura, transporte ou resposta ilegível.
+func (c *EventClient) Send(ctx context.Context, ev Event) (*EventResult, error) {
+	signed, err := c.signedEvent(ev)
+	if err != nil {
+		return nil, fmt.Errorf("assinatura do evento: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	b.WriteString(`<soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope"><soap12:Body>`)
+	b.WriteString(`<nfeDadosMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeRecepcaoEvento4">`)
+	b.Write(signed)
+	b.WriteString(`</nfeDadosMsg></soap12:Body></soap12:Envelope>`)
+
+	body, err := c.Transport.Post(ctx, c.URL, eventSoapAction, b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	result, err := parseEventResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	result.Request = signed
+	return result, nil
+}
+
+// EventID monta o Id do infEvento: "ID" + tipo + chave + sequência com 2 dígitos
+func EventID(ev Event) string {
+	return fmt.Sprintf("ID%s%s%02d", ev.Type, ev.AccessKey, sequence(ev))
+}
+
+func (c *EventClient) signedEvent(ev Event) ([]byte, error) {
+	desc := EventDescription(ev.Type)
+	if desc == "" {
+		return nil, fmt.Errorf("tipo de evento %q não é manifestação do destinatário", ev.Type)
+	}
+	issuedAt := ev.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	id := EventID(ev)
+
+	var b bytes.Buffer
+	// idLote só identifica o envio; a SEFAZ não exige sequência
+	fmt.Fprintf(&b, `<envEvento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><idLote>%015d</idLote>`, issuedAt.UnixNano()%1e15)
+	fmt.Fprintf(&b, `<evento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><infEvento Id="%s">`, id)
+	fmt.Fprintf(&b, `<cOrgao>%s</cOrgao><tpAmb>%s</tpAmb><CNPJ>%s</CNPJ><chNFe>%s</chNFe>`,
+		orgaoAmbienteNacional, escape(c.TpAmb), escape(digits(ev.CNPJ)), escape(ev.AccessKey))
+	fmt.Fprintf(&b, `<dhEvento>%s</dhEvento><tpEvento>%s</tpEvento><nSeqEvento>%d</nSeqEvento><verEvento>1.00</verEvento>`,
+		issuedAt.Format("2006-01-02T15:04:05-07:00"), ev.Type, sequence(ev))
+	fmt.Fprintf(&b, `<detEvento versao="1.00"><descEvento>%s</descEvento>`, desc)
+	if ev.Type == EventNaoRealizada {
+		fmt.Fprintf(&b, `<xJust>%s</xJust>`, escape(strings.TrimSpace(ev.Justification)))
+	}
+	b.WriteString(`</detEvento></infEvento></evento></envEvento>`)
+
+	return c.Signer.Sign(b.Bytes(), id)
+}
+
+func sequence(ev Event) int {
+	if ev.Sequence < 1 {
+		return 1
+	}
+	return ev.Sequence
+}
+
+func parseEventResponse(body []byte) (*EventResult, error) {
+	var env eventSoapEnvelope
+	if err := xml.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if f := env.Body.Fault; f != nil {
+		return nil, fmt.Errorf("falha SOAP: %s", strings.TrimSpace(f.Reason+f.String))
+	}
+	if env.Body.Result == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	ret := env.Body.Result.Ret
+	result := &EventResult{CStat: ret.CStat, XMotivo: ret.XMotivo, Response: body}
+	// Lote rejeitado (ex: schema inválido) não traz retEvento
+	if ret.CStat == StatusBatchProcessed && len(ret.RetEvent) > 0 {
+		ev := ret.RetEvent[0]
+		result.CStat = ev.CStat
+		result.XMotivo = ev.XMotivo
+		result.Protocol = ev.NProt
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(ev.DhRegEvento)); err == nil {
+			result.RegisteredAt = &t
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package dfe
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"estoque/internal/services/xmldsig"
+)
+
+const testAccessKey = "35240112345678000195550010000012341123456785"
+
+// testCertificate é um certificado autoassinado no lugar do A1 do destinatário
+type testCertificate struct{ cert tls.Certificate }
+
+func (c testCertificate) TLSCertificate() (tls.Certificate, error) { return c.cert, nil }
+
+func newTestCertificate(t *testing.T) testCertificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "DESTINATARIO TESTE LTDA:98765432000110"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	return testCertificate{tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+func eventResponse(ret string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>` +
+		`<nfeResultMsg xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeRecepcaoEvento4">` + ret + `</nfeResultMsg></soap:Body></soap:Envelope>`
+}
+
+func eventStandIn(t *testing.T, handler http.HandlerFunc) *EventClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	transport := NewHTTPTransport(nil, 5*time.Second)
+	return &EventClient{Transport: transport, URL: server.URL, TpAmb: "2", Signer: CertificateSigner{newTestCertificate(t)}}
+}
+
+func TestSendEvent(t *testing.T) {
+	var request string
+	client := eventStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, eventSoapAction) {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		request = string(body)
+		fmt.Fprint(w, eventResponse(`<retEnvEvento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><idLote>1</idLote><cStat>128</cStat><xMotivo>Lote de evento processado</xMotivo>`+
+			`<retEvento versao="1.00"><infEvento><cStat>135</cStat><xMotivo>Evento registrado e vinculado a NF-e</xMotivo><chNFe>`+testAccessKey+`</chNFe>`+
+			`<tpEvento>210240</tpEvento><dhRegEvento>2024-01-16T09:00:00-03:00</dhRegEvento><nProt>891240000000123</nProt></infEvento></retEvento></retEnvEvento>`))
+	})
+
+	result, err := client.Send(context.Background(), Event{
+		AccessKey:     testAccessKey,
+		CNPJ:          "98.765.432/0001-10",
+		Type:          EventNaoRealizada,
+		Justification: "Mercadoria recusada no recebimento",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	id := "ID210240" + testAccessKey + "01"
+	for _, want := range []string{`Id="` + id + `"`, "<cOrgao>91</cOrgao>", "<tpAmb>2</tpAmb>", "<CNPJ>98765432000110</CNPJ>",
+		"<descEvento>Operacao nao Realizada</descEvento>", "<xJust>Mercadoria recusada no recebimento</xJust>", "<nSeqEvento>1</nSeqEvento>"} {
+		if !strings.Contains(request, want) {
+			t.Errorf("requisição sem %s: %s", want, request)
+		}
+	}
+	if _, err := xmldsig.VerifyEnveloped(result.Request, id); err != nil {
+		t.Errorf("assinatura do evento inválida: %v", err)
+	}
+	if !result.Registered() || result.Protocol != "891240000000123" || result.RegisteredAt == nil {
+		t.Errorf("resultado = %+v", result)
+	}
+}
+
+func TestSendEventRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		ret       string
+		wantCStat int
+	}{
+		{"evento rejeitado", `<retEnvEvento><cStat>128</cStat><retEvento><infEvento><cStat>596</cStat><xMotivo>Rejeição: Evento apresentado após o prazo</xMotivo></infEvento></retEvento></retEnvEvento>`, 596},
+		{"lote rejeitado", `<retEnvEvento><cStat>225</cStat><xMotivo>Rejeição: Falha no Schema XML</xMotivo></retEnvEvento>`, 225},
+		{"duplicidade", `<retEnvEvento><cStat>128</cStat><retEvento><infEvento><cStat>573</cStat><xMotivo>Duplicidade de evento</xMotivo></infEvento></retEvento></retEnvEvento>`, StatusEventDuplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := eventStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, eventResponse(tt.ret))
+			})
+			result, err := client.Send(context.Background(), Event{AccessKey: testAccessKey, CNPJ: "98765432000110", Type: EventCiencia})
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if result.CStat != tt.wantCStat {
+				t.Errorf("cStat = %d, want %d", result.CStat, tt.wantCStat)
+			}
+			if result.Registered() != (tt.wantCStat == StatusEventDuplicate) {
+				t.Errorf("Registered() = %v", result.Registered())
+			}
+		})
+	}
+}
+
+func TestSendEventInvalidType(t *testing.T) {
+	client := eventStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("evento inválido não deveria ser enviado")
+	})
+	if _, err := client.Send(context.Background(), Event{AccessKey: testAccessKey, Type: "110111"}); err == nil {
+		t.Error("Send() com tipo de cancelamento error = nil")
+	}
+}
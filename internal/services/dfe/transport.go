@@ -0,0 +1,81 @@
+package dfe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Certificate fornece o certificado do cliente para o TLS mútuo exigido pela SEFAZ
+type Certificate interface {
+	TLSCertificate() (tls.Certificate, error)
+}
+
+// Transport envia o envelope SOAP e devolve o corpo da resposta. Nos testes é
+// substituído por um servidor local que imita o web service.
+type Transport interface {
+	Post(ctx context.Context, url, action string, envelope []byte) ([]byte, error)
+}
+
+// PEMCertificate lê o certificado e a chave privada de arquivos PEM
+type PEMCertificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+func (c PEMCertificate) TLSCertificate() (tls.Certificate, error) {
+	return tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+}
+
+// HTTPTransport envia o SOAP 1.2 por HTTPS com o certificado do cliente
+type HTTPTransport struct {
+	client *http.Client
+}
+
+// NewHTTPTransport cria o transporte; cert nil dispensa o certificado do cliente
+// (servidores de teste). O certificado é pedido a cada handshake, então a troca
+// do certificado ativo vale para as novas conexões sem reiniciar o serviço.
+func NewHTTPTransport(cert Certificate, timeout time.Duration) *HTTPTransport {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c, err := cert.TLSCertificate()
+			if err != nil {
+				return nil, fmt.Errorf("certificado do cliente: %w", err)
+			}
+			return &c, nil
+		}
+	}
+	return &HTTPTransport{client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}}
+}
+
+func (t *HTTPTransport) Post(ctx context.Context, url, action string, envelope []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", fmt.Sprintf(`application/soap+xml; charset=utf-8; action="%s"`, action))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	// Falhas SOAP vêm com HTTP 500 e o detalhe no corpo, tratado pelo cliente
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusInternalServerError {
+		return nil, fmt.Errorf("web service respondeu HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
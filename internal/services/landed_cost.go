@@ -0,0 +1,166 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"math"
+)
+
+// Base de rateio das despesas informadas apenas no total da nota
+const (
+	ProrationByValue    = "VALOR"
+	ProrationByQuantity = "QUANTIDADE"
+)
+
+// CostRules define quais tributos compõem o custo de aquisição
+type CostRules struct {
+	Proration     string
+	IncludeIPI    bool
+	IncludeICMSST bool
+	CreditICMS    bool
+}
+
+// CostRulesFromConfig lê as regras de custo da configuração de NF-e
+func CostRulesFromConfig(cfg models.NfeConfig) CostRules {
+	proration := cfg.CostProration
+	if proration != ProrationByQuantity {
+		proration = ProrationByValue
+	}
+	return CostRules{
+		Proration:     proration,
+		IncludeIPI:    !cfg.CostExcludeIPI,
+		IncludeICMSST: !cfg.CostExcludeICMSST,
+		CreditICMS:    cfg.CostCreditICMS,
+	}
+}
+
+// noteCharges são as despesas do total da nota que não foram distribuídas nos itens
+type noteCharges struct {
+	freight, insurance, discount, other float64
+}
+
+// undistributedCharges compara os totais (ICMSTot) com a soma dos itens. Pelo
+// leiaute os totais são a soma dos itens, mas há emissores que informam frete,
+// seguro, desconto ou outras despesas só no total.
+func undistributedCharges(totals models.ICMSTot, items []models.NFeItem) noteCharges {
+	var sum noteCharges
+	for _, item := range items {
+		sum.freight += item.Freight
+		sum.insurance += item.Insurance
+		sum.discount += item.Discount
+		sum.other += item.OtherCharges
+	}
+	residual := func(total, distributed float64) float64 {
+		if r := roundCents(total - distributed); r > 0 {
+			return r
+		}
+		return 0
+	}
+	return noteCharges{
+		freight:   residual(totals.VFrete, sum.freight),
+		insurance: residual(totals.VSeg, sum.insurance),
+		discount:  residual(totals.VDesc, sum.discount),
+		other:     residual(totals.VOutro, sum.other),
+	}
+}
+
+// LandedCosts calcula o custo unitário de cada item (por unidade comercial, indexado
+// por nItem): despesas do próprio item vão para a sua linha e as informadas só no
+// total são rateadas entre todos os itens da nota, por valor ou quantidade.
+func LandedCosts(items []models.NFeItem, totals models.ICMSTot, rules CostRules) map[int]models.CostBreakdown {
+	charges := undistributedCharges(totals, items)
+
+	weights := make([]float64, len(items))
+	for i, item := range items {
+		if rules.Proration == ProrationByQuantity {
+			weights[i] = item.Quantity
+		} else {
+			weights[i] = item.TotalPrice
+		}
+	}
+	freight := prorate(charges.freight, weights)
+	insurance := prorate(charges.insurance, weights)
+	discount := prorate(charges.discount, weights)
+	other := prorate(charges.other, weights)
+
+	costs := make(map[int]models.CostBreakdown, len(items))
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			continue
+		}
+		line := models.CostBreakdown{
+			Freight:      item.Freight + freight[i],
+			Insurance:    item.Insurance + insurance[i],
+			Discount:     item.Discount + discount[i],
+			OtherCharges: item.OtherCharges + other[i],
+		}
+		if rules.IncludeIPI {
+			line.IPI = item.IPIValue
+		}
+		if rules.IncludeICMSST {
+			line.ICMSST = item.ICMSSTValue
+		}
+		if rules.CreditICMS {
+			line.ICMSCredit = item.ICMSValue
+		}
+
+		unit := scaleCost(line, 1/item.Quantity)
+		unit.Product = item.UnitPrice
+		costs[item.ItemNumber] = unit
+	}
+	return costs
+}
+
+// prorate distribui o valor proporcionalmente aos pesos, em centavos; a diferença
+// de arredondamento fica no último item com peso para o total fechar exato
+func prorate(amount float64, weights []float64) []float64 {
+	shares := make([]float64, len(weights))
+	if amount == 0 || len(weights) == 0 {
+		return shares
+	}
+
+	total := 0.0
+	last := -1
+	for i, w := range weights {
+		if w > 0 {
+			total += w
+			last = i
+		}
+	}
+	// Sem base de rateio (ex: itens sem valor), divide igualmente
+	if total == 0 {
+		equal := make([]float64, len(weights))
+		for i := range equal {
+			equal[i] = 1
+		}
+		weights, total, last = equal, float64(len(equal)), len(equal)-1
+	}
+
+	distributed := 0.0
+	for i, w := range weights {
+		if w <= 0 || i == last {
+			continue
+		}
+		shares[i] = roundCents(amount * w / total)
+		distributed += shares[i]
+	}
+	shares[last] = roundCents(amount - distributed)
+	return shares
+}
+
+// scaleCost multiplica todos os componentes (ex: para converter a unidade)
+func scaleCost(c models.CostBreakdown, k float64) models.CostBreakdown {
+	return models.CostBreakdown{
+		Product:      c.Product * k,
+		Freight:      c.Freight * k,
+		Insurance:    c.Insurance * k,
+		Discount:     c.Discount * k,
+		OtherCharges: c.OtherCharges * k,
+		IPI:          c.IPI * k,
+		ICMSST:       c.ICMSST * k,
+		ICMSCredit:   c.ICMSCredit * k,
+	}
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
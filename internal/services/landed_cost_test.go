@@ -0,0 +1,104 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLandedCosts(t *testing.T) {
+	charged := models.NFeItem{
+		ItemNumber: 1, Quantity: 10, UnitPrice: 10, TotalPrice: 100,
+		Freight: 5, Insurance: 1, Discount: 2, OtherCharges: 1,
+		IPIValue: 10, ICMSSTValue: 3, ICMSValue: 12,
+	}
+	itemA := models.NFeItem{ItemNumber: 1, Quantity: 10, UnitPrice: 10, TotalPrice: 100}
+	itemB := models.NFeItem{ItemNumber: 2, Quantity: 5, UnitPrice: 40, TotalPrice: 200}
+	defaults := CostRulesFromConfig(DefaultNfeConfig())
+
+	tests := []struct {
+		name   string
+		items  []models.NFeItem
+		totals models.ICMSTot
+		rules  CostRules
+		want   map[int]float64 // Custo unitário total por nItem
+	}{
+		{
+			"despesas e tributos do item (regras padrão)",
+			[]models.NFeItem{charged},
+			models.ICMSTot{VFrete: 5, VSeg: 1, VDesc: 2, VOutro: 1},
+			defaults,
+			map[int]float64{1: 11.8},
+		},
+		{
+			"IPI recuperável e crédito de ICMS",
+			[]models.NFeItem{charged},
+			models.ICMSTot{VFrete: 5, VSeg: 1, VDesc: 2, VOutro: 1},
+			CostRules{Proration: ProrationByValue, IncludeIPI: false, IncludeICMSST: true, CreditICMS: true},
+			map[int]float64{1: 9.6},
+		},
+		{
+			"frete só no total rateado por valor",
+			[]models.NFeItem{itemA, itemB},
+			models.ICMSTot{VFrete: 30},
+			defaults,
+			map[int]float64{1: 11, 2: 44},
+		},
+		{
+			"frete só no total rateado por quantidade",
+			[]models.NFeItem{itemA, itemB},
+			models.ICMSTot{VFrete: 30},
+			CostRulesFromConfig(models.NfeConfig{CostProration: ProrationByQuantity}),
+			map[int]float64{1: 12, 2: 42},
+		},
+		{
+			"desconto só no total",
+			[]models.NFeItem{itemA, itemB},
+			models.ICMSTot{VDesc: 15},
+			defaults,
+			map[int]float64{1: 9.5, 2: 38},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LandedCosts(tt.items, tt.totals, tt.rules)
+			for item, want := range tt.want {
+				if total := got[item].Total(); !almostEqual(total, want) {
+					t.Errorf("item %d: custo = %v (%+v), want %v", item, total, got[item], want)
+				}
+			}
+		})
+	}
+}
+
+func TestProrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  float64
+		weights []float64
+		want    []float64
+	}{
+		{"proporcional", 30, []float64{100, 200}, []float64{10, 20}},
+		{"sobra de arredondamento no último", 10, []float64{1, 1, 1}, []float64{3.33, 3.33, 3.34}},
+		{"item sem peso não recebe", 10, []float64{5, 0, 5}, []float64{5, 0, 5}},
+		{"sem base divide igualmente", 9, []float64{0, 0, 0}, []float64{3, 3, 3}},
+		{"nada a ratear", 0, []float64{1, 2}, []float64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prorate(tt.amount, tt.weights)
+			for i := range tt.want {
+				if !almostEqual(got[i], tt.want[i]) {
+					t.Errorf("prorate() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
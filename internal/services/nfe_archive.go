@@ -0,0 +1,172 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Limites de extração para evitar ZIPs maliciosos (zip bomb) ou aninhamento infinito
+const (
+	MaxArchiveDocuments = 5000
+	MaxArchiveSize      = 500 << 20 // Total descompactado
+	MaxDocumentSize     = 10 << 20  // Por XML, mesmo limite do upload individual
+	maxArchiveDepth     = 3
+)
+
+var (
+	ErrUnsupportedFile  = errors.New("tipo de arquivo não suportado (esperado .xml ou .zip)")
+	ErrDocumentTooLarge = errors.New("arquivo muito grande")
+	ErrArchiveTooLarge  = errors.New("conteúdo descompactado excede o limite do lote")
+	ErrArchiveTooDeep   = errors.New("ZIP aninhado em níveis demais")
+	ErrTooManyDocuments = fmt.Errorf("lote excede o limite de %d documentos", MaxArchiveDocuments)
+)
+
+// NfeDocument é um XML extraído de um upload ou anexo. Name traz o caminho
+// completo dentro dos ZIPs (ex: "marco.zip/filial/123.xml"). Quando Err não é
+// nil o arquivo não pôde ser lido e Data está vazio.
+type NfeDocument struct {
+	Name string
+	Data []byte
+	Err  error
+}
+
+// ExtractNfeDocuments devolve os XMLs de um arquivo avulso ou de um ZIP,
+// percorrendo pastas e ZIPs aninhados. Arquivos de outros tipos dentro de um
+// ZIP são ignorados; um arquivo avulso de tipo desconhecido vira um documento
+// com erro. O erro retornado só é preenchido quando o lote inteiro é inválido.
+func ExtractNfeDocuments(name string, data []byte) ([]NfeDocument, error) {
+	e := &archiveExtractor{}
+	err := e.extract(name, data)
+	return e.docs, err
+}
+
+// NfeBatch aplica MaxArchiveDocuments e MaxArchiveSize ao conjunto de arquivos
+// de um mesmo envio, e não a cada arquivo isoladamente
+type NfeBatch struct {
+	documents int
+	size      int64
+}
+
+// Extract extrai os XMLs de name contando para os limites do envio. Um arquivo
+// que estoura os limites não contribui com nenhum documento: vira um único
+// documento com o erro e não consome a cota dos arquivos seguintes.
+func (b *NfeBatch) Extract(name string, data []byte) []NfeDocument {
+	e := &archiveExtractor{previous: b.documents, size: b.size}
+	if err := e.extract(name, data); err != nil {
+		return []NfeDocument{{Name: name, Err: err}}
+	}
+	b.documents += len(e.docs)
+	b.size = e.size
+	return e.docs
+}
+
+type archiveExtractor struct {
+	docs     []NfeDocument
+	previous int // Documentos já extraídos de outros arquivos do envio
+	size     int64
+}
+
+func (e *archiveExtractor) extract(name string, data []byte) error {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".xml":
+		if e.previous+len(e.docs) >= MaxArchiveDocuments {
+			return ErrTooManyDocuments
+		}
+		if e.size += int64(len(data)); e.size > MaxArchiveSize {
+			return ErrArchiveTooLarge
+		}
+		e.add(name, data)
+	case ".zip":
+		return e.extractZip(name, data, 1)
+	default:
+		e.docs = append(e.docs, NfeDocument{Name: name, Err: ErrUnsupportedFile})
+	}
+	return nil
+}
+
+func (e *archiveExtractor) add(name string, data []byte) {
+	if len(data) > MaxDocumentSize {
+		e.docs = append(e.docs, NfeDocument{Name: name, Err: ErrDocumentTooLarge})
+		return
+	}
+	e.docs = append(e.docs, NfeDocument{Name: name, Data: data})
+}
+
+func (e *archiveExtractor) extractZip(name string, data []byte, depth int) error {
+	if depth > maxArchiveDepth {
+		e.docs = append(e.docs, NfeDocument{Name: name, Err: ErrArchiveTooDeep})
+		return nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		e.docs = append(e.docs, NfeDocument{Name: name, Err: fmt.Errorf("ZIP inválido: %w", err)})
+		return nil
+	}
+
+	for _, f := range zr.File {
+		entry := path.Clean(strings.ReplaceAll(f.Name, "\\", "/"))
+		if f.FileInfo().IsDir() || skipArchiveEntry(entry) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(entry))
+		if ext != ".xml" && ext != ".zip" {
+			continue
+		}
+		if e.previous+len(e.docs) >= MaxArchiveDocuments {
+			return ErrTooManyDocuments
+		}
+
+		fullName := name + "/" + entry
+		content, err := e.readEntry(f)
+		if errors.Is(err, ErrArchiveTooLarge) {
+			return err
+		}
+		if err != nil {
+			e.docs = append(e.docs, NfeDocument{Name: fullName, Err: err})
+			continue
+		}
+
+		if ext == ".zip" {
+			if err := e.extractZip(fullName, content, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		e.add(fullName, content)
+	}
+	return nil
+}
+
+// readEntry lê a entrada respeitando o limite total, sem confiar no tamanho declarado no ZIP
+func (e *archiveExtractor) readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	remaining := MaxArchiveSize - e.size
+	content, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	e.size += int64(len(content))
+	if e.size > MaxArchiveSize {
+		return nil, ErrArchiveTooLarge
+	}
+	return content, nil
+}
+
+// skipArchiveEntry ignora metadados do macOS e arquivos ocultos
+func skipArchiveEntry(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	return strings.HasPrefix(path.Base(name), ".")
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// buildZip monta um ZIP em memória com os arquivos informados (nome -> conteúdo)
+func buildZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip.Create(%s) error = %v", name, err)
+		}
+		f.Write(content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip.Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractNfeDocuments(t *testing.T) {
+	inner := buildZip(t, map[string][]byte{"abril/3.xml": []byte("<c/>")})
+	outer := buildZip(t, map[string][]byte{
+		"1.xml":                []byte("<a/>"),
+		"filial/2.XML":         []byte("<b/>"),
+		"filial/leia-me.txt":   []byte("ignorado"),
+		"__MACOSX/filial/._2":  []byte("ignorado"),
+		"filial/.DS_Store":     []byte("ignorado"),
+		"anteriores/abril.zip": inner,
+	})
+
+	docs, err := ExtractNfeDocuments("marco.zip", outer)
+	if err != nil {
+		t.Fatalf("ExtractNfeDocuments() error = %v", err)
+	}
+
+	got := make(map[string]string, len(docs))
+	for _, d := range docs {
+		if d.Err != nil {
+			t.Errorf("documento %s com erro inesperado: %v", d.Name, d.Err)
+		}
+		got[d.Name] = string(d.Data)
+	}
+	want := map[string]string{
+		"marco.zip/1.xml":                            "<a/>",
+		"marco.zip/filial/2.XML":                     "<b/>",
+		"marco.zip/anteriores/abril.zip/abril/3.xml": "<c/>",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractNfeDocuments() = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("documento %s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestExtractNfeDocuments_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		wantErr error
+	}{
+		{"tipo não suportado", "nota.pdf", []byte("%PDF"), ErrUnsupportedFile},
+		{"XML grande demais", "nota.xml", make([]byte, MaxDocumentSize+1), ErrDocumentTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := ExtractNfeDocuments(tt.file, tt.data)
+			if err != nil {
+				t.Fatalf("ExtractNfeDocuments() error = %v", err)
+			}
+			if len(docs) != 1 || !errors.Is(docs[0].Err, tt.wantErr) {
+				t.Errorf("ExtractNfeDocuments() = %+v, want erro %v", docs, tt.wantErr)
+			}
+		})
+	}
+
+	// ZIP corrompido vira um documento com erro, sem derrubar o lote
+	docs, err := ExtractNfeDocuments("lote.zip", []byte("não é zip"))
+	if err != nil || len(docs) != 1 || docs[0].Err == nil {
+		t.Errorf("ExtractNfeDocuments(ZIP corrompido) = %+v, %v", docs, err)
+	}
+}
+
+func TestNfeBatch_Limits(t *testing.T) {
+	batch := &NfeBatch{}
+	for i := 0; i < MaxArchiveDocuments-1; i++ {
+		if docs := batch.Extract("nota.xml", []byte("<a/>")); len(docs) != 1 || docs[0].Err != nil {
+			t.Fatalf("Extract(#%d) = %+v", i, docs)
+		}
+	}
+
+	// O ZIP que ultrapassa o limite do envio vira um único resultado com erro...
+	zipped := buildZip(t, map[string][]byte{"1.xml": []byte("<b/>"), "2.xml": []byte("<c/>")})
+	docs := batch.Extract("lote.zip", zipped)
+	if len(docs) != 1 || docs[0].Name != "lote.zip" || !errors.Is(docs[0].Err, ErrTooManyDocuments) {
+		t.Fatalf("Extract(lote.zip) = %+v, want erro %v", docs, ErrTooManyDocuments)
+	}
+
+	// ...sem consumir a cota: ainda cabe um documento, e depois nenhum
+	if docs := batch.Extract("ultima.xml", []byte("<d/>")); len(docs) != 1 || docs[0].Err != nil {
+		t.Fatalf("Extract(ultima.xml) = %+v", docs)
+	}
+	if docs := batch.Extract("excedente.xml", []byte("<e/>")); len(docs) != 1 || !errors.Is(docs[0].Err, ErrTooManyDocuments) {
+		t.Errorf("Extract(excedente.xml) = %+v, want erro %v", docs, ErrTooManyDocuments)
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"estoque/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Políticas para notas sem assinatura digital válida
+const (
+	SignaturePolicyReject = "REJEITAR"
+	SignaturePolicyFlag   = "SINALIZAR"
+)
+
+// GetNfeConfig retorna a configuração de recebimento de NF-e, com valores padrão se ainda não houver registro
+func GetNfeConfig(db *gorm.DB) models.NfeConfig {
+	var configs []models.NfeConfig
+	if err := db.Limit(1).Find(&configs).Error; err != nil || len(configs) == 0 {
+		return DefaultNfeConfig()
+	}
+	return configs[0]
+}
+
+// DefaultNfeConfig mantém o comportamento anterior: notas sem assinatura válida são aceitas e sinalizadas
+func DefaultNfeConfig() models.NfeConfig {
+	return models.NfeConfig{
+		SignaturePolicy: SignaturePolicyFlag,
+		CostProration:   ProrationByValue,
+	}
+}
@@ -2,42 +2,359 @@ package nfe_consumer
 
 import (
 	"context"
+	"errors"
+	"estoque/internal/models"
 	"estoque/internal/services/worker_pools"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/emersion/go-imap/client"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Intervalo em que o consumidor relê as caixas cadastradas para iniciar, parar
+// ou reiniciar (configuração alterada) a verificação de cada uma
+const mailboxReloadInterval = time.Minute
+
+const (
+	// Espera antes de reconectar, dobrada a cada falha seguida
+	minReconnectDelay = 5 * time.Second
+	maxReconnectDelay = 10 * time.Minute
+
+	// O IDLE é reiniciado antes dos 30 minutos em que o servidor pode encerrá-lo (RFC 2177)
+	maxIdleDuration = 20 * time.Minute
+	// Tempo máximo de um comando IMAP além do IDLE, para detectar conexões mortas
+	commandTimeout = 10 * time.Minute
+)
+
+// Modo de recebimento da caixa, gravado no status
+const (
+	ModeIdle    = "IDLE"    // Servidor avisa a chegada de e-mails
+	ModePolling = "POLLING" // Servidor sem IDLE: verificação a cada intervalo
 )
 
 type Consumer struct {
 	DB            *gorm.DB
 	NfeWorkerPool *worker_pools.NFeWorkerPool
+
+	mu      sync.Mutex
+	workers map[uint]*mailboxWorker
+}
+
+// mailboxWorker é a verificação em andamento de uma caixa
+type mailboxWorker struct {
+	cancel    context.CancelFunc
+	done      chan struct{} // Fechado quando a goroutine da caixa termina
+	updatedAt time.Time     // Versão da configuração em uso
+	stopped   bool          // Cancelada; fica no mapa até terminar
+}
+
+func (w *mailboxWorker) stop() {
+	w.cancel()
+	w.stopped = true
 }
 
 func NewConsumer(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool) *Consumer {
 	return &Consumer{
 		DB:            db,
 		NfeWorkerPool: nfePool,
+		workers:       make(map[uint]*mailboxWorker),
 	}
 }
 
 func (c *Consumer) Start(ctx context.Context) {
 	slog.Info("Starting NFE Email Consumer service")
 
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(mailboxReloadInterval)
 	defer ticker.Stop()
 
-	// Initial run
-	slog.Info("Iniciando busca automática de e-mails de NF-e...")
-	c.processEmails()
-
+	c.syncMailboxes(ctx)
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("Stopping NFE Email Consumer service")
+			c.stopAll()
 			return
 		case <-ticker.C:
-			c.processEmails()
+			c.syncMailboxes(ctx)
+		}
+	}
+}
+
+// syncMailboxes mantém uma goroutine por caixa ativa; cada caixa tem o próprio
+// intervalo e uma falha em uma delas não afeta as demais
+func (c *Consumer) syncMailboxes(ctx context.Context) {
+	var configs []models.EmailConfig
+	if err := c.DB.Where("active = ?", true).Find(&configs).Error; err != nil {
+		slog.Error("Erro ao buscar configurações de e-mail no banco", "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := make(map[uint]bool, len(configs))
+	for _, config := range configs {
+		active[config.ID] = true
+		previous := c.workers[config.ID]
+		if previous != nil {
+			if !previous.stopped && previous.updatedAt.Equal(config.UpdatedAt) {
+				continue
+			}
+			previous.stop()
+		}
+		c.startWorker(ctx, config, previous)
+	}
+
+	for id, w := range c.workers {
+		if active[id] {
+			continue
+		}
+		w.stop()
+		// Mantida até terminar para que uma reativação da caixa espere por ela
+		select {
+		case <-w.done:
+			delete(c.workers, id)
+		default:
+		}
+	}
+	if len(configs) == 0 {
+		slog.Debug("Nenhuma configuração de e-mail ativa encontrada no banco.")
+	}
+}
+
+// startWorker inicia a goroutine da caixa. A sessão anterior da mesma caixa
+// precisa terminar antes: duas conexões leriam os mesmos e-mails e disputariam
+// o último UID e as pastas de destino.
+func (c *Consumer) startWorker(ctx context.Context, config models.EmailConfig, previous *mailboxWorker) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	w := &mailboxWorker{cancel: cancel, done: make(chan struct{}), updatedAt: config.UpdatedAt}
+	c.workers[config.ID] = w
+	go func() {
+		defer close(w.done)
+		if previous != nil {
+			<-previous.done
+		}
+		c.runMailbox(workerCtx, config)
+	}()
+}
+
+// stopAll cancela todas as caixas e espera as goroutines terminarem
+func (c *Consumer) stopAll() {
+	c.mu.Lock()
+	var running []*mailboxWorker
+	for id, w := range c.workers {
+		w.stop()
+		running = append(running, w)
+		delete(c.workers, id)
+	}
+	c.mu.Unlock()
+
+	for _, w := range running {
+		<-w.done
+	}
+}
+
+// runMailbox mantém a conexão com a caixa até ser cancelada, reconectando com
+// espera exponencial quando ela cai
+func (c *Consumer) runMailbox(ctx context.Context, config models.EmailConfig) {
+	logger := slog.With("mailbox", mailboxName(config))
+	logger.Info("Iniciando busca automática de e-mails de NF-e", "interval", pollInterval(config))
+
+	delay := minReconnectDelay
+	for {
+		checked, err := c.runSession(ctx, config)
+		if ctx.Err() != nil {
+			return
+		}
+		// Uma sessão que chegou a verificar a caixa recomeça a contagem da espera
+		if checked {
+			delay = minReconnectDelay
+		}
+		logger.Warn("Conexão IMAP encerrada; nova tentativa agendada", "retry_in", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
 		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// runSession abre a conexão e verifica a caixa a cada aviso de IDLE ou, sem
+// suporte a IDLE no servidor, a cada intervalo. Devolve se alguma verificação
+// terminou bem e o erro que encerrou a sessão.
+func (c *Consumer) runSession(ctx context.Context, config models.EmailConfig) (bool, error) {
+	interval := pollInterval(config)
+	// Mesmo com IDLE a caixa é verificada a cada intervalo, o que também mantém a conexão viva
+	wait := min(interval, maxIdleDuration)
+
+	imapClient, err := openMailbox(config, wait+commandTimeout)
+	if err != nil {
+		c.recordStatus(config, mailboxStats{}, err, "")
+		return false, err
+	}
+	defer imapClient.Logout()
+
+	mode := ModePolling
+	if ok, _ := imapClient.Support("IDLE"); ok {
+		mode = ModeIdle
+	}
+	slog.Debug("Conectado à caixa de e-mail", "mailbox", mailboxName(config), "mode", mode)
+
+	// EXISTS/RECENT avisam que chegou e-mail; o canal precisa ser sempre
+	// esvaziado para não travar a leitura da conexão
+	updates := make(chan client.Update, 16)
+	newMail := make(chan struct{}, 1)
+	imapClient.Updates = updates
+	go func() {
+		for {
+			select {
+			case u := <-updates:
+				if _, ok := u.(*client.MailboxUpdate); ok {
+					select {
+					case newMail <- struct{}{}:
+					default:
+					}
+				}
+			case <-imapClient.LoggedOut():
+				return
+			}
+		}
+	}()
+
+	checked := false
+	for {
+		stats, err := c.checkMailbox(imapClient, config)
+		c.recordStatus(config, stats, err, mode)
+		if err != nil {
+			return checked, err
+		}
+		checked = true
+
+		if mode == ModeIdle {
+			err = waitIdle(ctx, imapClient, newMail, wait)
+		} else {
+			err = waitPoll(ctx, imapClient, interval)
+		}
+		if err != nil {
+			return checked, err
+		}
+	}
+}
+
+// waitIdle fica em IDLE até chegar e-mail, passar o tempo máximo ou o contexto ser cancelado
+func waitIdle(ctx context.Context, imapClient *client.Client, newMail <-chan struct{}, wait time.Duration) error {
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- imapClient.Idle(stop, &client.IdleOptions{LogoutTimeout: -1})
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		// O IDLE só termina sozinho quando a conexão cai
+		if err == nil {
+			err = errors.New("IDLE encerrado pelo servidor")
+		}
+		return err
+	case <-ctx.Done():
+		close(stop)
+		<-done
+		return ctx.Err()
+	case <-newMail:
+	case <-timer.C:
+	}
+	close(stop)
+	return <-done
+}
+
+// waitPoll aguarda o intervalo de polling com a conexão aberta
+func waitPoll(ctx context.Context, imapClient *client.Client, interval time.Duration) error {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-imapClient.LoggedOut():
+		return errors.New("conexão encerrada pelo servidor")
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Consumer) recordStatus(config models.EmailConfig, stats mailboxStats, runErr error, mode string) {
+	// A falha ao mover ou marcar os e-mails não derruba a conexão, mas aparece no status
+	if runErr == nil {
+		runErr = stats.actionErr
+	}
+	if runErr != nil {
+		slog.Error("Erro ao verificar caixa de e-mail", "mailbox", mailboxName(config), "error", runErr)
+	}
+	if err := recordMailboxStatus(c.DB, config.ID, stats, runErr, mode); err != nil {
+		slog.Error("Erro ao gravar status da caixa de e-mail", "mailbox", mailboxName(config), "error", err)
+	}
+}
+
+// recordMailboxStatus grava a última verificação, acumula os totais importados
+// e guarda até que UID a pasta já foi lida
+func recordMailboxStatus(db *gorm.DB, configID uint, stats mailboxStats, runErr error, mode string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		status := models.EmailMailboxStatus{EmailConfigID: configID}
+		if err := tx.Limit(1).Find(&status, "email_config_id = ?", configID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		status.LastRunAt = &now
+		status.LastRunMessages = stats.messages
+		status.Mode = mode
+		status.MessagesImported += int64(stats.messages)
+		status.DocumentsImported += int64(stats.documents)
+		if stats.uidValidity != 0 {
+			status.Folder = stats.folder
+			status.UIDValidity = stats.uidValidity
+			status.LastUID = stats.lastUID
+		}
+		if runErr != nil {
+			msg := runErr.Error()
+			status.LastError = &msg
+			status.LastErrorAt = &now
+		} else {
+			status.LastSuccessAt = &now
+			status.LastError = nil
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&status).Error
+	})
+}
+
+// pollInterval devolve o intervalo da caixa; zero usa os 5 minutos de antes da configuração por caixa
+func pollInterval(config models.EmailConfig) time.Duration {
+	if config.PollInterval <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(config.PollInterval) * time.Minute
+}
+
+// mailboxFolder devolve a pasta verificada (INBOX por padrão)
+func mailboxFolder(config models.EmailConfig) string {
+	if config.IMAPFolder == "" {
+		return "INBOX"
+	}
+	return config.IMAPFolder
+}
+
+// mailboxName identifica a caixa nos logs
+func mailboxName(config models.EmailConfig) string {
+	if config.Name != "" {
+		return config.Name
 	}
+	return config.IMAPUser
 }
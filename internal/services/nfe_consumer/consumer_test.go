@@ -0,0 +1,159 @@
+package nfe_consumer
+
+import (
+	"context"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/worker_pools"
+	"net"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Nota sem emitente nem chave: o pool a rejeita na validação (INVALIDO)
+const invalidNfeXML = `<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><NFe/></nfeProc>`
+
+// setupConsumerDB cria um banco em memória com as tabelas dos consumidores.
+// Uma única conexão mantém o mesmo banco para os workers do pool.
+func setupConsumerDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.WatchedFile{}, &models.DfeSummary{},
+		&models.DfeDistributionState{}, &models.DfeFailedDocument{}, &models.EmailMailboxStatus{}, &models.EmailIngestion{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+// newTestPool devolve o pool em execução; parado, o pool simula a
+// indisponibilidade (erro transitório) e recusa os envios
+func newTestPool(t *testing.T, db *gorm.DB, running bool) *worker_pools.NFeWorkerPool {
+	t.Helper()
+	pool := worker_pools.NewNFeWorkerPool(1, db)
+	pool.Start()
+	if !running {
+		pool.Stop()
+		return pool
+	}
+	t.Cleanup(pool.Stop)
+	return pool
+}
+
+func TestRecordMailboxStatus(t *testing.T) {
+	db := setupConsumerDB(t)
+	read := mailboxStats{messages: 3, documents: 2, folder: "INBOX", uidValidity: 7, lastUID: 40}
+
+	if err := recordMailboxStatus(db, 1, read, nil, ModeIdle); err != nil {
+		t.Fatalf("recordMailboxStatus() error = %v", err)
+	}
+	// Falha de conexão: a pasta não foi lida e a posição gravada é mantida
+	if err := recordMailboxStatus(db, 1, mailboxStats{}, errors.New("conexão recusada"), ""); err != nil {
+		t.Fatalf("recordMailboxStatus() error = %v", err)
+	}
+
+	var status models.EmailMailboxStatus
+	if err := db.First(&status, "email_config_id = ?", 1).Error; err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if status.Folder != "INBOX" || status.UIDValidity != 7 || status.LastUID != 40 {
+		t.Errorf("posição = %s/%d/%d, want INBOX/7/40", status.Folder, status.UIDValidity, status.LastUID)
+	}
+	if status.MessagesImported != 3 || status.DocumentsImported != 2 {
+		t.Errorf("totais = %d/%d, want 3/2", status.MessagesImported, status.DocumentsImported)
+	}
+	if status.LastError == nil || status.LastSuccessAt == nil {
+		t.Errorf("LastError = %v, LastSuccessAt = %v", status.LastError, status.LastSuccessAt)
+	}
+
+	if err := recordMailboxStatus(db, 1, mailboxStats{folder: "INBOX", uidValidity: 9, lastUID: 3}, nil, ModePolling); err != nil {
+		t.Fatalf("recordMailboxStatus() error = %v", err)
+	}
+	db.First(&status, "email_config_id = ?", 1)
+	if status.UIDValidity != 9 || status.LastUID != 3 || status.LastError != nil {
+		t.Errorf("após nova leitura: %d/%d, erro %v", status.UIDValidity, status.LastUID, status.LastError)
+	}
+}
+
+func TestLastReadUID(t *testing.T) {
+	db := setupConsumerDB(t)
+	c := NewConsumer(db, nil)
+	if err := db.Create(&models.EmailMailboxStatus{EmailConfigID: 1, Folder: "INBOX", UIDValidity: 7, LastUID: 40}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		configID    uint
+		folder      string
+		uidValidity uint32
+		want        uint32
+		wantKnown   bool // Falso: a leitura começa nos não lidos (startingUID)
+	}{
+		{"mesma pasta", 1, "INBOX", 7, 40, true},
+		{"UIDVALIDITY mudou", 1, "INBOX", 8, 0, false},
+		{"outra pasta", 1, "NFe", 7, 0, false},
+		{"caixa nunca lida", 2, "INBOX", 7, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config models.EmailConfig
+			config.ID = tt.configID
+			got, known, err := c.lastReadUID(config, tt.folder, tt.uidValidity)
+			if err != nil {
+				t.Fatalf("lastReadUID() error = %v", err)
+			}
+			if got != tt.want || known != tt.wantKnown {
+				t.Errorf("lastReadUID() = %d, %v; want %d, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestConsumer_StartWorkerWaitsPrevious(t *testing.T) {
+	db := setupConsumerDB(t)
+	c := NewConsumer(db, nil)
+
+	// Porta fechada: cada sessão falha na conexão e grava o erro no status
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	var config models.EmailConfig
+	config.ID = 1
+	config.IMAPHost, config.IMAPPort = "127.0.0.1", addr.Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	previous := &mailboxWorker{cancel: func() {}, done: make(chan struct{})}
+	c.startWorker(ctx, config, previous)
+	defer c.stopAll()
+
+	sessions := func() int64 {
+		var n int64
+		db.Model(&models.EmailMailboxStatus{}).Where("email_config_id = ?", 1).Count(&n)
+		return n
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := sessions(); n != 0 {
+		t.Fatalf("sessão iniciada antes da anterior terminar (%d status)", n)
+	}
+
+	close(previous.done)
+	deadline := time.Now().Add(2 * time.Second)
+	for sessions() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("sessão não iniciada depois que a anterior terminou")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,301 @@
+package nfe_consumer
+
+import (
+	"context"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/dfe"
+	"estoque/internal/services/worker_pools"
+	"estoque/internal/utils"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lotes consultados em sequência enquanto a SEFAZ indicar documentos pendentes
+// (ultNSU < maxNSU); o restante fica para o próximo ciclo
+const dfeMaxBatchesPerPoll = 20
+
+// Consultas seguidas em que o mesmo documento pode falhar antes de ser guardado
+// em dfe_failed_documents para que o NSU avance
+const dfeMaxDocumentAttempts = 5
+
+// documentError é a falha no processamento do próprio documento (resultado ERRO
+// do pool), que conta tentativas; as demais falhas são de infraestrutura e só
+// seguram o NSU
+type documentError struct {
+	err error
+}
+
+func (e *documentError) Error() string { return e.err.Error() }
+func (e *documentError) Unwrap() error { return e.err }
+
+// DfeConsumer busca na distribuição DF-e as notas emitidas contra os nossos CNPJs
+type DfeConsumer struct {
+	DB            *gorm.DB
+	NfeWorkerPool *worker_pools.NFeWorkerPool
+	Client        *dfe.Client
+	// CNPJs consultados; vazio usa os CNPJs próprios da configuração de NF-e
+	CNPJs    []string
+	Interval time.Duration
+}
+
+func NewDfeConsumer(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool, client *dfe.Client, cnpjs []string, interval time.Duration) *DfeConsumer {
+	return &DfeConsumer{
+		DB:            db,
+		NfeWorkerPool: nfePool,
+		Client:        client,
+		CNPJs:         cnpjs,
+		Interval:      interval,
+	}
+}
+
+func (c *DfeConsumer) Start(ctx context.Context) {
+	slog.Info("Starting NFE DF-e Distribution Consumer service", "interval", c.Interval)
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	c.pollAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping NFE DF-e Distribution Consumer service")
+			return
+		case <-ticker.C:
+			c.pollAll(ctx)
+		}
+	}
+}
+
+func (c *DfeConsumer) pollAll(ctx context.Context) {
+	cnpjs := c.CNPJs
+	if len(cnpjs) == 0 {
+		cnpjs = services.ParseOwnCNPJs(services.GetNfeConfig(c.DB).OwnCNPJs)
+	}
+	if len(cnpjs) == 0 {
+		slog.Info("Distribuição DF-e sem CNPJ configurado; consulta ignorada")
+		return
+	}
+	for _, cnpj := range cnpjs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.Poll(ctx, cnpj); err != nil {
+			slog.Error("Erro na distribuição DF-e", "cnpj", cnpj, "error", err)
+		}
+	}
+}
+
+// Poll consulta os documentos posteriores ao último NSU gravado. O NSU só avança
+// depois que os documentos do lote foram registrados; um erro transitório em um
+// documento mantém o NSU anterior a ele para que seja buscado de novo. Um
+// documento que falha em dfeMaxDocumentAttempts consultas é guardado e pulado.
+func (c *DfeConsumer) Poll(ctx context.Context, cnpj string) error {
+	state := models.DfeDistributionState{CNPJ: cnpj, LastNSU: dfe.PadNSU("0")}
+	if err := c.DB.Limit(1).Find(&state, "cnpj = ?", cnpj).Error; err != nil {
+		return err
+	}
+	if state.NextQueryAt != nil && time.Now().Before(*state.NextQueryAt) {
+		slog.Debug("Distribuição DF-e aguardando intervalo exigido pela SEFAZ", "cnpj", cnpj, "next", state.NextQueryAt)
+		return nil
+	}
+
+	for batch := 0; batch < dfeMaxBatchesPerPoll; batch++ {
+		resp, err := c.Client.DistNSU(ctx, cnpj, state.LastNSU)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		state.LastStatus = int32(resp.CStat)
+		state.LastMessage = utils.Truncate(resp.XMotivo, 255)
+		state.LastQueryAt = &now
+		state.NextQueryAt = nil
+		if resp.MaxNSU != "" {
+			state.MaxNSU = dfe.PadNSU(resp.MaxNSU)
+		}
+
+		var docErr error
+		switch resp.CStat {
+		case dfe.StatusDocumentsFound:
+			for _, doc := range resp.Documents {
+				if docErr = c.handleDocument(cnpj, doc); docErr != nil {
+					if docErr = c.countFailure(&state, doc, docErr); docErr != nil {
+						break
+					}
+				}
+				state.LastNSU = dfe.PadNSU(doc.NSU)
+				if state.FailedNSU != "" && state.FailedNSU <= state.LastNSU {
+					state.FailedNSU, state.FailedAttempts = "", 0
+				}
+			}
+			if docErr == nil && resp.UltNSU != "" {
+				state.LastNSU = dfe.PadNSU(resp.UltNSU)
+			}
+		case dfe.StatusNoDocuments:
+			if resp.UltNSU != "" {
+				state.LastNSU = dfe.PadNSU(resp.UltNSU)
+			}
+			next := now.Add(time.Hour)
+			state.NextQueryAt = &next
+		case dfe.StatusExcessiveUse:
+			next := now.Add(time.Hour)
+			state.NextQueryAt = &next
+			slog.Warn("SEFAZ bloqueou a distribuição DF-e por consumo indevido", "cnpj", cnpj, "motivo", resp.XMotivo)
+		default:
+			slog.Warn("Distribuição DF-e rejeitada", "cnpj", cnpj, "cStat", resp.CStat, "motivo", resp.XMotivo)
+		}
+
+		if err := c.DB.Save(&state).Error; err != nil {
+			return err
+		}
+		if docErr != nil {
+			return docErr
+		}
+		if resp.CStat != dfe.StatusDocumentsFound || state.LastNSU >= state.MaxNSU {
+			return nil
+		}
+	}
+	return nil
+}
+
+// handleDocument encaminha o documento: resumos são gravados em dfe_summaries e
+// XMLs completos (nota ou evento) seguem o fluxo normal do pool. Só erros
+// transitórios são devolvidos; documentos inválidos são registrados no log e pulados.
+func (c *DfeConsumer) handleDocument(cnpj string, doc dfe.Document) error {
+	switch doc.Kind() {
+	case dfe.KindResNFe:
+		res, err := dfe.ParseResNFe(doc.Data)
+		if err != nil {
+			slog.Warn("Resumo de NF-e inválido na distribuição DF-e", "nsu", doc.NSU, "error", err)
+			return nil
+		}
+		return c.saveSummary(cnpj, doc.NSU, res)
+
+	case dfe.KindProcNFe, dfe.KindProcEvent:
+		result, err := c.NfeWorkerPool.SubmitSync(worker_pools.NFeJob{
+			XMLData:   doc.Data,
+			UserID:    nil, // Processado pelo sistema
+			UserEmail: "sefaz-dfe",
+		})
+		if err != nil {
+			return err
+		}
+		switch outcome := result.Outcome(); outcome {
+		case worker_pools.OutcomeRegistered, worker_pools.OutcomeDuplicate:
+			if doc.Kind() == dfe.KindProcNFe && result.AccessKey != "" {
+				return c.DB.Model(&models.DfeSummary{}).Where("access_key = ?", result.AccessKey).Update("has_full_xml", true).Error
+			}
+		case worker_pools.OutcomeError:
+			return &documentError{fmt.Errorf("NSU %s: %w", doc.NSU, result.Error)}
+		default:
+			slog.Warn("Documento da distribuição DF-e não registrado", "nsu", doc.NSU, "outcome", outcome, "access_key", result.AccessKey, "error", result.Error)
+		}
+		return nil
+
+	default:
+		// resEvento e demais resumos não têm uso no estoque
+		slog.Debug("Documento da distribuição DF-e ignorado", "nsu", doc.NSU, "schema", doc.Schema)
+		return nil
+	}
+}
+
+// countFailure conta as consultas seguidas em que o documento falhou. Devolve o
+// erro enquanto houver tentativas, mantendo o NSU; na última, guarda o documento
+// em dfe_failed_documents e devolve nil para que o NSU avance sem ele.
+func (c *DfeConsumer) countFailure(state *models.DfeDistributionState, doc dfe.Document, err error) error {
+	var docErr *documentError
+	if !errors.As(err, &docErr) {
+		return err
+	}
+	nsu := dfe.PadNSU(doc.NSU)
+	if state.FailedNSU != nsu {
+		state.FailedNSU, state.FailedAttempts = nsu, 0
+	}
+	state.FailedAttempts++
+	if state.FailedAttempts < dfeMaxDocumentAttempts {
+		return err
+	}
+
+	failed := models.DfeFailedDocument{
+		CNPJ:     state.CNPJ,
+		NSU:      nsu,
+		Schema:   utils.Truncate(doc.Schema, 50),
+		Attempts: state.FailedAttempts,
+		Error:    err.Error(),
+		Content:  doc.Data,
+	}
+	if err := c.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&failed).Error; err != nil {
+		return err
+	}
+	slog.Error("Documento da distribuição DF-e pulado depois de falhar em todas as tentativas",
+		"cnpj", state.CNPJ, "nsu", nsu, "attempts", state.FailedAttempts, "error", err)
+	return nil
+}
+
+// saveSummary grava ou atualiza o resumo; a nota pode ter sido registrada antes por outro canal
+func (c *DfeConsumer) saveSummary(cnpj, nsu string, res *dfe.ResNFe) error {
+	var registered, known int64
+	if err := c.DB.Model(&models.ProcessedNFe{}).Where("access_key IN ?", []string{res.ChNFe, "NFe" + res.ChNFe}).Count(&registered).Error; err != nil {
+		return err
+	}
+	if err := c.DB.Model(&models.DfeSummary{}).Where("access_key = ?", res.ChNFe).Count(&known).Error; err != nil {
+		return err
+	}
+
+	summary := models.DfeSummary{
+		AccessKey:      res.ChNFe,
+		RecipientCNPJ:  cnpj,
+		NSU:            dfe.PadNSU(nsu),
+		IssuerDocument: firstNonEmpty(res.CNPJ, res.CPF),
+		IssuerName:     utils.Truncate(res.XNome, 191),
+		TotalValue:     res.VNF,
+		OperationType:  res.TpNF,
+		Situation:      res.CSitNFe,
+		ProtocolNumber: res.NProt,
+		HasFullXML:     registered > 0,
+	}
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(res.DhEmi)); err == nil {
+		summary.IssuedAt = &t
+	}
+	if err := c.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "access_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"nsu", "issuer_name", "total_value", "situation", "protocol_number", "updated_at"}),
+	}).Create(&summary).Error; err != nil {
+		return err
+	}
+
+	// A ciência libera o download do XML completo pela própria distribuição
+	if known == 0 && !summary.HasFullXML && res.CSitNFe == "1" && services.GetNfeConfig(c.DB).AutoCiencia {
+		c.sendCiencia(res.ChNFe)
+	}
+	return nil
+}
+
+// sendCiencia manifesta ciência da operação; falhas ficam registradas na
+// manifestação e não interrompem a distribuição
+func (c *DfeConsumer) sendCiencia(accessKey string) {
+	m, err := services.NewNfeService(c.DB).Manifest(context.Background(), accessKey, dfe.EventCiencia, "", services.ManifestationSourceDfe, nil)
+	if err != nil {
+		slog.Warn("Ciência da operação não enviada", "access_key", accessKey, "error", err)
+		return
+	}
+	if m.Status != services.ManifestationRegistered {
+		slog.Warn("Ciência da operação não registrada", "access_key", accessKey, "status", m.Status, "cStat", m.StatusCode, "motivo", m.StatusMessage)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
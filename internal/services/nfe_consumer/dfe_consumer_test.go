@@ -0,0 +1,164 @@
+package nfe_consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/dfe"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const dfeTestCNPJ = "98765432000110"
+
+const resNFeXML = `<resNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.01"><chNFe>35240112345678000195550010000012341123456785</chNFe><CNPJ>12345678000195</CNPJ><xNome>Fornecedor Exemplo LTDA</xNome><dhEmi>2024-01-15T10:30:00-03:00</dhEmi><tpNF>1</tpNF><vNF>255.00</vNF><nProt>135240000012345</nProt><cSitNFe>1</cSitNFe></resNFe>`
+
+// fakeTransport responde no lugar da SEFAZ com um retorno por consulta
+type fakeTransport struct {
+	t         *testing.T
+	responses []string
+	err       error
+	calls     int
+}
+
+func (f *fakeTransport) Post(_ context.Context, _, _ string, _ []byte) ([]byte, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.calls > len(f.responses) {
+		f.t.Errorf("consulta %d sem retorno configurado", f.calls)
+		return nil, errors.New("sem retorno")
+	}
+	return []byte(f.responses[f.calls-1]), nil
+}
+
+func dfeDoc(t *testing.T, nsu, schema, xmlData string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(xmlData))
+	zw.Close()
+	return fmt.Sprintf(`<docZip NSU="%s" schema="%s">%s</docZip>`, nsu, schema, base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+func dfeResponse(cStat int, ultNSU, maxNSU string, docs ...string) string {
+	lote := ""
+	for _, d := range docs {
+		lote += d
+	}
+	return fmt.Sprintf(`<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Body>`+
+		`<nfeDistDFeInteresseResponse xmlns="http://www.portalfiscal.inf.br/nfe/wsdl/NFeDistribuicaoDFe"><nfeDistDFeInteresseResult>`+
+		`<retDistDFeInt xmlns="http://www.portalfiscal.inf.br/nfe"><cStat>%d</cStat><xMotivo>retorno de teste</xMotivo><ultNSU>%s</ultNSU><maxNSU>%s</maxNSU>`+
+		`<loteDistDFeInt>%s</loteDistDFeInt></retDistDFeInt></nfeDistDFeInteresseResult></nfeDistDFeInteresseResponse></soap:Body></soap:Envelope>`,
+		cStat, ultNSU, maxNSU, lote)
+}
+
+func TestDfeConsumer_Poll(t *testing.T) {
+	summary := dfeDoc(t, "5", "resNFe_v1.01.xsd", resNFeXML)
+	invalid := dfeDoc(t, "6", "procNFe_v4.00.xsd", invalidNfeXML)
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		state       *models.DfeDistributionState // Estado gravado antes da consulta
+		responses   []string
+		transErr    error
+		running     bool
+		wantErr     bool
+		wantCalls   int
+		wantLastNSU string
+		wantNext    bool // NextQueryAt preenchido (espera exigida pela SEFAZ)
+		wantSummary bool
+	}{
+		{"resumo registrado", nil, []string{dfeResponse(138, "5", "5", summary)}, nil, true, false, 1, "5", false, true},
+		{"lote seguinte sem documentos", nil, []string{dfeResponse(138, "5", "8", summary), dfeResponse(137, "8", "8")}, nil, true, false, 2, "8", true, true},
+		{"nota inválida é pulada", nil, []string{dfeResponse(138, "6", "6", summary, invalid)}, nil, true, false, 1, "6", false, true},
+		{"pool indisponível mantém o NSU", nil, []string{dfeResponse(138, "6", "6", summary, invalid)}, nil, false, true, 1, "5", false, true},
+		{"nenhum documento (137)", nil, []string{dfeResponse(137, "9", "9")}, nil, true, false, 1, "9", true, false},
+		{"consumo indevido (656)", &models.DfeDistributionState{LastNSU: dfe.PadNSU("3")}, []string{dfeResponse(656, "", "")}, nil, true, false, 1, "3", true, false},
+		{"falha na consulta", &models.DfeDistributionState{LastNSU: dfe.PadNSU("3")}, nil, errors.New("timeout"), true, true, 1, "3", false, false},
+		{"aguardando intervalo", &models.DfeDistributionState{LastNSU: dfe.PadNSU("3"), NextQueryAt: &later}, nil, nil, true, false, 0, "3", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupConsumerDB(t)
+			if tt.state != nil {
+				tt.state.CNPJ = dfeTestCNPJ
+				if err := db.Create(tt.state).Error; err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+			transport := &fakeTransport{t: t, responses: tt.responses, err: tt.transErr}
+			client := &dfe.Client{Transport: transport, URL: "https://dfe.invalid", TpAmb: "2", CUFAutor: "35"}
+			c := NewDfeConsumer(db, newTestPool(t, db, tt.running), client, nil, time.Hour)
+
+			err := c.Poll(context.Background(), dfeTestCNPJ)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Poll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if transport.calls != tt.wantCalls {
+				t.Errorf("consultas = %d, want %d", transport.calls, tt.wantCalls)
+			}
+
+			var state models.DfeDistributionState
+			db.Limit(1).Find(&state, "cnpj = ?", dfeTestCNPJ)
+			if state.LastNSU != dfe.PadNSU(tt.wantLastNSU) {
+				t.Errorf("LastNSU = %s, want %s", state.LastNSU, dfe.PadNSU(tt.wantLastNSU))
+			}
+			if (state.NextQueryAt != nil) != tt.wantNext {
+				t.Errorf("NextQueryAt = %v, want preenchido %v", state.NextQueryAt, tt.wantNext)
+			}
+
+			var summaries int64
+			db.Model(&models.DfeSummary{}).Count(&summaries)
+			if (summaries > 0) != tt.wantSummary {
+				t.Errorf("resumos gravados = %d, want %v", summaries, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestDfeConsumer_CountFailure(t *testing.T) {
+	db := setupConsumerDB(t)
+	c := NewDfeConsumer(db, nil, nil, nil, time.Hour)
+	state := models.DfeDistributionState{CNPJ: dfeTestCNPJ, LastNSU: dfe.PadNSU("5")}
+	doc := dfe.Document{NSU: "6", Schema: "procNFe_v4.00.xsd", Data: []byte(invalidNfeXML)}
+	docErr := &documentError{errors.New("deadlock ao gravar a nota")}
+
+	// Falha de infraestrutura não conta tentativa
+	if err := c.countFailure(&state, doc, errors.New("pool parado")); err == nil || state.FailedAttempts != 0 {
+		t.Fatalf("countFailure(pool) = %v, tentativas %d", err, state.FailedAttempts)
+	}
+
+	for attempt := 1; attempt < dfeMaxDocumentAttempts; attempt++ {
+		if err := c.countFailure(&state, doc, docErr); err == nil {
+			t.Fatalf("countFailure() tentativa %d = nil, want erro mantendo o NSU", attempt)
+		}
+	}
+	if state.FailedNSU != dfe.PadNSU("6") || state.FailedAttempts != dfeMaxDocumentAttempts-1 {
+		t.Errorf("estado = %s/%d", state.FailedNSU, state.FailedAttempts)
+	}
+
+	// Outro NSU recomeça a contagem
+	other := dfe.Document{NSU: "7", Schema: doc.Schema}
+	if err := c.countFailure(&state, other, docErr); err == nil || state.FailedNSU != dfe.PadNSU("7") || state.FailedAttempts != 1 {
+		t.Errorf("countFailure(outro NSU) = %v, estado %s/%d", err, state.FailedNSU, state.FailedAttempts)
+	}
+
+	state.FailedNSU, state.FailedAttempts = dfe.PadNSU("6"), dfeMaxDocumentAttempts-1
+	if err := c.countFailure(&state, doc, docErr); err != nil {
+		t.Fatalf("countFailure() última tentativa = %v, want nil", err)
+	}
+	var failed models.DfeFailedDocument
+	if err := db.First(&failed, "cnpj = ? AND nsu = ?", dfeTestCNPJ, dfe.PadNSU("6")).Error; err != nil {
+		t.Fatalf("documento não guardado: %v", err)
+	}
+	if failed.Attempts != dfeMaxDocumentAttempts || string(failed.Content) != invalidNfeXML || failed.Error == "" {
+		t.Errorf("documento guardado = %+v", failed)
+	}
+}
@@ -0,0 +1,242 @@
+package nfe_consumer
+
+import (
+	"context"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/worker_pools"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Subpastas para onde os arquivos da pasta monitorada são movidos
+const (
+	FolderProcessed = "processed"
+	FolderDuplicate = "duplicate"
+	FolderFailed    = "failed"
+)
+
+// DirectoryWatcher consome os XMLs e ZIPs gravados em uma pasta compartilhada
+// (ERP, escritório de contabilidade) e os envia ao pool de NF-e
+type DirectoryWatcher struct {
+	DB            *gorm.DB
+	NfeWorkerPool *worker_pools.NFeWorkerPool
+	Dir           string
+	Interval      time.Duration
+	// Tempo sem alteração para considerar o arquivo completo; evita ler um
+	// arquivo que ainda está sendo gravado
+	Settle time.Duration
+}
+
+func NewDirectoryWatcher(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool, dir string, interval time.Duration) *DirectoryWatcher {
+	return &DirectoryWatcher{
+		DB:            db,
+		NfeWorkerPool: nfePool,
+		Dir:           dir,
+		Interval:      interval,
+		Settle:        5 * time.Second,
+	}
+}
+
+func (w *DirectoryWatcher) Start(ctx context.Context) {
+	for _, folder := range []string{FolderProcessed, FolderDuplicate, FolderFailed} {
+		if err := os.MkdirAll(filepath.Join(w.Dir, folder), 0755); err != nil {
+			slog.Error("Erro ao preparar pasta monitorada de NF-e", "dir", w.Dir, "error", err)
+			return
+		}
+	}
+	slog.Info("Starting NFE Directory Watcher service", "dir", w.Dir, "interval", w.Interval)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	w.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping NFE Directory Watcher service")
+			return
+		case <-ticker.C:
+			w.scan(ctx)
+		}
+	}
+}
+
+// scan processa os arquivos da raiz da pasta; as subpastas de destino não são lidas
+func (w *DirectoryWatcher) scan(ctx context.Context) {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		slog.Error("Erro ao listar pasta monitorada de NF-e", "dir", w.Dir, "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if entry.IsDir() || !watchable(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < w.Settle {
+			continue
+		}
+		w.processFile(entry.Name())
+	}
+}
+
+// watchable aceita .xml e .zip, ignorando arquivos ocultos e temporários de cópia
+func watchable(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, ".") || strings.HasPrefix(lower, "~") {
+		return false
+	}
+	return strings.HasSuffix(lower, ".xml") || strings.HasSuffix(lower, ".zip")
+}
+
+// processFile importa um arquivo e o move para a subpasta do resultado. O
+// registro em watched_files é gravado antes de mover: se o serviço parar entre
+// as duas etapas, a próxima leitura só conclui a movimentação. Se parar antes do
+// registro, o reenvio ao pool resulta em duplicado pela chave/hash da nota.
+func (w *DirectoryWatcher) processFile(name string) {
+	path := filepath.Join(w.Dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Erro ao ler arquivo da pasta monitorada", "file", name, "error", err)
+		return
+	}
+	hash := services.ContentHash(data)
+
+	var record models.WatchedFile
+	if err := w.DB.Where("content_hash = ?", hash).Limit(1).Find(&record).Error; err != nil {
+		slog.Error("Erro ao consultar arquivos importados", "file", name, "error", err)
+		return
+	}
+	switch {
+	case record.ID != 0 && !record.Moved:
+		slog.Info("Concluindo arquivo importado antes da reinicialização", "file", name, "folder", record.Folder)
+		w.finish(&record, path)
+		return
+	case record.ID != 0 && record.Folder != FolderFailed:
+		// Mesmo conteúdo já importado; só falhas devolvidas à pasta são reprocessadas
+		if _, err := moveFile(path, filepath.Join(w.Dir, FolderDuplicate)); err != nil {
+			slog.Error("Erro ao mover arquivo da pasta monitorada", "file", name, "error", err)
+			return
+		}
+		slog.Info("Arquivo já importado anteriormente movido para duplicados", "file", name, "first_file", record.FileName)
+		return
+	}
+
+	folder, detail, ok := w.importFile(name, data)
+	if !ok {
+		return
+	}
+	record.ContentHash = hash
+	record.FileName = name
+	record.Folder = folder
+	record.Detail = &detail
+	record.Moved = false
+	if err := w.DB.Save(&record).Error; err != nil {
+		slog.Error("Erro ao registrar arquivo importado", "file", name, "error", err)
+		return
+	}
+	w.finish(&record, path)
+}
+
+// importFile envia cada documento do arquivo ao pool e decide a subpasta: failed
+// se algum documento falhou (inclusive conteúdo divergente retido para análise),
+// processed se algum foi registrado e duplicate se todos já existiam. ok falso
+// indica que o pool não aceitou o envio; o arquivo fica para a próxima leitura.
+func (w *DirectoryWatcher) importFile(name string, data []byte) (folder, detail string, ok bool) {
+	docs, err := services.ExtractNfeDocuments(name, data)
+	if err != nil {
+		return FolderFailed, fmt.Sprintf("%s: %v\n", name, err), true
+	}
+	if len(docs) == 0 {
+		return FolderFailed, name + ": nenhum XML encontrado no arquivo\n", true
+	}
+
+	var lines strings.Builder
+	failed, registered := false, false
+	for _, doc := range docs {
+		if doc.Err != nil {
+			failed = true
+			fmt.Fprintf(&lines, "%s: %s - %v\n", doc.Name, worker_pools.OutcomeInvalid, doc.Err)
+			continue
+		}
+
+		result, err := w.NfeWorkerPool.SubmitSync(worker_pools.NFeJob{
+			XMLData:   doc.Data,
+			UserID:    nil, // Processado pelo sistema
+			UserEmail: "directory-watch",
+		})
+		if err != nil {
+			slog.Warn("Pool de NF-e indisponível; arquivo mantido na pasta", "file", name, "error", err)
+			return "", "", false
+		}
+
+		outcome := result.Outcome()
+		fmt.Fprintf(&lines, "%s: %s", doc.Name, outcome)
+		if result.AccessKey != "" {
+			fmt.Fprintf(&lines, " (%s)", result.AccessKey)
+		}
+		if result.Error != nil && outcome != worker_pools.OutcomeDuplicate {
+			fmt.Fprintf(&lines, " - %v", result.Error)
+		}
+		lines.WriteString("\n")
+
+		switch outcome {
+		case worker_pools.OutcomeRegistered:
+			registered = true
+		case worker_pools.OutcomeDuplicate:
+		default:
+			failed = true
+		}
+	}
+
+	switch {
+	case failed:
+		folder = FolderFailed
+	case registered:
+		folder = FolderProcessed
+	default:
+		folder = FolderDuplicate
+	}
+	return folder, lines.String(), true
+}
+
+// finish move o arquivo para a subpasta registrada; falhas ganham um arquivo
+// <nome>.erro.txt ao lado com o resultado de cada documento
+func (w *DirectoryWatcher) finish(record *models.WatchedFile, path string) {
+	dest, err := moveFile(path, filepath.Join(w.Dir, record.Folder))
+	if err != nil {
+		slog.Error("Erro ao mover arquivo da pasta monitorada", "file", record.FileName, "error", err)
+		return
+	}
+	if record.Folder == FolderFailed && record.Detail != nil {
+		if err := os.WriteFile(dest+".erro.txt", []byte(*record.Detail), 0644); err != nil {
+			slog.Error("Erro ao gravar arquivo de erro", "file", dest, "error", err)
+		}
+	}
+	if err := w.DB.Model(record).Update("moved", true).Error; err != nil {
+		slog.Error("Erro ao registrar movimentação do arquivo", "file", record.FileName, "error", err)
+	}
+	slog.Info("Arquivo da pasta monitorada importado", "file", record.FileName, "folder", record.Folder)
+}
+
+// moveFile move o arquivo para dir sem sobrescrever: nomes repetidos recebem a data e hora
+func moveFile(path, dir string) (string, error) {
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(dir, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102-150405.000"), ext))
+	}
+	return dest, os.Rename(path, dest)
+}
@@ -0,0 +1,62 @@
+package nfe_consumer
+
+import (
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectoryWatcher_ProcessFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  *models.WatchedFile // Registro anterior do mesmo conteúdo
+		running   bool
+		wantDir   string // Subpasta final do arquivo; vazio quando fica na raiz
+		wantMoved bool
+	}{
+		{"nota inválida", nil, true, FolderFailed, true},
+		{"pool indisponível", nil, false, "", false},
+		{"parado antes de mover", &models.WatchedFile{Folder: FolderProcessed}, false, FolderProcessed, true},
+		{"já importado", &models.WatchedFile{Folder: FolderProcessed, Moved: true}, false, FolderDuplicate, true},
+		{"falha devolvida à pasta", &models.WatchedFile{Folder: FolderFailed, Moved: true}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupConsumerDB(t)
+			dir := t.TempDir()
+			for _, folder := range []string{FolderProcessed, FolderDuplicate, FolderFailed} {
+				os.Mkdir(filepath.Join(dir, folder), 0755)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "nota.xml"), []byte(invalidNfeXML), 0644); err != nil {
+				t.Fatal(err)
+			}
+			hash := services.ContentHash([]byte(invalidNfeXML))
+			if tt.existing != nil {
+				tt.existing.ContentHash = hash
+				tt.existing.FileName = "nota.xml"
+				if err := db.Create(tt.existing).Error; err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+
+			w := NewDirectoryWatcher(db, newTestPool(t, db, tt.running), dir, 0)
+			w.processFile("nota.xml")
+
+			if _, err := os.Stat(filepath.Join(dir, tt.wantDir, "nota.xml")); err != nil {
+				t.Errorf("arquivo fora de %q: %v", tt.wantDir, err)
+			}
+			_, err := os.Stat(filepath.Join(dir, FolderFailed, "nota.xml.erro.txt"))
+			if wantErrFile := tt.wantDir == FolderFailed; (err == nil) != wantErrFile {
+				t.Errorf("nota.xml.erro.txt gravado = %v, want %v", err == nil, wantErrFile)
+			}
+
+			var record models.WatchedFile
+			db.Limit(1).Find(&record, "content_hash = ?", hash)
+			if record.Moved != tt.wantMoved {
+				t.Errorf("Moved = %v, want %v", record.Moved, tt.wantMoved)
+			}
+		})
+	}
+}
@@ -1,86 +1,136 @@
 package nfe_consumer
 
 import (
-	"archive/zip"
 	"bytes"
+	"errors"
 	"estoque/internal/models"
+	"estoque/internal/services"
 	"estoque/internal/services/worker_pools"
+	"estoque/internal/utils"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
 	"github.com/emersion/go-message/mail"
 )
 
-func (c *Consumer) processEmails() {
-	var configs []models.EmailConfig
-	if err := c.DB.Where("active = ?", true).Limit(1).Find(&configs).Error; err != nil {
-		slog.Error("Erro ao buscar configuração de e-mail no banco", "error", err)
-		return
-	}
+// mailboxStats resume uma verificação da caixa
+type mailboxStats struct {
+	messages  int // E-mails lidos
+	documents int // Documentos registrados a partir dos anexos
 
-	if len(configs) == 0 {
-		slog.Info("Nenhuma configuração de e-mail ativa encontrada no banco.")
-		return
-	}
-	config := configs[0]
+	// Posição da leitura na pasta; uidValidity zero quando a pasta não foi lida
+	folder      string
+	uidValidity uint32
+	lastUID     uint32
+
+	actionErr error // Falha ao marcar ou mover os e-mails lidos
+}
 
+// openMailbox conecta, autentica e seleciona a pasta da caixa. A conexão fica
+// aberta entre as verificações (IDLE ou polling).
+func openMailbox(config models.EmailConfig, timeout time.Duration) (*client.Client, error) {
 	addr := net.JoinHostPort(config.IMAPHost, fmt.Sprintf("%d", config.IMAPPort))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
 	var imapClient *client.Client
 	var err error
 
 	if config.UseTLS {
-		imapClient, err = client.DialTLS(addr, nil)
+		imapClient, err = client.DialWithDialerTLS(dialer, addr, nil)
 	} else {
-		imapClient, err = client.Dial(addr)
+		imapClient, err = client.DialWithDialer(dialer, addr)
 	}
 
 	if err != nil {
-		slog.Error("IMAP connection error", "error", err)
-		return
+		return nil, fmt.Errorf("conexão IMAP: %w", err)
+	}
+	imapClient.Timeout = timeout
+
+	if err := imapClient.Login(config.IMAPUser, string(config.IMAPPassword)); err != nil {
+		imapClient.Logout()
+		return nil, fmt.Errorf("login IMAP: %w", err)
 	}
-	defer imapClient.Logout()
 
-	if err := imapClient.Login(config.IMAPUser, config.IMAPPassword); err != nil {
-		slog.Error("IMAP login error", "error", err)
-		return
+	if _, err := imapClient.Select(mailboxFolder(config), false); err != nil {
+		imapClient.Logout()
+		return nil, fmt.Errorf("seleção da pasta %s: %w", mailboxFolder(config), err)
 	}
+	return imapClient, nil
+}
+
+// checkMailbox processa os e-mails da pasta selecionada que chegaram depois do
+// último UID lido, independente de já estarem marcados como lidos (na primeira
+// leitura, a partir do não lido mais antigo), e move cada um para a pasta do
+// seu resultado. Erros de comunicação são devolvidos para o status da caixa e
+// derrubam a conexão.
+func (c *Consumer) checkMailbox(imapClient *client.Client, config models.EmailConfig) (stats mailboxStats, err error) {
+	// Um pânico ao ler uma mensagem não derruba as outras caixas
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pânico ao processar a caixa: %v", r)
+		}
+	}()
+	logger := slog.With("mailbox", mailboxName(config))
 
-	mbox, err := imapClient.Select(config.IMAPFolder, false)
+	mbox := imapClient.Mailbox()
+	if mbox == nil {
+		return stats, errors.New("nenhuma pasta selecionada")
+	}
+	stats.folder = mailboxFolder(config)
+	stats.uidValidity = mbox.UidValidity
+	lastUID, known, err := c.lastReadUID(config, stats.folder, mbox.UidValidity)
 	if err != nil {
-		slog.Error("IMAP folder selection error", "error", err)
-		return
+		return stats, fmt.Errorf("posição de leitura da caixa: %w", err)
 	}
+	if !known {
+		if lastUID, err = startingUID(imapClient, mbox); err != nil {
+			return stats, fmt.Errorf("posição inicial da caixa: %w", err)
+		}
+		logger.Info("Primeira leitura da pasta: e-mails já lidos são ignorados",
+			"folder", stats.folder, "after_uid", lastUID)
+	}
+	stats.lastUID = lastUID
 
 	if mbox.Messages == 0 {
-		slog.Info("A pasta selecionada está vazia", "folder", config.IMAPFolder)
-		return
+		logger.Debug("A pasta selecionada está vazia", "folder", mbox.Name)
+		return stats, nil
 	}
 
 	criteria := imap.NewSearchCriteria()
-	criteria.WithoutFlags = []string{imap.SeenFlag}
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(stats.lastUID+1, 0)
 
 	// Filtro de Assunto (opcional)
 	if config.IMAPSubjectFilter != "" {
 		criteria.Text = []string{config.IMAPSubjectFilter}
 	}
 
-	ids, err := imapClient.Search(criteria)
+	found, err := imapClient.UidSearch(criteria)
 	if err != nil {
-		slog.Error("IMAP search error", "error", err)
-		return
+		return stats, fmt.Errorf("busca IMAP: %w", err)
 	}
 
-	if len(ids) == 0 {
-		slog.Info("Nenhum e-mail não lido encontrado para processamento.")
-		return
+	// "N:*" sempre inclui a última mensagem, mesmo com UID menor que N
+	uids := new(imap.SeqSet)
+	count := 0
+	for _, uid := range found {
+		if uid > stats.lastUID {
+			uids.AddNum(uid)
+			count++
+		}
+	}
+	if count == 0 {
+		logger.Debug("Nenhum e-mail novo encontrado para processamento.")
+		return stats, nil
 	}
 
-	slog.Info("E-mails novos encontrados!", "quantidade", len(ids))
+	logger.Info("E-mails novos encontrados!", "quantidade", count)
 
 	// Lista de remetentes permitidos (opcional)
 	var allowedSenders []string
@@ -91,23 +141,29 @@ func (c *Consumer) processEmails() {
 		}
 	}
 
-	seqset := new(imap.SeqSet)
-	seqset.AddNum(ids...)
-
 	// Precisamos do Envelope para filtrar por remetente se o filtro estiver ativo
-	section := &imap.BodySectionName{}
-	fetchItems := []imap.FetchItem{section.FetchItem(), imap.FetchEnvelope}
+	section := &imap.BodySectionName{Peek: true}
+	fetchItems := []imap.FetchItem{section.FetchItem(), imap.FetchEnvelope, imap.FetchUid}
 
 	messages := make(chan *imap.Message, 10)
 	done := make(chan error, 1)
 	go func() {
-		done <- imapClient.Fetch(seqset, fetchItems, messages)
+		done <- imapClient.UidFetch(uids, fetchItems, messages)
 	}()
 
+	// Destino de cada e-mail lido; as ações são aplicadas depois da leitura
+	// porque o servidor não pode remover mensagens durante um FETCH
+	read := new(imap.SeqSet)
+	moves := make(map[string]*imap.SeqSet)
+
 	for msg := range messages {
+		stats.messages++
+		if msg.Uid > stats.lastUID {
+			stats.lastUID = msg.Uid
+		}
 		// Ensure Envelope is available for filtering
 		if msg.Envelope == nil {
-			slog.Debug("Email ignorado: Envelope não disponível", "seqnum", msg.SeqNum)
+			logger.Debug("Email ignorado: Envelope não disponível", "uid", msg.Uid)
 			continue
 		}
 
@@ -127,78 +183,262 @@ func (c *Consumer) processEmails() {
 				}
 			}
 			if !allowed {
-				slog.Debug("E-mail ignorado: Remetente não permitido", "from", fromAddress, "subject", msg.Envelope.Subject)
+				logger.Debug("E-mail ignorado: Remetente não permitido", "from", fromAddress, "subject", msg.Envelope.Subject)
 				continue
 			}
 		}
 
 		// Filtrar por assunto se configurado
 		if config.IMAPSubjectFilter != "" && !strings.Contains(strings.ToLower(msg.Envelope.Subject), strings.ToLower(config.IMAPSubjectFilter)) {
-			slog.Debug("E-mail ignorado: Assunto não condiz com o filtro", "subject", msg.Envelope.Subject, "from", fromAddress)
+			logger.Debug("E-mail ignorado: Assunto não condiz com o filtro", "subject", msg.Envelope.Subject, "from", fromAddress)
 			continue
 		}
 
+		// Base do histórico: um registro por anexo, ou pelo e-mail quando não há anexo
+		base := models.EmailIngestion{
+			EmailConfigID: config.ID,
+			MailboxName:   mailboxName(config),
+			UIDValidity:   stats.uidValidity,
+			UID:           msg.Uid,
+			MessageID:     utils.Truncate(msg.Envelope.MessageId, 255),
+			Sender:        utils.Truncate(fromAddress, 255),
+			Subject:       utils.Truncate(msg.Envelope.Subject, 500),
+		}
+		if !msg.Envelope.Date.IsZero() {
+			date := msg.Envelope.Date
+			base.EmailDate = &date
+		}
+
 		r := msg.GetBody(section)
 		if r == nil {
-			slog.Debug("E-mail ignorado: Corpo da mensagem não disponível", "subject", msg.Envelope.Subject, "from", fromAddress)
+			logger.Debug("E-mail ignorado: Corpo da mensagem não disponível", "subject", msg.Envelope.Subject, "from", fromAddress)
 			continue
 		}
 
-		// Processar partes da mensagem (anexos)
-		mr, err := mail.CreateReader(r)
-		if err != nil {
-			slog.Error("Erro ao criar reader de e-mail", "error", err)
-			continue
+		outcomes := c.processMessage(logger, base, r)
+		for _, outcome := range outcomes {
+			if outcome == worker_pools.OutcomeRegistered {
+				stats.documents++
+			}
 		}
 
-		foundAttachment := false
-		for {
-			p, err := mr.NextPart()
-			if err == io.EOF {
-				break
+		read.AddNum(msg.Uid)
+		if folder := destinationFolder(config, outcomes); folder != "" && !strings.EqualFold(folder, stats.folder) {
+			if moves[folder] == nil {
+				moves[folder] = new(imap.SeqSet)
 			}
-			if err != nil {
-				slog.Error("Erro ao ler parte do e-mail", "error", err)
-				break
+			moves[folder].AddNum(msg.Uid)
+		}
+	}
+
+	if err := <-done; err != nil {
+		return stats, fmt.Errorf("leitura IMAP: %w", err)
+	}
+	stats.actionErr = applyMessageActions(imapClient, read, moves)
+	return stats, nil
+}
+
+// lastReadUID devolve o último UID lido da pasta. known é falso quando a caixa
+// nunca foi lida, mudou de pasta ou a pasta mudou de UIDVALIDITY (recriada no
+// servidor): a posição gravada não vale e a leitura começa em startingUID.
+func (c *Consumer) lastReadUID(config models.EmailConfig, folder string, uidValidity uint32) (uid uint32, known bool, err error) {
+	var status models.EmailMailboxStatus
+	if err := c.DB.Limit(1).Find(&status, "email_config_id = ?", config.ID).Error; err != nil {
+		return 0, false, err
+	}
+	if status.UIDValidity == uidValidity && status.Folder == folder {
+		return status.LastUID, true, nil
+	}
+	if status.UIDValidity != 0 {
+		slog.Warn("UIDVALIDITY da pasta mudou; a leitura recomeça nos e-mails não lidos",
+			"mailbox", mailboxName(config), "folder", folder, "old", status.UIDValidity, "new", uidValidity)
+	}
+	return 0, false, nil
+}
+
+// startingUID define a posição da primeira leitura de uma pasta: logo antes do
+// e-mail não lido mais antigo ou, sem nenhum, no fim da pasta (UIDNEXT). O
+// histórico já lido na caixa não é reimportado.
+func startingUID(imapClient *client.Client, mbox *imap.MailboxStatus) (uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	unseen, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return 0, err
+	}
+	if len(unseen) > 0 {
+		lowest := unseen[0]
+		for _, uid := range unseen {
+			if uid < lowest {
+				lowest = uid
 			}
+		}
+		return lowest - 1, nil
+	}
+	if mbox.UidNext > 0 {
+		return mbox.UidNext - 1, nil
+	}
 
-			switch h := p.Header.(type) {
-			case *mail.AttachmentHeader:
-				filename, _ := h.Filename()
-				ext := strings.ToLower(filename)
-				if strings.HasSuffix(ext, ".xml") {
-					slog.Info("Identificado anexo XML de NF-e", "arquivo", filename)
-					c.processXMLAttachment(p.Body, filename)
-					foundAttachment = true
-				} else if strings.HasSuffix(ext, ".zip") {
-					slog.Info("Identificado anexo ZIP de NF-e", "arquivo", filename)
-					c.processZipAttachment(p.Body, filename)
-					foundAttachment = true
-				}
+	// Servidor sem UIDNEXT no SELECT: o fim da pasta é o maior UID existente
+	all, err := imapClient.UidSearch(imap.NewSearchCriteria())
+	if err != nil {
+		return 0, err
+	}
+	var highest uint32
+	for _, uid := range all {
+		if uid > highest {
+			highest = uid
+		}
+	}
+	return highest, nil
+}
+
+// processMessage importa os anexos XML/ZIP do e-mail, grava o histórico e
+// devolve o resultado de cada anexo (vazio quando não havia anexo de NF-e)
+func (c *Consumer) processMessage(logger *slog.Logger, base models.EmailIngestion, r io.Reader) []string {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		logger.Error("Erro ao criar reader de e-mail", "error", err)
+		row := base
+		row.Outcome = worker_pools.OutcomeError
+		row.Error = "Erro ao ler e-mail: " + err.Error()
+		c.saveIngestion(&row)
+		return []string{row.Outcome}
+	}
+
+	var outcomes []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Error("Erro ao ler parte do e-mail", "error", err)
+			row := base
+			row.Outcome = worker_pools.OutcomeError
+			row.Error = "Erro ao ler parte do e-mail: " + err.Error()
+			c.saveIngestion(&row)
+			outcomes = append(outcomes, row.Outcome)
+			break
+		}
+
+		switch h := p.Header.(type) {
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			ext := strings.ToLower(filename)
+			if strings.HasSuffix(ext, ".xml") {
+				logger.Info("Identificado anexo XML de NF-e", "arquivo", filename)
+				outcomes = append(outcomes, c.processXMLAttachment(base, p.Body, filename))
+			} else if strings.HasSuffix(ext, ".zip") {
+				logger.Info("Identificado anexo ZIP de NF-e", "arquivo", filename)
+				outcomes = append(outcomes, c.processZipAttachment(base, p.Body, filename)...)
 			}
 		}
+	}
+
+	if len(outcomes) == 0 {
+		logger.Debug("E-mail processado, mas nenhum anexo XML/ZIP encontrado", "subject", base.Subject, "from", base.Sender)
+		row := base
+		row.Outcome = OutcomeIgnored
+		c.saveIngestion(&row)
+	}
+	return outcomes
+}
 
-		if !foundAttachment {
-			slog.Debug("E-mail processado, mas nenhum anexo XML/ZIP encontrado", "subject", msg.Envelope.Subject, "from", fromAddress)
+// destinationFolder escolhe a pasta do e-mail pelos resultados dos anexos: uma
+// falha prevalece sobre os demais, e sem anexo de NF-e o e-mail é ignorado
+func destinationFolder(config models.EmailConfig, outcomes []string) string {
+	if len(outcomes) == 0 {
+		return config.IgnoredFolder
+	}
+	for _, outcome := range outcomes {
+		if outcome == worker_pools.OutcomeError || outcome == worker_pools.OutcomeInvalid {
+			return config.ErrorFolder
 		}
+	}
+	return config.ProcessedFolder
+}
 
-		// Marcar como lido (Visto)
-		seqSet := new(imap.SeqSet)
-		seqSet.AddNum(msg.SeqNum)
-		imapClient.Store(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil)
+// applyMessageActions marca os e-mails lidos e os move para as pastas de
+// destino, criando a pasta que ainda não existe. Só os nossos UIDs podem sair da
+// pasta: sem MOVE nem UIDPLUS (UID EXPUNGE) no servidor, o EXPUNGE simples
+// apagaria qualquer e-mail marcado como \Deleted por outro cliente, então os
+// e-mails ficam apenas marcados como lidos.
+func applyMessageActions(imapClient *client.Client, read *imap.SeqSet, moves map[string]*imap.SeqSet) error {
+	if read.Empty() {
+		return nil
+	}
+	if err := imapClient.UidStore(read, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+		return fmt.Errorf("marcar e-mails como lidos: %w", err)
+	}
+	if len(moves) == 0 {
+		return nil
 	}
 
-	if err := <-done; err != nil {
-		slog.Error("IMAP fetch finished with error", "error", err)
+	move, _ := imapClient.Support("MOVE")
+	uidPlus, _ := imapClient.Support("UIDPLUS")
+	if !move && !uidPlus {
+		slog.Warn("Servidor IMAP sem MOVE nem UIDPLUS; e-mails lidos ficam na pasta, marcados como lidos")
+		return nil
 	}
+
+	var errs []error
+	for folder, uids := range moves {
+		err := moveMessages(imapClient, uids, folder, move)
+		if err != nil && imapClient.Create(folder) == nil {
+			err = moveMessages(imapClient, uids, folder, move)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mover e-mails para %s: %w", folder, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// moveMessages move os UIDs com MOVE ou, sem ele, com COPY, \Deleted e UID
+// EXPUNGE restrito a esses UIDs. Uma falha no COPY (ex: pasta inexistente) não
+// deixa cópia; depois dele, o e-mail fica marcado e nenhum outro é apagado.
+func moveMessages(imapClient *client.Client, uids *imap.SeqSet, folder string, move bool) error {
+	if move {
+		return imapClient.UidMove(uids, folder)
+	}
+	if err := imapClient.UidCopy(uids, folder); err != nil {
+		return err
+	}
+	if err := imapClient.UidStore(uids, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return err
+	}
+	status, err := imapClient.Execute(&commands.Uid{Cmd: &uidExpunge{uids: uids}}, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// uidExpunge é o EXPUNGE do UIDPLUS (RFC 4315), enviado como UID EXPUNGE
+type uidExpunge struct {
+	uids *imap.SeqSet
 }
 
-func (c *Consumer) processXMLAttachment(r io.Reader, filename string) {
+func (cmd *uidExpunge) Command() *imap.Command {
+	return &imap.Command{Name: "EXPUNGE", Arguments: []interface{}{cmd.uids}}
+}
+
+// processXMLAttachment envia o anexo ao pool, grava o resultado no histórico
+// e o devolve
+func (c *Consumer) processXMLAttachment(base models.EmailIngestion, r io.Reader, filename string) string {
+	row := base
+	row.Filename = utils.Truncate(filename, 255)
+	defer c.saveIngestion(&row)
+
 	xmlData, err := io.ReadAll(r)
 	if err != nil {
 		slog.Error("Erro ao ler anexo XML", "file", filename, "error", err)
-		return
+		row.Outcome = worker_pools.OutcomeError
+		row.Error = "Erro ao ler anexo: " + err.Error()
+		return row.Outcome
 	}
+	row.Content, row.ContentSize = xmlData, len(xmlData)
 
 	job := worker_pools.NFeJob{
 		XMLData:   xmlData,
@@ -209,39 +449,72 @@ func (c *Consumer) processXMLAttachment(r io.Reader, filename string) {
 	result, err := c.NfeWorkerPool.SubmitSync(job)
 	if err != nil {
 		slog.Error("Erro ao processar NF-e de e-mail (pool)", "file", filename, "error", err)
-		return
+		row.Outcome = worker_pools.OutcomeError
+		row.Error = err.Error()
+		return row.Outcome
+	}
+	applyResult(&row, result)
+	if storedNfe(result) {
+		row.Content = nil
 	}
 
-	if result.Success {
+	if result.Duplicate {
+		slog.Info("NF-e de e-mail já registrada com o mesmo conteúdo", "file", filename, "access_key", result.AccessKey)
+	} else if result.Success && result.Document == services.DocumentEvent {
+		slog.Info("Evento de NF-e registrado via e-mail", "access_key", result.AccessKey, "event_type", result.EventType)
+	} else if result.Success {
 		slog.Info("NF-e processada com sucesso via e-mail", "access_key", result.AccessKey, "items", result.Items)
+	} else if result.ErrorCode == services.ErrNfeContentConflict.Code {
+		slog.Warn("NF-e de e-mail com conteúdo divergente retida para análise", "file", filename, "access_key", result.AccessKey, "error", result.Error)
+	} else if result.ErrorCode != "" {
+		slog.Warn("NF-e de e-mail rejeitada na validação", "file", filename, "access_key", result.AccessKey, "code", result.ErrorCode, "error", result.Error)
 	} else {
 		slog.Warn("Falha ao processar NF-e via e-mail", "file", filename, "error", result.Error)
 	}
+	return row.Outcome
 }
 
-func (c *Consumer) processZipAttachment(r io.Reader, filename string) {
+// processZipAttachment processa os XMLs do ZIP (um registro no histórico por
+// XML) e devolve o resultado de cada um
+func (c *Consumer) processZipAttachment(base models.EmailIngestion, r io.Reader, filename string) []string {
 	// Ler o ZIP completo para memória
 	zipData, err := io.ReadAll(r)
 	if err != nil {
 		slog.Error("Erro ao ler anexo ZIP", "file", filename, "error", err)
-		return
+		row := base
+		row.Filename = utils.Truncate(filename, 255)
+		row.Outcome = worker_pools.OutcomeError
+		row.Error = "Erro ao ler anexo: " + err.Error()
+		c.saveIngestion(&row)
+		return []string{row.Outcome}
 	}
 
-	zipReader, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	var outcomes []string
+	// Inclui pastas e ZIPs aninhados
+	docs, err := services.ExtractNfeDocuments(filename, zipData)
 	if err != nil {
-		slog.Error("Erro ao abrir arquivo ZIP", "file", filename, "error", err)
-		return
+		slog.Error("Erro ao extrair arquivo ZIP", "file", filename, "error", err)
+		row := base
+		row.Filename = utils.Truncate(filename, 255)
+		row.Outcome = worker_pools.OutcomeInvalid
+		row.Error = "Erro ao extrair arquivo ZIP: " + err.Error()
+		row.Content = zipData
+		c.saveIngestion(&row)
+		outcomes = append(outcomes, row.Outcome)
 	}
-
-	for _, f := range zipReader.File {
-		if strings.HasSuffix(strings.ToLower(f.Name), ".xml") {
-			rc, err := f.Open()
-			if err != nil {
-				slog.Error("Erro ao abrir arquivo dentro do ZIP", "zip", filename, "file", f.Name, "error", err)
-				continue
-			}
-			c.processXMLAttachment(rc, f.Name)
-			rc.Close()
+	// doc.Name já vem como "lote.zip/pasta/nota.xml"
+	for _, doc := range docs {
+		if doc.Err != nil {
+			slog.Error("Erro ao abrir arquivo dentro do ZIP", "zip", filename, "file", doc.Name, "error", doc.Err)
+			row := base
+			row.Filename = utils.Truncate(doc.Name, 255)
+			row.Outcome = worker_pools.OutcomeInvalid
+			row.Error = doc.Err.Error()
+			c.saveIngestion(&row)
+			outcomes = append(outcomes, row.Outcome)
+			continue
 		}
+		outcomes = append(outcomes, c.processXMLAttachment(base, bytes.NewReader(doc.Data), doc.Name))
 	}
+	return outcomes
 }
@@ -0,0 +1,182 @@
+package nfe_consumer
+
+import (
+	"bytes"
+	"estoque/internal/models"
+	"estoque/internal/secrets"
+	"estoque/internal/services/worker_pools"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+// nfeEmail é um e-mail com a nota (inválida) anexada
+const nfeEmail = "From: fornecedor@example.com\r\n" +
+	"To: nfe@example.com\r\n" +
+	"Subject: NF-e 1234\r\n" +
+	"Message-ID: <nfe-1234@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=limite\r\n" +
+	"\r\n" +
+	"--limite\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Segue a nota.\r\n" +
+	"--limite\r\n" +
+	"Content-Type: application/xml\r\n" +
+	"Content-Disposition: attachment; filename=nota.xml\r\n" +
+	"\r\n" +
+	invalidNfeXML + "\r\n" +
+	"--limite--\r\n"
+
+// imapStandIn sobe um servidor IMAP em memória; a caixa INBOX já traz um e-mail
+// lido e sem anexo (UID 6)
+func imapStandIn(t *testing.T) models.EmailConfig {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+
+	var config models.EmailConfig
+	config.ID = 1
+	config.IMAPHost, config.IMAPPort = "127.0.0.1", listener.Addr().(*net.TCPAddr).Port
+	config.IMAPUser, config.IMAPPassword = "username", secrets.String("password")
+	return config
+}
+
+func TestDestinationFolder(t *testing.T) {
+	config := models.EmailConfig{ProcessedFolder: "NFe/Importadas", ErrorFolder: "NFe/Erros", IgnoredFolder: "NFe/Outros"}
+
+	tests := []struct {
+		name     string
+		config   models.EmailConfig
+		outcomes []string
+		want     string
+	}{
+		{"registrada", config, []string{worker_pools.OutcomeRegistered}, "NFe/Importadas"},
+		{"duplicada", config, []string{worker_pools.OutcomeDuplicate}, "NFe/Importadas"},
+		{"suspeita", config, []string{worker_pools.OutcomeSuspicious}, "NFe/Importadas"},
+		{"erro prevalece", config, []string{worker_pools.OutcomeRegistered, worker_pools.OutcomeError}, "NFe/Erros"},
+		{"inválida prevalece", config, []string{worker_pools.OutcomeInvalid, worker_pools.OutcomeDuplicate}, "NFe/Erros"},
+		{"sem anexo de NF-e", config, nil, "NFe/Outros"},
+		{"sem pastas configuradas", models.EmailConfig{}, []string{worker_pools.OutcomeError}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := destinationFolder(tt.config, tt.outcomes); got != tt.want {
+				t.Errorf("destinationFolder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// selectInbox abre a caixa do servidor em memória e anexa os e-mails com as flags dadas
+func selectInbox(t *testing.T, config models.EmailConfig, flags ...[]string) *client.Client {
+	t.Helper()
+	imapClient, err := openMailbox(config, time.Minute)
+	if err != nil {
+		t.Fatalf("openMailbox() error = %v", err)
+	}
+	t.Cleanup(func() { imapClient.Logout() })
+	for _, f := range flags {
+		if err := imapClient.Append("INBOX", f, time.Now(), bytes.NewBufferString(nfeEmail)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if _, err := imapClient.Select("INBOX", false); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	return imapClient
+}
+
+func TestConsumer_CheckMailbox(t *testing.T) {
+	db := setupConsumerDB(t)
+	config := imapStandIn(t)
+	c := NewConsumer(db, newTestPool(t, db, true))
+	imapClient := selectInbox(t, config, nil)
+
+	// Primeira leitura: o e-mail já lido (UID 6) fica de fora
+	stats, err := c.checkMailbox(imapClient, config)
+	if err != nil || stats.actionErr != nil {
+		t.Fatalf("checkMailbox() error = %v, actionErr = %v", err, stats.actionErr)
+	}
+	if stats.messages != 1 || stats.lastUID != 7 || stats.folder != "INBOX" {
+		t.Errorf("stats = %+v, want 1 e-mail até o UID 7 em INBOX", stats)
+	}
+	if err := recordMailboxStatus(db, config.ID, stats, nil, ModePolling); err != nil {
+		t.Fatalf("recordMailboxStatus() error = %v", err)
+	}
+
+	var rows []models.EmailIngestion
+	db.Order("uid").Find(&rows)
+	if len(rows) != 1 {
+		t.Fatalf("histórico = %d registros, want 1", len(rows))
+	}
+	if rows[0].UID != 7 || rows[0].Outcome != worker_pools.OutcomeInvalid || rows[0].Filename != "nota.xml" ||
+		!strings.Contains(string(rows[0].Content), "<NFe/>") || rows[0].Sender != "fornecedor@example.com" {
+		t.Errorf("anexo = UID %d %s %s %q de %s", rows[0].UID, rows[0].Outcome, rows[0].Filename, rows[0].Content, rows[0].Sender)
+	}
+
+	// O e-mail lido fica marcado como lido, na pasta (sem pastas de destino)
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(7)
+	messages := make(chan *imap.Message, 1)
+	if err := imapClient.UidFetch(seqset, []imap.FetchItem{imap.FetchFlags}, messages); err != nil {
+		t.Fatalf("UidFetch() error = %v", err)
+	}
+	msg := <-messages
+	if msg == nil || len(msg.Flags) == 0 || msg.Flags[0] != imap.SeenFlag {
+		t.Errorf("flags do UID 7 = %v, want \\Seen", msg)
+	}
+
+	// A próxima verificação começa depois do último UID lido
+	stats, err = c.checkMailbox(imapClient, config)
+	if err != nil || stats.messages != 0 || stats.lastUID != 7 {
+		t.Errorf("segunda verificação = %+v, %v", stats, err)
+	}
+}
+
+func TestConsumer_CheckMailboxReadHistory(t *testing.T) {
+	db := setupConsumerDB(t)
+	config := imapStandIn(t)
+	c := NewConsumer(db, newTestPool(t, db, true))
+	// Pasta em uso antes da configuração: todos os e-mails já foram lidos
+	imapClient := selectInbox(t, config, []string{imap.SeenFlag}, []string{imap.SeenFlag})
+
+	stats, err := c.checkMailbox(imapClient, config)
+	if err != nil {
+		t.Fatalf("checkMailbox() error = %v", err)
+	}
+	if stats.messages != 0 || stats.lastUID != 8 {
+		t.Errorf("primeira leitura = %+v, want nenhum e-mail e posição no UID 8", stats)
+	}
+	if err := recordMailboxStatus(db, config.ID, stats, nil, ModePolling); err != nil {
+		t.Fatalf("recordMailboxStatus() error = %v", err)
+	}
+
+	// Só o que chega depois é importado, mesmo que já venha marcado como lido
+	if err := imapClient.Append("INBOX", []string{imap.SeenFlag}, time.Now(), bytes.NewBufferString(nfeEmail)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	stats, err = c.checkMailbox(imapClient, config)
+	if err != nil || stats.messages != 1 || stats.lastUID != 9 {
+		t.Errorf("segunda verificação = %+v, %v; want 1 e-mail até o UID 9", stats, err)
+	}
+
+	var rows []models.EmailIngestion
+	db.Find(&rows)
+	if len(rows) != 1 || rows[0].UID != 9 {
+		t.Errorf("histórico = %+v, want apenas o UID 9", rows)
+	}
+}
@@ -0,0 +1,95 @@
+package nfe_consumer
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/worker_pools"
+	"estoque/internal/utils"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutcomeIgnored marca o e-mail lido sem anexo XML/ZIP; os demais resultados
+// são os do pool (worker_pools.Outcome*)
+const OutcomeIgnored = "IGNORADO"
+
+var ErrIngestionNotRetryable = errors.New("só anexos XML com erro ou rejeitados na validação podem ser reprocessados")
+
+// Retryable indica se o anexo pode ser reenviado ao pool: XML guardado cujo
+// processamento falhou (um ZIP que não abriu não tem o que reprocessar)
+func Retryable(row *models.EmailIngestion) bool {
+	if row.Outcome != worker_pools.OutcomeError && row.Outcome != worker_pools.OutcomeInvalid {
+		return false
+	}
+	return len(row.Content) > 0 && !strings.HasSuffix(strings.ToLower(row.Filename), ".zip")
+}
+
+// applyResult copia o resultado do pool para o registro do anexo
+func applyResult(row *models.EmailIngestion, result worker_pools.NFeResult) {
+	row.Outcome = result.Outcome()
+	row.ErrorCode = result.ErrorCode
+	row.Error = ""
+	if result.Error != nil && row.Outcome != worker_pools.OutcomeDuplicate {
+		row.Error = result.Error.Error()
+	}
+	if result.AccessKey != "" {
+		row.AccessKey = utils.Truncate(result.AccessKey, 50)
+	}
+}
+
+// storedNfe indica se o anexo é uma NF-e registrada (ou já registrada): o XML
+// fica em processed_nfes.xml_data e o histórico guarda só a chave de acesso
+func storedNfe(result worker_pools.NFeResult) bool {
+	return result.Success && result.Document == services.DocumentNfe && result.AccessKey != ""
+}
+
+// saveIngestion grava o registro; uma falha aqui não interrompe a leitura da caixa
+func (c *Consumer) saveIngestion(row *models.EmailIngestion) {
+	if len(row.Content) > 0 {
+		row.ContentSize = len(row.Content)
+	}
+	if err := c.DB.Create(row).Error; err != nil {
+		slog.Error("Erro ao gravar histórico de importação de e-mail", "file", row.Filename, "error", err)
+	}
+}
+
+// RetryIngestion reenvia ao pool o anexo guardado de uma importação que falhou
+// e grava o novo resultado
+func RetryIngestion(db *gorm.DB, pool *worker_pools.NFeWorkerPool, id int32, userID *int32, userEmail string) (*models.EmailIngestion, error) {
+	var row models.EmailIngestion
+	if err := db.First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	if !Retryable(&row) {
+		return &row, ErrIngestionNotRetryable
+	}
+
+	result, err := pool.SubmitSync(worker_pools.NFeJob{
+		XMLData:   row.Content,
+		UserID:    userID,
+		UserEmail: userEmail,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	applyResult(&row, result)
+	now := time.Now()
+	row.Attempts++
+	row.RetriedAt = &now
+	row.RetriedBy = userID
+	columns := []string{"outcome", "error_code", "error", "access_key", "attempts", "retried_at", "retried_by"}
+	if storedNfe(result) {
+		// A nota passou a estar em processed_nfes
+		row.Content = nil
+		columns = append(columns, "content")
+	}
+	if err := db.Model(&row).Select(columns).Updates(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
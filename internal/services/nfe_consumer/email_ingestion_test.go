@@ -0,0 +1,58 @@
+package nfe_consumer
+
+import (
+	"estoque/internal/models"
+	"estoque/internal/services"
+	"estoque/internal/services/worker_pools"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	xml := []byte(invalidNfeXML)
+
+	tests := []struct {
+		name string
+		row  models.EmailIngestion
+		want bool
+	}{
+		{"XML com erro", models.EmailIngestion{Filename: "nota.xml", Outcome: worker_pools.OutcomeError, Content: xml}, true},
+		{"XML inválido", models.EmailIngestion{Filename: "nota.xml", Outcome: worker_pools.OutcomeInvalid, Content: xml}, true},
+		{"XML de dentro do ZIP", models.EmailIngestion{Filename: "lote.zip/nota.xml", Outcome: worker_pools.OutcomeError, Content: xml}, true},
+		{"ZIP que não abriu", models.EmailIngestion{Filename: "lote.ZIP", Outcome: worker_pools.OutcomeError, Content: []byte("PK")}, false},
+		{"sem conteúdo guardado", models.EmailIngestion{Filename: "nota.xml", Outcome: worker_pools.OutcomeError}, false},
+		{"registrada", models.EmailIngestion{Filename: "nota.xml", Outcome: worker_pools.OutcomeRegistered, Content: xml}, false},
+		{"suspeita", models.EmailIngestion{Filename: "nota.xml", Outcome: worker_pools.OutcomeSuspicious, Content: xml}, false},
+		{"e-mail sem anexo", models.EmailIngestion{Outcome: OutcomeIgnored}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(&tt.row); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredNfe(t *testing.T) {
+	const key = "35240112345678000195550010000012341123456785"
+
+	tests := []struct {
+		name   string
+		result worker_pools.NFeResult
+		want   bool
+	}{
+		{"nota registrada", worker_pools.NFeResult{Success: true, AccessKey: key, Document: services.DocumentNfe}, true},
+		{"nota já registrada", worker_pools.NFeResult{Success: true, Duplicate: true, AccessKey: key, Document: services.DocumentNfe}, true},
+		{"evento registrado", worker_pools.NFeResult{Success: true, AccessKey: key, Document: services.DocumentEvent}, false},
+		{"conteúdo divergente", worker_pools.NFeResult{AccessKey: key, ErrorCode: services.ErrNfeContentConflict.Code}, false},
+		{"rejeitada na validação", worker_pools.NFeResult{AccessKey: key, ErrorCode: "CHAVE_DV_INVALIDO"}, false},
+		{"erro de processamento", worker_pools.NFeResult{AccessKey: key}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storedNfe(tt.result); got != tt.want {
+				t.Errorf("storedNfe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
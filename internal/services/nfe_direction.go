@@ -0,0 +1,189 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Sentido da nota em relação ao nosso estoque
+const (
+	DirectionInbound  = "ENTRADA"
+	DirectionOutbound = "SAIDA"
+)
+
+// Natureza da operação deduzida do CFOP
+const (
+	OperationPurchase = "COMPRA"
+	OperationSale     = "VENDA"
+	OperationTransfer = "TRANSFERENCIA"
+	OperationReturn   = "DEVOLUCAO"
+	OperationShipment = "REMESSA"
+	OperationOther    = "OUTRA"
+)
+
+var (
+	ErrNfeCfopDirection     = &NfeValidationError{Code: "CFOP_DIVERGENTE_TPNF", Message: "CFOP dos itens diverge do tipo da nota (tpNF)"}
+	ErrNfeInsufficientStock = &NfeValidationError{Code: "ESTOQUE_INSUFICIENTE", Message: "estoque insuficiente para a saída da nota"}
+)
+
+// ParseOwnCNPJs extrai os documentos da lista configurada (vírgula, ponto e vírgula ou quebra de linha)
+func ParseOwnCNPJs(list string) []string {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\n' || r == '\r' || r == ' '
+	})
+	docs := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		doc := onlyDigits(f)
+		if doc == "" || seen[doc] {
+			continue
+		}
+		seen[doc] = true
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// isOwnDocument indica se o emitente é um dos CNPJs da própria empresa
+func isOwnDocument(ownCNPJs []string, doc string) bool {
+	if doc == "" {
+		return false
+	}
+	for _, own := range ownCNPJs {
+		if own == doc {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyNfe define sentido e natureza da operação. Notas de terceiros são sempre
+// entradas; notas emitidas por nós seguem o tpNF, que precisa concordar com o CFOP
+// dos itens (1/2/3 entrada, 5/6/7 saída).
+func ClassifyNfe(proc *models.NfeProc, issuedByUs bool) (direction, operation string, err error) {
+	if !issuedByUs {
+		return DirectionInbound, "", nil
+	}
+
+	direction = DirectionInbound
+	if strings.TrimSpace(proc.NFe.InfNFe.Ide.TpNF) == "1" {
+		direction = DirectionOutbound
+	}
+
+	for _, det := range proc.NFe.InfNFe.Det {
+		cfop := onlyDigits(det.Prod.CFOP)
+		if cfop == "" {
+			continue
+		}
+		if cfopDirection(cfop) != direction {
+			return direction, "", &NfeValidationError{
+				Code:    ErrNfeCfopDirection.Code,
+				Message: fmt.Sprintf("%s (item %d, CFOP %s)", ErrNfeCfopDirection.Message, det.NItem, cfop),
+			}
+		}
+		if operation == "" {
+			operation = CfopOperation(cfop)
+		}
+	}
+	if operation == "" {
+		operation = OperationOther
+	}
+	return direction, operation, nil
+}
+
+// cfopDirection retorna o sentido indicado pelo primeiro dígito do CFOP
+func cfopDirection(cfop string) string {
+	switch cfop[0] {
+	case '5', '6', '7':
+		return DirectionOutbound
+	}
+	return DirectionInbound
+}
+
+// CfopOperation agrupa o CFOP na natureza da operação usada nos filtros e relatórios
+func CfopOperation(cfop string) string {
+	cfop = onlyDigits(cfop)
+	if len(cfop) != 4 {
+		return OperationOther
+	}
+	group := cfop[1:]
+	switch {
+	case group >= "151" && group <= "159", group >= "408" && group <= "409":
+		return OperationTransfer
+	case group[0] == '2', group >= "410" && group <= "413":
+		return OperationReturn
+	case group[0] == '1', group[0] == '4':
+		if cfopDirection(cfop) == DirectionOutbound {
+			return OperationSale
+		}
+		return OperationPurchase
+	case group[0] == '9':
+		return OperationShipment
+	}
+	return OperationOther
+}
+
+// resolveNfeProducts resolve os itens pelos mapeamentos do emitente; em notas
+// emitidas por nós o cProd já é o código interno, usado quando não há mapeamento
+func resolveNfeProducts(tx *gorm.DB, nfe *models.ProcessedNFe, supplierCNPJ string, items []models.NFeItem) (map[string]string, error) {
+	resolved, err := resolveMappings(tx, supplierCNPJ, items)
+	if err != nil || !nfe.IssuedByUs {
+		return resolved, err
+	}
+
+	var codes []string
+	for _, item := range items {
+		if _, ok := resolved[item.Code]; !ok {
+			codes = append(codes, item.Code)
+		}
+	}
+	if len(codes) == 0 {
+		return resolved, nil
+	}
+
+	var existing []string
+	if err := tx.Model(&models.Product{}).Where("code IN ? AND active = ?", codes, true).Pluck("code", &existing).Error; err != nil {
+		return nil, err
+	}
+	for _, code := range existing {
+		resolved[code] = code
+	}
+	return resolved, nil
+}
+
+// checkOutboundStock confere, antes de qualquer baixa, se há saldo para todos os
+// produtos da nota de saída (somando linhas repetidas do mesmo produto)
+func checkOutboundStock(tx *gorm.DB, required map[string]float64) error {
+	codes := make([]string, 0, len(required))
+	for code := range required {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var stocks []models.Stock
+	if err := tx.Where("product_code IN ?", codes).Find(&stocks).Error; err != nil {
+		return err
+	}
+	available := make(map[string]float64, len(stocks))
+	for _, st := range stocks {
+		available[st.ProductCode] = st.Quantity
+	}
+
+	var missing []string
+	for _, code := range codes {
+		if available[code] < required[code] {
+			missing = append(missing, fmt.Sprintf("%s: saldo %.4g, saída %.4g", code, available[code], required[code]))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &NfeValidationError{
+		Code:    ErrNfeInsufficientStock.Code,
+		Message: fmt.Sprintf("%s (%s)", ErrNfeInsufficientStock.Message, strings.Join(missing, "; ")),
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOwnCNPJs(t *testing.T) {
+	got := ParseOwnCNPJs("12.345.678/0001-95, 98765432000110;\n12345678000195 ")
+	want := []string{"12345678000195", "98765432000110"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOwnCNPJs() = %v, want %v", got, want)
+	}
+	if got := ParseOwnCNPJs(""); len(got) != 0 {
+		t.Errorf("ParseOwnCNPJs(\"\") = %v, want vazio", got)
+	}
+}
+
+func TestCfopOperation(t *testing.T) {
+	tests := []struct {
+		cfop string
+		want string
+	}{
+		{"5102", OperationSale},
+		{"6.108", OperationSale},
+		{"5405", OperationSale},
+		{"1102", OperationPurchase},
+		{"5152", OperationTransfer},
+		{"5409", OperationTransfer},
+		{"5202", OperationReturn},
+		{"1202", OperationReturn},
+		{"5411", OperationReturn},
+		{"5915", OperationShipment},
+		{"5551", OperationOther},
+		{"51", OperationOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cfop, func(t *testing.T) {
+			if got := CfopOperation(tt.cfop); got != tt.want {
+				t.Errorf("CfopOperation(%q) = %v, want %v", tt.cfop, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyNfe(t *testing.T) {
+	proc := parseSampleNfe(t)
+
+	// Nota de terceiro é sempre entrada, mesmo com tpNF=1
+	if dir, op, err := ClassifyNfe(&proc, false); err != nil || dir != DirectionInbound || op != "" {
+		t.Errorf("ClassifyNfe(terceiro) = %v, %v, %v", dir, op, err)
+	}
+
+	// Emitida por nós com tpNF=1 e CFOP 5102: saída de venda
+	if dir, op, err := ClassifyNfe(&proc, true); err != nil || dir != DirectionOutbound || op != OperationSale {
+		t.Errorf("ClassifyNfe(própria) = %v, %v, %v", dir, op, err)
+	}
+
+	// tpNF de entrada com CFOP de saída é rejeitado
+	proc.NFe.InfNFe.Ide.TpNF = "0"
+	if _, _, err := ClassifyNfe(&proc, true); NfeErrorCode(err) != ErrNfeCfopDirection.Code {
+		t.Errorf("ClassifyNfe(tpNF divergente) error = %v, want %s", err, ErrNfeCfopDirection.Code)
+	}
+
+	// Entrada própria (ex: devolução de cliente)
+	for i := range proc.NFe.InfNFe.Det {
+		proc.NFe.InfNFe.Det[i].Prod.CFOP = "1202"
+	}
+	if dir, op, err := ClassifyNfe(&proc, true); err != nil || dir != DirectionInbound || op != OperationReturn {
+		t.Errorf("ClassifyNfe(devolução) = %v, %v, %v", dir, op, err)
+	}
+}
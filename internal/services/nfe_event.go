@@ -0,0 +1,341 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"estoque/internal/models"
+	"estoque/internal/utils"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tipos de documento fiscal reconhecidos na entrada
+const (
+	DocumentNfe   = "NFE"
+	DocumentEvent = "EVENTO"
+)
+
+// Tipos de evento da NF-e (tpEvento)
+const (
+	EventCancellation = "110111"
+	EventCorrection   = "110110"
+)
+
+var (
+	ErrNfeEventInvalid       = &NfeValidationError{Code: "EVENTO_INVALIDO", Message: "evento da NF-e sem tipo ou chave de acesso"}
+	ErrNfeEventNotRegistered = &NfeValidationError{Code: "EVENTO_NAO_REGISTRADO", Message: "evento sem retorno de registro válido da SEFAZ (retEvento)"}
+	ErrNfeEventKeyMismatch   = &NfeValidationError{Code: "EVENTO_CHAVE_DIVERGENTE", Message: "retorno do evento pertence a outra chave de acesso"}
+	ErrNfeEventMismatch      = &NfeValidationError{Code: "EVENTO_RETORNO_DIVERGENTE", Message: "retorno da SEFAZ pertence a outro tipo ou sequência de evento"}
+	ErrNfeEventAuthor        = &NfeValidationError{Code: "EVENTO_AUTOR_DIVERGENTE", Message: "evento do emitente enviado por outro CNPJ"}
+	ErrNfeCancelled          = &NfeValidationError{Code: "NFE_CANCELADA", Message: "NF-e cancelada pelo emitente não pode gerar entrada de estoque"}
+	ErrNfeEventApplied       = &NfeValidationError{Code: "EVENTO_JA_APLICADO", Message: "evento já aplicado à nota"}
+	ErrNfeEventWithoutNfe    = &NfeValidationError{Code: "EVENTO_SEM_NOTA", Message: "a nota do evento ainda não foi recebida"}
+)
+
+// DetectDocumentType identifica pelo elemento raiz se o XML é uma NF-e ou um evento
+func DetectDocumentType(xmlData []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(xmlData))
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "nfeProc", "NFe":
+				return DocumentNfe
+			case "procEventoNFe":
+				return DocumentEvent
+			}
+			return ""
+		}
+	}
+}
+
+// EventDescription retorna a descrição legível do tipo de evento
+func EventDescription(eventType string) string {
+	switch eventType {
+	case EventCancellation:
+		return "Cancelamento"
+	case EventCorrection:
+		return "Carta de Correção"
+	}
+	return "Evento " + eventType
+}
+
+// eventSignaturePath é a posição de infEvento lida em models.ProcEventoNFe
+var eventSignaturePath = []string{"procEventoNFe", "evento", "infEvento"}
+
+// VerifyEventSignature confere a assinatura do autor sobre o infEvento lido em proc
+func VerifyEventSignature(proc *models.ProcEventoNFe, xmlData []byte) NfeSignatureCheck {
+	inf := proc.Evento.InfEvento
+	return verifySignature(xmlData, inf.ID, eventSignaturePath, inf.CNPJ, inf.DhEvento)
+}
+
+// RegisterEvent grava um procEventoNFe e o vincula à nota correspondente. Um
+// cancelamento marca a nota como CANCELADA e estorna o estoque se ela já tiver
+// sido processada. Se a nota ainda não foi recebida, o efeito é aplicado quando
+// ela for registrada. signature é o resultado de VerifyEventSignature, já
+// submetido à política configurada: cancelamentos sem assinatura VALIDA ficam
+// registrados sem efeito sobre a nota, à espera de ApplyEvent.
+func (s *NfeService) RegisterEvent(proc *models.ProcEventoNFe, xmlData []byte, signature *NfeSignatureCheck) (*models.NFeEvent, error) {
+	inf := proc.Evento.InfEvento
+	accessKey := NormalizeAccessKey(inf.ChNFe)
+	if accessKey == "" || strings.TrimSpace(inf.TpEvento) == "" {
+		return nil, ErrNfeEventInvalid
+	}
+	if err := ValidateAccessKey(accessKey); err != nil {
+		return nil, err
+	}
+
+	ret := proc.RetEvento.InfEvento
+	if !eventRegistered(ret.CStat) {
+		return nil, ErrNfeEventNotRegistered
+	}
+	if ret.ChNFe != "" && NormalizeAccessKey(ret.ChNFe) != accessKey {
+		return nil, ErrNfeEventKeyMismatch
+	}
+	if (ret.TpEvento != "" && strings.TrimSpace(ret.TpEvento) != strings.TrimSpace(inf.TpEvento)) ||
+		(ret.NSeqEvento != 0 && ret.NSeqEvento != max(inf.NSeqEvento, 1)) {
+		return nil, ErrNfeEventMismatch
+	}
+	// Cancelamento e carta de correção só podem ser feitos pelo emitente (CNPJ da chave)
+	if emitterEvent(inf.TpEvento) && onlyDigits(inf.CNPJ) != accessKey[6:20] {
+		return nil, ErrNfeEventAuthor
+	}
+
+	sequence := inf.NSeqEvento
+	if sequence == 0 {
+		sequence = 1
+	}
+	event := models.NFeEvent{
+		AccessKey:     accessKey,
+		EventType:     strings.TrimSpace(inf.TpEvento),
+		Sequence:      sequence,
+		Description:   utils.Truncate(firstNonEmpty(inf.DetEvento.DescEvento, EventDescription(inf.TpEvento)), 100),
+		Justification: optionalString(firstNonEmpty(inf.DetEvento.XJust, inf.DetEvento.XCorrecao)),
+		Protocol:      optionalString(ret.NProt),
+		StatusCode:    int32(ret.CStat),
+		XMLData:       xmlData,
+	}
+	event.SignatureStatus = SignatureNotVerified
+	if signature != nil {
+		event.SignatureStatus = signature.Status
+		if signature.Error != nil {
+			event.SignatureError = stringPtr(utils.Truncate(signature.Error.Error(), 255))
+		}
+	}
+	if t, ok := parseFiscalDateTime(inf.DhEvento); ok {
+		event.EventAt = &t
+	}
+	if t, ok := parseFiscalDateTime(ret.DhRegEvento); ok {
+		event.RegisteredAt = &t
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.NFeEvent{}).
+			Where("access_key = ? AND event_type = ? AND sequence = ?", event.AccessKey, event.EventType, event.Sequence).
+			Count(&count)
+		if count > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+
+		var nfe models.ProcessedNFe
+		err := tx.First(&nfe, "access_key IN ?", []string{accessKey, "NFe" + accessKey}).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err == nil {
+			if err := applyEvent(tx, &nfe, &event); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// applyPendingEvents aplica eventos recebidos antes da própria nota
+func applyPendingEvents(tx *gorm.DB, nfe *models.ProcessedNFe) error {
+	var events []models.NFeEvent
+	if err := tx.Where("access_key = ? AND applied = ?", nfe.AccessKey, false).Order("id ASC").Find(&events).Error; err != nil {
+		return err
+	}
+	for i := range events {
+		if err := applyEvent(tx, nfe, &events[i]); err != nil {
+			return err
+		}
+		if events[i].Applied {
+			if err := tx.Model(&events[i]).Update("applied", true).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyEvent executa o efeito do evento sobre a nota. Apenas o cancelamento altera
+// estado, e só é aplicado automaticamente quando a assinatura do emitente confere
+// e a cadeia ICP-Brasil foi validada (VALIDA). Sem isso, inclusive sem
+// ICP_BRASIL_ROOTS configurado, o cancelamento fica pendente até um
+// administrador aplicá-lo com ApplyEvent.
+func applyEvent(tx *gorm.DB, nfe *models.ProcessedNFe, event *models.NFeEvent) error {
+	if event.EventType != EventCancellation {
+		event.Applied = true
+		return nil
+	}
+	if event.SignatureStatus != SignatureValid {
+		slog.Warn("Cancelamento de NF-e sem assinatura válida aguardando aplicação manual",
+			"access_key", nfe.AccessKey,
+			"signature_status", event.SignatureStatus,
+		)
+		return nil
+	}
+	if err := cancelNfe(tx, nfe, nil, "Cancelamento registrado pelo emitente"); err != nil {
+		return err
+	}
+	event.Applied = true
+	return nil
+}
+
+// ApplyEvent aplica manualmente um evento que ficou pendente (cancelamento cuja
+// assinatura não pôde ser validada), depois que um administrador conferiu o
+// cancelamento na SEFAZ. O motivo fica no histórico de status da nota.
+func (s *NfeService) ApplyEvent(accessKey string, eventID int32, reason string, userID *int32) (*models.NFeEvent, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrNfeReasonRequired
+	}
+
+	var event models.NFeEvent
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&event, "id = ? AND access_key = ?", eventID, NormalizeAccessKey(accessKey)).Error; err != nil {
+			return err
+		}
+		if event.Applied {
+			return ErrNfeEventApplied
+		}
+
+		var nfe models.ProcessedNFe
+		err := tx.First(&nfe, "access_key IN ?", []string{event.AccessKey, "NFe" + event.AccessKey}).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrNfeEventWithoutNfe
+		}
+		if err != nil {
+			return err
+		}
+		if event.EventType == EventCancellation {
+			if err := cancelNfe(tx, &nfe, userID, "Cancelamento aplicado manualmente: "+reason); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		event.Applied, event.AppliedBy, event.AppliedAt = true, userID, &now
+		return tx.Model(&event).Select("applied", "applied_by", "applied_at").Updates(&event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// cancelNfe marca a nota como CANCELADA e, se ela já movimentou estoque, lança
+// saídas compensatórias para cada entrada gerada por ela
+func cancelNfe(tx *gorm.DB, nfe *models.ProcessedNFe, userID *int32, reason string) error {
+	if nfe.Status == NfeStatusCancelled {
+		return nil
+	}
+
+	if nfe.Status == NfeStatusProcessed || nfe.Status == NfeStatusPartial {
+		var movements []models.Movement
+		if err := tx.Where("reference = ? AND origin = ?", nfe.AccessKey, "NFE").Find(&movements).Error; err != nil {
+			return err
+		}
+
+		for _, original := range movements {
+			// Entradas são estornadas com saída e saídas (notas emitidas por nós) com entrada
+			reversalType, delta, label := "SAIDA", -original.Quantity, "entrada"
+			if original.Type == "SAIDA" {
+				reversalType, delta, label = "ENTRADA", original.Quantity, "saída"
+			}
+			reversal := models.Movement{
+				ProductCode:        original.ProductCode,
+				Type:               reversalType,
+				Quantity:           original.Quantity,
+				UnitCost:           original.UnitCost,
+				CostBreakdown:      original.CostBreakdown,
+				CommercialQuantity: original.CommercialQuantity,
+				CommercialUnit:     original.CommercialUnit,
+				BatchNumber:        original.BatchNumber,
+				ManufacturingDate:  original.ManufacturingDate,
+				ExpirationDate:     original.ExpirationDate,
+				Origin:             stringPtr("NFE_CANCELAMENTO"),
+				Reference:          stringPtr(nfe.AccessKey),
+				Notes:              stringPtr(fmt.Sprintf("Estorno da %s #%d por cancelamento da NF-e", label, original.ID)),
+			}
+			if err := tx.Create(&reversal).Error; err != nil {
+				return err
+			}
+
+			// O estorno é obrigatório mesmo que o saldo fique negativo
+			var stock models.Stock
+			err := tx.First(&stock, "product_code = ?", original.ProductCode).Error
+			if err == gorm.ErrRecordNotFound {
+				stock = models.Stock{ProductCode: original.ProductCode, Quantity: delta}
+				err = tx.Create(&stock).Error
+			} else if err == nil {
+				stock.Quantity += delta
+				err = tx.Save(&stock).Error
+			}
+			if err != nil {
+				return err
+			}
+			if stock.Quantity < 0 {
+				slog.Warn("Estorno de NF-e cancelada deixou estoque negativo",
+					"access_key", nfe.AccessKey,
+					"product_code", original.ProductCode,
+					"quantity", stock.Quantity,
+				)
+			}
+		}
+	}
+
+	return transitionNfe(tx, nfe, NfeStatusCancelled, userID, reason, nil)
+}
+
+// emitterEvent indica os eventos que só o emitente da NF-e pode registrar
+func emitterEvent(eventType string) bool {
+	switch strings.TrimSpace(eventType) {
+	case EventCancellation, EventCorrection:
+		return true
+	}
+	return false
+}
+
+// eventRegistered indica se o cStat do retEvento confirma o registro do evento
+func eventRegistered(cStat int) bool {
+	switch cStat {
+	case 135, 136, 155: // Vinculado, vinculado sem NF-e na base, cancelamento fora de prazo
+		return true
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
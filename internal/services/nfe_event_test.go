@@ -0,0 +1,217 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/xmldsig"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const sampleCancelEventXML = `<?xml version="1.0" encoding="UTF-8"?>
+<procEventoNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00">
+	<evento versao="1.00">
+		<infEvento Id="ID1101113524011234567800019555001000001234112345678501">
+			<cOrgao>35</cOrgao>
+			<tpAmb>1</tpAmb>
+			<CNPJ>12345678000195</CNPJ>
+			<chNFe>35240112345678000195550010000012341123456785</chNFe>
+			<dhEvento>2024-01-16T10:00:00-03:00</dhEvento>
+			<tpEvento>110111</tpEvento>
+			<nSeqEvento>1</nSeqEvento>
+			<verEvento>1.00</verEvento>
+			<detEvento versao="1.00">
+				<descEvento>Cancelamento</descEvento>
+				<nProt>135240000012345</nProt>
+				<xJust>Pedido cancelado pelo cliente antes do envio</xJust>
+			</detEvento>
+		</infEvento>
+	</evento>
+	<retEvento versao="1.00">
+		<infEvento>
+			<tpAmb>1</tpAmb>
+			<cStat>135</cStat>
+			<xMotivo>Evento registrado e vinculado a NF-e</xMotivo>
+			<chNFe>35240112345678000195550010000012341123456785</chNFe>
+			<tpEvento>110111</tpEvento>
+			<nSeqEvento>1</nSeqEvento>
+			<dhRegEvento>2024-01-16T10:00:05-03:00</dhRegEvento>
+			<nProt>135240000099999</nProt>
+		</infEvento>
+	</retEvento>
+</procEventoNFe>`
+
+func TestDetectDocumentType(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"nfeProc", sampleNfeXML, DocumentNfe},
+		{"procEventoNFe", sampleCancelEventXML, DocumentEvent},
+		{"outro documento", `<resNFe><chNFe>1</chNFe></resNFe>`, ""},
+		{"conteúdo inválido", "invalid", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectDocumentType([]byte(tt.xml)); got != tt.want {
+				t.Errorf("DetectDocumentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterEvent_Validation(t *testing.T) {
+	// As validações rejeitam o evento antes de qualquer acesso ao banco
+	s := &NfeService{}
+
+	tests := []struct {
+		name    string
+		tamper  func(proc *models.ProcEventoNFe)
+		wantErr error
+	}{
+		{"sem tipo de evento", func(proc *models.ProcEventoNFe) { proc.Evento.InfEvento.TpEvento = "" }, ErrNfeEventInvalid},
+		{"chave com DV inválido", func(proc *models.ProcEventoNFe) {
+			proc.Evento.InfEvento.ChNFe = "35240112345678000195550010000012341123456780"
+		}, ErrNfeKeyCheckDigit},
+		{"sem retorno da SEFAZ", func(proc *models.ProcEventoNFe) { proc.RetEvento = models.RetEvento{} }, ErrNfeEventNotRegistered},
+		{"evento rejeitado", func(proc *models.ProcEventoNFe) { proc.RetEvento.InfEvento.CStat = 573 }, ErrNfeEventNotRegistered},
+		{"retorno de outra chave", func(proc *models.ProcEventoNFe) {
+			proc.RetEvento.InfEvento.ChNFe = "35240112345678000195550010000012351123456780"
+		}, ErrNfeEventKeyMismatch},
+		{"retorno de outro evento", func(proc *models.ProcEventoNFe) { proc.RetEvento.InfEvento.TpEvento = EventCorrection }, ErrNfeEventMismatch},
+		{"retorno de outra sequência", func(proc *models.ProcEventoNFe) { proc.RetEvento.InfEvento.NSeqEvento = 2 }, ErrNfeEventMismatch},
+		{"cancelamento por outro CNPJ", func(proc *models.ProcEventoNFe) { proc.Evento.InfEvento.CNPJ = "98765432000110" }, ErrNfeEventAuthor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proc models.ProcEventoNFe
+			if err := xml.Unmarshal([]byte(sampleCancelEventXML), &proc); err != nil {
+				t.Fatalf("xml.Unmarshal() error = %v", err)
+			}
+			tt.tamper(&proc)
+			if _, err := s.RegisterEvent(&proc, nil, nil); err != tt.wantErr {
+				t.Errorf("RegisterEvent() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyEventSignature(t *testing.T) {
+	root, rootKey := issueTestCertificate(t, "AC Raiz Teste", nil, nil)
+	emitter, emitterKey := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA:12345678000195", root, rootKey)
+	other, otherKey := issueTestCertificate(t, "OUTRA EMPRESA LTDA:98765432000110", root, rootKey)
+	store, err := xmldsig.NewTrustStore(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	if err != nil {
+		t.Fatalf("NewTrustStore() error = %v", err)
+	}
+	ConfigureTrustStore(store)
+	t.Cleanup(func() { ConfigureTrustStore(nil) })
+
+	sign := func(cert *x509.Certificate, key *rsa.PrivateKey) []byte {
+		signed, err := xmldsig.SignEnveloped([]byte(sampleCancelEventXML), "ID1101113524011234567800019555001000001234112345678501", key, cert)
+		if err != nil {
+			t.Fatalf("SignEnveloped() error = %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		xml        []byte
+		wantStatus string
+	}{
+		{"assinado pelo emitente", sign(emitter, emitterKey), SignatureValid},
+		{"assinado por outro CNPJ", sign(other, otherKey), SignatureInvalid},
+		{"sem assinatura", []byte(sampleCancelEventXML), SignatureMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proc models.ProcEventoNFe
+			if err := xml.Unmarshal(tt.xml, &proc); err != nil {
+				t.Fatalf("xml.Unmarshal() error = %v", err)
+			}
+			if got := VerifyEventSignature(&proc, tt.xml); got.Status != tt.wantStatus {
+				t.Errorf("VerifyEventSignature() status = %s (%v), want %s", got.Status, got.Error, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestApplyEvent_UnverifiedCancellation(t *testing.T) {
+	// Sem assinatura válida o cancelamento não chega a tocar no banco; cadeia não
+	// verificada não basta (certificado autoassinado com o CNPJ do emitente)
+	for _, status := range []string{SignatureInvalid, SignatureMissing, SignatureNotVerified, SignatureChainUnchecked} {
+		t.Run(status, func(t *testing.T) {
+			nfe := models.ProcessedNFe{AccessKey: "35240112345678000195550010000012341123456785", Status: NfeStatusProcessed}
+			event := models.NFeEvent{EventType: EventCancellation, SignatureStatus: status}
+			if err := applyEvent(nil, &nfe, &event); err != nil {
+				t.Fatalf("applyEvent() error = %v", err)
+			}
+			if event.Applied || nfe.Status != NfeStatusProcessed {
+				t.Errorf("applyEvent() applied = %v, status = %s; want cancelamento pendente", event.Applied, nfe.Status)
+			}
+		})
+	}
+}
+
+func TestApplyEvent_Manual(t *testing.T) {
+	const key = "35240112345678000195550010000012341123456785"
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.NFeEvent{}, &models.Movement{}, &models.Stock{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	pending := models.NFeEvent{AccessKey: key, EventType: EventCancellation, Sequence: 1, SignatureStatus: SignatureChainUnchecked}
+	orphan := models.NFeEvent{AccessKey: "35240112345678000195550010000099991123456780", EventType: EventCancellation, Sequence: 1, SignatureStatus: SignatureChainUnchecked}
+	if err := db.Create(&models.ProcessedNFe{AccessKey: key, Status: NfeStatusPending}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.Create(&[]models.NFeEvent{pending, orphan}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := NewNfeService(db)
+	admin := int32(1)
+
+	if _, err := s.ApplyEvent(key, 1, " ", &admin); !errors.Is(err, ErrNfeReasonRequired) {
+		t.Fatalf("ApplyEvent() sem motivo error = %v, want %v", err, ErrNfeReasonRequired)
+	}
+	if _, err := s.ApplyEvent(key, 2, "conferido na SEFAZ", &admin); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("ApplyEvent() de outra nota error = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if _, err := s.ApplyEvent(orphan.AccessKey, 2, "conferido na SEFAZ", &admin); !errors.Is(err, ErrNfeEventWithoutNfe) {
+		t.Fatalf("ApplyEvent() sem nota error = %v, want %v", err, ErrNfeEventWithoutNfe)
+	}
+
+	event, err := s.ApplyEvent(key, 1, "conferido na SEFAZ", &admin)
+	if err != nil {
+		t.Fatalf("ApplyEvent() error = %v", err)
+	}
+	if !event.Applied || event.AppliedBy == nil || *event.AppliedBy != admin || event.AppliedAt == nil {
+		t.Errorf("evento = applied %v, por %v em %v", event.Applied, event.AppliedBy, event.AppliedAt)
+	}
+	var nfe models.ProcessedNFe
+	db.First(&nfe, "access_key = ?", key)
+	if nfe.Status != NfeStatusCancelled {
+		t.Errorf("status da nota = %s, want %s", nfe.Status, NfeStatusCancelled)
+	}
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("entity_id = ? AND user_id = ?", key, admin).Count(&audits)
+	if audits != 1 {
+		t.Errorf("histórico do administrador = %d registros, want 1", audits)
+	}
+
+	if _, err := s.ApplyEvent(key, 1, "conferido na SEFAZ", &admin); !errors.Is(err, ErrNfeEventApplied) {
+		t.Errorf("ApplyEvent() repetido error = %v, want %v", err, ErrNfeEventApplied)
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"estoque/internal/events"
+	"estoque/internal/models"
+	"estoque/internal/utils"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Situação de um documento divergente retido para análise
+const (
+	ConflictStatusPending  = "PENDENTE"
+	ConflictStatusReviewed = "ANALISADO"
+)
+
+var (
+	ErrNfeContentConflict = &NfeValidationError{Code: "CONTEUDO_DIVERGENTE", Message: "chave de acesso já registrada com XML diferente; documento retido para análise"}
+
+	ErrConflictNotFound        = errors.New("documento divergente não encontrado")
+	ErrConflictAlreadyReviewed = errors.New("documento divergente já analisado")
+)
+
+// ContentHash calcula o SHA-256 (hex) dos bytes do XML como recebidos
+func ContentHash(xmlData []byte) string {
+	sum := sha256.Sum256(xmlData)
+	return hex.EncodeToString(sum[:])
+}
+
+// isDuplicateKeyError reconhece a violação de chave única do MySQL e do SQLite,
+// que o GORM só traduz para ErrDuplicatedKey com TranslateError habilitado
+func isDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+// documentDigest devolve o DigestValue de infNFe quando a verificação da
+// assinatura o conferiu com o conteúdo; sem isso o valor declarado no XML não
+// identifica o documento
+func documentDigest(proc *models.NfeProc, signature *NfeSignatureCheck) string {
+	if signature == nil || (signature.Status != SignatureValid && signature.Status != SignatureChainUnchecked) {
+		return ""
+	}
+	return strings.TrimSpace(proc.NFe.Signature.DigestValue)
+}
+
+// resolveDuplicate compara o documento recebido com a nota já registrada. O
+// mesmo infNFe (DigestValue conferido nas duas assinaturas) é um reenvio
+// idempotente, ainda que os bytes mudem entre canais (e-mail, DF-e, upload), e
+// devolve a nota existente sem erro; o hash dos bytes só distingue a cópia
+// exata e decide quando não há assinatura conferida. Conteúdo diferente fica
+// retido em nfe_conflicts e resulta em ErrNfeContentConflict.
+func (s *NfeService) resolveDuplicate(accessKey string, xmlData []byte, hash, digest, source string) (*models.ProcessedNFe, error) {
+	var existing models.ProcessedNFe
+	err := s.DB.First(&existing, "access_key IN ?", []string{accessKey, "NFe" + accessKey}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Notas anteriores ao hash têm o valor calculado e gravado agora
+	existingHash := ""
+	if existing.ContentHash != nil {
+		existingHash = *existing.ContentHash
+	} else if len(existing.XMLData) > 0 {
+		existingHash = ContentHash(existing.XMLData)
+		s.DB.Model(&models.ProcessedNFe{}).Where("access_key = ?", existing.AccessKey).Update("content_hash", existingHash)
+	}
+
+	exact := existingHash == hash
+	if exact || (digest != "" && s.existingDigest(&existing) == digest) {
+		logger := slog.With("access_key", accessKey, "source", source)
+		if exact {
+			logger.Debug("Reenvio idêntico de NF-e já registrada")
+		} else {
+			logger.Info("NF-e já registrada recebida com outros bytes (mesmo DigestValue)")
+		}
+		existing.XMLData = nil
+		return &existing, nil
+	}
+
+	conflict, err := s.recordConflict(accessKey, xmlData, hash, existingHash, source)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &NfeValidationError{
+		Code:    ErrNfeContentConflict.Code,
+		Message: fmt.Sprintf("%s (registro %d)", ErrNfeContentConflict.Message, conflict.ID),
+	}
+}
+
+// existingDigest devolve o DigestValue gravado da nota; notas anteriores à
+// coluna com assinatura conferida têm o valor lido do XML e gravado agora
+func (s *NfeService) existingDigest(existing *models.ProcessedNFe) string {
+	if existing.DocumentDigest != nil {
+		return *existing.DocumentDigest
+	}
+	if existing.SignatureStatus != SignatureValid && existing.SignatureStatus != SignatureChainUnchecked {
+		return ""
+	}
+	var proc models.NfeProc
+	if err := xml.Unmarshal(existing.XMLData, &proc); err != nil {
+		return ""
+	}
+	digest := strings.TrimSpace(proc.NFe.Signature.DigestValue)
+	if digest != "" {
+		s.DB.Model(&models.ProcessedNFe{}).Where("access_key = ?", existing.AccessKey).Update("document_digest", digest)
+	}
+	return digest
+}
+
+// recordConflict grava o documento divergente; o reenvio do mesmo conteúdo só
+// incrementa as tentativas do registro existente
+func (s *NfeService) recordConflict(accessKey string, xmlData []byte, hash, existingHash, source string) (*models.NFeConflict, error) {
+	var conflict models.NFeConflict
+	err := s.DB.Where("access_key = ? AND content_hash = ?", accessKey, hash).First(&conflict).Error
+	if err == nil {
+		err = s.DB.Model(&conflict).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+		return &conflict, err
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	conflict = models.NFeConflict{
+		AccessKey:    accessKey,
+		ContentHash:  hash,
+		ExistingHash: existingHash,
+		Source:       utils.Truncate(source, 191),
+		Attempts:     1,
+		Status:       ConflictStatusPending,
+		XMLData:      xmlData,
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conflict).Error; err != nil {
+			return err
+		}
+		description := fmt.Sprintf("XML divergente recebido para a chave %s (origem: %s)", accessKey, firstNonEmpty(source, "desconhecida"))
+		return models.LogAction(tx, nil, "NFE_CONFLICT", "processed_nfe", accessKey, description, optionalString(existingHash), optionalString(hash))
+	})
+	if isDuplicateKeyError(err) {
+		// Outro worker registrou o mesmo conflito ao mesmo tempo
+		return &conflict, s.DB.Where("access_key = ? AND content_hash = ?", accessKey, hash).First(&conflict).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go events.NotifyNfeConflict(accessKey, conflict.ID)
+	return &conflict, nil
+}
+
+// ListConflicts retorna os documentos divergentes, opcionalmente filtrados pela situação
+func (s *NfeService) ListConflicts(status string) ([]models.NFeConflict, error) {
+	conflicts := []models.NFeConflict{}
+	query := s.DB.Omit("xml_data").Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return conflicts, query.Find(&conflicts).Error
+}
+
+// ReviewConflict encerra a análise de um documento divergente com a conclusão do revisor
+func (s *NfeService) ReviewConflict(id int32, resolution string, userID *int32) (*models.NFeConflict, error) {
+	var conflict models.NFeConflict
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("xml_data").First(&conflict, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrConflictNotFound
+			}
+			return err
+		}
+		if conflict.Status != ConflictStatusPending {
+			return ErrConflictAlreadyReviewed
+		}
+
+		now := time.Now()
+		conflict.Status = ConflictStatusReviewed
+		conflict.Resolution = optionalString(strings.TrimSpace(resolution))
+		conflict.ReviewedBy = userID
+		conflict.ReviewedAt = &now
+		if err := tx.Model(&conflict).Updates(map[string]interface{}{
+			"status":      conflict.Status,
+			"resolution":  conflict.Resolution,
+			"reviewed_by": conflict.ReviewedBy,
+			"reviewed_at": conflict.ReviewedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("Documento divergente %d da chave %s analisado", conflict.ID, conflict.AccessKey)
+		return models.LogAction(tx, userID, "NFE_CONFLICT_REVIEW", "processed_nfe", conflict.AccessKey, description, nil, conflict.Resolution)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestContentHash(t *testing.T) {
+	hash := ContentHash([]byte(sampleNfeXML))
+	if len(hash) != 64 {
+		t.Fatalf("hash com %d caracteres, esperado 64", len(hash))
+	}
+	if ContentHash([]byte(sampleNfeXML)) != hash {
+		t.Error("hash não é determinístico")
+	}
+	if ContentHash([]byte(sampleNfeXML+"\n")) == hash {
+		t.Error("bytes diferentes geraram o mesmo hash")
+	}
+	if got := ContentHash(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("ContentHash(nil) = %s", got)
+	}
+}
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"gorm", gorm.ErrDuplicatedKey, true},
+		{"mysql", errors.New("Error 1062 (23000): Duplicate entry '3524...' for key 'PRIMARY'"), true},
+		{"sqlite", errors.New("UNIQUE constraint failed: processed_nfes.access_key"), true},
+		{"outro erro", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDuplicateKeyError(tt.err); got != tt.want {
+				t.Errorf("isDuplicateKeyError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDuplicate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.NFeConflict{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	hash := ContentHash([]byte(sampleNfeXML))
+	if err := db.Create(&models.ProcessedNFe{AccessKey: manifestKey, Status: NfeStatusProcessed, ContentHash: &hash, XMLData: []byte(sampleNfeXML)}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := NewNfeService(db)
+
+	// Reenvio idêntico devolve a nota existente, sem erro e sem conflito
+	existing, err := s.resolveDuplicate(manifestKey, []byte(sampleNfeXML), hash, "", "teste")
+	if err != nil || existing == nil || existing.AccessKey != manifestKey || existing.Status != NfeStatusProcessed {
+		t.Fatalf("resolveDuplicate(idêntico) = %+v, %v", existing, err)
+	}
+
+	// Conteúdo diferente continua sendo um erro, retido para análise
+	changed := []byte(sampleNfeXML + "\n")
+	existing, err = s.resolveDuplicate(manifestKey, changed, ContentHash(changed), "", "teste")
+	if existing != nil || NfeErrorCode(err) != ErrNfeContentConflict.Code {
+		t.Fatalf("resolveDuplicate(divergente) = %+v, %v; want %s", existing, err, ErrNfeContentConflict.Code)
+	}
+	var conflicts int64
+	db.Model(&models.NFeConflict{}).Count(&conflicts)
+	if conflicts != 1 {
+		t.Errorf("conflitos = %d, want 1", conflicts)
+	}
+}
+
+func TestResolveDuplicate_SameDigest(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.NFeConflict{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	cert, key := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA:12345678000195", nil, nil)
+	proc, signed := signSampleNfe(t, cert, key)
+	digest := documentDigest(proc, &NfeSignatureCheck{Status: SignatureChainUnchecked})
+	if digest == "" {
+		t.Fatal("documentDigest() vazio para assinatura conferida")
+	}
+	if got := documentDigest(proc, &NfeSignatureCheck{Status: SignatureInvalid}); got != "" {
+		t.Errorf("documentDigest(INVALIDA) = %q, want vazio", got)
+	}
+	if got := documentDigest(proc, nil); got != "" {
+		t.Errorf("documentDigest(nil) = %q, want vazio", got)
+	}
+
+	// Nota gravada antes da coluna: o DigestValue vem do XML assinado
+	hash := ContentHash(signed)
+	if err := db.Create(&models.ProcessedNFe{AccessKey: manifestKey, Status: NfeStatusPending, ContentHash: &hash,
+		XMLData: signed, SignatureStatus: SignatureChainUnchecked}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := NewNfeService(db)
+
+	// O mesmo documento com outra formatação (ex: recebido por outro canal)
+	reformatted := append([]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"), signed...)
+	existing, err := s.resolveDuplicate(manifestKey, reformatted, ContentHash(reformatted), digest, "e-mail")
+	if err != nil || existing == nil || existing.AccessKey != manifestKey {
+		t.Fatalf("resolveDuplicate(mesmo digest) = %+v, %v", existing, err)
+	}
+	var stored models.ProcessedNFe
+	db.First(&stored, "access_key = ?", manifestKey)
+	if stored.DocumentDigest == nil || *stored.DocumentDigest != digest {
+		t.Errorf("DocumentDigest gravado = %v, want %s", stored.DocumentDigest, digest)
+	}
+
+	// Sem assinatura conferida ou com outro digest, bytes diferentes são conflito
+	for _, other := range []string{"", "outroDigestValue="} {
+		existing, err = s.resolveDuplicate(manifestKey, reformatted, ContentHash(reformatted), other, "e-mail")
+		if existing != nil || NfeErrorCode(err) != ErrNfeContentConflict.Code {
+			t.Errorf("resolveDuplicate(digest %q) = %+v, %v; want %s", other, existing, err, ErrNfeContentConflict.Code)
+		}
+	}
+}
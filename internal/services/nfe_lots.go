@@ -0,0 +1,62 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"strings"
+	"time"
+)
+
+// itemLot é a parte de um item recebida em um lote (grupo rastro)
+type itemLot struct {
+	number        string
+	quantity      float64 // Na unidade comercial (uCom)
+	manufacturing *time.Time
+	expiration    *time.Time
+}
+
+// nfeLots lê os grupos rastro de cada item, indexados por nItem
+func nfeLots(proc *models.NfeProc) map[int][]itemLot {
+	lots := make(map[int][]itemLot)
+	for _, det := range proc.NFe.InfNFe.Det {
+		for _, r := range det.Prod.Rastro {
+			number := strings.TrimSpace(r.NLote)
+			if number == "" || r.QLote <= 0 {
+				continue
+			}
+			lots[det.NItem] = append(lots[det.NItem], itemLot{
+				number:        number,
+				quantity:      r.QLote,
+				manufacturing: optionalFiscalDate(r.DFab),
+				expiration:    optionalFiscalDate(r.DVal),
+			})
+		}
+	}
+	return lots
+}
+
+// splitByLots distribui a quantidade recebida entre os lotes na ordem do XML. Na
+// conferência parcial os últimos lotes ficam sem saldo; o que exceder a soma dos
+// lotes vira uma parte sem lote.
+func splitByLots(received float64, lots []itemLot) []itemLot {
+	if len(lots) == 0 {
+		return []itemLot{{quantity: received}}
+	}
+
+	const epsilon = 1e-9
+	parts := make([]itemLot, 0, len(lots)+1)
+	remaining := received
+	for _, lot := range lots {
+		if remaining <= epsilon {
+			break
+		}
+		if lot.quantity > remaining {
+			lot.quantity = remaining
+		}
+		parts = append(parts, lot)
+		remaining -= lot.quantity
+	}
+	if remaining > epsilon {
+		parts = append(parts, itemLot{quantity: remaining})
+	}
+	return parts
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestNfeLots(t *testing.T) {
+	proc := parseSampleNfe(t)
+
+	lots := nfeLots(&proc)
+	if len(lots[1]) != 0 {
+		t.Errorf("item 1 lots = %d, want 0", len(lots[1]))
+	}
+	got := lots[2]
+	if len(got) != 2 {
+		t.Fatalf("item 2 lots = %d, want 2", len(got))
+	}
+	if got[0].number != "A123" || got[0].quantity != 30 || got[1].number != "B456" || got[1].quantity != 20 {
+		t.Errorf("lots = %+v", got)
+	}
+	if got[0].manufacturing == nil || got[0].manufacturing.Format("2006-01-02") != "2024-01-05" {
+		t.Errorf("manufacturing = %v, want 2024-01-05", got[0].manufacturing)
+	}
+	if got[1].expiration == nil || got[1].expiration.Format("2006-01-02") != "2026-01-10" {
+		t.Errorf("expiration = %v, want 2026-01-10", got[1].expiration)
+	}
+}
+
+func TestSplitByLots(t *testing.T) {
+	lots := []itemLot{{number: "A", quantity: 30}, {number: "B", quantity: 20}}
+
+	type part struct {
+		number   string
+		quantity float64
+	}
+	tests := []struct {
+		name     string
+		received float64
+		lots     []itemLot
+		want     []part
+	}{
+		{"sem rastro", 50, nil, []part{{"", 50}}},
+		{"lotes cobrem o recebido", 50, lots, []part{{"A", 30}, {"B", 20}}},
+		{"conferência parcial", 40, lots, []part{{"A", 30}, {"B", 10}}},
+		{"parcial dentro do primeiro lote", 25, lots, []part{{"A", 25}}},
+		{"recebido acima dos lotes", 60, lots, []part{{"A", 30}, {"B", 20}, {"", 10}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitByLots(tt.received, tt.lots)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitByLots() = %+v, want %+v", got, tt.want)
+			}
+			for i, w := range tt.want {
+				if got[i].number != w.number || !almostEqual(got[i].quantity, w.quantity) {
+					t.Errorf("part %d = %s/%v, want %s/%v", i, got[i].number, got[i].quantity, w.number, w.quantity)
+				}
+			}
+		})
+	}
+	if lots[0].quantity != 30 || lots[1].quantity != 20 {
+		t.Errorf("splitByLots() alterou os lotes de entrada: %+v", lots)
+	}
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/dfe"
+	"estoque/internal/utils"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Situação de um envio de manifestação
+const (
+	ManifestationPending    = "PENDENTE"
+	ManifestationRegistered = "REGISTRADA"
+	ManifestationRejected   = "REJEITADA"
+	ManifestationError      = "ERRO"
+)
+
+// Origem do envio
+const (
+	ManifestationSourceManual  = "MANUAL"
+	ManifestationSourceReject  = "REJEICAO"
+	ManifestationSourceProcess = "EFETIVACAO"
+	ManifestationSourceDfe     = "DFE"
+)
+
+const manifestationSendTimeout = 60 * time.Second
+
+var (
+	ErrManifestationUnavailable = errors.New("manifestação do destinatário indisponível: certificado digital não configurado")
+
+	ErrManifestationInvalidType    = &NfeValidationError{Code: "MANIFESTACAO_INVALIDA", Message: "tipo de manifestação deve ser 210200, 210210, 210220 ou 210240"}
+	ErrManifestationJustification  = &NfeValidationError{Code: "JUSTIFICATIVA_MANIFESTACAO", Message: "operação não realizada exige justificativa de 15 a 255 caracteres"}
+	ErrManifestationDuplicate      = &NfeValidationError{Code: "MANIFESTACAO_DUPLICADA", Message: "esta manifestação já foi registrada para a nota"}
+	ErrManifestationConcluded      = &NfeValidationError{Code: "MANIFESTACAO_CONCLUIDA", Message: "a nota já tem manifestação conclusiva registrada"}
+	ErrManifestationNotRecipient   = &NfeValidationError{Code: "MANIFESTACAO_NAO_DESTINATARIO", Message: "só o destinatário pode manifestar; a nota foi emitida por nós"}
+	ErrManifestationUnknownCNPJ    = &NfeValidationError{Code: "MANIFESTACAO_SEM_CNPJ", Message: "CNPJ do destinatário não identificado para a nota"}
+	ErrManifestationUnknownNfe     = &NfeValidationError{Code: "MANIFESTACAO_NFE_DESCONHECIDA", Message: "nota não encontrada nem entre as notas recebidas nem nos resumos da distribuição DF-e"}
+	ErrManifestationInvalidKeySize = &NfeValidationError{Code: "CHAVE_INVALIDA", Message: "chave de acesso deve ter 44 dígitos"}
+)
+
+// ManifestationSender envia o evento à SEFAZ (dfe.EventClient); nos testes é substituído
+type ManifestationSender interface {
+	Send(ctx context.Context, ev dfe.Event) (*dfe.EventResult, error)
+}
+
+var (
+	manifestationMu     sync.RWMutex
+	manifestationSender ManifestationSender
+	manifestationCert   dfe.Certificate
+)
+
+// ConfigureManifestation define o envio de manifestações; sender nil desativa.
+// cert, quando informado, é consultado antes de cada envio: sem certificado
+// ativo a manifestação fica indisponível em vez de gerar um envio com erro.
+func ConfigureManifestation(sender ManifestationSender, cert dfe.Certificate) {
+	manifestationMu.Lock()
+	defer manifestationMu.Unlock()
+	manifestationSender = sender
+	manifestationCert = cert
+}
+
+// ManifestationEnabled indica se há certificado configurado para enviar manifestações
+func ManifestationEnabled() bool {
+	_, err := currentManifestationSender()
+	return err == nil
+}
+
+func currentManifestationSender() (ManifestationSender, error) {
+	manifestationMu.RLock()
+	sender, cert := manifestationSender, manifestationCert
+	manifestationMu.RUnlock()
+
+	if sender == nil {
+		return nil, ErrManifestationUnavailable
+	}
+	if cert != nil {
+		if _, err := cert.TLSCertificate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrManifestationUnavailable, err)
+		}
+	}
+	return sender, nil
+}
+
+// CheckManifestation valida o envio antes de qualquer efeito (ex: antes de rejeitar
+// a nota que vai gerar a operação não realizada)
+func CheckManifestation(eventType, justification string) error {
+	if _, err := currentManifestationSender(); err != nil {
+		return err
+	}
+	if dfe.EventDescription(eventType) == "" {
+		return ErrManifestationInvalidType
+	}
+	if eventType == dfe.EventNaoRealizada {
+		if n := utf8.RuneCountInString(strings.TrimSpace(justification)); n < 15 || n > 255 {
+			return ErrManifestationJustification
+		}
+	}
+	return nil
+}
+
+// isConclusiveManifestation indica os eventos que encerram a manifestação da nota
+func isConclusiveManifestation(eventType string) bool {
+	return eventType == dfe.EventConfirmacao || eventType == dfe.EventDesconhecimento || eventType == dfe.EventNaoRealizada
+}
+
+// ListManifestations devolve os envios de manifestação da nota, do mais recente ao mais antigo
+func (s *NfeService) ListManifestations(accessKey string) ([]models.NFeManifestation, error) {
+	var list []models.NFeManifestation
+	err := s.DB.Where("access_key = ?", NormalizeAccessKey(accessKey)).Order("id DESC").Find(&list).Error
+	return list, err
+}
+
+// Manifest envia a manifestação do destinatário e registra o resultado. Rejeições
+// e falhas de comunicação com a SEFAZ ficam gravadas no registro devolvido
+// (REJEITADA/ERRO) e podem ser reenviadas; o erro só indica que nada foi enviado.
+func (s *NfeService) Manifest(ctx context.Context, accessKey, eventType, justification, source string, userID *int32) (*models.NFeManifestation, error) {
+	if err := CheckManifestation(eventType, justification); err != nil {
+		return nil, err
+	}
+	sender, err := currentManifestationSender()
+	if err != nil {
+		return nil, err
+	}
+
+	key := NormalizeAccessKey(accessKey)
+	if len(key) != 44 {
+		return nil, ErrManifestationInvalidKeySize
+	}
+	justification = strings.TrimSpace(justification)
+	if eventType != dfe.EventNaoRealizada {
+		justification = ""
+	}
+
+	cnpj, err := s.manifestationRecipient(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var registered []models.NFeManifestation
+	if err := s.DB.Where("access_key = ? AND status = ?", key, ManifestationRegistered).Find(&registered).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range registered {
+		if m.EventType == eventType {
+			return nil, ErrManifestationDuplicate
+		}
+		if isConclusiveManifestation(m.EventType) {
+			return nil, ErrManifestationConcluded
+		}
+	}
+
+	record := models.NFeManifestation{
+		AccessKey:     key,
+		RecipientCNPJ: cnpj,
+		EventType:     eventType,
+		Sequence:      1,
+		Justification: optionalString(justification),
+		Status:        ManifestationPending,
+		Source:        source,
+		UserID:        userID,
+	}
+	if err := s.DB.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, manifestationSendTimeout)
+	defer cancel()
+	result, sendErr := sender.Send(sendCtx, dfe.Event{
+		AccessKey:     key,
+		CNPJ:          cnpj,
+		Type:          eventType,
+		Sequence:      record.Sequence,
+		Justification: justification,
+	})
+
+	updates := map[string]interface{}{}
+	switch {
+	case sendErr != nil:
+		record.Status = ManifestationError
+		record.StatusMessage = optionalString(utils.Truncate(sendErr.Error(), 255))
+	case result.Registered():
+		record.Status = ManifestationRegistered
+	default:
+		record.Status = ManifestationRejected
+	}
+	if result != nil {
+		record.StatusCode = int32(result.CStat)
+		record.StatusMessage = optionalString(utils.Truncate(result.XMotivo, 255))
+		record.ProtocolNumber = optionalString(result.Protocol)
+		record.RegisteredAt = result.RegisteredAt
+		record.XMLData = result.Request
+		record.ResponseXML = result.Response
+	}
+	updates["status"] = record.Status
+	updates["status_code"] = record.StatusCode
+	updates["status_message"] = record.StatusMessage
+	updates["protocol_number"] = record.ProtocolNumber
+	updates["registered_at"] = record.RegisteredAt
+	updates["xml_data"] = record.XMLData
+	updates["response_xml"] = record.ResponseXML
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&record).Updates(updates).Error; err != nil {
+			return err
+		}
+		if record.Status == ManifestationRegistered {
+			if err := tx.Model(&models.ProcessedNFe{}).Where("access_key IN ?", []string{key, "NFe" + key}).Update("manifestation", eventType).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.DfeSummary{}).Where("access_key = ?", key).Update("manifestation", eventType).Error; err != nil {
+				return err
+			}
+		}
+		description := fmt.Sprintf("Manifestação %s (%s): %s", eventType, dfe.EventDescription(eventType), record.Status)
+		if record.StatusMessage != nil {
+			description += " - " + *record.StatusMessage
+		}
+		return models.LogAction(tx, userID, "NFE_MANIFESTATION", "processed_nfe", key, description, nil, jsonString(map[string]interface{}{
+			"event_type":  eventType,
+			"status":      record.Status,
+			"status_code": record.StatusCode,
+			"protocol":    record.ProtocolNumber,
+			"source":      source,
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Manifestação do destinatário enviada",
+		"access_key", key,
+		"event_type", eventType,
+		"status", record.Status,
+		"cStat", record.StatusCode,
+	)
+	return &record, nil
+}
+
+// manifestationRecipient identifica o CNPJ do destinatário pela nota registrada ou
+// pelo resumo da distribuição DF-e (ciência é enviada antes de termos o XML)
+func (s *NfeService) manifestationRecipient(key string) (string, error) {
+	var nfes []models.ProcessedNFe
+	if err := s.DB.Select("access_key", "issued_by_us", "direction", "recipient_document").
+		Where("access_key IN ?", []string{key, "NFe" + key}).Limit(1).Find(&nfes).Error; err != nil {
+		return "", err
+	}
+	if len(nfes) > 0 {
+		nfe := nfes[0]
+		if nfe.IssuedByUs && nfe.Direction == DirectionOutbound {
+			return "", ErrManifestationNotRecipient
+		}
+		if nfe.RecipientDocument != nil {
+			if doc := onlyDigits(*nfe.RecipientDocument); len(doc) == 14 {
+				return doc, nil
+			}
+		}
+	}
+
+	var summaries []models.DfeSummary
+	if err := s.DB.Where("access_key = ?", key).Limit(1).Find(&summaries).Error; err != nil {
+		return "", err
+	}
+	if len(summaries) > 0 {
+		return summaries[0].RecipientCNPJ, nil
+	}
+	if len(nfes) > 0 {
+		return "", ErrManifestationUnknownCNPJ
+	}
+	return "", ErrManifestationUnknownNfe
+}
+
+// manifestInBackground envia a manifestação automática sem bloquear o fluxo que a originou
+func (s *NfeService) manifestInBackground(accessKey, eventType, source string, userID *int32) {
+	if !ManifestationEnabled() {
+		return
+	}
+	go func() {
+		m, err := s.Manifest(context.Background(), accessKey, eventType, "", source, userID)
+		if err != nil {
+			slog.Warn("Manifestação automática não enviada", "access_key", accessKey, "event_type", eventType, "error", err)
+			return
+		}
+		if m.Status != ManifestationRegistered {
+			slog.Warn("Manifestação automática não registrada", "access_key", accessKey, "event_type", eventType, "status", m.Status, "cStat", m.StatusCode)
+		}
+	}()
+}
+
+// ListDfeSummaries lista os resumos recebidos pela distribuição DF-e; pending
+// restringe aos que ainda não têm o XML completo
+func (s *NfeService) ListDfeSummaries(cnpj string, pending bool, page, limit int) ([]models.DfeSummary, int64, error) {
+	query := s.DB.Model(&models.DfeSummary{})
+	if cnpj = onlyDigits(cnpj); cnpj != "" {
+		query = query.Where("recipient_cnpj = ?", cnpj)
+	}
+	if pending {
+		query = query.Where("has_full_xml = ?", false)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []models.DfeSummary
+	err := query.Order("nsu DESC").Offset((page - 1) * limit).Limit(limit).Find(&list).Error
+	return list, total, err
+}
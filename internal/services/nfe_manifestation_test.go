@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/dfe"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	manifestKey      = "35240112345678000195550010000012341123456785"
+	manifestKeyOther = "35240112345678000195550010000099991123456780"
+	manifestKeyOwn   = "35240198765432000110550010000000011000000017"
+)
+
+// fakeSender responde no lugar da SEFAZ com o cStat configurado
+type fakeSender struct {
+	cStat int
+	err   error
+	sent  []dfe.Event
+}
+
+func (f *fakeSender) Send(_ context.Context, ev dfe.Event) (*dfe.EventResult, error) {
+	f.sent = append(f.sent, ev)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &dfe.EventResult{CStat: f.cStat, XMotivo: "retorno de teste", Protocol: "891240000000001", Request: []byte("<envEvento/>")}, nil
+}
+
+func setupManifestationDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.DfeSummary{}, &models.NFeManifestation{}, &models.AuditLog{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	nfes := []models.ProcessedNFe{
+		{AccessKey: manifestKey, RecipientDocument: stringPtr("98.765.432/0001-10"), Direction: DirectionInbound, Status: NfeStatusPending},
+		{AccessKey: manifestKeyOwn, IssuedByUs: true, Direction: DirectionOutbound, Status: NfeStatusProcessed},
+	}
+	if err := db.Create(&nfes).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.Create(&models.DfeSummary{AccessKey: manifestKeyOther, RecipientCNPJ: "98765432000110", Situation: "1"}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return db
+}
+
+func TestManifest(t *testing.T) {
+	s := NewNfeService(setupManifestationDB(t))
+	ctx := context.Background()
+
+	ConfigureManifestation(nil, nil)
+	if _, err := s.Manifest(ctx, manifestKey, dfe.EventCiencia, "", ManifestationSourceManual, nil); !errors.Is(err, ErrManifestationUnavailable) {
+		t.Fatalf("Manifest() sem certificado error = %v, want %v", err, ErrManifestationUnavailable)
+	}
+
+	sender := &fakeSender{cStat: dfe.StatusEventRegistered}
+	ConfigureManifestation(sender, nil)
+	t.Cleanup(func() { ConfigureManifestation(nil, nil) })
+
+	tests := []struct {
+		name          string
+		key           string
+		eventType     string
+		justification string
+		wantErr       error
+		wantStatus    string
+	}{
+		{"tipo inválido", manifestKey, "110111", "", ErrManifestationInvalidType, ""},
+		{"não realizada sem justificativa", manifestKey, dfe.EventNaoRealizada, "recusada", ErrManifestationJustification, ""},
+		{"nota emitida por nós", manifestKeyOwn, dfe.EventCiencia, "", ErrManifestationNotRecipient, ""},
+		{"chave desconhecida", "35240112345678000195550010000077771123456781", dfe.EventCiencia, "", ErrManifestationUnknownNfe, ""},
+		{"ciência pelo resumo DF-e", manifestKeyOther, dfe.EventCiencia, "", nil, ManifestationRegistered},
+		{"ciência repetida", manifestKeyOther, dfe.EventCiencia, "", ErrManifestationDuplicate, ""},
+		{"ciência da nota registrada", manifestKey, dfe.EventCiencia, "", nil, ManifestationRegistered},
+		{"confirmação", manifestKey, dfe.EventConfirmacao, "", nil, ManifestationRegistered},
+		{"desconhecimento após confirmação", manifestKey, dfe.EventDesconhecimento, "", ErrManifestationConcluded, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := s.Manifest(ctx, tt.key, tt.eventType, tt.justification, ManifestationSourceManual, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Manifest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && m.Status != tt.wantStatus {
+				t.Errorf("Manifest() status = %s, want %s", m.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	if last := sender.sent[len(sender.sent)-1]; last.CNPJ != "98765432000110" || last.Type != dfe.EventConfirmacao {
+		t.Errorf("último evento enviado = %+v", last)
+	}
+	var nfe models.ProcessedNFe
+	s.DB.First(&nfe, "access_key = ?", manifestKey)
+	if nfe.Manifestation == nil || *nfe.Manifestation != dfe.EventConfirmacao {
+		t.Errorf("ProcessedNFe.Manifestation = %v, want %s", nfe.Manifestation, dfe.EventConfirmacao)
+	}
+	var summary models.DfeSummary
+	s.DB.First(&summary, "access_key = ?", manifestKeyOther)
+	if summary.Manifestation == nil || *summary.Manifestation != dfe.EventCiencia {
+		t.Errorf("DfeSummary.Manifestation = %v, want %s", summary.Manifestation, dfe.EventCiencia)
+	}
+}
+
+func TestManifestRejectedCanBeResent(t *testing.T) {
+	s := NewNfeService(setupManifestationDB(t))
+	ctx := context.Background()
+	sender := &fakeSender{err: errors.New("timeout")}
+	ConfigureManifestation(sender, nil)
+	t.Cleanup(func() { ConfigureManifestation(nil, nil) })
+
+	justification := "Mercadoria recusada no recebimento"
+	m, err := s.Manifest(ctx, manifestKey, dfe.EventNaoRealizada, justification, ManifestationSourceReject, nil)
+	if err != nil || m.Status != ManifestationError {
+		t.Fatalf("Manifest() com falha de comunicação = %+v, %v", m, err)
+	}
+
+	sender.err, sender.cStat = nil, 596
+	if m, err = s.Manifest(ctx, manifestKey, dfe.EventNaoRealizada, justification, ManifestationSourceReject, nil); err != nil || m.Status != ManifestationRejected || m.StatusCode != 596 {
+		t.Fatalf("Manifest() rejeitada = %+v, %v", m, err)
+	}
+
+	sender.cStat = dfe.StatusEventRegistered
+	if m, err = s.Manifest(ctx, manifestKey, dfe.EventNaoRealizada, justification, ManifestationSourceReject, nil); err != nil || m.Status != ManifestationRegistered {
+		t.Fatalf("Manifest() reenviada = %+v, %v", m, err)
+	}
+	if sender.sent[2].Justification != justification {
+		t.Errorf("justificativa enviada = %q", sender.sent[2].Justification)
+	}
+
+	list, err := s.ListManifestations(manifestKey)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("ListManifestations() = %d, %v; want 3 registros", len(list), err)
+	}
+	if list[0].Status != ManifestationRegistered || list[2].Status != ManifestationError {
+		t.Errorf("ListManifestations() fora de ordem: %s, %s", list[0].Status, list[2].Status)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"estoque/internal/utils"
+	"strings"
+	"time"
+)
+
+// Situação de autorização da nota na SEFAZ, derivada do cStat do protNFe
+const (
+	AuthorizationAuthorized    = "AUTORIZADA"
+	AuthorizationDenied        = "DENEGADA"
+	AuthorizationNotAuthorized = "NAO_AUTORIZADA"
+	AuthorizationNoProtocol    = "SEM_PROTOCOLO"
+)
+
+var (
+	ErrNfeProtocolKeyMismatch    = &NfeValidationError{Code: "PROTOCOLO_CHAVE_DIVERGENTE", Message: "protocolo de autorização pertence a outra chave de acesso"}
+	ErrNfeProtocolDigestMismatch = &NfeValidationError{Code: "PROTOCOLO_DIGEST_DIVERGENTE", Message: "digVal do protocolo não confere com o DigestValue da assinatura da NF-e"}
+	ErrNfeProtocolHomologation   = &NfeValidationError{Code: "PROTOCOLO_HOMOLOGACAO", Message: "protocolo emitido em ambiente de homologação (tpAmb=2), sem valor fiscal"}
+	ErrNfeNotAuthorized          = &NfeValidationError{Code: "NFE_NAO_AUTORIZADA", Message: "NF-e sem autorização de uso da SEFAZ não pode gerar entrada de estoque"}
+)
+
+// AuthorizationStateFromCStat classifica o código de status do protocolo
+func AuthorizationStateFromCStat(cStat int) string {
+	switch cStat {
+	case 0:
+		return AuthorizationNoProtocol
+	case 100, 150: // Autorizado o uso (150: fora de prazo)
+		return AuthorizationAuthorized
+	case 110, 301, 302, 303: // Uso denegado
+		return AuthorizationDenied
+	default:
+		return AuthorizationNotAuthorized
+	}
+}
+
+// ValidateProtocol confere se o protNFe, quando presente, pertence à nota: mesma
+// chave e digVal igual ao DigestValue da assinatura de infNFe, sem o qual um
+// protocolo verdadeiro poderia ser anexado a outro conteúdo com a mesma chave.
+// Protocolos de homologação são recusados por não terem valor fiscal.
+func ValidateProtocol(proc *models.NfeProc, accessKey string) error {
+	prot := proc.ProtNFe.InfProt
+	chNFe := strings.TrimSpace(prot.ChNFe)
+	if chNFe == "" && prot.CStat == 0 {
+		return nil
+	}
+	if chNFe != "" && chNFe != accessKey {
+		return ErrNfeProtocolKeyMismatch
+	}
+	if strings.TrimSpace(prot.TpAmb) == "2" {
+		return ErrNfeProtocolHomologation
+	}
+	digVal := strings.TrimSpace(prot.DigVal)
+	if digVal == "" || digVal != strings.TrimSpace(proc.NFe.Signature.DigestValue) {
+		return ErrNfeProtocolDigestMismatch
+	}
+	return nil
+}
+
+// applyProtocol copia os dados do protNFe para o registro da nota
+func applyProtocol(nfe *models.ProcessedNFe, prot models.InfProt) {
+	nfe.AuthorizationState = AuthorizationStateFromCStat(prot.CStat)
+	if prot.CStat == 0 {
+		return
+	}
+
+	cStat := int32(prot.CStat)
+	nfe.ProtocolStatus = &cStat
+	nfe.ProtocolNumber = optionalString(prot.NProt)
+	nfe.ProtocolMessage = optionalString(utils.Truncate(prot.XMotivo, 255))
+	if t, ok := parseFiscalDateTime(prot.DhRecbto); ok {
+		nfe.AuthorizedAt = &t
+	}
+}
+
+// parseFiscalDateTime aceita datas com fuso (layout 3.10+) e sem fuso (layouts antigos)
+func parseFiscalDateTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// optionalFiscalDate é parseFiscalDateTime para campos opcionais: vazio ou inválido vira nil
+func optionalFiscalDate(value string) *time.Time {
+	t, ok := parseFiscalDateTime(value)
+	if !ok {
+		return nil
+	}
+	return &t
+}
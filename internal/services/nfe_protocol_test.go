@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"testing"
+)
+
+func TestAuthorizationStateFromCStat(t *testing.T) {
+	tests := []struct {
+		name  string
+		cStat int
+		want  string
+	}{
+		{"sem protocolo", 0, AuthorizationNoProtocol},
+		{"autorizada", 100, AuthorizationAuthorized},
+		{"autorizada fora de prazo", 150, AuthorizationAuthorized},
+		{"denegada", 110, AuthorizationDenied},
+		{"denegada por irregularidade do destinatário", 302, AuthorizationDenied},
+		{"rejeitada", 204, AuthorizationNotAuthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AuthorizationStateFromCStat(tt.cStat); got != tt.want {
+				t.Errorf("AuthorizationStateFromCStat(%d) = %v, want %v", tt.cStat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyProtocol(t *testing.T) {
+	proc := parseSampleNfe(t)
+
+	var nfe models.ProcessedNFe
+	applyProtocol(&nfe, proc.ProtNFe.InfProt)
+	if nfe.AuthorizationState != AuthorizationAuthorized {
+		t.Errorf("AuthorizationState = %v, want %v", nfe.AuthorizationState, AuthorizationAuthorized)
+	}
+	if nfe.ProtocolNumber == nil || *nfe.ProtocolNumber != "135240000012345" {
+		t.Errorf("ProtocolNumber = %v, want 135240000012345", nfe.ProtocolNumber)
+	}
+	if nfe.ProtocolStatus == nil || *nfe.ProtocolStatus != 100 {
+		t.Errorf("ProtocolStatus = %v, want 100", nfe.ProtocolStatus)
+	}
+	if nfe.AuthorizedAt == nil || nfe.AuthorizedAt.UTC().Hour() != 11 {
+		t.Errorf("AuthorizedAt = %v, want 2024-01-15 11:30:12 UTC", nfe.AuthorizedAt)
+	}
+
+	var unsigned models.ProcessedNFe
+	applyProtocol(&unsigned, models.InfProt{})
+	if unsigned.AuthorizationState != AuthorizationNoProtocol || unsigned.ProtocolNumber != nil {
+		t.Errorf("applyProtocol() sem protNFe = %+v", unsigned)
+	}
+}
+
+func TestValidateProtocol(t *testing.T) {
+	key := "35240112345678000195550010000012341123456785"
+	cert, certKey := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA:12345678000195", nil, nil)
+	signed, _ := signSampleNfe(t, cert, certKey)
+	digest := signed.NFe.Signature.DigestValue
+
+	tests := []struct {
+		name   string
+		signed bool // Nota assinada; sem assinatura não há DigestValue
+		prot   func(p *models.InfProt)
+		want   error
+	}{
+		{"protocolo da nota", true, func(p *models.InfProt) { p.DigVal = digest }, nil},
+		{"sem protocolo", false, func(p *models.InfProt) { *p = models.InfProt{} }, nil},
+		{"chave divergente", true, func(p *models.InfProt) { p.DigVal, p.ChNFe = digest, "35240112345678000195550010000012351123456780" }, ErrNfeProtocolKeyMismatch},
+		{"digVal de outro conteúdo", true, func(p *models.InfProt) {}, ErrNfeProtocolDigestMismatch},
+		{"protocolo sem digVal", true, func(p *models.InfProt) { p.DigVal = "" }, ErrNfeProtocolDigestMismatch},
+		{"nota sem assinatura", false, func(p *models.InfProt) {}, ErrNfeProtocolDigestMismatch},
+		{"homologação", true, func(p *models.InfProt) { p.DigVal, p.TpAmb = digest, "2" }, ErrNfeProtocolHomologation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := parseSampleNfe(t)
+			if tt.signed {
+				proc = *signed
+			}
+			tt.prot(&proc.ProtNFe.InfProt)
+			if err := ValidateProtocol(&proc, key); !errors.Is(err, tt.want) {
+				t.Errorf("ValidateProtocol() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNfeInvalidQuantity  = &NfeValidationError{Code: "QUANTIDADE_INVALIDA", Message: "quantidade recebida não pode ser negativa"}
+	ErrNfeNothingToReceive = &NfeValidationError{Code: "NENHUM_ITEM_RECEBIDO", Message: "todas as linhas foram excluídas; rejeite a nota em vez de efetivá-la"}
+	ErrNfeDivergenceReason = &NfeValidationError{Code: "JUSTIFICATIVA_DIVERGENCIA", Message: "informe o motivo da divergência ao excluir a linha ou alterar a quantidade"}
+)
+
+// receivedQuantity é a quantidade (unidade comercial) que efetivamente entra no estoque
+func receivedQuantity(item models.NFeItem) float64 {
+	if item.Excluded {
+		return 0
+	}
+	if item.ReceivedQuantity != nil {
+		return *item.ReceivedQuantity
+	}
+	return item.Quantity
+}
+
+// hasDivergence indica se a linha foi excluída ou recebida em quantidade diferente da faturada
+func hasDivergence(item models.NFeItem) bool {
+	return item.Excluded || math.Abs(receivedQuantity(item)-item.Quantity) > 1e-9
+}
+
+// editableNfe carrega e trava a nota e garante que ela ainda está em conferência.
+// A trava é a mesma de ProcessNfe: a conferência não altera linhas de uma nota
+// que começou a ser efetivada.
+func editableNfe(tx *gorm.DB, accessKey string) (*models.ProcessedNFe, error) {
+	var nfe models.ProcessedNFe
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		return nil, err
+	}
+	if nfe.Status != NfeStatusPending && nfe.Status != NfeStatusInReview {
+		return nil, ErrNfeNotEditable
+	}
+	return &nfe, nil
+}
+
+// StartReview coloca a nota em conferência
+func (s *NfeService) StartReview(accessKey string, userID *int32) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		nfe, err := editableNfe(tx, accessKey)
+		if err != nil || nfe.Status == NfeStatusInReview {
+			return err
+		}
+		return transitionNfe(tx, nfe, NfeStatusInReview, userID, "", nil)
+	})
+}
+
+// ReviewItem registra a conferência de uma linha: quantidade recebida, exclusão
+// e motivo da divergência. A nota passa para EM_CONFERENCIA se ainda estava pendente.
+func (s *NfeService) ReviewItem(accessKey string, itemNumber int, req models.ReviewNfeItemRequest, userID *int32) (*models.NFeItem, error) {
+	if req.ReceivedQuantity != nil && *req.ReceivedQuantity < 0 {
+		return nil, ErrNfeInvalidQuantity
+	}
+
+	// Garante que itens de notas antigas estejam na tabela
+	if _, err := s.GetNfeItems(accessKey); err != nil {
+		return nil, err
+	}
+
+	var item models.NFeItem
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		nfe, err := editableNfe(tx, accessKey)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&item, "access_key = ? AND item_number = ?", accessKey, itemNumber).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		item.Excluded = req.Excluded
+		item.ReceivedQuantity = req.ReceivedQuantity
+		item.DivergenceReason = optionalString(req.DivergenceReason)
+		item.ReviewedBy = userID
+		item.ReviewedAt = &now
+		if hasDivergence(item) && item.DivergenceReason == nil {
+			return ErrNfeDivergenceReason
+		}
+
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"excluded":          item.Excluded,
+			"received_quantity": item.ReceivedQuantity,
+			"divergence_reason": item.DivergenceReason,
+			"reviewed_by":       item.ReviewedBy,
+			"reviewed_at":       item.ReviewedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		if nfe.Status == NfeStatusPending {
+			return transitionNfe(tx, nfe, NfeStatusInReview, userID, "", nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RejectNfe recusa a nota inteira sem movimentar estoque
+func (s *NfeService) RejectNfe(accessKey, reason string, userID *int32) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrNfeReasonRequired
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var nfe models.ProcessedNFe
+		if err := tx.First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+			return err
+		}
+		return transitionNfe(tx, &nfe, NfeStatusRejected, userID, reason, map[string]interface{}{
+			"rejection_reason": reason,
+			"reviewed_by":      userID,
+			"reviewed_at":      time.Now(),
+		})
+	})
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"estoque/internal/models"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidNfeSort = errors.New("campo de ordenação inválido")
+
+// nfeSortColumns são os campos aceitos em NfeListFilter.Sort e as colunas correspondentes
+var nfeSortColumns = map[string]string{
+	"access_key":          "access_key",
+	"number":              "LENGTH(number), number", // nNF é texto: ordena numericamente sem CAST
+	"supplier_name":       "supplier_name",
+	"supplier_cnpj":       "supplier_cnpj",
+	"recipient_name":      "recipient_name",
+	"total_items":         "total_items",
+	"total_value":         "total_value",
+	"status":              "status",
+	"direction":           "direction",
+	"authorization_state": "authorization_state",
+	"issued_at":           "issued_at",
+	"processed_at":        "processed_at",
+}
+
+// NfeListFilter reúne os filtros da listagem de notas; campos vazios não filtram
+type NfeListFilter struct {
+	Statuses   []string
+	Supplier   string // Nome (parcial) ou CNPJ do emitente
+	SupplierID string
+	Number     string
+	IssuedFrom *time.Time
+	IssuedTo   *time.Time // Inclusivo: considera o dia inteiro
+	MinValue   *float64
+	MaxValue   *float64
+	Product    string // Código/EAN do fornecedor, código interno ou parte da descrição de um item
+	Direction  string
+	Sort       string
+	Desc       bool
+}
+
+// NfeStatusTotal é a quantidade e o valor das notas filtradas em uma situação
+type NfeStatusTotal struct {
+	Status     string  `json:"status"`
+	Count      int64   `json:"count"`
+	TotalValue float64 `json:"total_value"`
+}
+
+// NfeListSummary agrega o conjunto filtrado inteiro, não apenas a página
+type NfeListSummary struct {
+	Count      int64            `json:"count"`
+	TotalValue float64          `json:"total_value"`
+	ByStatus   []NfeStatusTotal `json:"by_status"`
+}
+
+// orderClause monta o ORDER BY; o padrão é a data de registro mais recente primeiro
+func (f NfeListFilter) orderClause() (string, error) {
+	if f.Sort == "" {
+		return "processed_at DESC", nil
+	}
+	column, ok := nfeSortColumns[f.Sort]
+	if !ok {
+		return "", ErrInvalidNfeSort
+	}
+	direction := " ASC"
+	if f.Desc {
+		direction = " DESC"
+	}
+	parts := strings.Split(column, ", ")
+	for i := range parts {
+		parts[i] += direction
+	}
+	// Desempate estável para a paginação
+	return strings.Join(parts, ", ") + ", access_key" + direction, nil
+}
+
+// apply aplica os filtros à consulta de processed_nfes
+func (f NfeListFilter) apply(db *gorm.DB) *gorm.DB {
+	if len(f.Statuses) > 0 {
+		db = db.Where("status IN ?", f.Statuses)
+	}
+	if supplier := strings.TrimSpace(f.Supplier); supplier != "" {
+		if isDocumentSearch(supplier) {
+			db = db.Where("supplier_cnpj LIKE ?", "%"+onlyDigits(supplier)+"%")
+		} else {
+			db = db.Where("supplier_name LIKE ?", "%"+supplier+"%")
+		}
+	}
+	if f.SupplierID != "" {
+		db = db.Where("supplier_id = ?", f.SupplierID)
+	}
+	// nNF não tem zeros à esquerda no leiaute; a busca aceita o número como impresso no DANFE
+	if number := strings.TrimLeft(onlyDigits(f.Number), "0"); number != "" {
+		db = db.Where("number = ?", number)
+	}
+	if f.IssuedFrom != nil {
+		db = db.Where("issued_at >= ?", *f.IssuedFrom)
+	}
+	if f.IssuedTo != nil {
+		db = db.Where("issued_at < ?", f.IssuedTo.AddDate(0, 0, 1))
+	}
+	if f.MinValue != nil {
+		db = db.Where("total_value >= ?", *f.MinValue)
+	}
+	if f.MaxValue != nil {
+		db = db.Where("total_value <= ?", *f.MaxValue)
+	}
+	if product := strings.TrimSpace(f.Product); product != "" {
+		items := db.Session(&gorm.Session{NewDB: true}).Model(&models.NFeItem{}).Select("access_key").
+			Where("code = ? OR ean = ? OR product_code = ? OR name LIKE ?", product, product, product, "%"+product+"%")
+		db = db.Where("access_key IN (?)", items)
+	}
+	if f.Direction != "" {
+		db = db.Where("direction = ?", f.Direction)
+	}
+	return db
+}
+
+// isDocumentSearch indica se o texto é um CNPJ/CPF (completo ou parcial, com ou sem pontuação)
+func isDocumentSearch(text string) bool {
+	digits := 0
+	for _, c := range text {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' || c == '/' || c == '-' || c == ' ':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// SearchNfes lista as notas que atendem ao filtro, paginadas, com os totais do conjunto filtrado
+func (s *NfeService) SearchNfes(filter NfeListFilter, page, limit int) ([]models.ProcessedNFe, NfeListSummary, error) {
+	summary := NfeListSummary{ByStatus: []NfeStatusTotal{}}
+	order, err := filter.orderClause()
+	if err != nil {
+		return nil, summary, err
+	}
+
+	base := func() *gorm.DB {
+		return filter.apply(s.DB.Model(&models.ProcessedNFe{}))
+	}
+
+	if err := base().Select("status, COUNT(*) AS count, COALESCE(SUM(total_value), 0) AS total_value").
+		Group("status").Order("status").Scan(&summary.ByStatus).Error; err != nil {
+		return nil, summary, err
+	}
+	for _, st := range summary.ByStatus {
+		summary.Count += st.Count
+		summary.TotalValue += st.TotalValue
+	}
+	summary.TotalValue = roundCents(summary.TotalValue)
+
+	nfes := []models.ProcessedNFe{}
+	if err := base().Omit("xml_data").Order(order).Offset((page - 1) * limit).Limit(limit).Find(&nfes).Error; err != nil {
+		return nil, summary, err
+	}
+	return nfes, summary, nil
+}
+
+// BackfillIssueDates preenche a data de emissão das notas registradas antes da
+// coluna existir, lendo o dhEmi do XML armazenado
+func (s *NfeService) BackfillIssueDates() error {
+	const batchSize = 200
+	cursor := ""
+	filled := 0
+	for {
+		var nfes []models.ProcessedNFe
+		if err := s.DB.Select("access_key", "xml_data").
+			Where("issued_at IS NULL AND access_key > ?", cursor).
+			Order("access_key").Limit(batchSize).Find(&nfes).Error; err != nil {
+			return err
+		}
+		for _, nfe := range nfes {
+			cursor = nfe.AccessKey
+			var proc models.NfeProc
+			if len(nfe.XMLData) == 0 || xml.Unmarshal(nfe.XMLData, &proc) != nil {
+				continue
+			}
+			issuedAt := optionalFiscalDate(proc.NFe.InfNFe.Ide.DhEmi)
+			if issuedAt == nil {
+				continue
+			}
+			if err := s.DB.Model(&models.ProcessedNFe{}).Where("access_key = ?", nfe.AccessKey).Update("issued_at", issuedAt).Error; err != nil {
+				return err
+			}
+			filled++
+		}
+		if len(nfes) < batchSize {
+			break
+		}
+	}
+	if filled > 0 {
+		slog.Info("Data de emissão preenchida em notas antigas", "count", filled)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSearchDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.NFeItem{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	date := func(s string) *time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return &d
+	}
+	nfes := []models.ProcessedNFe{
+		{AccessKey: "K1", Number: stringPtr("9"), SupplierName: stringPtr("Acme Parafusos"), SupplierCNPJ: stringPtr("11222333000181"), TotalValue: 100, Status: NfeStatusProcessed, IssuedAt: date("2024-03-05")},
+		{AccessKey: "K2", Number: stringPtr("10"), SupplierName: stringPtr("Acme Parafusos"), SupplierCNPJ: stringPtr("11222333000181"), TotalValue: 250.5, Status: NfeStatusPending, IssuedAt: date("2024-03-31")},
+		{AccessKey: "K3", Number: stringPtr("123"), SupplierName: stringPtr("Farma Distribuidora"), SupplierCNPJ: stringPtr("44555666000172"), TotalValue: 80, Status: NfeStatusPending, IssuedAt: date("2024-04-01")},
+	}
+	if err := db.Create(&nfes).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	items := []models.NFeItem{
+		{AccessKey: "K1", ItemNumber: 1, Code: "ABC-1", Name: "Parafuso Sextavado"},
+		{AccessKey: "K3", ItemNumber: 1, Code: "MED-7", Name: "Dipirona 500mg", ProductCode: stringPtr("DIP500")},
+	}
+	if err := db.Create(&items).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return db
+}
+
+func TestSearchNfes(t *testing.T) {
+	s := NewNfeService(setupSearchDB(t))
+	march := func(day int) *time.Time {
+		d := time.Date(2024, 3, day, 0, 0, 0, 0, time.Local)
+		return &d
+	}
+	value := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name   string
+		filter NfeListFilter
+		want   []string
+	}{
+		{"sem filtro ordena por número", NfeListFilter{Sort: "number"}, []string{"K1", "K2", "K3"}},
+		{"status", NfeListFilter{Statuses: []string{NfeStatusPending}, Sort: "access_key"}, []string{"K2", "K3"}},
+		{"nome do fornecedor", NfeListFilter{Supplier: "acme", Sort: "access_key"}, []string{"K1", "K2"}},
+		{"CNPJ com pontuação", NfeListFilter{Supplier: "44.555.666/0001-72"}, []string{"K3"}},
+		{"número com zeros à esquerda", NfeListFilter{Number: "000.000.010"}, []string{"K2"}},
+		{"março inteiro", NfeListFilter{IssuedFrom: march(1), IssuedTo: march(31), Sort: "access_key"}, []string{"K1", "K2"}},
+		{"faixa de valor", NfeListFilter{MinValue: value(90), MaxValue: value(300), Sort: "total_value", Desc: true}, []string{"K2", "K1"}},
+		{"produto pela descrição", NfeListFilter{Product: "dipirona"}, []string{"K3"}},
+		{"produto pelo código interno", NfeListFilter{Product: "DIP500"}, []string{"K3"}},
+		{"produto pelo código do fornecedor", NfeListFilter{Product: "ABC-1"}, []string{"K1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nfes, summary, err := s.SearchNfes(tt.filter, 1, 50)
+			if err != nil {
+				t.Fatalf("SearchNfes() error = %v", err)
+			}
+			var got []string
+			for _, nfe := range nfes {
+				got = append(got, nfe.AccessKey)
+			}
+			if len(got) != len(tt.want) || summary.Count != int64(len(tt.want)) {
+				t.Fatalf("SearchNfes() = %v (count %d), want %v", got, summary.Count, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("SearchNfes() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSearchNfesSummary(t *testing.T) {
+	s := NewNfeService(setupSearchDB(t))
+
+	nfes, summary, err := s.SearchNfes(NfeListFilter{Supplier: "acme"}, 1, 1)
+	if err != nil {
+		t.Fatalf("SearchNfes() error = %v", err)
+	}
+	if len(nfes) != 1 {
+		t.Errorf("página com %d notas, want 1", len(nfes))
+	}
+	if summary.Count != 2 || summary.TotalValue != 350.5 {
+		t.Errorf("summary = %d/%v, want 2/350.5", summary.Count, summary.TotalValue)
+	}
+	want := map[string]NfeStatusTotal{
+		NfeStatusPending:   {Status: NfeStatusPending, Count: 1, TotalValue: 250.5},
+		NfeStatusProcessed: {Status: NfeStatusProcessed, Count: 1, TotalValue: 100},
+	}
+	if len(summary.ByStatus) != len(want) {
+		t.Fatalf("by_status = %+v", summary.ByStatus)
+	}
+	for _, st := range summary.ByStatus {
+		if st != want[st.Status] {
+			t.Errorf("by_status[%s] = %+v, want %+v", st.Status, st, want[st.Status])
+		}
+	}
+
+	if _, _, err := s.SearchNfes(NfeListFilter{Sort: "xml_data"}, 1, 50); err != ErrInvalidNfeSort {
+		t.Errorf("sort inválido: err = %v, want ErrInvalidNfeSort", err)
+	}
+}
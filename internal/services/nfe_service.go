@@ -4,9 +4,13 @@ import (
 	"encoding/xml"
 	"estoque/internal/events"
 	"estoque/internal/models"
+	"estoque/internal/services/dfe"
+	"estoque/internal/utils"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NfeService struct {
@@ -17,29 +21,91 @@ func NewNfeService(db *gorm.DB) *NfeService {
 	return &NfeService{DB: db}
 }
 
-// RegisterNfe apenas salva os metadados e o XML com status PENDENTE
-func (s *NfeService) RegisterNfe(proc *models.NfeProc, xmlData []byte) error {
-	return s.DB.Transaction(func(tx *gorm.DB) error {
-		// Verificar duplicação
+// RegisterNfe valida a chave de acesso e salva os metadados e o XML com status PENDENTE.
+// signature traz o resultado da verificação XMLDSig (nil quando não verificada).
+// source identifica quem enviou o documento (usuário ou canal).
+// Reenviar os mesmos bytes é idempotente: devolve a nota já registrada com
+// duplicate verdadeiro e sem erro. Um XML diferente com a chave de uma nota já
+// registrada é retido para análise e retorna ErrNfeContentConflict, a menos que
+// a assinatura de ambos comprove o mesmo infNFe (mesmo DigestValue).
+func (s *NfeService) RegisterNfe(proc *models.NfeProc, xmlData []byte, signature *NfeSignatureCheck, source string) (nfe *models.ProcessedNFe, duplicate bool, err error) {
+	accessKey, err := ValidateNfe(proc)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ValidateProtocol(proc, accessKey); err != nil {
+		return nil, false, err
+	}
+
+	// Notas emitidas pelos nossos CNPJs são classificadas por tpNF/CFOP
+	emitter := emitterDocument(proc.NFe.InfNFe.Emit)
+	issuedByUs := isOwnDocument(ParseOwnCNPJs(GetNfeConfig(s.DB).OwnCNPJs), emitter)
+	direction, operation, err := ClassifyNfe(proc, issuedByUs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hash := ContentHash(xmlData)
+	digest := documentDigest(proc, signature)
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Verificar duplicação (notas antigas foram gravadas com o prefixo "NFe")
 		var count int64
-		tx.Model(&models.ProcessedNFe{}).Where("access_key = ?", proc.NFe.InfNFe.ID).Count(&count)
+		tx.Model(&models.ProcessedNFe{}).Where("access_key IN ?", []string{accessKey, "NFe" + accessKey}).Count(&count)
 		if count > 0 {
 			return gorm.ErrDuplicatedKey
 		}
 
+		// Cadastrar ou atualizar o fornecedor a partir do emitente (nós mesmos não somos fornecedor)
+		var supplier *models.Supplier
+		if !issuedByUs {
+			var err error
+			if supplier, err = UpsertSupplier(tx, proc.NFe.InfNFe.Emit); err != nil {
+				return err
+			}
+		}
+
 		// Registrar NF-e pendente
-		nfe := models.ProcessedNFe{
-			AccessKey:    proc.NFe.InfNFe.ID,
+		nfe = &models.ProcessedNFe{
+			AccessKey:    accessKey,
 			Number:       &proc.NFe.InfNFe.Ide.NNF,
 			SupplierName: &proc.NFe.InfNFe.Emit.XNome,
+			SupplierCNPJ: optionalString(emitter),
 			TotalItems:   int32(len(proc.NFe.InfNFe.Det)),
 			TotalValue:   proc.NFe.InfNFe.Total.ICMSTot.VNF,
-			Status:       "PENDENTE",
+			Status:       NfeStatusPending,
 			XMLData:      xmlData,
+			ContentHash:  &hash,
+			IssuedAt:     optionalFiscalDate(proc.NFe.InfNFe.Ide.DhEmi),
 			ProcessedAt:  time.Now(),
+
+			IssuedByUs:        issuedByUs,
+			Direction:         direction,
+			Operation:         optionalString(operation),
+			RecipientName:     optionalString(utils.Truncate(proc.NFe.InfNFe.Dest.XNome, 191)),
+			RecipientDocument: optionalString(firstNonEmpty(onlyDigits(proc.NFe.InfNFe.Dest.CNPJ), onlyDigits(proc.NFe.InfNFe.Dest.CPF))),
+
+			DocumentDigest: optionalString(digest),
+		}
+		if supplier != nil {
+			nfe.SupplierID = &supplier.ID
 		}
+		signature.apply(nfe)
+		applyProtocol(nfe, proc.ProtNFe.InfProt)
 
-		if err := tx.Create(&nfe).Error; err != nil {
+		if err := tx.Create(nfe).Error; err != nil {
+			return err
+		}
+
+		// Registrar itens normalizados
+		items := BuildNfeItems(nfe.AccessKey, proc.NFe.InfNFe.Det)
+		if len(items) > 0 {
+			if err := tx.CreateInBatches(&items, 100).Error; err != nil {
+				return err
+			}
+		}
+
+		// Eventos (ex: cancelamento) recebidos antes da própria nota
+		if err := applyPendingEvents(tx, nfe); err != nil {
 			return err
 		}
 
@@ -48,94 +114,398 @@ func (s *NfeService) RegisterNfe(proc *models.NfeProc, xmlData []byte) error {
 
 		return nil
 	})
+
+	// A violação da chave primária cobre a corrida com outra instância que gravou a
+	// mesma nota entre a verificação e o insert
+	if isDuplicateKeyError(err) {
+		existing, err := s.resolveDuplicate(accessKey, xmlData, hash, digest, source)
+		return existing, existing != nil, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return nfe, false, nil
 }
 
-// ProcessNfe realiza a movimentação de estoque para uma nota pendente
-func (s *NfeService) ProcessNfe(accessKey string) (int, error) {
+// ProcessNfe efetiva a entrada de estoque de uma nota pendente ou em conferência.
+// Linhas excluídas na conferência são ignoradas e a quantidade recebida, quando
+// informada, substitui a faturada; nesses casos a nota termina como PARCIAL.
+// Notas de saída emitidas por nós geram movimentações SAIDA e exigem saldo suficiente.
+func (s *NfeService) ProcessNfe(accessKey string, userID *int32) (int, error) {
 	var nfe models.ProcessedNFe
 	if err := s.DB.First(&nfe, "access_key = ?", accessKey).Error; err != nil {
 		return 0, err
 	}
 
-	if nfe.Status == "PROCESSADA" {
+	if nfe.Status == NfeStatusProcessed || nfe.Status == NfeStatusPartial {
 		return int(nfe.TotalItems), nil
 	}
+	if nfe.Status == NfeStatusCancelled {
+		return 0, ErrNfeCancelled
+	}
+	if !CanTransition(nfe.Status, NfeStatusProcessed) {
+		return 0, invalidTransition(nfe.Status, NfeStatusProcessed)
+	}
 
-	// Decodificar XML armazenado
-	var proc models.NfeProc
-	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+	if err := s.ensureAuthorization(&nfe); err != nil {
 		return 0, err
 	}
+	if nfe.AuthorizationState != AuthorizationAuthorized {
+		return 0, ErrNfeNotAuthorized
+	}
 
-	err := s.DB.Transaction(func(tx *gorm.DB) error {
-		// Processar cada produto
-		for _, det := range proc.NFe.InfNFe.Det {
-			product := models.Product{
-				Code:      det.Prod.CProd,
-				Name:      det.Prod.XProd,
-				Unit:      "UN",
-				CostPrice: det.Prod.VUnCom,
+	// Garante que itens de notas antigas estejam na tabela
+	if _, err := s.GetNfeItems(accessKey); err != nil {
+		return 0, err
+	}
+	supplierCNPJ, err := s.supplierDocument(&nfe)
+	if err != nil {
+		return 0, err
+	}
+	proc, err := storedNfeProc(&nfe)
+	if err != nil {
+		return 0, err
+	}
+	lots := nfeLots(proc)
+	costRules := CostRulesFromConfig(GetNfeConfig(s.DB))
+
+	outbound := nfe.Direction == DirectionOutbound
+	movementType := "ENTRADA"
+	if outbound {
+		movementType = "SAIDA"
+	}
+
+	var items []models.NFeItem
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// A nota fica travada até o fim da efetivação: a conferência de uma linha
+		// (ReviewItem) espera e depois encontra a nota efetivada, e os itens lidos
+		// aqui são exatamente os lançados no estoque
+		if err := lockNfe(tx, &nfe); err != nil {
+			return err
+		}
+		var allItems []models.NFeItem
+		if err := tx.Where("access_key = ?", accessKey).Order("item_number ASC").Find(&allItems).Error; err != nil {
+			return err
+		}
+		partial := false
+		for _, item := range allItems {
+			if hasDivergence(item) {
+				partial = true
 			}
-			// Tentar encontrar ou criar o produto
-			var existingProduct models.Product
-			err := tx.First(&existingProduct, "code = ?", product.Code).Error
-			if err == gorm.ErrRecordNotFound {
-				if err := tx.Create(&product).Error; err != nil {
-					return err
-				}
-			} else if err != nil {
+			if !item.Excluded {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return ErrNfeNothingToReceive
+		}
+
+		// Todo item recebido precisa estar mapeado para um produto interno do fornecedor
+		resolved, err := resolveNfeProducts(tx, &nfe, supplierCNPJ, items)
+		if err != nil {
+			return err
+		}
+		if err := unmappedItemsError(items, resolved); err != nil {
+			return err
+		}
+
+		// Unidade comercial (uCom) precisa ser convertível para a unidade de estoque
+		factors, missing, err := resolveConversions(tx, supplierCNPJ, items, resolved)
+		if err != nil {
+			return err
+		}
+		if err := missingConversionError(missing); err != nil {
+			return err
+		}
+
+		// Custo de aquisição das compras: despesas e tributos rateados conforme a configuração
+		var landed map[int]models.CostBreakdown
+		if !nfe.IssuedByUs {
+			landed = LandedCosts(allItems, proc.NFe.InfNFe.Total.ICMSTot, costRules)
+		}
+
+		status := NfeStatusProcessed
+		if partial {
+			status = NfeStatusPartial
+		}
+		if err := transitionNfe(tx, &nfe, status, userID, "", map[string]interface{}{
+			"reviewed_by": userID,
+			"reviewed_at": time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		// Notas de saída só são baixadas se houver saldo para todos os itens
+		if outbound {
+			required := make(map[string]float64, len(items))
+			for _, item := range items {
+				required[resolved[item.Code]] += newItemConversion(item, factors[item.ItemNumber]).stockQty
+			}
+			if err := checkOutboundStock(tx, required); err != nil {
+				return err
+			}
+		}
+
+		var supplierID *int32
+		if !nfe.IssuedByUs {
+			var err error
+			if supplierID, err = ensureSupplier(tx, &nfe); err != nil {
 				return err
-			} else {
-				// Atualizar nome e preco de custo do produto existente
-				if err := tx.Model(&existingProduct).Updates(map[string]interface{}{
-					"name":       product.Name,
-					"cost_price": product.CostPrice,
+			}
+		}
+
+		// Processar cada produto
+		for _, item := range items {
+			productCode := resolved[item.Code]
+			conv := newItemConversion(item, factors[item.ItemNumber])
+			var cost models.CostBreakdown
+			if landed != nil {
+				cost = scaleCost(landed[item.ItemNumber], 1/conv.factor)
+				conv.unitCost = cost.Total()
+			}
+
+			// Custo e fornecedor vêm apenas de compras; nome e cadastro pertencem ao nosso catálogo
+			if !nfe.IssuedByUs {
+				if err := tx.Model(&models.Product{}).Where("code = ?", productCode).Updates(map[string]interface{}{
+					"cost_price": conv.unitCost,
 					"updated_at": time.Now(),
 				}).Error; err != nil {
 					return err
 				}
 			}
-
-			movement := models.Movement{
-				ProductCode: det.Prod.CProd,
-				Type:        "ENTRADA",
-				Quantity:    det.Prod.QCom,
-				Origin:      stringPtr("NFE"),
-				Reference:   stringPtr(proc.NFe.InfNFe.ID),
-			}
-			if err := tx.Create(&movement).Error; err != nil {
-				return err
+			// Produtos sem fornecedor passam a pertencer ao emitente da nota
+			if supplierID != nil {
+				if err := tx.Model(&models.Product{}).
+					Where("code = ? AND supplier_id IS NULL", productCode).
+					Update("supplier_id", *supplierID).Error; err != nil {
+					return err
+				}
 			}
 
-			var stock models.Stock
-			err = tx.First(&stock, "product_code = ?", det.Prod.CProd).Error
-			if err == gorm.ErrRecordNotFound {
-				stock = models.Stock{
-					ProductCode: det.Prod.CProd,
-					Quantity:    det.Prod.QCom,
+			if conv.stockQty > 0 {
+				// Um movimento por lote (rastro), com fabricação e validade
+				for _, part := range splitByLots(receivedQuantity(item), lots[item.ItemNumber]) {
+					commercialQty := part.quantity
+					movement := models.Movement{
+						ProductCode:        productCode,
+						Type:               movementType,
+						Quantity:           part.quantity * conv.factor,
+						UnitCost:           conv.unitCost,
+						CostBreakdown:      cost,
+						CommercialQuantity: &commercialQty,
+						CommercialUnit:     optionalString(item.Unit),
+						BatchNumber:        optionalString(part.number),
+						ManufacturingDate:  part.manufacturing,
+						ExpirationDate:     part.expiration,
+						Origin:             stringPtr("NFE"),
+						Reference:          stringPtr(nfe.AccessKey),
+						UserID:             userID,
+					}
+					if item.DivergenceReason != nil {
+						movement.Notes = stringPtr("Divergência na conferência: " + *item.DivergenceReason)
+					}
+					if err := tx.Create(&movement).Error; err != nil {
+						return err
+					}
 				}
-				if err := tx.Create(&stock).Error; err != nil {
-					return err
+
+				delta := conv.stockQty
+				if outbound {
+					delta = -delta
 				}
-			} else if err != nil {
-				return err
-			} else {
-				stock.Quantity += det.Prod.QCom
-				if err := tx.Save(&stock).Error; err != nil {
+				var stock models.Stock
+				err := tx.First(&stock, "product_code = ?", productCode).Error
+				if err == gorm.ErrRecordNotFound {
+					stock = models.Stock{
+						ProductCode: productCode,
+						Quantity:    delta,
+					}
+					if err := tx.Create(&stock).Error; err != nil {
+						return err
+					}
+				} else if err != nil {
 					return err
+				} else {
+					stock.Quantity += delta
+					if err := tx.Save(&stock).Error; err != nil {
+						return err
+					}
 				}
 			}
-		}
 
-		// Atualizar status
-		return tx.Model(&nfe).Update("status", "PROCESSADA").Error
+			if err := tx.Model(&item).Updates(map[string]interface{}{
+				"product_code":      productCode,
+				"conversion_factor": conv.factor,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 
 	if err != nil {
 		return 0, err
 	}
 
-	return len(proc.NFe.InfNFe.Det), nil
+	// Mercadoria recebida: confirma a operação na SEFAZ quando configurado
+	if nfe.Direction != DirectionOutbound && (nfe.Manifestation == nil || !isConclusiveManifestation(*nfe.Manifestation)) &&
+		GetNfeConfig(s.DB).AutoConfirmation {
+		s.manifestInBackground(accessKey, dfe.EventConfirmacao, ManifestationSourceProcess, userID)
+	}
+
+	return len(items), nil
+}
+
+// ensureAuthorization preenche o protocolo de notas registradas antes de ele ser persistido
+func (s *NfeService) ensureAuthorization(nfe *models.ProcessedNFe) error {
+	if nfe.AuthorizationState != "" && nfe.AuthorizationState != AuthorizationNoProtocol {
+		return nil
+	}
+
+	var proc models.NfeProc
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		return err
+	}
+	if err := ValidateProtocol(&proc, NormalizeAccessKey(proc.NFe.InfNFe.ID)); err != nil {
+		return err
+	}
+
+	applyProtocol(nfe, proc.ProtNFe.InfProt)
+	return s.DB.Model(nfe).Updates(map[string]interface{}{
+		"authorization_state": nfe.AuthorizationState,
+		"protocol_number":     nfe.ProtocolNumber,
+		"protocol_status":     nfe.ProtocolStatus,
+		"protocol_message":    nfe.ProtocolMessage,
+		"authorized_at":       nfe.AuthorizedAt,
+	}).Error
+}
+
+// GetNfeItems retorna os itens normalizados de uma nota. Notas registradas antes
+// da tabela nfe_items existir têm seus itens extraídos do XML e persistidos aqui.
+func (s *NfeService) GetNfeItems(accessKey string) ([]models.NFeItem, error) {
+	var items []models.NFeItem
+	if err := s.DB.Where("access_key = ?", accessKey).Order("item_number ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		return items, nil
+	}
+
+	var nfe models.ProcessedNFe
+	if err := s.DB.Select("access_key", "xml_data").First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		return nil, err
+	}
+	if len(nfe.XMLData) == 0 {
+		return items, nil
+	}
+
+	var proc models.NfeProc
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		return nil, err
+	}
+
+	// Duas requisições podem preencher a mesma nota ao mesmo tempo: o índice
+	// único (access_key, item_number) descarta a segunda cópia de cada linha
+	items = BuildNfeItems(accessKey, proc.NFe.InfNFe.Det)
+	if len(items) == 0 {
+		return items, nil
+	}
+	if err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&items, 100).Error; err != nil {
+		return nil, err
+	}
+	items = nil
+	return items, s.DB.Where("access_key = ?", accessKey).Order("item_number ASC").Find(&items).Error
+}
+
+// BuildNfeItems converte os elementos det do XML em linhas da tabela nfe_items
+func BuildNfeItems(accessKey string, dets []models.Det) []models.NFeItem {
+	items := make([]models.NFeItem, 0, len(dets))
+	for i, det := range dets {
+		itemNumber := det.NItem
+		if itemNumber == 0 {
+			itemNumber = i + 1
+		}
+
+		icms := det.Imposto.ICMS.Grupo
+		ipi := det.Imposto.IPI
+		pis := det.Imposto.PIS.Grupo
+		cofins := det.Imposto.COFINS.Grupo
+
+		items = append(items, models.NFeItem{
+			AccessKey:           accessKey,
+			ItemNumber:          itemNumber,
+			Code:                det.Prod.CProd,
+			EAN:                 gtinPtr(det.Prod.CEAN),
+			Name:                det.Prod.XProd,
+			NCM:                 optionalString(det.Prod.NCM),
+			CEST:                optionalString(det.Prod.CEST),
+			CFOP:                det.Prod.CFOP,
+			Unit:                det.Prod.UCom,
+			Quantity:            det.Prod.QCom,
+			UnitPrice:           det.Prod.VUnCom,
+			TotalPrice:          det.Prod.VProd,
+			TaxEAN:              gtinPtr(det.Prod.CEANTrib),
+			TaxUnit:             det.Prod.UTrib,
+			TaxQuantity:         det.Prod.QTrib,
+			TaxUnitPrice:        det.Prod.VUnTrib,
+			Freight:             det.Prod.VFrete,
+			Insurance:           det.Prod.VSeg,
+			Discount:            det.Prod.VDesc,
+			OtherCharges:        det.Prod.VOutro,
+			ICMSGroup:           icms.XMLName.Local,
+			ICMSOrigin:          icms.Orig,
+			ICMSCST:             icms.Situacao(),
+			ICMSBase:            icms.VBC,
+			ICMSRate:            icms.PICMS,
+			ICMSValue:           icms.VICMS,
+			ICMSSTBase:          icms.VBCST,
+			ICMSSTValue:         icms.VICMSST,
+			IPICST:              ipi.CST(),
+			IPIBase:             ipi.IPITrib.VBC,
+			IPIRate:             ipi.IPITrib.PIPI,
+			IPIValue:            ipi.IPITrib.VIPI,
+			PISCST:              pis.CST,
+			PISBase:             pis.VBC,
+			PISRate:             pis.PPIS,
+			PISValue:            pis.VPIS,
+			COFINSCST:           cofins.CST,
+			COFINSBase:          cofins.VBC,
+			COFINSRate:          cofins.PCOFINS,
+			COFINSValue:         cofins.VCOFINS,
+			ApproximateTaxTotal: det.Imposto.VTotTrib,
+			AdditionalInfo:      optionalString(det.InfAdProd),
+		})
+	}
+	return items
+}
+
+// storedNfeProc lê o XML armazenado da nota; sem XML devolve a estrutura vazia
+func storedNfeProc(nfe *models.ProcessedNFe) (*models.NfeProc, error) {
+	var proc models.NfeProc
+	if len(nfe.XMLData) == 0 {
+		return &proc, nil
+	}
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		return nil, err
+	}
+	return &proc, nil
+}
+
+// gtinPtr descarta o valor "SEM GTIN" usado pela SEFAZ para itens sem código de barras
+func gtinPtr(gtin string) *string {
+	gtin = strings.TrimSpace(gtin)
+	if gtin == "" || strings.EqualFold(gtin, "SEM GTIN") {
+		return nil
+	}
+	return &gtin
+}
+
+func optionalString(s string) *string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 func stringPtr(s string) *string {
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"encoding/xml"
+	"estoque/internal/models"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const sampleNfeXML = `<?xml version="1.0" encoding="UTF-8"?>
+<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00">
+	<NFe>
+		<infNFe Id="NFe35240112345678000195550010000012341123456785" versao="4.00">
+			<ide>
+				<cUF>35</cUF>
+				<cNF>12345678</cNF>
+				<natOp>VENDA</natOp>
+				<mod>55</mod>
+				<serie>1</serie>
+				<nNF>1234</nNF>
+				<dhEmi>2024-01-15T10:30:00-03:00</dhEmi>
+				<tpNF>1</tpNF>
+				<tpEmis>1</tpEmis>
+				<cDV>5</cDV>
+			</ide>
+			<emit>
+				<CNPJ>12345678000195</CNPJ>
+				<xNome>Fornecedor Exemplo LTDA</xNome>
+				<xFant>Exemplo</xFant>
+				<enderEmit>
+					<xLgr>Rua das Flores</xLgr>
+					<nro>100</nro>
+					<xCpl>Galpão 2</xCpl>
+					<xBairro>Centro</xBairro>
+					<cMun>3550308</cMun>
+					<xMun>São Paulo</xMun>
+					<UF>SP</UF>
+					<CEP>01001000</CEP>
+					<cPais>1058</cPais>
+					<xPais>BRASIL</xPais>
+					<fone>1133334444</fone>
+				</enderEmit>
+				<IE>111222333444</IE>
+				<CRT>3</CRT>
+			</emit>
+			<det nItem="1">
+				<prod>
+					<cProd>ABC-1</cProd>
+					<cEAN>7891234567895</cEAN>
+					<xProd>Parafuso Sextavado</xProd>
+					<NCM>73181500</NCM>
+					<CFOP>5102</CFOP>
+					<uCom>CX</uCom>
+					<qCom>10.0000</qCom>
+					<vUnCom>25.5000000000</vUnCom>
+					<vProd>255.00</vProd>
+					<cEANTrib>SEM GTIN</cEANTrib>
+					<uTrib>UN</uTrib>
+					<qTrib>1000.0000</qTrib>
+					<vUnTrib>0.2550000000</vUnTrib>
+					<vFrete>5.00</vFrete>
+					<indTot>1</indTot>
+				</prod>
+				<imposto>
+					<vTotTrib>30.00</vTotTrib>
+					<ICMS>
+						<ICMS00>
+							<orig>0</orig>
+							<CST>00</CST>
+							<modBC>3</modBC>
+							<vBC>260.00</vBC>
+							<pICMS>18.00</pICMS>
+							<vICMS>46.80</vICMS>
+						</ICMS00>
+					</ICMS>
+					<IPI>
+						<cEnq>999</cEnq>
+						<IPITrib>
+							<CST>50</CST>
+							<vBC>255.00</vBC>
+							<pIPI>5.00</pIPI>
+							<vIPI>12.75</vIPI>
+						</IPITrib>
+					</IPI>
+					<PIS>
+						<PISAliq>
+							<CST>01</CST>
+							<vBC>255.00</vBC>
+							<pPIS>1.65</pPIS>
+							<vPIS>4.21</vPIS>
+						</PISAliq>
+					</PIS>
+					<COFINS>
+						<COFINSAliq>
+							<CST>01</CST>
+							<vBC>255.00</vBC>
+							<pCOFINS>7.60</pCOFINS>
+							<vCOFINS>19.38</vCOFINS>
+						</COFINSAliq>
+					</COFINS>
+				</imposto>
+				<infAdProd>Lote 42</infAdProd>
+			</det>
+			<det nItem="2">
+				<prod>
+					<cProd>XYZ-9</cProd>
+					<cEAN>SEM GTIN</cEAN>
+					<xProd>Arruela Lisa</xProd>
+					<NCM>73182200</NCM>
+					<CFOP>5405</CFOP>
+					<uCom>UN</uCom>
+					<qCom>50.0000</qCom>
+					<vUnCom>0.1000000000</vUnCom>
+					<vProd>5.00</vProd>
+					<uTrib>UN</uTrib>
+					<qTrib>50.0000</qTrib>
+					<vUnTrib>0.1000000000</vUnTrib>
+					<indTot>1</indTot>
+					<rastro>
+						<nLote>A123</nLote>
+						<qLote>30.000</qLote>
+						<dFab>2024-01-05</dFab>
+						<dVal>2026-01-05</dVal>
+					</rastro>
+					<rastro>
+						<nLote>B456</nLote>
+						<qLote>20.000</qLote>
+						<dFab>2024-01-10</dFab>
+						<dVal>2026-01-10</dVal>
+					</rastro>
+				</prod>
+				<imposto>
+					<ICMS>
+						<ICMSSN500>
+							<orig>0</orig>
+							<CSOSN>500</CSOSN>
+						</ICMSSN500>
+					</ICMS>
+					<IPI>
+						<cEnq>999</cEnq>
+						<IPINT>
+							<CST>53</CST>
+						</IPINT>
+					</IPI>
+					<PIS>
+						<PISNT>
+							<CST>07</CST>
+						</PISNT>
+					</PIS>
+					<COFINS>
+						<COFINSNT>
+							<CST>07</CST>
+						</COFINSNT>
+					</COFINS>
+				</imposto>
+			</det>
+			<total>
+				<ICMSTot>
+					<vBC>260.00</vBC>
+					<vICMS>46.80</vICMS>
+					<vProd>260.00</vProd>
+					<vFrete>5.00</vFrete>
+					<vIPI>12.75</vIPI>
+					<vNF>277.75</vNF>
+				</ICMSTot>
+			</total>
+		</infNFe>
+	</NFe>
+	<protNFe versao="4.00">
+		<infProt>
+			<tpAmb>1</tpAmb>
+			<verAplic>SP_NFE_PL009_V4</verAplic>
+			<chNFe>35240112345678000195550010000012341123456785</chNFe>
+			<dhRecbto>2024-01-15T08:30:12-03:00</dhRecbto>
+			<nProt>135240000012345</nProt>
+			<digVal>n0Ylz3lPsbV1cZ3SP7sdQBrN1X0=</digVal>
+			<cStat>100</cStat>
+			<xMotivo>Autorizado o uso da NF-e</xMotivo>
+		</infProt>
+	</protNFe>
+</nfeProc>`
+
+func parseSampleNfe(t *testing.T) models.NfeProc {
+	t.Helper()
+	var proc models.NfeProc
+	if err := xml.Unmarshal([]byte(sampleNfeXML), &proc); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+	return proc
+}
+
+func TestBuildNfeItems(t *testing.T) {
+	proc := parseSampleNfe(t)
+
+	items := BuildNfeItems("35240112345678000195550010000012341123456785", proc.NFe.InfNFe.Det)
+	if len(items) != 2 {
+		t.Fatalf("BuildNfeItems() len = %d, want 2", len(items))
+	}
+
+	first := items[0]
+	if first.ItemNumber != 1 || first.Code != "ABC-1" || first.CFOP != "5102" {
+		t.Errorf("BuildNfeItems()[0] = %+v", first)
+	}
+	if first.EAN == nil || *first.EAN != "7891234567895" {
+		t.Errorf("BuildNfeItems()[0].EAN = %v, want 7891234567895", first.EAN)
+	}
+	if first.TaxEAN != nil {
+		t.Errorf("BuildNfeItems()[0].TaxEAN = %v, want nil for SEM GTIN", *first.TaxEAN)
+	}
+	if first.Unit != "CX" || first.TaxUnit != "UN" || first.TaxQuantity != 1000 {
+		t.Errorf("BuildNfeItems()[0] units = %s/%s/%v", first.Unit, first.TaxUnit, first.TaxQuantity)
+	}
+	if first.ICMSGroup != "ICMS00" || first.ICMSCST != "00" || first.ICMSValue != 46.80 {
+		t.Errorf("BuildNfeItems()[0] ICMS = %s/%s/%v", first.ICMSGroup, first.ICMSCST, first.ICMSValue)
+	}
+	if first.IPICST != "50" || first.IPIValue != 12.75 {
+		t.Errorf("BuildNfeItems()[0] IPI = %s/%v", first.IPICST, first.IPIValue)
+	}
+	if first.PISValue != 4.21 || first.COFINSValue != 19.38 {
+		t.Errorf("BuildNfeItems()[0] PIS/COFINS = %v/%v", first.PISValue, first.COFINSValue)
+	}
+	if first.Freight != 5 {
+		t.Errorf("BuildNfeItems()[0].Freight = %v, want 5", first.Freight)
+	}
+
+	second := items[1]
+	if second.EAN != nil {
+		t.Errorf("BuildNfeItems()[1].EAN = %v, want nil", *second.EAN)
+	}
+	if second.ICMSGroup != "ICMSSN500" || second.ICMSCST != "500" {
+		t.Errorf("BuildNfeItems()[1] ICMS = %s/%s, want ICMSSN500/500", second.ICMSGroup, second.ICMSCST)
+	}
+	if second.IPICST != "53" || second.PISCST != "07" || second.COFINSCST != "07" {
+		t.Errorf("BuildNfeItems()[1] CSTs = %s/%s/%s", second.IPICST, second.PISCST, second.COFINSCST)
+	}
+}
+
+func TestGetNfeItems_Backfill(t *testing.T) {
+	const key = "35240112345678000195550010000012341123456785"
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ProcessedNFe{}, &models.NFeItem{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	// Nota registrada antes de nfe_items existir: só o XML está gravado
+	if err := db.Create(&models.ProcessedNFe{AccessKey: key, XMLData: []byte(sampleNfeXML)}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := NewNfeService(db)
+
+	items, err := s.GetNfeItems(key)
+	if err != nil {
+		t.Fatalf("GetNfeItems() error = %v", err)
+	}
+	if len(items) != 2 || items[0].ID == 0 || items[0].ItemNumber != 1 || items[1].ItemNumber != 2 {
+		t.Fatalf("GetNfeItems() = %+v, want os 2 itens gravados", items)
+	}
+
+	// O índice único impede a segunda cópia de um preenchimento concorrente
+	duplicate := BuildNfeItems(key, parseSampleNfe(t).NFe.InfNFe.Det)[:1]
+	if err := db.Create(&duplicate).Error; !isDuplicateKeyError(err) {
+		t.Errorf("Create() de item repetido error = %v, want chave duplicada", err)
+	}
+	if items, _ := s.GetNfeItems(key); len(items) != 2 {
+		t.Errorf("GetNfeItems() depois da segunda leitura = %d itens, want 2", len(items))
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/xmldsig"
+	"estoque/internal/utils"
+	"sync"
+	"time"
+)
+
+// Situação da assinatura digital gravada em ProcessedNFe.SignatureStatus
+const (
+	SignatureValid       = "VALIDA"
+	SignatureInvalid     = "INVALIDA"
+	SignatureMissing     = "AUSENTE"
+	SignatureNotVerified = "NAO_VERIFICADA"
+	// Assinatura confere, mas sem ICP_BRASIL_ROOTS a cadeia do certificado não foi validada
+	SignatureChainUnchecked = "VALIDA_SEM_CADEIA"
+)
+
+var (
+	ErrNfeSignatureMissing   = &NfeValidationError{Code: "ASSINATURA_AUSENTE", Message: "NF-e sem assinatura digital"}
+	ErrNfeSignatureInvalid   = &NfeValidationError{Code: "ASSINATURA_INVALIDA", Message: "assinatura digital da NF-e inválida"}
+	ErrNfeSignatureUnchained = &NfeValidationError{Code: "ASSINATURA_SEM_CADEIA", Message: "cadeia do certificado não verificada: configure ICP_BRASIL_ROOTS"}
+)
+
+var (
+	trustMu    sync.RWMutex
+	trustStore *xmldsig.TrustStore
+)
+
+// ConfigureTrustStore define as ACs ICP-Brasil usadas para validar a cadeia dos
+// certificados; nil deixa as assinaturas como VALIDA_SEM_CADEIA
+func ConfigureTrustStore(s *xmldsig.TrustStore) {
+	trustMu.Lock()
+	trustStore = s
+	trustMu.Unlock()
+}
+
+func currentTrustStore() *xmldsig.TrustStore {
+	trustMu.RLock()
+	defer trustMu.RUnlock()
+	return trustStore
+}
+
+// nfeSignaturePath é a posição de infNFe lida em models.NfeProc
+var nfeSignaturePath = []string{"nfeProc", "NFe", "infNFe"}
+
+// NfeSignatureCheck resume a verificação XMLDSig feita no recebimento da nota
+type NfeSignatureCheck struct {
+	Status string
+	Error  error
+	Signer *xmldsig.CertificateInfo
+}
+
+// VerifyNfeSignature confere a assinatura envelopada sobre o infNFe lido em
+// proc, a cadeia do certificado até as ACs ICP-Brasil configuradas e se o
+// certificado pertence ao emitente (mesma raiz de CNPJ)
+func VerifyNfeSignature(proc *models.NfeProc, xmlData []byte) NfeSignatureCheck {
+	return verifySignature(xmlData, proc.NFe.InfNFe.ID, nfeSignaturePath, proc.NFe.InfNFe.Emit.CNPJ, proc.NFe.InfNFe.Ide.DhEmi)
+}
+
+// verifySignature é a verificação comum a NF-e e eventos: path é a posição do
+// elemento assinado, emitter o CNPJ de quem deveria assinar e issuedAt a data
+// do documento, usada para validar a cadeia
+func verifySignature(xmlData []byte, referenceID string, path []string, emitter, issuedAt string) NfeSignatureCheck {
+	result, err := xmldsig.VerifyEnveloped(xmlData, referenceID, path...)
+	if errors.Is(err, xmldsig.ErrSignatureMissing) {
+		return NfeSignatureCheck{Status: SignatureMissing, Error: err}
+	}
+	if err != nil {
+		return NfeSignatureCheck{Status: SignatureInvalid, Error: err}
+	}
+
+	check := NfeSignatureCheck{Status: SignatureValid, Signer: &result.Signer}
+	emitter = onlyDigits(emitter)
+	if len(emitter) == 14 {
+		// Certificado sem CNPJ não comprova que o emitente assinou
+		if result.Signer.CNPJ == "" {
+			check.Status = SignatureInvalid
+			check.Error = errors.New("certificado da assinatura sem CNPJ do emitente")
+			return check
+		}
+		if result.Signer.CNPJ[:8] != emitter[:8] {
+			check.Status = SignatureInvalid
+			check.Error = errors.New("certificado da assinatura não pertence ao emitente")
+			return check
+		}
+	}
+
+	store := currentTrustStore()
+	if store == nil {
+		check.Status = SignatureChainUnchecked
+		check.Error = errors.New("cadeia do certificado não verificada (ICP_BRASIL_ROOTS não configurado)")
+		return check
+	}
+	at := time.Now()
+	if t := optionalFiscalDate(issuedAt); t != nil {
+		at = *t
+	}
+	if err := store.VerifyChain(result.Certificate, result.Intermediates, at); err != nil {
+		check.Status = SignatureInvalid
+		check.Error = err
+	}
+	return check
+}
+
+// Enforce aplica a política configurada: com REJEITAR, notas sem assinatura válida
+// retornam um NfeValidationError; com SINALIZAR, apenas ficam registradas como tal
+func (c NfeSignatureCheck) Enforce(policy string) error {
+	if policy != SignaturePolicyReject || c.Status == SignatureValid {
+		return nil
+	}
+	if c.Status == SignatureMissing {
+		return ErrNfeSignatureMissing
+	}
+	if c.Status == SignatureChainUnchecked {
+		return ErrNfeSignatureUnchained
+	}
+	return &NfeValidationError{
+		Code:    ErrNfeSignatureInvalid.Code,
+		Message: ErrNfeSignatureInvalid.Message + ": " + c.Error.Error(),
+	}
+}
+
+// apply grava o resultado da verificação no registro da nota
+func (c *NfeSignatureCheck) apply(nfe *models.ProcessedNFe) {
+	if c == nil {
+		nfe.SignatureStatus = SignatureNotVerified
+		return
+	}
+	nfe.SignatureStatus = c.Status
+	if c.Error != nil {
+		nfe.SignatureError = stringPtr(utils.Truncate(c.Error.Error(), 255))
+	}
+	if c.Signer != nil {
+		nfe.SignerSubject = stringPtr(utils.Truncate(c.Signer.Subject, 255))
+		nfe.SignerIssuer = stringPtr(utils.Truncate(c.Signer.Issuer, 255))
+		nfe.SignerSerial = stringPtr(c.Signer.SerialNumber)
+		if c.Signer.CNPJ != "" {
+			nfe.SignerCNPJ = stringPtr(c.Signer.CNPJ)
+		}
+		validUntil := c.Signer.NotAfter
+		nfe.SignerValidUntil = &validUntil
+	}
+}
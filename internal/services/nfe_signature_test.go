@@ -0,0 +1,108 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"estoque/internal/models"
+	"estoque/internal/services/xmldsig"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// issueTestCertificate emite um certificado válido na emissão da nota de exemplo
+// (2024); autoassinado quando parent é nil
+func issueTestCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func signSampleNfe(t *testing.T, cert *x509.Certificate, key *rsa.PrivateKey) (*models.NfeProc, []byte) {
+	t.Helper()
+	signed, err := xmldsig.SignEnveloped([]byte(sampleNfeXML), "NFe35240112345678000195550010000012341123456785", key, cert)
+	if err != nil {
+		t.Fatalf("SignEnveloped() error = %v", err)
+	}
+	var proc models.NfeProc
+	if err := xml.Unmarshal(signed, &proc); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+	return &proc, signed
+}
+
+func TestVerifyNfeSignature(t *testing.T) {
+	root, rootKey := issueTestCertificate(t, "AC Raiz Teste", nil, nil)
+	leaf, leafKey := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA:12345678000195", root, rootKey)
+	selfSigned, selfKey := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA:12345678000195", nil, nil)
+	noCNPJ, noCNPJKey := issueTestCertificate(t, "FORNECEDOR EXEMPLO LTDA", root, rootKey)
+	store, err := xmldsig.NewTrustStore(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	if err != nil {
+		t.Fatalf("NewTrustStore() error = %v", err)
+	}
+	t.Cleanup(func() { ConfigureTrustStore(nil) })
+
+	tests := []struct {
+		name       string
+		store      *xmldsig.TrustStore
+		cert       *x509.Certificate
+		key        *rsa.PrivateKey
+		wantStatus string
+		wantReject error
+	}{
+		{"cadeia ICP-Brasil", store, leaf, leafKey, SignatureValid, nil},
+		{"autoassinado com o CNPJ do emitente", store, selfSigned, selfKey, SignatureInvalid, ErrNfeSignatureInvalid},
+		{"sem raízes configuradas", nil, leaf, leafKey, SignatureChainUnchecked, ErrNfeSignatureUnchained},
+		{"certificado sem CNPJ", store, noCNPJ, noCNPJKey, SignatureInvalid, ErrNfeSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigureTrustStore(tt.store)
+			proc, signed := signSampleNfe(t, tt.cert, tt.key)
+
+			check := VerifyNfeSignature(proc, signed)
+			if check.Status != tt.wantStatus {
+				t.Fatalf("VerifyNfeSignature() status = %s (%v), want %s", check.Status, check.Error, tt.wantStatus)
+			}
+			err := check.Enforce(SignaturePolicyReject)
+			if tt.wantReject == nil {
+				if err != nil {
+					t.Errorf("Enforce(REJEITAR) error = %v", err)
+				}
+				return
+			}
+			var verr *NfeValidationError
+			if !errors.As(err, &verr) || verr.Code != tt.wantReject.(*NfeValidationError).Code {
+				t.Errorf("Enforce(REJEITAR) error = %v, want código %s", err, tt.wantReject.(*NfeValidationError).Code)
+			}
+			if err := check.Enforce(SignaturePolicyFlag); err != nil {
+				t.Errorf("Enforce(SINALIZAR) error = %v", err)
+			}
+		})
+	}
+}
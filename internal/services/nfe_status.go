@@ -0,0 +1,116 @@
+package services
+
+import (
+	"encoding/json"
+	"estoque/internal/models"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Estados de uma NF-e recebida
+const (
+	NfeStatusPending   = "PENDENTE"
+	NfeStatusInReview  = "EM_CONFERENCIA"
+	NfeStatusProcessed = "PROCESSADA"
+	NfeStatusPartial   = "PARCIAL"
+	NfeStatusRejected  = "REJEITADA"
+	NfeStatusCancelled = "CANCELADA"
+)
+
+// nfeTransitions lista para quais estados cada estado pode ir. O cancelamento
+// pelo emitente é aceito em qualquer estado que não seja final.
+var nfeTransitions = map[string][]string{
+	NfeStatusPending:   {NfeStatusInReview, NfeStatusProcessed, NfeStatusPartial, NfeStatusRejected, NfeStatusCancelled},
+	NfeStatusInReview:  {NfeStatusPending, NfeStatusProcessed, NfeStatusPartial, NfeStatusRejected, NfeStatusCancelled},
+	NfeStatusProcessed: {NfeStatusCancelled},
+	NfeStatusPartial:   {NfeStatusCancelled},
+	NfeStatusRejected:  {NfeStatusCancelled},
+	NfeStatusCancelled: {},
+}
+
+var (
+	ErrNfeInvalidTransition = &NfeValidationError{Code: "TRANSICAO_INVALIDA", Message: "mudança de status não permitida"}
+	ErrNfeNotEditable       = &NfeValidationError{Code: "NFE_NAO_EDITAVEL", Message: "conferência só é permitida em notas pendentes ou em conferência"}
+	ErrNfeReasonRequired    = &NfeValidationError{Code: "JUSTIFICATIVA_OBRIGATORIA", Message: "informe a justificativa"}
+	ErrNfeStatusConflict    = &NfeValidationError{Code: "STATUS_ALTERADO", Message: "a nota foi alterada por outra operação; recarregue e tente novamente"}
+)
+
+// CanTransition indica se a nota pode passar do estado from para to
+func CanTransition(from, to string) bool {
+	for _, allowed := range nfeTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionNfe valida e grava a mudança de status, registrando-a no log de auditoria
+// na mesma transação. extra é gravado junto ao novo status (ex: justificativa).
+// O update só acontece se a nota ainda estiver no status lido em nfe; se outra
+// operação a alterou nesse meio tempo, retorna ErrNfeStatusConflict.
+func transitionNfe(tx *gorm.DB, nfe *models.ProcessedNFe, to string, userID *int32, reason string, extra map[string]interface{}) error {
+	from := nfe.Status
+	if from == "" {
+		from = NfeStatusPending
+	}
+	if !CanTransition(from, to) {
+		return invalidTransition(from, to)
+	}
+
+	updates := map[string]interface{}{"status": to}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	result := tx.Model(&models.ProcessedNFe{}).
+		Where("access_key = ? AND status = ?", nfe.AccessKey, nfe.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNfeStatusConflict
+	}
+	nfe.Status = to
+
+	oldValues := jsonString(map[string]interface{}{"status": from})
+	newState := map[string]interface{}{"status": to}
+	if reason != "" {
+		newState["reason"] = reason
+	}
+	description := fmt.Sprintf("NF-e %s: %s → %s", nfe.AccessKey, from, to)
+	return models.LogAction(tx, userID, "STATUS_CHANGE", "processed_nfe", nfe.AccessKey, description, oldValues, jsonString(newState))
+}
+
+// lockNfe trava a linha da nota até o fim da transação e confirma que o status
+// lido antes dela não mudou; um processamento concorrente recebe ErrNfeStatusConflict
+func lockNfe(tx *gorm.DB, nfe *models.ProcessedNFe) error {
+	var current models.ProcessedNFe
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("access_key", "status").
+		First(&current, "access_key = ?", nfe.AccessKey).Error; err != nil {
+		return err
+	}
+	if current.Status != nfe.Status {
+		return ErrNfeStatusConflict
+	}
+	return nil
+}
+
+// invalidTransition descreve a transição recusada mantendo o código TRANSICAO_INVALIDA
+func invalidTransition(from, to string) error {
+	return &NfeValidationError{
+		Code:    ErrNfeInvalidTransition.Code,
+		Message: fmt.Sprintf("%s: %s → %s", ErrNfeInvalidTransition.Message, from, to),
+	}
+}
+
+func jsonString(v interface{}) *string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	s := string(data)
+	return &s
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{NfeStatusPending, NfeStatusInReview, true},
+		{NfeStatusPending, NfeStatusProcessed, true},
+		{NfeStatusInReview, NfeStatusPartial, true},
+		{NfeStatusInReview, NfeStatusRejected, true},
+		{NfeStatusProcessed, NfeStatusCancelled, true},
+		{NfeStatusRejected, NfeStatusCancelled, true},
+		{NfeStatusProcessed, NfeStatusPending, false},
+		{NfeStatusRejected, NfeStatusProcessed, false},
+		{NfeStatusPartial, NfeStatusProcessed, false},
+		{NfeStatusCancelled, NfeStatusPending, false},
+		{"DESCONHECIDO", NfeStatusProcessed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceivedQuantity(t *testing.T) {
+	five := 5.0
+	ten := 10.0
+
+	tests := []struct {
+		name           string
+		item           models.NFeItem
+		wantQty        float64
+		wantDivergence bool
+	}{
+		{"sem conferência", models.NFeItem{Quantity: 10}, 10, false},
+		{"recebido conforme faturado", models.NFeItem{Quantity: 10, ReceivedQuantity: &ten}, 10, false},
+		{"recebido a menor", models.NFeItem{Quantity: 10, ReceivedQuantity: &five}, 5, true},
+		{"linha excluída", models.NFeItem{Quantity: 10, ReceivedQuantity: &ten, Excluded: true}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := receivedQuantity(tt.item); got != tt.wantQty {
+				t.Errorf("receivedQuantity() = %v, want %v", got, tt.wantQty)
+			}
+			if got := hasDivergence(tt.item); got != tt.wantDivergence {
+				t.Errorf("hasDivergence() = %v, want %v", got, tt.wantDivergence)
+			}
+		})
+	}
+}
+
+func TestTransitionNfe_Conflict(t *testing.T) {
+	db := setupManifestationDB(t)
+
+	// Duas operações leram a nota pendente; só a primeira pode mudar o status
+	var first, second models.ProcessedNFe
+	db.First(&first, "access_key = ?", manifestKey)
+	db.First(&second, "access_key = ?", manifestKey)
+
+	if err := transitionNfe(db, &first, NfeStatusRejected, nil, "recusada", nil); err != nil {
+		t.Fatalf("transitionNfe() error = %v", err)
+	}
+	if err := transitionNfe(db, &second, NfeStatusInReview, nil, "", nil); err != ErrNfeStatusConflict {
+		t.Fatalf("transitionNfe() concorrente error = %v, want %v", err, ErrNfeStatusConflict)
+	}
+	if second.Status != NfeStatusPending {
+		t.Errorf("status em memória = %s, want %s", second.Status, NfeStatusPending)
+	}
+
+	var stored models.ProcessedNFe
+	db.First(&stored, "access_key = ?", manifestKey)
+	if stored.Status != NfeStatusRejected {
+		t.Errorf("status gravado = %s, want %s", stored.Status, NfeStatusRejected)
+	}
+	var logs int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "STATUS_CHANGE").Count(&logs)
+	if logs != 1 {
+		t.Errorf("logs de auditoria = %d, want 1", logs)
+	}
+}
+
+func TestReviewItem_AfterProcessingStarted(t *testing.T) {
+	db := setupManifestationDB(t)
+	if err := db.AutoMigrate(&models.NFeItem{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&models.NFeItem{AccessKey: manifestKey, ItemNumber: 1, Code: "ABC-1", Name: "Parafuso", Quantity: 10}).Error; err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	s := NewNfeService(db)
+	five := 5.0
+
+	// A efetivação trava a nota lida e a conferência só continua depois dela
+	var read models.ProcessedNFe
+	db.First(&read, "access_key = ?", manifestKey)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockNfe(tx, &read); err != nil {
+			return err
+		}
+		return transitionNfe(tx, &read, NfeStatusProcessed, nil, "", nil)
+	})
+	if err != nil {
+		t.Fatalf("efetivação error = %v", err)
+	}
+
+	_, err = s.ReviewItem(manifestKey, 1, models.ReviewNfeItemRequest{ReceivedQuantity: &five, DivergenceReason: "avaria"}, nil)
+	if !errors.Is(err, ErrNfeNotEditable) {
+		t.Errorf("ReviewItem() depois da efetivação error = %v, want %v", err, ErrNfeNotEditable)
+	}
+	var item models.NFeItem
+	db.First(&item, "access_key = ? AND item_number = ?", manifestKey, 1)
+	if item.ReceivedQuantity != nil {
+		t.Errorf("ReceivedQuantity = %v, want linha sem alteração", *item.ReceivedQuantity)
+	}
+
+	// Outro processamento que leu a nota pendente não passa da trava
+	stale := models.ProcessedNFe{AccessKey: manifestKey, Status: NfeStatusPending}
+	if err := lockNfe(db, &stale); !errors.Is(err, ErrNfeStatusConflict) {
+		t.Errorf("lockNfe() com status antigo error = %v, want %v", err, ErrNfeStatusConflict)
+	}
+}
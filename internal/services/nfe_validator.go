@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"strconv"
+	"strings"
+)
+
+// NfeValidationError representa uma rejeição da NF-e com código específico,
+// para que upload e consumidor de e-mail possam reportar o motivo por arquivo
+type NfeValidationError struct {
+	Code    string
+	Message string
+}
+
+func (e *NfeValidationError) Error() string {
+	return e.Message
+}
+
+// Códigos de rejeição da chave de acesso
+var (
+	ErrNfeKeyMissing       = &NfeValidationError{Code: "CHAVE_AUSENTE", Message: "chave de acesso ausente no XML"}
+	ErrNfeKeyFormat        = &NfeValidationError{Code: "CHAVE_FORMATO_INVALIDO", Message: "chave de acesso deve conter 44 dígitos numéricos"}
+	ErrNfeKeyCheckDigit    = &NfeValidationError{Code: "CHAVE_DV_INVALIDO", Message: "dígito verificador da chave de acesso inválido"}
+	ErrNfeKeyUF            = &NfeValidationError{Code: "CHAVE_UF_DIVERGENTE", Message: "UF da chave de acesso diverge de ide/cUF"}
+	ErrNfeKeyEmissionMonth = &NfeValidationError{Code: "CHAVE_AAMM_DIVERGENTE", Message: "ano/mês da chave de acesso diverge da data de emissão"}
+	ErrNfeKeyEmitter       = &NfeValidationError{Code: "CHAVE_EMITENTE_DIVERGENTE", Message: "CNPJ/CPF da chave de acesso diverge do emitente"}
+	ErrNfeKeyModel         = &NfeValidationError{Code: "CHAVE_MODELO_DIVERGENTE", Message: "modelo da chave de acesso diverge de ide/mod"}
+	ErrNfeKeySeries        = &NfeValidationError{Code: "CHAVE_SERIE_DIVERGENTE", Message: "série da chave de acesso diverge de ide/serie"}
+	ErrNfeKeyNumber        = &NfeValidationError{Code: "CHAVE_NUMERO_DIVERGENTE", Message: "número da chave de acesso diverge de ide/nNF"}
+	ErrNfeKeyEmissionType  = &NfeValidationError{Code: "CHAVE_TPEMIS_DIVERGENTE", Message: "tipo de emissão da chave de acesso diverge de ide/tpEmis"}
+	ErrNfeKeyNumericCode   = &NfeValidationError{Code: "CHAVE_CNF_DIVERGENTE", Message: "código numérico da chave de acesso diverge de ide/cNF"}
+	ErrNfeKeyDeclaredDigit = &NfeValidationError{Code: "CHAVE_CDV_DIVERGENTE", Message: "dígito verificador da chave de acesso diverge de ide/cDV"}
+)
+
+var ErrNfeMalformedXML = &NfeValidationError{Code: "XML_INVALIDO", Message: "arquivo não é um XML bem formado"}
+
+// NfeErrorCode extrai o código de rejeição de um erro do pipeline de NF-e, se houver
+func NfeErrorCode(err error) string {
+	var validationErr *NfeValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
+
+// NormalizeAccessKey remove o prefixo "NFe" e espaços do atributo Id de infNFe
+func NormalizeAccessKey(id string) string {
+	key := strings.TrimSpace(id)
+	if len(key) >= 3 && strings.EqualFold(key[:3], "NFe") {
+		key = key[3:]
+	}
+	return strings.ReplaceAll(key, " ", "")
+}
+
+// AccessKeyCheckDigit calcula o dígito verificador (módulo 11) das 43 primeiras posições da chave
+func AccessKeyCheckDigit(key43 string) int {
+	sum := 0
+	weight := 2
+	for i := len(key43) - 1; i >= 0; i-- {
+		sum += int(key43[i]-'0') * weight
+		weight++
+		if weight > 9 {
+			weight = 2
+		}
+	}
+	remainder := sum % 11
+	if remainder < 2 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+// ValidateAccessKey verifica formato e dígito verificador de uma chave já normalizada
+func ValidateAccessKey(key string) error {
+	if key == "" {
+		return ErrNfeKeyMissing
+	}
+	if len(key) != 44 || !isDigits(key) {
+		return ErrNfeKeyFormat
+	}
+	if AccessKeyCheckDigit(key[:43]) != int(key[43]-'0') {
+		return ErrNfeKeyCheckDigit
+	}
+	return nil
+}
+
+// ValidateNfe normaliza a chave de acesso e confere se os campos embutidos nela
+// (UF, AAMM, CNPJ, modelo, série, número, tpEmis, cNF e cDV) batem com ide/emit.
+// Retorna a chave normalizada.
+func ValidateNfe(proc *models.NfeProc) (string, error) {
+	inf := proc.NFe.InfNFe
+	key := NormalizeAccessKey(inf.ID)
+	if err := ValidateAccessKey(key); err != nil {
+		return key, err
+	}
+
+	ide := inf.Ide
+	if !sameNumber(key[0:2], ide.CUF) {
+		return key, ErrNfeKeyUF
+	}
+	if yymm := emissionYYMM(ide); yymm != "" && key[2:6] != yymm {
+		return key, ErrNfeKeyEmissionMonth
+	}
+	if emitter := emitterDocument(inf.Emit); emitter != "" && key[6:20] != emitter {
+		return key, ErrNfeKeyEmitter
+	}
+	if !sameNumber(key[20:22], ide.Mod) {
+		return key, ErrNfeKeyModel
+	}
+	if !sameNumber(key[22:25], ide.Serie) {
+		return key, ErrNfeKeySeries
+	}
+	if !sameNumber(key[25:34], ide.NNF) {
+		return key, ErrNfeKeyNumber
+	}
+	if ide.TpEmis != "" && !sameNumber(key[34:35], ide.TpEmis) {
+		return key, ErrNfeKeyEmissionType
+	}
+	if ide.CNF != "" && !sameNumber(key[35:43], ide.CNF) {
+		return key, ErrNfeKeyNumericCode
+	}
+	if ide.CDV != "" && !sameNumber(key[43:44], ide.CDV) {
+		return key, ErrNfeKeyDeclaredDigit
+	}
+
+	return key, nil
+}
+
+// emissionYYMM extrai o AAMM da data de emissão (dhEmi no layout 3.10+, dEmi nos anteriores)
+func emissionYYMM(ide models.Ide) string {
+	date := strings.TrimSpace(ide.DhEmi)
+	if date == "" {
+		date = strings.TrimSpace(ide.DEmi)
+	}
+	if len(date) < 7 || date[4] != '-' {
+		return ""
+	}
+	return date[2:4] + date[5:7]
+}
+
+// emitterDocument retorna o CNPJ do emitente ou o CPF completado com zeros à esquerda, como na chave
+func emitterDocument(emit models.Emit) string {
+	if doc := onlyDigits(emit.CNPJ); doc != "" {
+		return doc
+	}
+	if doc := onlyDigits(emit.CPF); doc != "" && len(doc) <= 14 {
+		return strings.Repeat("0", 14-len(doc)) + doc
+	}
+	return ""
+}
+
+// sameNumber compara um trecho numérico da chave com o valor do XML, que pode vir sem zeros à esquerda
+func sameNumber(keyPart, value string) bool {
+	a, errA := strconv.ParseInt(keyPart, 10, 64)
+	b, errB := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return errA == nil && errB == nil && a == b
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package services
+
+import "testing"
+
+func TestNormalizeAccessKey(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"com prefixo NFe", "NFe35240112345678000195550010000012341123456785", "35240112345678000195550010000012341123456785"},
+		{"sem prefixo", "35240112345678000195550010000012341123456785", "35240112345678000195550010000012341123456785"},
+		{"com espaços", " NFe3524 0112345678000195550010000012341123456785 ", "35240112345678000195550010000012341123456785"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeAccessKey(tt.id); got != tt.want {
+				t.Errorf("NormalizeAccessKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAccessKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"chave válida", "35240112345678000195550010000012341123456785", nil},
+		{"chave vazia", "", ErrNfeKeyMissing},
+		{"chave curta", "3524011234567800019555001000001234112345678", ErrNfeKeyFormat},
+		{"chave com letras", "3524011234567800019555001000001234112345678X", ErrNfeKeyFormat},
+		{"dígito verificador errado", "35240112345678000195550010000012341123456780", ErrNfeKeyCheckDigit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAccessKey(tt.key); err != tt.wantErr {
+				t.Errorf("ValidateAccessKey() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNfe(t *testing.T) {
+	proc := parseSampleNfe(t)
+	key, err := ValidateNfe(&proc)
+	if err != nil {
+		t.Fatalf("ValidateNfe() error = %v", err)
+	}
+	if key != "35240112345678000195550010000012341123456785" {
+		t.Errorf("ValidateNfe() key = %v", key)
+	}
+
+	tests := []struct {
+		name     string
+		tamper   func()
+		wantCode string
+	}{
+		{"UF divergente", func() { proc.NFe.InfNFe.Ide.CUF = "41" }, "CHAVE_UF_DIVERGENTE"},
+		{"mês de emissão divergente", func() { proc.NFe.InfNFe.Ide.DhEmi = "2024-02-01T08:00:00-03:00" }, "CHAVE_AAMM_DIVERGENTE"},
+		{"emitente divergente", func() { proc.NFe.InfNFe.Emit.CNPJ = "99999999000191" }, "CHAVE_EMITENTE_DIVERGENTE"},
+		{"modelo divergente", func() { proc.NFe.InfNFe.Ide.Mod = "65" }, "CHAVE_MODELO_DIVERGENTE"},
+		{"série divergente", func() { proc.NFe.InfNFe.Ide.Serie = "2" }, "CHAVE_SERIE_DIVERGENTE"},
+		{"número divergente", func() { proc.NFe.InfNFe.Ide.NNF = "1235" }, "CHAVE_NUMERO_DIVERGENTE"},
+		{"cDV divergente", func() { proc.NFe.InfNFe.Ide.CDV = "4" }, "CHAVE_CDV_DIVERGENTE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc = parseSampleNfe(t)
+			tt.tamper()
+			_, err := ValidateNfe(&proc)
+			if got := NfeErrorCode(err); got != tt.wantCode {
+				t.Errorf("ValidateNfe() code = %q, want %q (err = %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
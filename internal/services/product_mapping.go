@@ -0,0 +1,432 @@
+package services
+
+import (
+	"encoding/xml"
+	"estoque/internal/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Origem da sugestão de produto
+const (
+	SuggestionByEAN  = "EAN"
+	SuggestionByName = "NOME"
+)
+
+const (
+	maxSuggestions      = 5
+	minNameSimilarity   = 0.3
+	nameCandidatesLimit = 50
+)
+
+var ErrNfeUnmappedItems = &NfeValidationError{Code: "ITENS_SEM_MAPEAMENTO", Message: "existem itens da nota sem produto interno associado"}
+
+// supplierDocument retorna o CNPJ/CPF do emitente, extraindo do XML (e gravando)
+// para notas registradas antes da coluna existir
+func (s *NfeService) supplierDocument(nfe *models.ProcessedNFe) (string, error) {
+	if nfe.SupplierCNPJ != nil && *nfe.SupplierCNPJ != "" {
+		return *nfe.SupplierCNPJ, nil
+	}
+
+	var proc models.NfeProc
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		return "", err
+	}
+	doc := emitterDocument(proc.NFe.InfNFe.Emit)
+	if doc == "" {
+		return "", ErrNfeKeyEmitter
+	}
+
+	nfe.SupplierCNPJ = &doc
+	if err := s.DB.Model(nfe).Update("supplier_cnpj", doc).Error; err != nil {
+		return "", err
+	}
+	return doc, nil
+}
+
+// resolveMappings retorna o código interno de cada cProd mapeado para o fornecedor
+func resolveMappings(tx *gorm.DB, supplierCNPJ string, items []models.NFeItem) (map[string]string, error) {
+	codes := make([]string, 0, len(items))
+	for _, item := range items {
+		codes = append(codes, item.Code)
+	}
+
+	var mappings []models.SupplierProductMapping
+	if err := tx.Where("supplier_cnpj = ? AND supplier_code IN ?", supplierCNPJ, codes).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		resolved[m.SupplierCode] = m.ProductCode
+	}
+	return resolved, nil
+}
+
+// unmappedItemsError lista os itens sem mapeamento na mensagem de rejeição
+func unmappedItemsError(items []models.NFeItem, resolved map[string]string) error {
+	var missing []string
+	for _, item := range items {
+		if _, ok := resolved[item.Code]; !ok {
+			missing = append(missing, strconv.Itoa(item.ItemNumber))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &NfeValidationError{
+		Code:    ErrNfeUnmappedItems.Code,
+		Message: fmt.Sprintf("%s (itens %s)", ErrNfeUnmappedItems.Message, strings.Join(missing, ", ")),
+	}
+}
+
+// GetItemMappings retorna cada item da nota com o produto interno associado ou,
+// quando não houver mapeamento, sugestões por EAN e por semelhança de nome
+func (s *NfeService) GetItemMappings(accessKey string) ([]models.NfeItemMapping, error) {
+	var nfe models.ProcessedNFe
+	if err := s.DB.First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		return nil, err
+	}
+	supplierCNPJ, err := s.supplierDocument(&nfe)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.GetNfeItems(accessKey)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := resolveNfeProducts(s.DB, &nfe, supplierCNPJ, items)
+	if err != nil {
+		return nil, err
+	}
+	factors, _, err := resolveConversions(s.DB, supplierCNPJ, items, resolved)
+	if err != nil {
+		return nil, err
+	}
+	stockUnits, err := productUnits(s.DB, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.NfeItemMapping, 0, len(items))
+	for _, item := range items {
+		entry := models.NfeItemMapping{Item: item}
+		if code, ok := resolved[item.Code]; ok {
+			entry.ProductCode = stringPtr(code)
+			entry.StockUnit = optionalString(stockUnits[code])
+			if factor, ok := factors[item.ItemNumber]; ok {
+				entry.ConversionFactor = &factor
+			}
+		} else {
+			suggestions, err := s.SuggestProducts(item)
+			if err != nil {
+				return nil, err
+			}
+			entry.Suggestions = suggestions
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// SuggestProducts procura produtos ativos com o mesmo EAN do item e, em seguida, com nome parecido
+func (s *NfeService) SuggestProducts(item models.NFeItem) ([]models.ProductSuggestion, error) {
+	suggestions := []models.ProductSuggestion{}
+	seen := map[string]bool{}
+
+	var eans []string
+	for _, ean := range []*string{item.EAN, item.TaxEAN} {
+		if ean != nil && *ean != "" {
+			eans = append(eans, *ean)
+		}
+	}
+	if len(eans) > 0 {
+		var products []models.Product
+		if err := s.DB.Where("active = ? AND barcode IN ?", true, eans).Find(&products).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range products {
+			seen[p.Code] = true
+			suggestions = append(suggestions, models.ProductSuggestion{
+				ProductCode: p.Code,
+				Name:        p.Name,
+				Barcode:     p.Barcode,
+				MatchedBy:   SuggestionByEAN,
+				Score:       1,
+			})
+		}
+	}
+
+	// Candidatos por nome: produtos que contenham alguma das palavras mais longas da descrição
+	words := significantWords(item.Name, 3)
+	if len(words) == 0 {
+		return suggestions, nil
+	}
+	query := s.DB.Where("active = ?", true)
+	conditions := s.DB
+	for i, w := range words {
+		if i == 0 {
+			conditions = conditions.Where("UPPER(name) LIKE ?", "%"+w+"%")
+		} else {
+			conditions = conditions.Or("UPPER(name) LIKE ?", "%"+w+"%")
+		}
+	}
+	var candidates []models.Product
+	if err := query.Where(conditions).Limit(nameCandidatesLimit).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var byName []models.ProductSuggestion
+	for _, p := range candidates {
+		if seen[p.Code] {
+			continue
+		}
+		score := NameSimilarity(item.Name, p.Name)
+		if score < minNameSimilarity {
+			continue
+		}
+		byName = append(byName, models.ProductSuggestion{
+			ProductCode: p.Code,
+			Name:        p.Name,
+			Barcode:     p.Barcode,
+			MatchedBy:   SuggestionByName,
+			Score:       score,
+		})
+	}
+	sort.SliceStable(byName, func(i, j int) bool { return byName[i].Score > byName[j].Score })
+
+	suggestions = append(suggestions, byName...)
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions, nil
+}
+
+// MapItem associa o cProd do item ao produto interno informado para todas as
+// notas futuras do mesmo fornecedor. Com conversionFactor > 0, grava também o
+// fator entre a unidade comercial do item e a unidade de estoque para o fornecedor.
+func (s *NfeService) MapItem(accessKey string, itemNumber int, productCode string, conversionFactor float64, userID *int32) (*models.SupplierProductMapping, error) {
+	var mapping *models.SupplierProductMapping
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.First(&product, "code = ? AND active = ?", productCode, true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		mapping, err = s.saveMapping(tx, accessKey, itemNumber, product.Code, userID)
+		if err != nil || conversionFactor <= 0 {
+			return err
+		}
+
+		var item models.NFeItem
+		if err := tx.First(&item, "access_key = ? AND item_number = ?", accessKey, itemNumber).Error; err != nil {
+			return err
+		}
+		_, err = SaveUnitConversion(tx, models.UnitConversion{
+			ProductCode:  product.Code,
+			SupplierCNPJ: mapping.SupplierCNPJ,
+			PurchaseUnit: item.Unit,
+			Factor:       conversionFactor,
+		})
+		return err
+	})
+	return mapping, err
+}
+
+// productUnits retorna a unidade de estoque normalizada dos produtos mapeados
+func productUnits(tx *gorm.DB, resolved map[string]string) (map[string]string, error) {
+	codes := make([]string, 0, len(resolved))
+	for _, code := range resolved {
+		codes = append(codes, code)
+	}
+	var products []models.Product
+	if err := tx.Select("code", "unit").Where("code IN ?", codes).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	units := make(map[string]string, len(products))
+	for _, p := range products {
+		units[p.Code] = NormalizeUnit(p.Unit)
+	}
+	return units, nil
+}
+
+// CreateProductForItem cadastra um novo produto a partir dos dados do item e o mapeia.
+// Campos não informados em product são preenchidos com os dados da nota.
+func (s *NfeService) CreateProductForItem(accessKey string, itemNumber int, product models.Product, userID *int32) (*models.SupplierProductMapping, error) {
+	var mapping *models.SupplierProductMapping
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var item models.NFeItem
+		if err := tx.First(&item, "access_key = ? AND item_number = ?", accessKey, itemNumber).Error; err != nil {
+			return err
+		}
+
+		product.Code = strings.TrimSpace(product.Code)
+		if product.Code == "" {
+			return gorm.ErrInvalidData
+		}
+		var count int64
+		tx.Unscoped().Model(&models.Product{}).Where("code = ?", product.Code).Count(&count)
+		if count > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+
+		if strings.TrimSpace(product.Name) == "" {
+			product.Name = item.Name
+		}
+		if product.Unit == "" {
+			product.Unit = strings.ToUpper(item.Unit)
+		}
+		if product.CostPrice == 0 {
+			product.CostPrice = item.UnitPrice
+		}
+		if product.Barcode == nil && item.EAN != nil {
+			// Só aproveita o EAN se nenhum outro produto já o usa (coluna única)
+			tx.Unscoped().Model(&models.Product{}).Where("barcode = ?", *item.EAN).Count(&count)
+			if count == 0 {
+				product.Barcode = item.EAN
+			}
+		}
+		if product.SupplierID == nil {
+			var nfe models.ProcessedNFe
+			if err := tx.First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+				return err
+			}
+			supplierID, err := ensureSupplier(tx, &nfe)
+			if err != nil {
+				return err
+			}
+			product.SupplierID = supplierID
+		}
+		product.Active = true
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+
+		var err error
+		mapping, err = s.saveMapping(tx, accessKey, itemNumber, product.Code, userID)
+		return err
+	})
+	return mapping, err
+}
+
+// saveMapping cria ou substitui o mapeamento (fornecedor, cProd) do item informado
+func (s *NfeService) saveMapping(tx *gorm.DB, accessKey string, itemNumber int, productCode string, userID *int32) (*models.SupplierProductMapping, error) {
+	var nfe models.ProcessedNFe
+	if err := tx.First(&nfe, "access_key = ?", accessKey).Error; err != nil {
+		return nil, err
+	}
+	supplierCNPJ, err := (&NfeService{DB: tx}).supplierDocument(&nfe)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.NFeItem
+	if err := tx.First(&item, "access_key = ? AND item_number = ?", accessKey, itemNumber).Error; err != nil {
+		return nil, err
+	}
+
+	mapping := models.SupplierProductMapping{
+		SupplierCNPJ: supplierCNPJ,
+		SupplierCode: item.Code,
+		SupplierName: optionalString(item.Name),
+		ProductCode:  productCode,
+		CreatedBy:    userID,
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "supplier_cnpj"}, {Name: "supplier_code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"product_code", "supplier_name", "created_by", "updated_at"}),
+	}).Create(&mapping).Error
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// NameSimilarity compara duas descrições pelo coeficiente de Dice dos bigramas,
+// ignorando acentos, caixa e pontuação. Retorna um valor entre 0 e 1.
+func NameSimilarity(a, b string) float64 {
+	ba := bigrams(normalizeName(a))
+	bb := bigrams(normalizeName(b))
+	if len(ba) == 0 || len(bb) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(ba))
+	for _, g := range ba {
+		counts[g]++
+	}
+	matches := 0
+	for _, g := range bb {
+		if counts[g] > 0 {
+			counts[g]--
+			matches++
+		}
+	}
+	return float64(2*matches) / float64(len(ba)+len(bb))
+}
+
+var accentFold = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u',
+	'ç': 'c', 'ñ': 'n',
+}
+
+// normalizeName remove acentos e pontuação e deixa as palavras em maiúsculas separadas por um espaço
+func normalizeName(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range s {
+		if plain, ok := accentFold[unicode.ToLower(r)]; ok {
+			r = plain
+		}
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func bigrams(s string) []string {
+	var grams []string
+	for _, word := range strings.Fields(s) {
+		runes := []rune(word)
+		if len(runes) == 1 {
+			grams = append(grams, word)
+			continue
+		}
+		for i := 0; i < len(runes)-1; i++ {
+			grams = append(grams, string(runes[i:i+2]))
+		}
+	}
+	return grams
+}
+
+// significantWords retorna as n palavras mais longas (mínimo 3 letras) da descrição normalizada
+func significantWords(name string, n int) []string {
+	var words []string
+	for _, w := range strings.Fields(normalizeName(name)) {
+		if len([]rune(w)) >= 3 {
+			words = append(words, w)
+		}
+	}
+	sort.SliceStable(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"testing"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		wantMin float64
+		wantMax float64
+	}{
+		{"idênticos com acento e caixa diferentes", "Café Torrado 500g", "CAFE TORRADO 500G", 1, 1},
+		{"pontuação ignorada", "PARAFUSO SEXT. M8x30", "Parafuso sext M8X30", 1, 1},
+		{"parecidos", "PARAFUSO SEXTAVADO M8 X 30", "PARAFUSO SEXT M8X30 ZINCADO", 0.5, 0.9},
+		{"diferentes abaixo do limite de sugestão", "CAFE TORRADO", "PARAFUSO M8", 0, minNameSimilarity},
+		{"vazio", "", "CAFE", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NameSimilarity(tt.a, tt.b)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("NameSimilarity(%q, %q) = %.2f, want entre %.2f e %.2f", tt.a, tt.b, got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestSignificantWords(t *testing.T) {
+	got := significantWords("Parafuso sext. M8 x 30 zincado", 3)
+	want := []string{"PARAFUSO", "ZINCADO", "SEXT"}
+	if len(got) != len(want) {
+		t.Fatalf("significantWords() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("significantWords()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUnmappedItemsError(t *testing.T) {
+	items := []models.NFeItem{
+		{ItemNumber: 1, Code: "ABC-1"},
+		{ItemNumber: 2, Code: "XYZ-9"},
+		{ItemNumber: 3, Code: "DEF-2"},
+	}
+
+	if err := unmappedItemsError(items, map[string]string{"ABC-1": "P1", "XYZ-9": "P2", "DEF-2": "P3"}); err != nil {
+		t.Errorf("unmappedItemsError() com todos mapeados = %v, want nil", err)
+	}
+
+	err := unmappedItemsError(items, map[string]string{"XYZ-9": "P2"})
+	if NfeErrorCode(err) != "ITENS_SEM_MAPEAMENTO" {
+		t.Fatalf("unmappedItemsError() code = %q, want ITENS_SEM_MAPEAMENTO", NfeErrorCode(err))
+	}
+	if want := "existem itens da nota sem produto interno associado (itens 1, 3)"; err.Error() != want {
+		t.Errorf("unmappedItemsError() = %q, want %q", err.Error(), want)
+	}
+}
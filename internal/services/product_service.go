@@ -17,7 +17,7 @@ func NewProductService(db *gorm.DB) *ProductService {
 
 // GetStockList retorna a listagem de saldos de produtos com filtros e paginação
 // Otimizado para evitar queries N+1 usando JOIN ao invés de múltiplos Preloads
-func (s *ProductService) GetStockList(search string, categoryID string, page int, limit int) ([]models.StockItem, int64, error) {
+func (s *ProductService) GetStockList(search string, categoryID string, supplierID string, page int, limit int) ([]models.StockItem, int64, error) {
 	// Query base otimizada com JOIN
 	query := s.DB.Table("products").
 		Select(`
@@ -48,6 +48,10 @@ func (s *ProductService) GetStockList(search string, categoryID string, page int
 		query = query.Where("products.category_id = ?", categoryID)
 	}
 
+	if supplierID != "" {
+		query = query.Where("products.supplier_id = ?", supplierID)
+	}
+
 	// Contar total antes de paginar
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/xml"
+	"estoque/internal/models"
+	"estoque/internal/utils"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertSupplier cadastra ou atualiza o fornecedor a partir do bloco emit da NF-e,
+// usando o CNPJ (ou CPF) como chave. Campos ausentes no XML não apagam os já cadastrados.
+// Retorna nil quando o emitente não tem documento.
+func UpsertSupplier(tx *gorm.DB, emit models.Emit) (*models.Supplier, error) {
+	doc := emitterDocument(emit)
+	if doc == "" {
+		return nil, nil
+	}
+
+	ender := emit.EnderEmit
+	supplier := models.Supplier{
+		Name:              utils.Truncate(strings.TrimSpace(emit.XNome), 191),
+		TradeName:         optionalString(utils.Truncate(emit.XFant, 191)),
+		CNPJ:              &doc,
+		StateRegistration: optionalString(emit.IE),
+		Phone:             optionalString(onlyDigits(ender.Fone)),
+		Address:           optionalString(FormatAddress(ender)),
+		City:              optionalString(ender.XMun),
+		State:             optionalString(strings.ToUpper(ender.UF)),
+		Active:            true,
+	}
+	if supplier.Name == "" {
+		supplier.Name = doc
+	}
+
+	// Atualiza apenas as colunas que vieram preenchidas no XML
+	columns := []string{"name", "updated_at"}
+	optional := []struct {
+		column string
+		value  *string
+	}{
+		{"trade_name", supplier.TradeName},
+		{"state_registration", supplier.StateRegistration},
+		{"phone", supplier.Phone},
+		{"address", supplier.Address},
+		{"city", supplier.City},
+		{"state", supplier.State},
+	}
+	for _, o := range optional {
+		if o.value != nil {
+			columns = append(columns, o.column)
+		}
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cnpj"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&supplier).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Em conflito o MySQL não devolve o ID do registro existente
+	if err := tx.First(&supplier, "cnpj = ?", doc).Error; err != nil {
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+// ensureSupplier garante que a nota esteja ligada ao fornecedor, inclusive notas
+// registradas antes do cadastro automático
+func ensureSupplier(tx *gorm.DB, nfe *models.ProcessedNFe) (*int32, error) {
+	if nfe.SupplierID != nil {
+		return nfe.SupplierID, nil
+	}
+
+	var proc models.NfeProc
+	if err := xml.Unmarshal(nfe.XMLData, &proc); err != nil {
+		return nil, err
+	}
+	supplier, err := UpsertSupplier(tx, proc.NFe.InfNFe.Emit)
+	if err != nil || supplier == nil {
+		return nil, err
+	}
+
+	nfe.SupplierID = &supplier.ID
+	if err := tx.Model(nfe).Update("supplier_id", supplier.ID).Error; err != nil {
+		return nil, err
+	}
+	return nfe.SupplierID, nil
+}
+
+// FormatAddress monta o endereço em uma linha: logradouro, número - complemento - bairro - município/UF - CEP
+func FormatAddress(e models.Endereco) string {
+	street := strings.TrimSpace(e.XLgr)
+	if nro := strings.TrimSpace(e.Nro); nro != "" && street != "" {
+		street += ", " + nro
+	}
+
+	city := strings.TrimSpace(e.XMun)
+	if uf := strings.TrimSpace(e.UF); uf != "" {
+		if city != "" {
+			city += "/" + uf
+		} else {
+			city = uf
+		}
+	}
+
+	cep := onlyDigits(e.CEP)
+	if len(cep) == 8 {
+		cep = "CEP " + cep[:5] + "-" + cep[5:]
+	}
+
+	var parts []string
+	for _, p := range []string{street, strings.TrimSpace(e.XCpl), strings.TrimSpace(e.XBairro), city, cep} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " - ")
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"testing"
+)
+
+func TestEmitParsing(t *testing.T) {
+	emit := parseSampleNfe(t).NFe.InfNFe.Emit
+
+	if emit.XFant != "Exemplo" || emit.IE != "111222333444" || emit.CRT != "3" {
+		t.Errorf("Emit = %+v", emit)
+	}
+	if emit.EnderEmit.XMun != "São Paulo" || emit.EnderEmit.UF != "SP" || emit.EnderEmit.Fone != "1133334444" {
+		t.Errorf("EnderEmit = %+v", emit.EnderEmit)
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		ender models.Endereco
+		want  string
+	}{
+		{
+			"endereço completo",
+			parseSampleNfe(t).NFe.InfNFe.Emit.EnderEmit,
+			"Rua das Flores, 100 - Galpão 2 - Centro - São Paulo/SP - CEP 01001-000",
+		},
+		{
+			"sem complemento e sem CEP",
+			models.Endereco{XLgr: "Av. Brasil", Nro: "S/N", XBairro: "Jardim", XMun: "Curitiba", UF: "PR"},
+			"Av. Brasil, S/N - Jardim - Curitiba/PR",
+		},
+		{
+			"somente UF",
+			models.Endereco{UF: "MG"},
+			"MG",
+		},
+		{"vazio", models.Endereco{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatAddress(tt.ender); got != tt.want {
+				t.Errorf("FormatAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"estoque/internal/models"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNfeMissingConversion = &NfeValidationError{Code: "CONVERSAO_UNIDADE_AUSENTE", Message: "existem itens com unidade comercial diferente da unidade de estoque sem fator de conversão"}
+	ErrInvalidConversion    = errors.New("conversão de unidade deve ter produto, unidade de compra e fator maior que zero")
+)
+
+// unitAliases agrupa grafias usuais da mesma unidade
+var unitAliases = map[string]string{
+	"UND":     "UN",
+	"UNID":    "UN",
+	"UNIDADE": "UN",
+}
+
+// NormalizeUnit padroniza a unidade para comparação (caixa alta, sem espaços e pontos)
+func NormalizeUnit(unit string) string {
+	u := strings.ToUpper(strings.TrimSpace(unit))
+	u = strings.TrimRight(u, ".")
+	if alias, ok := unitAliases[u]; ok {
+		return alias
+	}
+	return u
+}
+
+// itemConversion é o fator aplicado a um item na efetivação
+type itemConversion struct {
+	factor   float64
+	stockQty float64
+	unitCost float64
+}
+
+// newItemConversion converte a quantidade recebida e o custo unitário da unidade comercial para a de estoque
+func newItemConversion(item models.NFeItem, factor float64) itemConversion {
+	return itemConversion{
+		factor:   factor,
+		stockQty: receivedQuantity(item) * factor,
+		unitCost: item.UnitPrice / factor,
+	}
+}
+
+// resolveConversions encontra o fator de cada item: igual a 1 quando a unidade
+// comercial é a unidade de estoque; senão o fator do fornecedor ou, na falta,
+// o fator geral do produto. Itens sem fator são devolvidos em missing.
+func resolveConversions(tx *gorm.DB, supplierCNPJ string, items []models.NFeItem, resolved map[string]string) (map[int]float64, []int, error) {
+	productCodes := make([]string, 0, len(resolved))
+	for _, code := range resolved {
+		productCodes = append(productCodes, code)
+	}
+
+	stockUnits, err := productUnits(tx, resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var conversions []models.UnitConversion
+	if err := tx.Where("product_code IN ? AND supplier_cnpj IN ?", productCodes, []string{supplierCNPJ, ""}).Find(&conversions).Error; err != nil {
+		return nil, nil, err
+	}
+	type convKey struct{ product, supplier, unit string }
+	byKey := make(map[convKey]float64, len(conversions))
+	for _, c := range conversions {
+		byKey[convKey{c.ProductCode, c.SupplierCNPJ, NormalizeUnit(c.PurchaseUnit)}] = c.Factor
+	}
+
+	factors := make(map[int]float64, len(items))
+	var missing []int
+	for _, item := range items {
+		productCode, ok := resolved[item.Code]
+		if !ok {
+			continue
+		}
+		unit := NormalizeUnit(item.Unit)
+		switch {
+		case unit == "" || unit == stockUnits[productCode]:
+			factors[item.ItemNumber] = 1
+		case byKey[convKey{productCode, supplierCNPJ, unit}] > 0:
+			factors[item.ItemNumber] = byKey[convKey{productCode, supplierCNPJ, unit}]
+		case byKey[convKey{productCode, "", unit}] > 0:
+			factors[item.ItemNumber] = byKey[convKey{productCode, "", unit}]
+		default:
+			missing = append(missing, item.ItemNumber)
+		}
+	}
+	return factors, missing, nil
+}
+
+// missingConversionError lista os itens sem fator na mensagem de rejeição
+func missingConversionError(missing []int) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	numbers := make([]string, len(missing))
+	for i, n := range missing {
+		numbers[i] = strconv.Itoa(n)
+	}
+	return &NfeValidationError{
+		Code:    ErrNfeMissingConversion.Code,
+		Message: fmt.Sprintf("%s (itens %s)", ErrNfeMissingConversion.Message, strings.Join(numbers, ", ")),
+	}
+}
+
+// SaveUnitConversion cria ou atualiza o fator de um produto para a unidade de compra (e fornecedor, se informado)
+func SaveUnitConversion(db *gorm.DB, conv models.UnitConversion) (*models.UnitConversion, error) {
+	conv.ProductCode = strings.TrimSpace(conv.ProductCode)
+	conv.SupplierCNPJ = onlyDigits(conv.SupplierCNPJ)
+	conv.PurchaseUnit = NormalizeUnit(conv.PurchaseUnit)
+	if conv.ProductCode == "" || conv.PurchaseUnit == "" || conv.Factor <= 0 {
+		return nil, ErrInvalidConversion
+	}
+
+	var product models.Product
+	if err := db.Select("code").First(&product, "code = ?", conv.ProductCode).Error; err != nil {
+		return nil, err
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_code"}, {Name: "supplier_cnpj"}, {Name: "purchase_unit"}},
+		DoUpdates: clause.AssignmentColumns([]string{"factor", "updated_at"}),
+	}).Create(&conv).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
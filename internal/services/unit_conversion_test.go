@@ -0,0 +1,56 @@
+package services
+
+import (
+	"estoque/internal/models"
+	"testing"
+)
+
+func TestNormalizeUnit(t *testing.T) {
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"un", "UN"},
+		{"UNID", "UN"},
+		{" Und. ", "UN"},
+		{"cx", "CX"},
+		{"RL", "RL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			if got := NormalizeUnit(tt.unit); got != tt.want {
+				t.Errorf("NormalizeUnit(%q) = %q, want %q", tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewItemConversion(t *testing.T) {
+	// 10 caixas de 12 unidades a R$ 60,00 a caixa
+	item := models.NFeItem{Unit: "CX", Quantity: 10, UnitPrice: 60, TotalPrice: 600}
+
+	conv := newItemConversion(item, 12)
+	if conv.stockQty != 120 {
+		t.Errorf("stockQty = %v, want 120", conv.stockQty)
+	}
+	if conv.unitCost != 5 {
+		t.Errorf("unitCost = %v, want 5", conv.unitCost)
+	}
+
+	same := newItemConversion(item, 1)
+	if same.stockQty != item.Quantity || same.unitCost != item.UnitPrice {
+		t.Errorf("newItemConversion() com fator 1 = %+v", same)
+	}
+}
+
+func TestMissingConversionError(t *testing.T) {
+	if err := missingConversionError(nil); err != nil {
+		t.Errorf("missingConversionError(nil) = %v, want nil", err)
+	}
+
+	err := missingConversionError([]int{2, 4})
+	if NfeErrorCode(err) != "CONVERSAO_UNIDADE_AUSENTE" {
+		t.Errorf("missingConversionError() code = %q, want CONVERSAO_UNIDADE_AUSENTE", NfeErrorCode(err))
+	}
+}
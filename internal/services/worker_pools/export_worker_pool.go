@@ -219,9 +219,10 @@ func (p *ExportWorkerPool) processExport(job ExportJob, workerID int) ExportResu
 func (p *ExportWorkerPool) exportStock(job ExportJob, workerID int) ExportResult {
 	search := job.Filters["search"]
 	categoryID := job.Filters["category_id"]
+	supplierID := job.Filters["supplier_id"]
 	
 	// Buscar todos os produtos (sem paginação para exportação)
-	list, _, err := p.productService.GetStockList(search, categoryID, 1, 100000)
+	list, _, err := p.productService.GetStockList(search, categoryID, supplierID, 1, 100000)
 	if err != nil {
 		slog.Error("Error fetching stock for export", 
 			"worker_id", workerID,
@@ -324,6 +325,9 @@ func (p *ExportWorkerPool) exportMovements(job ExportJob, workerID int) ExportRe
 	if movType := job.Filters["type"]; movType != "" {
 		db = db.Where("type = ?", movType)
 	}
+	if supplierID := job.Filters["supplier_id"]; supplierID != "" {
+		db = db.Where("product_code IN (SELECT code FROM products WHERE supplier_id = ?)", supplierID)
+	}
 	
 	var movements []models.Movement
 	if err := db.Preload("Product").Preload("User").Find(&movements).Error; err != nil {
@@ -0,0 +1,45 @@
+package worker_pools
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightKeys serializa os documentos de uma mesma chave de acesso: enquanto um
+// worker registra a nota (ou um evento dela), os demais com a mesma chave esperam
+// e, ao seguir, já encontram o registro gravado em vez de disputar o insert
+type inflightKeys struct {
+	mu   sync.Mutex
+	keys map[string]chan struct{}
+}
+
+// acquire reserva a chave, aguardando se outro worker estiver com ela. waited
+// indica que houve espera; release deve ser chamado ao terminar.
+func (f *inflightKeys) acquire(ctx context.Context, key string) (release func(), waited bool, err error) {
+	for {
+		f.mu.Lock()
+		if f.keys == nil {
+			f.keys = make(map[string]chan struct{})
+		}
+		busy, ok := f.keys[key]
+		if !ok {
+			done := make(chan struct{})
+			f.keys[key] = done
+			f.mu.Unlock()
+			return func() {
+				f.mu.Lock()
+				delete(f.keys, key)
+				f.mu.Unlock()
+				close(done)
+			}, waited, nil
+		}
+		f.mu.Unlock()
+
+		waited = true
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return nil, waited, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package worker_pools
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInflightKeys_SerializesSameKey(t *testing.T) {
+	var f inflightKeys
+	ctx := context.Background()
+
+	release, waited, err := f.acquire(ctx, "chave-1")
+	if err != nil || waited {
+		t.Fatalf("primeira reserva: waited=%v err=%v", waited, err)
+	}
+
+	// Outra chave não espera
+	releaseOther, waited, err := f.acquire(ctx, "chave-2")
+	if err != nil || waited {
+		t.Fatalf("chave diferente: waited=%v err=%v", waited, err)
+	}
+	releaseOther()
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r, waited, err := f.acquire(ctx, "chave-1")
+		if err != nil {
+			t.Errorf("segunda reserva: %v", err)
+			return
+		}
+		defer r()
+		mu.Lock()
+		order = append(order, "segundo")
+		mu.Unlock()
+		if !waited {
+			t.Errorf("segunda reserva deveria ter esperado")
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	order = append(order, "primeiro")
+	mu.Unlock()
+	release()
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "primeiro" {
+		t.Errorf("ordem = %v, esperado primeiro antes de segundo", order)
+	}
+	if len(f.keys) != 0 {
+		t.Errorf("chaves em processamento = %d, esperado 0", len(f.keys))
+	}
+}
+
+func TestInflightKeys_CanceledContext(t *testing.T) {
+	var f inflightKeys
+	release, _, _ := f.acquire(context.Background(), "chave")
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, waited, err := f.acquire(ctx, "chave"); err == nil || !waited {
+		t.Errorf("esperado erro do contexto após espera, waited=%v err=%v", waited, err)
+	}
+}
@@ -3,6 +3,7 @@ package worker_pools
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"estoque/internal/models"
 	"estoque/internal/services"
 	"io"
@@ -24,12 +25,44 @@ type NFeJob struct {
 // NFeResult representa o resultado do processamento
 type NFeResult struct {
 	Success   bool
+	Duplicate bool // Reenvio idêntico de uma nota já registrada (sucesso idempotente)
 	Items     int
 	AccessKey string
 	Error     error
+	ErrorCode string // Código de rejeição da validação (ex: CHAVE_DV_INVALIDO)
+	Document  string // NFE ou EVENTO
+	EventType string // tpEvento, quando o documento é um evento
 	Duration  time.Duration
 }
 
+// Situação de cada documento no relatório de um lote
+const (
+	OutcomeRegistered = "REGISTRADO"
+	OutcomeDuplicate  = "DUPLICADO"
+	OutcomeSuspicious = "SUSPEITO"
+	OutcomeInvalid    = "INVALIDO"
+	OutcomeError      = "ERRO"
+)
+
+// Outcome classifica o resultado: registrado, duplicado (reenvio idêntico),
+// suspeito (mesma chave com XML diferente, retido para análise), inválido (XML
+// malformado ou rejeitado na validação, ou seja, com ErrorCode) ou erro de processamento
+func (r NFeResult) Outcome() string {
+	switch {
+	case r.Success && r.Duplicate:
+		return OutcomeDuplicate
+	case r.Success:
+		return OutcomeRegistered
+	case errors.Is(r.Error, gorm.ErrDuplicatedKey):
+		return OutcomeDuplicate
+	case r.ErrorCode == services.ErrNfeContentConflict.Code:
+		return OutcomeSuspicious
+	case r.ErrorCode != "":
+		return OutcomeInvalid
+	}
+	return OutcomeError
+}
+
 // NFeWorkerPool gerencia workers para processar NF-es em paralelo
 type NFeWorkerPool struct {
 	workers  int
@@ -39,6 +72,7 @@ type NFeWorkerPool struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	metrics  *NFeMetrics
+	inflight inflightKeys // Chaves de acesso sendo registradas neste momento
 }
 
 // NFeMetrics armazena métricas do worker pool
@@ -130,6 +164,54 @@ func (p *NFeWorkerPool) SubmitSync(job NFeJob) (NFeResult, error) {
 	}
 }
 
+// SubmitBatch envia todos os jobs ao pool e aguarda os resultados, que ficam na
+// mesma ordem dos jobs. onResult (opcional) é chamado na goroutine de quem chama,
+// na ordem em que os documentos terminam, para acompanhar o progresso.
+// Jobs ainda não enviados quando ctx é cancelado retornam com o erro do contexto.
+func (p *NFeWorkerPool) SubmitBatch(ctx context.Context, jobs []NFeJob, onResult func(index int, result NFeResult)) []NFeResult {
+	type indexedResult struct {
+		index  int
+		result NFeResult
+	}
+	results := make([]NFeResult, len(jobs))
+	done := make(chan indexedResult, len(jobs))
+
+	go func() {
+		for i := range jobs {
+			resultChan := make(chan NFeResult, 1)
+			job := jobs[i]
+			job.ResultChan = resultChan
+
+			if err := ctx.Err(); err != nil {
+				done <- indexedResult{i, NFeResult{Success: false, Error: err}}
+				continue
+			}
+			// Submit bloqueia enquanto a fila estiver cheia; os demais jobs aguardam a vez
+			if err := p.Submit(job); err != nil {
+				done <- indexedResult{i, NFeResult{Success: false, Error: err}}
+				continue
+			}
+			go func(i int) {
+				select {
+				case result := <-resultChan:
+					done <- indexedResult{i, result}
+				case <-p.ctx.Done():
+					done <- indexedResult{i, NFeResult{Success: false, Error: p.ctx.Err()}}
+				}
+			}(i)
+		}
+	}()
+
+	for n := 0; n < len(jobs); n++ {
+		r := <-done
+		results[r.index] = r.result
+		if onResult != nil {
+			onResult(r.index, r.result)
+		}
+	}
+	return results
+}
+
 // worker processa jobs do pool
 func (p *NFeWorkerPool) worker(id int) {
 	defer p.wg.Done()
@@ -176,6 +258,10 @@ func (p *NFeWorkerPool) processNFe(nfeService *services.NfeService, job NFeJob,
 		"xml_size", len(job.XMLData),
 	)
 
+	if services.DetectDocumentType(job.XMLData) == services.DocumentEvent {
+		return p.processEvent(nfeService, job, workerID)
+	}
+
 	// Decodificar XML
 	var proc models.NfeProc
 	if err := xml.Unmarshal(job.XMLData, &proc); err != nil {
@@ -184,25 +270,78 @@ func (p *NFeWorkerPool) processNFe(nfeService *services.NfeService, job NFeJob,
 			"error", err,
 		)
 		return NFeResult{
-			Success: false,
-			Error:   err,
+			Success:   false,
+			Error:     err,
+			ErrorCode: services.ErrNfeMalformedXML.Code,
 		}
 	}
 
-	accessKey := proc.NFe.InfNFe.ID
+	accessKey := services.NormalizeAccessKey(proc.NFe.InfNFe.ID)
 
-	// Registrar NF-e (apenas salva metadados e XML com status PENDENTE)
-	err := nfeService.RegisterNfe(&proc, job.XMLData)
+	// A mesma nota pode chegar ao mesmo tempo por upload e e-mail: um worker por chave
+	release, waited, err := p.inflight.acquire(p.ctx, accessKey)
 	if err != nil {
-		slog.Error("Error registering NFe",
+		return NFeResult{Success: false, AccessKey: accessKey, Error: err}
+	}
+	defer release()
+	if waited {
+		slog.Info("NFe access key was in flight, processed after the other worker",
+			"worker_id", workerID,
+			"access_key", accessKey,
+		)
+	}
+
+	// Verificar assinatura digital e aplicar a política configurada
+	signature := services.VerifyNfeSignature(&proc, job.XMLData)
+	err = signature.Enforce(services.GetNfeConfig(p.db).SignaturePolicy)
+	duplicate := false
+	if err == nil {
+		if signature.Status != services.SignatureValid {
+			slog.Warn("NFe signature not valid (flagged)",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"signature_status", signature.Status,
+				"error", signature.Error,
+			)
+		}
+
+		// Registrar NF-e (valida a chave e salva metadados e XML com status PENDENTE)
+		_, duplicate, err = nfeService.RegisterNfe(&proc, job.XMLData, &signature, job.UserEmail)
+	}
+	if err == nil && duplicate {
+		slog.Info("NFe already registered with identical content",
 			"worker_id", workerID,
 			"access_key", accessKey,
-			"error", err,
 		)
+		return NFeResult{
+			Success:   true,
+			Duplicate: true,
+			Items:     len(proc.NFe.InfNFe.Det),
+			AccessKey: accessKey,
+			Document:  services.DocumentNfe,
+		}
+	}
+	if err != nil {
+		errorCode := services.NfeErrorCode(err)
+		if errorCode != "" {
+			slog.Warn("NFe rejected by validation",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"code", errorCode,
+				"error", err,
+			)
+		} else {
+			slog.Error("Error registering NFe",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"error", err,
+			)
+		}
 		return NFeResult{
 			Success:   false,
 			AccessKey: accessKey,
 			Error:     err,
+			ErrorCode: errorCode,
 		}
 	}
 
@@ -216,6 +355,87 @@ func (p *NFeWorkerPool) processNFe(nfeService *services.NfeService, job NFeJob,
 		Success:   true,
 		Items:     len(proc.NFe.InfNFe.Det),
 		AccessKey: accessKey,
+		Document:  services.DocumentNfe,
+	}
+}
+
+// processEvent registra um evento da NF-e (ex: cancelamento) e o vincula à nota
+func (p *NFeWorkerPool) processEvent(nfeService *services.NfeService, job NFeJob, workerID int) NFeResult {
+	var proc models.ProcEventoNFe
+	if err := xml.Unmarshal(job.XMLData, &proc); err != nil {
+		slog.Error("Error decoding event XML",
+			"worker_id", workerID,
+			"error", err,
+		)
+		return NFeResult{Success: false, Error: err, ErrorCode: services.ErrNfeMalformedXML.Code, Document: services.DocumentEvent}
+	}
+
+	accessKey := services.NormalizeAccessKey(proc.Evento.InfEvento.ChNFe)
+	eventType := proc.Evento.InfEvento.TpEvento
+
+	// Evento e nota da mesma chave não são aplicados em paralelo
+	release, _, err := p.inflight.acquire(p.ctx, accessKey)
+	if err != nil {
+		return NFeResult{Success: false, AccessKey: accessKey, Error: err, Document: services.DocumentEvent, EventType: eventType}
+	}
+	defer release()
+
+	// Assinatura do autor sobre infEvento, com a mesma política aplicada às notas
+	signature := services.VerifyEventSignature(&proc, job.XMLData)
+	err = signature.Enforce(services.GetNfeConfig(p.db).SignaturePolicy)
+	var event *models.NFeEvent
+	if err == nil {
+		if signature.Status != services.SignatureValid {
+			slog.Warn("NFe event signature not valid (flagged)",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"event_type", eventType,
+				"signature_status", signature.Status,
+				"error", signature.Error,
+			)
+		}
+		event, err = nfeService.RegisterEvent(&proc, job.XMLData, &signature)
+	}
+	if err != nil {
+		errorCode := services.NfeErrorCode(err)
+		if errorCode != "" {
+			slog.Warn("NFe event rejected by validation",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"event_type", eventType,
+				"code", errorCode,
+				"error", err,
+			)
+		} else {
+			slog.Error("Error registering NFe event",
+				"worker_id", workerID,
+				"access_key", accessKey,
+				"event_type", eventType,
+				"error", err,
+			)
+		}
+		return NFeResult{
+			Success:   false,
+			AccessKey: accessKey,
+			Error:     err,
+			ErrorCode: errorCode,
+			Document:  services.DocumentEvent,
+			EventType: eventType,
+		}
+	}
+
+	slog.Info("NFe event registered",
+		"worker_id", workerID,
+		"access_key", accessKey,
+		"event_type", event.EventType,
+		"applied", event.Applied,
+	)
+
+	return NFeResult{
+		Success:   true,
+		AccessKey: accessKey,
+		Document:  services.DocumentEvent,
+		EventType: event.EventType,
 	}
 }
 
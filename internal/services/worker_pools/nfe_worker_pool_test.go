@@ -367,3 +367,96 @@ func TestNFeWorkerPool_ConcurrentSubmits(t *testing.T) {
 		t.Errorf("ConcurrentSubmits() had %d errors, want 0", errors)
 	}
 }
+
+func TestNFeWorkerPool_processNFe_EventWithoutProtocol(t *testing.T) {
+	db := setupTestDB(t)
+	pool := NewNFeWorkerPool(1, db)
+	
+	nfeService := services.NewNfeService(db)
+	
+	job := NFeJob{
+		XMLData: []byte(`<procEventoNFe xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00">
+			<evento versao="1.00"><infEvento>
+				<chNFe>35240112345678000195550010000012341123456785</chNFe>
+				<tpEvento>110111</tpEvento><nSeqEvento>1</nSeqEvento>
+			</infEvento></evento>
+		</procEventoNFe>`),
+		UserEmail: "test@example.com",
+	}
+	
+	result := pool.processNFe(nfeService, job, 0)
+	
+	// Evento deve ser reconhecido (e não tratado como NF-e), mas rejeitado sem retEvento
+	if result.Document != services.DocumentEvent {
+		t.Errorf("processNFe() Document = %q, want %q", result.Document, services.DocumentEvent)
+	}
+	if result.Success || result.ErrorCode != "EVENTO_NAO_REGISTRADO" {
+		t.Errorf("processNFe() = (%v, %q), want (false, EVENTO_NAO_REGISTRADO)", result.Success, result.ErrorCode)
+	}
+}
+
+func TestNFeResult_Outcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		result NFeResult
+		want   string
+	}{
+		{"registrada", NFeResult{Success: true}, OutcomeRegistered},
+		{"duplicada", NFeResult{Error: gorm.ErrDuplicatedKey}, OutcomeDuplicate},
+		{"reenvio idêntico", NFeResult{Success: true, Duplicate: true}, OutcomeDuplicate},
+		{"conteúdo divergente", NFeResult{Error: services.ErrNfeContentConflict, ErrorCode: services.ErrNfeContentConflict.Code}, OutcomeSuspicious},
+		{"rejeitada na validação", NFeResult{Error: services.ErrNfeKeyCheckDigit, ErrorCode: services.ErrNfeKeyCheckDigit.Code}, OutcomeInvalid},
+		{"erro de banco", NFeResult{Error: context.DeadlineExceeded}, OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.Outcome(); got != tt.want {
+				t.Errorf("Outcome() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNFeWorkerPool_SubmitBatch(t *testing.T) {
+	db := setupTestDB(t)
+	pool := NewNFeWorkerPool(2, db)
+	pool.Start()
+	defer pool.Stop()
+
+	jobs := make([]NFeJob, 10)
+	for i := range jobs {
+		jobs[i] = NFeJob{XMLData: []byte("invalid xml"), UserEmail: "test@example.com"}
+	}
+
+	calls := 0
+	results := pool.SubmitBatch(context.Background(), jobs, func(index int, result NFeResult) {
+		calls++
+	})
+
+	if len(results) != len(jobs) || calls != len(jobs) {
+		t.Fatalf("SubmitBatch() results = %d, callbacks = %d, want %d", len(results), calls, len(jobs))
+	}
+	for i, r := range results {
+		if r.Outcome() != OutcomeInvalid || r.ErrorCode != services.ErrNfeMalformedXML.Code {
+			t.Errorf("results[%d] = %v (%q), want %v", i, r.Outcome(), r.ErrorCode, OutcomeInvalid)
+		}
+	}
+}
+
+func TestNFeWorkerPool_SubmitBatch_CanceledContext(t *testing.T) {
+	db := setupTestDB(t)
+	pool := NewNFeWorkerPool(1, db)
+	pool.Start()
+	defer pool.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := pool.SubmitBatch(ctx, []NFeJob{{XMLData: []byte("<a/>")}, {XMLData: []byte("<b/>")}}, nil)
+	for i, r := range results {
+		if r.Success || r.Error != context.Canceled {
+			t.Errorf("results[%d] = %+v, want erro %v", i, r, context.Canceled)
+		}
+	}
+}
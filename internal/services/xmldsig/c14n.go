@@ -0,0 +1,251 @@
+package xmldsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	nsXML   = "http://www.w3.org/XML/1998/namespace"
+	nsDSig  = "http://www.w3.org/2000/09/xmldsig#"
+	nsXMLNS = "xmlns"
+)
+
+// elementMatcher decide se um elemento (com namespace já resolvido) é a raiz do
+// trecho a ser canonicalizado; path traz os nomes locais desde a raiz do
+// documento até o próprio elemento
+type elementMatcher func(path []string, space, local string, attrs []xml.Attr) bool
+
+// canonicalize aplica Canonical XML 1.0 (sem comentários) ao primeiro elemento
+// do documento aceito por match. Quando enveloped é verdadeiro, elementos
+// ds:Signature dentro do trecho são omitidos (transform enveloped-signature).
+func canonicalize(data []byte, match elementMatcher, enveloped bool) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	// Escopo de namespaces de todos os ancestrais (inclusive os que não são emitidos)
+	scopes := []map[string]string{{"xml": nsXML}}
+	// Namespaces já emitidos pelo ancestral de saída mais próximo
+	rendered := []map[string]string{}
+	// Nomes locais dos elementos abertos
+	var path []string
+
+	var out bytes.Buffer
+	depth := 0     // profundidade dentro do trecho emitido (0 = fora)
+	skipDepth := 0 // profundidade dentro de um ds:Signature omitido
+	found := false
+
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			scope := copyScope(scopes[len(scopes)-1])
+			for _, a := range t.Attr {
+				if a.Name.Space == "" && a.Name.Local == nsXMLNS {
+					scope[""] = a.Value
+				} else if a.Name.Space == nsXMLNS {
+					scope[a.Name.Local] = a.Value
+				}
+			}
+			scopes = append(scopes, scope)
+			path = append(path, t.Name.Local)
+			space := scope[t.Name.Space]
+
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			if depth == 0 {
+				if found || !match(path, space, t.Name.Local, t.Attr) {
+					continue
+				}
+				found = true
+				rendered = append(rendered, map[string]string{"": ""})
+			} else if enveloped && space == nsDSig && t.Name.Local == "Signature" {
+				skipDepth = 1
+				continue
+			}
+
+			depth++
+			parentRendered := rendered[len(rendered)-1]
+			current := copyScope(parentRendered)
+			writeStartElement(&out, t, scope, parentRendered, current)
+			rendered = append(rendered, current)
+
+		case xml.EndElement:
+			scopes = scopes[:len(scopes)-1]
+			path = path[:len(path)-1]
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			if depth == 0 {
+				continue
+			}
+			out.WriteString("</")
+			out.WriteString(qualifiedName(t.Name))
+			out.WriteByte('>')
+			rendered = rendered[:len(rendered)-1]
+			depth--
+			if depth == 0 {
+				return out.Bytes(), nil
+			}
+
+		case xml.CharData:
+			if depth > 0 && skipDepth == 0 {
+				escapeText(&out, string(t))
+			}
+
+		case xml.ProcInst:
+			if depth > 0 && skipDepth == 0 {
+				out.WriteString("<?")
+				out.WriteString(t.Target)
+				if len(t.Inst) > 0 {
+					out.WriteByte(' ')
+					out.Write(t.Inst)
+				}
+				out.WriteString("?>")
+			}
+		}
+	}
+
+	if !found {
+		return nil, ErrReferenceNotFound
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// writeStartElement emite a tag de abertura com namespaces e atributos na ordem canônica
+func writeStartElement(out *bytes.Buffer, t xml.StartElement, scope, parentRendered, current map[string]string) {
+	out.WriteByte('<')
+	out.WriteString(qualifiedName(t.Name))
+
+	// Namespaces: emitir os que estão em escopo e diferem do que o ancestral de saída já emitiu
+	prefixes := make([]string, 0, len(scope))
+	for prefix := range scope {
+		if prefix == "xml" {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		uri := scope[prefix]
+		if parentRendered[prefix] == uri {
+			continue
+		}
+		if _, ok := parentRendered[prefix]; !ok && uri == "" {
+			continue
+		}
+		current[prefix] = uri
+		if prefix == "" {
+			out.WriteString(` xmlns="`)
+		} else {
+			out.WriteString(" xmlns:")
+			out.WriteString(prefix)
+			out.WriteString(`="`)
+		}
+		escapeAttr(out, uri)
+		out.WriteByte('"')
+	}
+
+	// Atributos: ordenados por URI do namespace e depois pelo nome local
+	type attr struct {
+		uri, name, value string
+	}
+	attrs := make([]attr, 0, len(t.Attr))
+	for _, a := range t.Attr {
+		if (a.Name.Space == "" && a.Name.Local == nsXMLNS) || a.Name.Space == nsXMLNS {
+			continue
+		}
+		uri := ""
+		if a.Name.Space != "" {
+			uri = scope[a.Name.Space]
+		}
+		attrs = append(attrs, attr{uri: uri, name: qualifiedName(a.Name), value: a.Value})
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return localPart(attrs[i].name) < localPart(attrs[j].name)
+	})
+	for _, a := range attrs {
+		out.WriteByte(' ')
+		out.WriteString(a.name)
+		out.WriteString(`="`)
+		escapeAttr(out, a.value)
+		out.WriteByte('"')
+	}
+	out.WriteByte('>')
+}
+
+func copyScope(src map[string]string) map[string]string {
+	dst := make(map[string]string, len(src)+1)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+func localPart(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func escapeText(out *bytes.Buffer, s string) {
+	for _, c := range s {
+		switch c {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			out.WriteString("&lt;")
+		case '>':
+			out.WriteString("&gt;")
+		case '\r':
+			out.WriteString("&#xD;")
+		default:
+			out.WriteRune(c)
+		}
+	}
+}
+
+func escapeAttr(out *bytes.Buffer, s string) {
+	for _, c := range s {
+		switch c {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			out.WriteString("&lt;")
+		case '"':
+			out.WriteString("&quot;")
+		case '\t':
+			out.WriteString("&#x9;")
+		case '\n':
+			out.WriteString("&#xA;")
+		case '\r':
+			out.WriteString("&#xD;")
+		default:
+			out.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package xmldsig
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+	"time"
+)
+
+// oidSubjectAltName identifica a extensão subjectAltName (RFC 5280)
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// oidICPBrasilCNPJ identifica o otherName com o CNPJ da pessoa jurídica em certificados ICP-Brasil
+var oidICPBrasilCNPJ = asn1.ObjectIdentifier{2, 16, 76, 1, 3, 3}
+
+// CertificateInfo resume os dados de um certificado relevantes para auditoria
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	CNPJ         string    `json:"cnpj,omitempty"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+// DescribeCertificate extrai titular, emissor, série, CNPJ e validade do certificado
+func DescribeCertificate(cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: strings.ToUpper(cert.SerialNumber.Text(16)),
+		CNPJ:         CertificateCNPJ(cert),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
+
+// CertificateCNPJ retorna o CNPJ do titular de um e-CNPJ ICP-Brasil. Procura primeiro
+// o otherName 2.16.76.1.3.3 e depois o sufixo "NOME:CNPJ" do CommonName.
+func CertificateCNPJ(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		if cnpj := cnpjFromSAN(ext.Value); cnpj != "" {
+			return cnpj
+		}
+	}
+
+	cn := cert.Subject.CommonName
+	if i := strings.LastIndexByte(cn, ':'); i >= 0 {
+		if candidate := cn[i+1:]; len(candidate) == 14 && isNumeric(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// cnpjFromSAN percorre GeneralNames em busca do otherName com o CNPJ
+func cnpjFromSAN(der []byte) string {
+	var names asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &names); err != nil {
+		return ""
+	}
+	rest := names.Bytes
+	for len(rest) > 0 {
+		var name asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &name)
+		if err != nil {
+			return ""
+		}
+		// otherName: [0] IMPLICIT SEQUENCE { type-id OID, value [0] EXPLICIT ANY }
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue
+		}
+		var typeID asn1.ObjectIdentifier
+		valueBytes, err := asn1.Unmarshal(name.Bytes, &typeID)
+		if err != nil || !typeID.Equal(oidICPBrasilCNPJ) {
+			continue
+		}
+		var wrapper asn1.RawValue
+		if _, err := asn1.Unmarshal(valueBytes, &wrapper); err != nil {
+			continue
+		}
+		var inner asn1.RawValue
+		if _, err := asn1.Unmarshal(wrapper.Bytes, &inner); err != nil {
+			continue
+		}
+		if value := strings.TrimSpace(string(inner.Bytes)); len(value) == 14 && isNumeric(value) {
+			return value
+		}
+	}
+	return ""
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
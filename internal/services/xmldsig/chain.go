@@ -0,0 +1,106 @@
+package xmldsig
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUntrustedChain = errors.New("certificado da assinatura não encadeia até uma AC raiz ICP-Brasil configurada")
+
+// TrustStore guarda as ACs (raízes e intermediárias ICP-Brasil) usadas para
+// validar a cadeia do certificado que assinou o documento
+type TrustStore struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	Roots         int
+}
+
+// NewTrustStore separa os certificados PEM informados em raízes (autoassinados)
+// e intermediárias
+func NewTrustStore(pemData ...[]byte) (*TrustStore, error) {
+	s := &TrustStore{roots: x509.NewCertPool(), intermediates: x509.NewCertPool()}
+	for _, data := range pemData {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("certificado de AC inválido: %w", err)
+			}
+			if cert.CheckSignatureFrom(cert) == nil {
+				s.roots.AddCert(cert)
+				s.Roots++
+			} else {
+				s.intermediates.AddCert(cert)
+			}
+		}
+	}
+	if s.Roots == 0 {
+		return nil, errors.New("nenhuma AC raiz encontrada nos certificados informados")
+	}
+	return s, nil
+}
+
+// LoadTrustStore lê as ACs de um arquivo PEM ou de todos os .pem/.crt/.cer de um diretório
+func LoadTrustStore(path string) (*TrustStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".pem", ".crt", ".cer":
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	var data [][]byte
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b)
+	}
+	return NewTrustStore(data...)
+}
+
+// VerifyChain confere se o certificado encadeia até uma das raízes na data
+// informada (a emissão do documento: o certificado pode ter vencido depois).
+// Intermediárias embutidas na assinatura completam as do TrustStore.
+func (s *TrustStore) VerifyChain(cert *x509.Certificate, extra []*x509.Certificate, at time.Time) error {
+	intermediates := s.intermediates.Clone()
+	for _, c := range extra {
+		intermediates.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         s.roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedChain, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package xmldsig
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate emite um certificado assinado por parent (autoassinado quando nil)
+func testCertificate(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() error = %v", err)
+	}
+	return cert, key
+}
+
+func pemOf(certs ...*x509.Certificate) []byte {
+	var out []byte
+	for _, c := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return out
+}
+
+func TestVerifyChain(t *testing.T) {
+	root, rootKey := testCertificate(t, "AC Raiz Teste", true, nil, nil)
+	intermediate, intermediateKey := testCertificate(t, "AC Intermediaria Teste", true, root, rootKey)
+	leaf, _ := testCertificate(t, "EMPRESA TESTE LTDA:12345678000195", false, intermediate, intermediateKey)
+	selfSigned, _ := testCertificate(t, "EMPRESA TESTE LTDA:12345678000195", false, nil, nil)
+
+	full, err := NewTrustStore(pemOf(root, intermediate))
+	if err != nil {
+		t.Fatalf("NewTrustStore() error = %v", err)
+	}
+	rootOnly, err := NewTrustStore(pemOf(root))
+	if err != nil {
+		t.Fatalf("NewTrustStore() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		store   *TrustStore
+		cert    *x509.Certificate
+		extra   []*x509.Certificate
+		at      time.Time
+		wantErr bool
+	}{
+		{"cadeia completa", full, leaf, nil, time.Now(), false},
+		{"intermediária embutida na assinatura", rootOnly, leaf, []*x509.Certificate{intermediate}, time.Now(), false},
+		{"sem intermediária", rootOnly, leaf, nil, time.Now(), true},
+		{"autoassinado com o CNPJ do emitente", full, selfSigned, nil, time.Now(), true},
+		{"fora da validade na emissão", full, leaf, nil, time.Now().Add(48 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.store.VerifyChain(tt.cert, tt.extra, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUntrustedChain) {
+				t.Errorf("VerifyChain() error = %v, want %v", err, ErrUntrustedChain)
+			}
+		})
+	}
+}
+
+func TestLoadTrustStore(t *testing.T) {
+	root, rootKey := testCertificate(t, "AC Raiz Teste", true, nil, nil)
+	intermediate, _ := testCertificate(t, "AC Intermediaria Teste", true, root, rootKey)
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "raiz.crt"), pemOf(root), 0600)
+	os.WriteFile(filepath.Join(dir, "intermediaria.pem"), pemOf(intermediate), 0600)
+	os.WriteFile(filepath.Join(dir, "leia-me.txt"), []byte("ignorado"), 0600)
+	onlyIntermediate := filepath.Join(t.TempDir(), "intermediaria.pem")
+	os.WriteFile(onlyIntermediate, pemOf(intermediate), 0600)
+
+	tests := []struct {
+		name      string
+		path      string
+		wantRoots int
+		wantErr   bool
+	}{
+		{"diretório", dir, 1, false},
+		{"arquivo", filepath.Join(dir, "raiz.crt"), 1, false},
+		{"sem raiz", onlyIntermediate, 0, true},
+		{"inexistente", filepath.Join(dir, "nada"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := LoadTrustStore(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTrustStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && store.Roots != tt.wantRoots {
+				t.Errorf("LoadTrustStore() roots = %d, want %d", store.Roots, tt.wantRoots)
+			}
+		})
+	}
+}
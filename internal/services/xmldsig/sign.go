@@ -0,0 +1,112 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// SignEnveloped assina o elemento com o Id informado no padrão dos documentos
+// fiscais (C14N, enveloped-signature, RSA-SHA1) e insere ds:Signature logo após
+// ele, como irmão (ex: evento/infEvento + evento/Signature). O Id precisa ser
+// único e o elemento ainda não pode ter uma assinatura irmã.
+func SignEnveloped(data []byte, referenceID string, key *rsa.PrivateKey, cert *x509.Certificate) ([]byte, error) {
+	refPath, err := checkReference(data, referenceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	sigPath := append(append([]string{}, refPath[:len(refPath)-1]...), "Signature")
+	end, signatures, err := elementEnd(data, referenceID, sigPath)
+	if err != nil {
+		return nil, err
+	}
+	if signatures > 0 {
+		return nil, ErrAmbiguousReference
+	}
+
+	referenced, err := canonicalize(data, matchID(referenceID), true)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha1.Sum(referenced)
+
+	var sig strings.Builder
+	sig.WriteString(`<Signature xmlns="` + nsDSig + `"><SignedInfo>`)
+	sig.WriteString(`<CanonicalizationMethod Algorithm="` + AlgC14N + `"/>`)
+	sig.WriteString(`<SignatureMethod Algorithm="` + AlgSignRSASHA1 + `"/>`)
+	sig.WriteString(`<Reference URI="#` + referenceID + `"><Transforms>`)
+	sig.WriteString(`<Transform Algorithm="` + AlgEnveloped + `"/><Transform Algorithm="` + AlgC14N + `"/>`)
+	sig.WriteString(`</Transforms><DigestMethod Algorithm="` + AlgDigestSHA1 + `"/>`)
+	sig.WriteString(`<DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</DigestValue></Reference>`)
+	sig.WriteString(`</SignedInfo><SignatureValue>`)
+	valueAt := sig.Len()
+	sig.WriteString(`</SignatureValue><KeyInfo><X509Data><X509Certificate>`)
+	sig.WriteString(base64.StdEncoding.EncodeToString(cert.Raw))
+	sig.WriteString(`</X509Certificate></X509Data></KeyInfo></Signature>`)
+	signature := sig.String()
+
+	doc := make([]byte, 0, len(data)+len(signature)+512)
+	doc = append(doc, data[:end]...)
+	doc = append(doc, signature...)
+	doc = append(doc, data[end:]...)
+
+	// O SignedInfo é canonicalizado no contexto do documento, herdando o namespace de Signature
+	signedInfo, err := canonicalize(doc, matchPath(nsDSig, append(sigPath, "SignedInfo")), false)
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum(signedInfo)
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(doc)+512)
+	out = append(out, doc[:end+valueAt]...)
+	out = append(out, base64.StdEncoding.EncodeToString(value)...)
+	out = append(out, doc[end+valueAt:]...)
+	return out, nil
+}
+
+// elementEnd devolve a posição logo após o fechamento do elemento com o Id e
+// quantos elementos já existem em sigPath no documento
+func elementEnd(data []byte, id string, sigPath []string) (int, int, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	depth, end, signatures := 0, 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if samePath(stack, sigPath) {
+				signatures++
+			}
+			if hasID(t.Attr, id) {
+				depth = len(stack)
+			}
+		case xml.EndElement:
+			if depth > 0 && len(stack) == depth {
+				end, depth = int(dec.InputOffset()), 0
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if end == 0 {
+		return 0, 0, ErrReferenceNotFound
+	}
+	return end, signatures, nil
+}
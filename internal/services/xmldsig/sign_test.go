@@ -0,0 +1,67 @@
+package xmldsig
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignEnveloped(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(77),
+		Subject:      pkix.Name{CommonName: "DESTINATARIO TESTE LTDA:98765432000110"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() error = %v", err)
+	}
+
+	id := "ID2102103524011234567800019555001000001234112345678501"
+	unsigned := `<envEvento xmlns="http://www.portalfiscal.inf.br/nfe" versao="1.00"><idLote>1</idLote>` +
+		`<evento versao="1.00"><infEvento Id="` + id + `"><cOrgao>91</cOrgao><tpEvento>210210</tpEvento>` +
+		`<detEvento versao="1.00"><descEvento>Ciencia da Operacao</descEvento></detEvento></infEvento></evento></envEvento>`
+
+	signed, err := SignEnveloped([]byte(unsigned), id, key, cert)
+	if err != nil {
+		t.Fatalf("SignEnveloped() error = %v", err)
+	}
+	if !strings.Contains(string(signed), `</infEvento><Signature xmlns="`+nsDSig+`">`) {
+		t.Errorf("Signature fora da posição esperada: %s", signed)
+	}
+
+	result, err := VerifyEnveloped(signed, id)
+	if err != nil {
+		t.Fatalf("VerifyEnveloped() error = %v", err)
+	}
+	if result.Signer.CNPJ != "98765432000110" {
+		t.Errorf("VerifyEnveloped() signer CNPJ = %q, want 98765432000110", result.Signer.CNPJ)
+	}
+
+	tampered := strings.Replace(string(signed), "<cOrgao>91</cOrgao>", "<cOrgao>35</cOrgao>", 1)
+	if _, err := VerifyEnveloped([]byte(tampered), id); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("VerifyEnveloped() com evento alterado error = %v, want %v", err, ErrDigestMismatch)
+	}
+
+	if _, err := SignEnveloped(signed, id, key, cert); !errors.Is(err, ErrAmbiguousReference) {
+		t.Errorf("SignEnveloped() já assinado error = %v, want %v", err, ErrAmbiguousReference)
+	}
+	if _, err := SignEnveloped([]byte(unsigned), "ID000", key, cert); !errors.Is(err, ErrReferenceNotFound) {
+		t.Errorf("SignEnveloped() com Id inexistente error = %v, want %v", err, ErrReferenceNotFound)
+	}
+}
@@ -0,0 +1,372 @@
+// Package xmldsig implementa a verificação de assinaturas XMLDSig envelopadas
+// no formato usado pelos documentos fiscais eletrônicos (NF-e, eventos).
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // Registra SHA-1 para crypto.Hash.New
+	_ "crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Algoritmos suportados
+const (
+	AlgC14N          = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	AlgEnveloped     = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	AlgDigestSHA1    = "http://www.w3.org/2000/09/xmldsig#sha1"
+	AlgDigestSHA256  = "http://www.w3.org/2001/04/xmlenc#sha256"
+	AlgSignRSASHA1   = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	AlgSignRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+)
+
+var (
+	ErrSignatureMissing     = errors.New("assinatura digital ausente")
+	ErrReferenceNotFound    = errors.New("elemento referenciado pela assinatura não encontrado")
+	ErrUnsupportedAlgorithm = errors.New("algoritmo de assinatura não suportado")
+	ErrDigestMismatch       = errors.New("digest do conteúdo assinado não confere (documento alterado)")
+	ErrSignatureInvalid     = errors.New("valor da assinatura RSA inválido")
+	ErrCertificateMissing   = errors.New("certificado X.509 ausente na assinatura")
+	ErrAmbiguousReference   = errors.New("Id referenciado pela assinatura repetido ou fora da posição esperada")
+)
+
+// Signature mapeia o elemento ds:Signature
+type Signature struct {
+	XMLName        xml.Name   `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
+	SignedInfo     SignedInfo `xml:"SignedInfo"`
+	SignatureValue string     `xml:"SignatureValue"`
+	KeyInfo        struct {
+		X509Data struct {
+			X509Certificate []string `xml:"X509Certificate"`
+		} `xml:"X509Data"`
+	} `xml:"KeyInfo"`
+}
+
+type SignedInfo struct {
+	CanonicalizationMethod struct {
+		Algorithm string `xml:"Algorithm,attr"`
+	} `xml:"CanonicalizationMethod"`
+	SignatureMethod struct {
+		Algorithm string `xml:"Algorithm,attr"`
+	} `xml:"SignatureMethod"`
+	Reference struct {
+		URI        string `xml:"URI,attr"`
+		Transforms struct {
+			Transform []struct {
+				Algorithm string `xml:"Algorithm,attr"`
+			} `xml:"Transform"`
+		} `xml:"Transforms"`
+		DigestMethod struct {
+			Algorithm string `xml:"Algorithm,attr"`
+		} `xml:"DigestMethod"`
+		DigestValue string `xml:"DigestValue"`
+	} `xml:"Reference"`
+}
+
+// Result descreve uma assinatura verificada
+type Result struct {
+	ReferenceID   string
+	Certificate   *x509.Certificate
+	Intermediates []*x509.Certificate // Demais certificados do KeyInfo, se houver
+	Signer        CertificateInfo
+}
+
+// VerifyEnveloped localiza a assinatura cuja Reference aponta para o elemento
+// com o Id informado e confere canonicalização, digest e assinatura RSA contra
+// o certificado X.509 embutido. Com path (nomes locais desde a raiz, ex:
+// "nfeProc", "NFe", "infNFe"), o elemento assinado precisa ser exatamente o
+// que está nessa posição, o mesmo que quem chama leu do XML; em qualquer caso
+// o Id não pode se repetir no documento. A ds:Signature verificada é a irmã do
+// elemento assinado (ex: NFe/Signature) e o SignedInfo conferido é o filho
+// dela. A validade da cadeia do certificado não é verificada aqui (ver VerifyChain).
+func VerifyEnveloped(data []byte, referenceID string, path ...string) (*Result, error) {
+	refPath, err := checkReference(data, referenceID, path)
+	if err != nil {
+		return nil, err
+	}
+	sigPath := append(append([]string{}, refPath[:len(refPath)-1]...), "Signature")
+	sig, err := findSignature(data, referenceID, sigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Conferir algoritmos declarados
+	if sig.SignedInfo.CanonicalizationMethod.Algorithm != AlgC14N {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, sig.SignedInfo.CanonicalizationMethod.Algorithm)
+	}
+	for _, tr := range sig.SignedInfo.Reference.Transforms.Transform {
+		if tr.Algorithm != AlgEnveloped && tr.Algorithm != AlgC14N {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, tr.Algorithm)
+		}
+	}
+	digestHash, err := digestAlgorithm(sig.SignedInfo.Reference.DigestMethod.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	signHash, err := signatureAlgorithm(sig.SignedInfo.SignatureMethod.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificado do signatário
+	if len(sig.KeyInfo.X509Data.X509Certificate) == 0 {
+		return nil, ErrCertificateMissing
+	}
+	certDER, err := decodeBase64(sig.KeyInfo.X509Data.X509Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("certificado X.509 inválido: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("certificado X.509 inválido: %w", err)
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: chave pública não é RSA", ErrUnsupportedAlgorithm)
+	}
+
+	// 1. Digest do elemento referenciado
+	referenced, err := canonicalize(data, matchPathID(refPath, referenceID), true)
+	if err != nil {
+		return nil, err
+	}
+	expectedDigest, err := decodeBase64(sig.SignedInfo.Reference.DigestValue)
+	if err != nil {
+		return nil, fmt.Errorf("DigestValue inválido: %w", err)
+	}
+	h := digestHash.New()
+	h.Write(referenced)
+	if !bytes.Equal(h.Sum(nil), expectedDigest) {
+		return nil, ErrDigestMismatch
+	}
+
+	// 2. Assinatura sobre o SignedInfo canonicalizado
+	signedInfo, err := canonicalize(data, matchPath(nsDSig, append(sigPath, "SignedInfo")), false)
+	if err != nil {
+		return nil, err
+	}
+	signatureValue, err := decodeBase64(sig.SignatureValue)
+	if err != nil {
+		return nil, fmt.Errorf("SignatureValue inválido: %w", err)
+	}
+	h = signHash.New()
+	h.Write(signedInfo)
+	if err := rsa.VerifyPKCS1v15(pub, signHash, h.Sum(nil), signatureValue); err != nil {
+		return nil, ErrSignatureInvalid
+	}
+
+	result := &Result{
+		ReferenceID: referenceID,
+		Certificate: cert,
+		Signer:      DescribeCertificate(cert),
+	}
+	for _, extra := range sig.KeyInfo.X509Data.X509Certificate[1:] {
+		if der, err := decodeBase64(extra); err == nil {
+			if c, err := x509.ParseCertificate(der); err == nil {
+				result.Intermediates = append(result.Intermediates, c)
+			}
+		}
+	}
+	return result, nil
+}
+
+// findSignature retorna a ds:Signature que está em sigPath. Ela precisa ser a
+// única nessa posição, ter um único SignedInfo e ele ser o único do documento
+// que referencia o Id: uma cópia do SignedInfo original em outro ponto do XML
+// não pode ser a conferida pela RSA enquanto o digest vem de outra.
+func findSignature(data []byte, referenceID string, sigPath []string) (*Signature, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	atPath, infosAtPath, references := 0, 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsDSig && t.Name.Local == "SignedInfo" {
+				var info SignedInfo
+				if err := dec.DecodeElement(&info, &t); err != nil {
+					return nil, err
+				}
+				if samePath(stack, sigPath) {
+					infosAtPath++
+				}
+				if strings.TrimPrefix(info.Reference.URI, "#") == referenceID {
+					references++
+				}
+				continue
+			}
+			stack = append(stack, t.Name.Local)
+			if t.Name.Local == "Signature" && samePath(stack, sigPath) {
+				atPath++
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if references == 0 {
+		return nil, ErrSignatureMissing
+	}
+	if atPath != 1 || infosAtPath != 1 || references != 1 {
+		return nil, ErrAmbiguousReference
+	}
+
+	// Única na posição: decodificar a assinatura que será conferida
+	dec = xml.NewDecoder(bytes.NewReader(data))
+	stack = stack[:0]
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if !samePath(stack, sigPath) {
+				continue
+			}
+			var sig Signature
+			if err := dec.DecodeElement(&sig, &t); err != nil {
+				return nil, err
+			}
+			if strings.TrimPrefix(sig.SignedInfo.Reference.URI, "#") != referenceID {
+				return nil, ErrAmbiguousReference
+			}
+			return &sig, nil
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// checkReference garante que um único elemento do documento tem o Id e que,
+// com path informado, ele é o elemento dessa posição e não há outro nela.
+// Sem isso uma cópia do trecho assinado em outro ponto do XML passaria na
+// verificação enquanto o conteúdo lido pelo sistema foi alterado. Devolve a
+// posição do elemento, usada para localizar a assinatura irmã dele.
+func checkReference(data []byte, id string, path []string) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack, found []string
+	withID, atPath, idAtPath := 0, 0, false
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			inPath := len(path) > 0 && samePath(stack, path)
+			if inPath {
+				atPath++
+			}
+			if hasID(t.Attr, id) {
+				withID++
+				idAtPath = inPath
+				found = append([]string{}, stack...)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if withID == 0 {
+		return nil, ErrReferenceNotFound
+	}
+	if withID > 1 || (len(path) > 0 && (atPath != 1 || !idAtPath)) {
+		return nil, ErrAmbiguousReference
+	}
+	return found, nil
+}
+
+// matchID aceita o elemento cujo atributo Id (ou ID/id) é igual ao informado
+func matchID(id string) elementMatcher {
+	return matchPathID(nil, id)
+}
+
+// matchPathID aceita o elemento com o Id informado; com path, só na posição indicada
+func matchPathID(path []string, id string) elementMatcher {
+	return func(current []string, _, _ string, attrs []xml.Attr) bool {
+		if len(path) > 0 && !samePath(current, path) {
+			return false
+		}
+		return hasID(attrs, id)
+	}
+}
+
+func hasID(attrs []xml.Attr, id string) bool {
+	for _, a := range attrs {
+		if a.Name.Space == "" && strings.EqualFold(a.Name.Local, "id") && a.Value == id {
+			return true
+		}
+	}
+	return false
+}
+
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPath aceita o elemento com o nome informado exatamente na posição path
+// (nomes locais desde a raiz, incluindo o próprio elemento)
+func matchPath(space string, path []string) elementMatcher {
+	return func(current []string, s, _ string, _ []xml.Attr) bool {
+		return s == space && samePath(current, path)
+	}
+}
+
+func digestAlgorithm(alg string) (crypto.Hash, error) {
+	switch alg {
+	case AlgDigestSHA1:
+		return crypto.SHA1, nil
+	case AlgDigestSHA256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+}
+
+func signatureAlgorithm(alg string) (crypto.Hash, error) {
+	switch alg {
+	case AlgSignRSASHA1:
+		return crypto.SHA1, nil
+	case AlgSignRSASHA256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+}
+
+// decodeBase64 tolera as quebras de linha comuns em DigestValue, SignatureValue e certificados
+func decodeBase64(s string) ([]byte, error) {
+	clean := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\n', '\r', '\t':
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(clean)
+}
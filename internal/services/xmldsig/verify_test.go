@@ -0,0 +1,229 @@
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInfNFe = `<infNFe Id="NFe35240112345678000195550010000012341123456785" versao="4.00">
+			<ide><cUF>35</cUF><nNF>1234</nNF></ide>
+			<det nItem="1"><prod><cProd>ABC-1</cProd><qCom>10.0000</qCom></prod></det>
+		</infNFe>`
+
+// signTestDocument monta um nfeProc assinado com um certificado autoassinado
+func signTestDocument(t *testing.T) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: "EMPRESA TESTE LTDA:12345678000195"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+
+	unsigned := `<nfeProc xmlns="http://www.portalfiscal.inf.br/nfe" versao="4.00"><NFe>` + testInfNFe + `</NFe></nfeProc>`
+	referenced, err := canonicalize([]byte(unsigned), matchID("NFe35240112345678000195550010000012341123456785"), true)
+	if err != nil {
+		t.Fatalf("canonicalize(infNFe) error = %v", err)
+	}
+	digest := sha1.Sum(referenced)
+
+	signature := `<Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo>` +
+		`<CanonicalizationMethod Algorithm="` + AlgC14N + `"/>` +
+		`<SignatureMethod Algorithm="` + AlgSignRSASHA1 + `"/>` +
+		`<Reference URI="#NFe35240112345678000195550010000012341123456785"><Transforms>` +
+		`<Transform Algorithm="` + AlgEnveloped + `"/><Transform Algorithm="` + AlgC14N + `"/>` +
+		`</Transforms><DigestMethod Algorithm="` + AlgDigestSHA1 + `"/>` +
+		`<DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</DigestValue></Reference>` +
+		`</SignedInfo><SignatureValue>{{SIG}}</SignatureValue><KeyInfo><X509Data><X509Certificate>` +
+		base64.StdEncoding.EncodeToString(certDER) + `</X509Certificate></X509Data></KeyInfo></Signature>`
+
+	doc := strings.Replace(unsigned, "</NFe>", signature+"</NFe>", 1)
+	signedInfo, err := canonicalize([]byte(doc), matchPath(nsDSig, []string{"nfeProc", "NFe", "Signature", "SignedInfo"}), false)
+	if err != nil {
+		t.Fatalf("canonicalize(SignedInfo) error = %v", err)
+	}
+	h := sha1.Sum(signedInfo)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, h[:])
+	if err != nil {
+		t.Fatalf("rsa.SignPKCS1v15() error = %v", err)
+	}
+
+	return strings.Replace(doc, "{{SIG}}", base64.StdEncoding.EncodeToString(sig), 1)
+}
+
+func TestVerifyEnveloped(t *testing.T) {
+	doc := signTestDocument(t)
+	id := "NFe35240112345678000195550010000012341123456785"
+
+	result, err := VerifyEnveloped([]byte(doc), id)
+	if err != nil {
+		t.Fatalf("VerifyEnveloped() error = %v", err)
+	}
+	if result.Signer.CNPJ != "12345678000195" {
+		t.Errorf("VerifyEnveloped() signer CNPJ = %q, want 12345678000195", result.Signer.CNPJ)
+	}
+	if result.Signer.SerialNumber != "1092" {
+		t.Errorf("VerifyEnveloped() serial = %q, want 1092", result.Signer.SerialNumber)
+	}
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr error
+	}{
+		{
+			name:    "quantidade alterada",
+			doc:     strings.Replace(doc, "<qCom>10.0000</qCom>", "<qCom>99.0000</qCom>", 1),
+			wantErr: ErrDigestMismatch,
+		},
+		{
+			name:    "assinatura removida",
+			doc:     doc[:strings.Index(doc, "<Signature")] + "</NFe></nfeProc>",
+			wantErr: ErrSignatureMissing,
+		},
+		{
+			name:    "algoritmo de digest alterado",
+			doc:     strings.Replace(doc, AlgDigestSHA1, AlgDigestSHA256, 1),
+			wantErr: ErrDigestMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyEnveloped([]byte(tt.doc), id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyEnveloped() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Cópia do infNFe assinado fora de NFe enquanto o infNFe lido pelo sistema foi alterado
+func TestVerifyEnveloped_ReferenceOutOfPlace(t *testing.T) {
+	doc := signTestDocument(t)
+	id := "NFe35240112345678000195550010000012341123456785"
+	start := strings.Index(doc, "<infNFe")
+	end := strings.Index(doc, "</infNFe>") + len("</infNFe>")
+	original := doc[start:end]
+	tampered := strings.Replace(doc, "<qCom>10.0000</qCom>", "<qCom>99.0000</qCom>", 1)
+	wrapped := strings.Replace(doc, original, "<NFe>"+original+"</NFe>", 1)
+
+	tests := []struct {
+		name string
+		doc  string
+		path []string
+	}{
+		{"cópia antes de NFe", strings.Replace(tampered, "<NFe>", original+"<NFe>", 1), []string{"nfeProc", "NFe", "infNFe"}},
+		{"cópia antes de NFe sem posição informada", strings.Replace(tampered, "<NFe>", original+"<NFe>", 1), nil},
+		{"cópia com ID em maiúsculas", strings.Replace(tampered, "<NFe>", strings.Replace(original, `Id="`, `ID="`, 1)+"<NFe>", 1), nil},
+		{"fora da posição lida", wrapped, []string{"nfeProc", "NFe", "infNFe"}},
+		{"dois NFe", strings.Replace(doc, "</nfeProc>", "<NFe><infNFe/></NFe></nfeProc>", 1), []string{"nfeProc", "NFe", "infNFe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyEnveloped([]byte(tt.doc), id, tt.path...); !errors.Is(err, ErrAmbiguousReference) {
+				t.Errorf("VerifyEnveloped() error = %v, want %v", err, ErrAmbiguousReference)
+			}
+		})
+	}
+
+	if _, err := VerifyEnveloped([]byte(doc), id, "nfeProc", "NFe", "infNFe"); err != nil {
+		t.Errorf("VerifyEnveloped() na posição esperada error = %v", err)
+	}
+}
+
+// SignedInfo original copiado para outro ponto do documento, com o infNFe
+// alterado e o DigestValue da assinatura trocado pelo do conteúdo alterado: a
+// RSA não pode ser conferida contra a cópia intacta
+func TestVerifyEnveloped_SignedInfoCopy(t *testing.T) {
+	doc := signTestDocument(t)
+	id := "NFe35240112345678000195550010000012341123456785"
+	start := strings.Index(doc, "<SignedInfo>")
+	end := strings.Index(doc, "</SignedInfo>") + len("</SignedInfo>")
+	original := doc[start:end]
+	bare := strings.Replace(original, "<SignedInfo>", `<SignedInfo xmlns="`+nsDSig+`">`, 1)
+
+	tampered := strings.Replace(doc, "<qCom>10.0000</qCom>", "<qCom>99.0000</qCom>", 1)
+	referenced, err := canonicalize([]byte(tampered), matchID(id), true)
+	if err != nil {
+		t.Fatalf("canonicalize(infNFe) error = %v", err)
+	}
+	digest := sha1.Sum(referenced)
+	oldDigest := doc[strings.Index(doc, "<DigestValue>")+len("<DigestValue>") : strings.Index(doc, "</DigestValue>")]
+	tampered = strings.Replace(tampered, oldDigest, base64.StdEncoding.EncodeToString(digest[:]), 1)
+	otherURI := strings.Replace(bare, `URI="#`+id, `URI="#outro`, 1)
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr error
+	}{
+		{"SignedInfo antes de NFe", strings.Replace(tampered, "<NFe>", bare+"<NFe>", 1), ErrAmbiguousReference},
+		{"Signature antes de NFe", strings.Replace(tampered, "<NFe>", `<Signature xmlns="`+nsDSig+`">`+original+"</Signature><NFe>", 1), ErrAmbiguousReference},
+		{"dois SignedInfo na assinatura", strings.Replace(tampered, "</SignedInfo>", "</SignedInfo>"+original, 1), ErrAmbiguousReference},
+		{"duas Signature em NFe", strings.Replace(tampered, "</NFe>", `<Signature xmlns="`+nsDSig+`">`+original+"</Signature></NFe>", 1), ErrAmbiguousReference},
+		{"cópia com outra URI", strings.Replace(tampered, "<NFe>", otherURI+"<NFe>", 1), ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range [][]string{nil, {"nfeProc", "NFe", "infNFe"}} {
+				if _, err := VerifyEnveloped([]byte(tt.doc), id, path...); !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyEnveloped(path %v) error = %v, want %v", path, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEnveloped_TamperedSignedInfo(t *testing.T) {
+	doc := signTestDocument(t)
+	// Comentários e a forma de escrever elementos vazios não mudam a forma canônica
+	tampered := strings.Replace(doc, `<Transform Algorithm="`+AlgC14N+`"/>`, `<Transform Algorithm="`+AlgC14N+`"></Transform><!-- x -->`, 1)
+	if _, err := VerifyEnveloped([]byte(tampered), "NFe35240112345678000195550010000012341123456785"); err != nil {
+		t.Errorf("VerifyEnveloped() com SignedInfo equivalente em C14N error = %v, want nil", err)
+	}
+
+	// Qualquer atributo novo no SignedInfo invalida a assinatura RSA
+	tampered = strings.Replace(doc, `<Reference URI=`, `<Reference Type="x" URI=`, 1)
+	if _, err := VerifyEnveloped([]byte(tampered), "NFe35240112345678000195550010000012341123456785"); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("VerifyEnveloped() com SignedInfo alterado error = %v, want %v", err, ErrSignatureInvalid)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<root xmlns="urn:a" xmlns:b="urn:b"><!-- comentário -->
+	<child z="1" b:y="2" a="3&amp;&quot;"><empty/><![CDATA[x < y]]></child>
+</root>`
+	want := `<child xmlns="urn:a" xmlns:b="urn:b" a="3&amp;&quot;" z="1" b:y="2"><empty></empty>x &lt; y</child>`
+
+	got, err := canonicalize([]byte(input), func(_ []string, space, local string, _ []xml.Attr) bool {
+		return space == "urn:a" && local == "child"
+	}, false)
+	if err != nil {
+		t.Fatalf("canonicalize() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("canonicalize() =\n%s\nwant\n%s", got, want)
+	}
+}
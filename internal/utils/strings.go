@@ -0,0 +1,17 @@
+package utils
+
+// Truncate corta s em no máximo max caracteres sem partir um caractere UTF-8 ao
+// meio; as colunas varchar do MySQL contam caracteres, não bytes
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	count := 0
+	for i := range s {
+		if count == max {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"menor que o limite", "Parafuso", 20, "Parafuso"},
+		{"ASCII", "Parafuso sextavado", 8, "Parafuso"},
+		{"não parte acentos", "Conexão elétrica", 7, "Conexão"},
+		{"limite em caracteres", "ÇÃÉÍÕ", 3, "ÇÃÉ"},
+		{"vazio", "", 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Truncate(tt.s, tt.max); got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"estoque/internal/api"
 	"estoque/internal/database"
+	"estoque/internal/models"
+	"estoque/internal/secrets"
+	"estoque/internal/services"
+	"estoque/internal/services/certstore"
+	"estoque/internal/services/dfe"
 	"estoque/internal/services/nfe_consumer"
 	"estoque/internal/services/worker_pools"
+	"estoque/internal/services/xmldsig"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -21,6 +27,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -97,13 +104,72 @@ func main() {
 	nfePool.Start()
 	exportPool.Start()
 
+	// Credenciais (senhas de e-mail, certificado A1) cifradas com SECRETS_KEY
+	keyring, err := secrets.LoadKeyring()
+	if err != nil {
+		slog.Error("Failed to load secrets key", "error", err)
+		os.Exit(1)
+	}
+	secrets.Configure(keyring)
+	secrets.AllowPlaintext(os.Getenv("SECRETS_ALLOW_PLAINTEXT") == "true")
+	certStore := certstore.New(db, keyring)
+	rotateSecrets(db, keyring, certStore)
+	go certStore.WatchExpiry(context.Background(), 6*time.Hour)
+
+	// ACs ICP-Brasil para validar a cadeia dos certificados das assinaturas
+	if rootsPath := os.Getenv("ICP_BRASIL_ROOTS"); rootsPath != "" {
+		store, err := xmldsig.LoadTrustStore(rootsPath)
+		if err != nil {
+			slog.Error("Failed to load ICP-Brasil roots", "path", rootsPath, "error", err)
+			os.Exit(1)
+		}
+		services.ConfigureTrustStore(store)
+		slog.Info("ICP-Brasil roots loaded", "roots", store.Roots)
+	} else {
+		slog.Warn("ICP_BRASIL_ROOTS not set: certificate chains of signatures are not verified")
+	}
+
 	// 5. Inicialização dos Handlers e Serviços
-	h := api.NewHandler(db, nfePool, exportPool)
+	h := api.NewHandler(db, nfePool, exportPool, certStore)
+
+	// Notas registradas antes da data de emissão ser gravada (filtro da listagem)
+	go func() {
+		if err := h.NfeService.BackfillIssueDates(); err != nil {
+			slog.Warn("Falha ao preencher data de emissão das NF-es", "error", err)
+		}
+	}()
 
 	// Iniciar Consumidor de e-mails de NF-e em background
 	nfeConsumer := nfe_consumer.NewConsumer(db, nfePool)
 	go nfeConsumer.Start(context.Background())
 
+	// Consumidor da pasta compartilhada de XMLs (ERP/contabilidade), se configurada
+	if watchDir := os.Getenv("NFE_WATCH_DIR"); watchDir != "" {
+		watchInterval := 30 * time.Second
+		if intervalStr := os.Getenv("NFE_WATCH_INTERVAL"); intervalStr != "" {
+			if n, err := strconv.Atoi(intervalStr); err == nil && n > 0 {
+				watchInterval = time.Duration(n) * time.Second
+			}
+		}
+		watcher := nfe_consumer.NewDirectoryWatcher(db, nfePool, watchDir, watchInterval)
+		go watcher.Start(context.Background())
+	}
+
+	// Integrações com a SEFAZ usam o certificado enviado pelo admin, salvo quando
+	// SEFAZ_DFE_CERT aponta para arquivos PEM
+	var sefazCert dfe.Certificate = certStore
+	var signer dfe.Signer = certStore
+	if certFile := os.Getenv("SEFAZ_DFE_CERT"); certFile != "" {
+		pemCert := dfe.PEMCertificate{CertFile: certFile, KeyFile: os.Getenv("SEFAZ_DFE_KEY")}
+		sefazCert, signer = pemCert, dfe.CertificateSigner{Certificate: pemCert}
+	}
+	configureManifestation(sefazCert, signer)
+
+	// Distribuição DF-e da SEFAZ: notas emitidas contra os nossos CNPJs
+	if os.Getenv("SEFAZ_DFE_UF") != "" {
+		startDfeConsumer(db, nfePool, sefazCert)
+	}
+
 	// 6. Setup de Rotas com Chi
 	r := chi.NewRouter()
 
@@ -171,6 +237,9 @@ func main() {
 				r.Get("/notifications/stream", h.StreamNotificationsHandler)
 			})
 
+			// Upload em lote: ZIPs com centenas de XMLs passam do timeout padrão
+			r.With(middleware.Timeout(10*time.Minute)).Post("/nfe/upload/batch", h.BatchUploadHandler)
+
 			// 2. Rotas comuns (COM timeout de 60s para segurança)
 			r.Group(func(r chi.Router) {
 				r.Use(middleware.Timeout(60 * time.Second))
@@ -180,6 +249,25 @@ func main() {
 				r.Get("/nfes", h.ListNFesHandler)
 				r.Get("/nfes/{accessKey}", h.GetNfeDetailHandler)
 				r.Post("/nfes/{accessKey}/process", h.ProcessNfeHandler)
+				r.Post("/nfes/{accessKey}/review", h.StartNfeReviewHandler)
+				r.Put("/nfes/{accessKey}/items/{itemNumber}/review", h.ReviewNfeItemHandler)
+				// Recusa e manifestação têm efeito fiscal (evento na SEFAZ): só ADMIN
+				r.With(api.RoleMiddleware("ADMIN")).Post("/nfes/{accessKey}/reject", h.RejectNfeHandler)
+				// Cancelamento sem assinatura validada só é aplicado por um ADMIN
+				r.With(api.RoleMiddleware("ADMIN")).Post("/nfes/{accessKey}/events/{eventID}/apply", h.ApplyNfeEventHandler)
+				r.Get("/nfes/{accessKey}/manifestations", h.ListNfeManifestationsHandler)
+				r.With(api.RoleMiddleware("ADMIN")).Post("/nfes/{accessKey}/manifestations", h.ManifestNfeHandler)
+				r.Get("/dfe-summaries", h.ListDfeSummariesHandler)
+				r.Get("/nfes/{accessKey}/danfe.pdf", h.DanfeHandler)
+				r.Get("/nfes/{accessKey}/mappings", h.GetNfeItemMappingsHandler)
+				r.Put("/nfes/{accessKey}/items/{itemNumber}/mapping", h.MapNfeItemHandler)
+				r.Post("/nfes/{accessKey}/items/{itemNumber}/product", h.CreateProductFromNfeItemHandler)
+				r.Get("/nfe-conflicts", h.ListNfeConflictsHandler)
+				r.Get("/nfe-conflicts/{id}/xml", h.GetNfeConflictXMLHandler)
+				r.Post("/nfe-conflicts/{id}/review", h.ReviewNfeConflictHandler)
+				r.Get("/product-mappings", h.ListProductMappingsHandler)
+				r.Get("/unit-conversions", h.ListUnitConversionsHandler)
+				r.Put("/unit-conversions", h.SaveUnitConversionHandler)
 
 				// Products & Stock
 				r.Get("/products", h.ListProductsHandler)
@@ -191,6 +279,7 @@ func main() {
 				r.Post("/movements/batch", h.BatchCreateMovementHandler)
 				r.Get("/movements/list", h.ListMovementsHandler)
 				r.Get("/reports/movements", h.GetMovementsReport)
+				r.Get("/reports/nfe-items", h.GetNfeItemsReport)
 				r.Get("/export/movements", h.ExportMovementsHandler)
 
 				// Export
@@ -206,6 +295,9 @@ func main() {
 				r.Put("/categories/{id}", h.CategoriesHandler)
 				r.Delete("/categories/{id}", h.CategoriesHandler)
 
+				// Suppliers
+				r.Get("/suppliers", h.ListSuppliersHandler)
+
 				// Users (Admin Only)
 				r.Group(func(r chi.Router) {
 					r.Use(api.RoleMiddleware("ADMIN"))
@@ -216,8 +308,25 @@ func main() {
 
 					// Configurações de Sistema
 					r.Get("/config/email", h.GetEmailConfigHandler)
-					r.Put("/config/email", h.UpdateEmailConfigHandler)
 					r.Post("/config/email/test", h.TestEmailConnectionHandler)
+					r.Get("/config/mailboxes", h.ListMailboxesHandler)
+					r.Post("/config/mailboxes", h.CreateMailboxHandler)
+					r.Get("/config/mailboxes/{id}", h.GetMailboxHandler)
+					r.Put("/config/mailboxes/{id}", h.UpdateMailboxHandler)
+					r.Delete("/config/mailboxes/{id}", h.DeleteMailboxHandler)
+					r.Get("/config/nfe", h.GetNfeConfigHandler)
+					r.Put("/config/nfe", h.UpdateNfeConfigHandler)
+					r.Get("/config/certificates", h.ListCertificatesHandler)
+					r.Post("/config/certificates", h.UploadCertificateHandler)
+					r.Post("/config/certificates/{id}/activate", h.ActivateCertificateHandler)
+					r.Delete("/config/certificates/{id}", h.DeleteCertificateHandler)
+					r.Delete("/product-mappings/{id}", h.DeleteProductMappingHandler)
+					r.Delete("/unit-conversions/{id}", h.DeleteUnitConversionHandler)
+
+					// Histórico de importação por e-mail
+					r.Get("/email-ingestions", h.ListEmailIngestionsHandler)
+					r.Get("/email-ingestions/{id}/attachment", h.DownloadEmailIngestionHandler)
+					r.Post("/email-ingestions/{id}/retry", h.RetryEmailIngestionHandler)
 
 					// Logs de Auditoria
 					r.Get("/audit/logs", h.ListAuditLogsHandler)
@@ -322,3 +431,83 @@ func getDSN() string {
 	}
 	return dsn
 }
+
+// rotateSecrets recifra com a chave atual as credenciais gravadas em texto puro
+// ou com uma chave anterior; concluída, a chave anterior pode sair de SECRETS_PREVIOUS_KEYS
+func rotateSecrets(db *gorm.DB, keyring *secrets.Keyring, certStore *certstore.Store) {
+	if keyring == nil {
+		if os.Getenv("SECRETS_ALLOW_PLAINTEXT") == "true" {
+			slog.Warn("SECRETS_KEY não configurada; SECRETS_ALLOW_PLAINTEXT ativo: senhas de e-mail gravadas em texto puro e envio de certificados desativado")
+		} else {
+			slog.Warn("SECRETS_KEY não configurada; cadastro de senhas de e-mail e envio de certificados desativados")
+		}
+		if n, err := secrets.Plaintext(db, models.EncryptedColumns...); err == nil && n > 0 {
+			slog.Warn("Credenciais gravadas em texto puro; serão cifradas quando SECRETS_KEY for configurada", "fields", n)
+		}
+		return
+	}
+	n, err := secrets.Rotate(db, keyring, models.EncryptedColumns...)
+	if err != nil {
+		slog.Error("Erro ao recifrar credenciais", "error", err)
+	}
+	certs, err := certStore.Rotate()
+	if err != nil {
+		slog.Error("Erro ao recifrar certificados digitais", "error", err)
+	}
+	if n+certs > 0 {
+		slog.Info("Credenciais recifradas com a chave atual", "fields", n, "certificates", certs)
+	}
+}
+
+// configureManifestation habilita o envio da manifestação do destinatário
+func configureManifestation(cert dfe.Certificate, signer dfe.Signer) {
+	transport := dfe.NewHTTPTransport(cert, 60*time.Second)
+
+	client := &dfe.EventClient{
+		Transport: transport,
+		URL:       dfe.URLEventProduction,
+		TpAmb:     "1",
+		Signer:    signer,
+	}
+	if os.Getenv("SEFAZ_TP_AMB") == "2" {
+		client.URL = dfe.URLEventHomologation
+		client.TpAmb = "2"
+	}
+	if url := os.Getenv("SEFAZ_EVENT_URL"); url != "" {
+		client.URL = url
+	}
+	services.ConfigureManifestation(client, cert)
+}
+
+// startDfeConsumer inicia a consulta periódica à distribuição DF-e (SEFAZ_DFE_*)
+func startDfeConsumer(db *gorm.DB, nfePool *worker_pools.NFeWorkerPool, cert dfe.Certificate) {
+	transport := dfe.NewHTTPTransport(cert, 60*time.Second)
+
+	client := &dfe.Client{
+		Transport: transport,
+		URL:       dfe.URLProduction,
+		TpAmb:     "1",
+		CUFAutor:  os.Getenv("SEFAZ_DFE_UF"),
+	}
+	if os.Getenv("SEFAZ_TP_AMB") == "2" {
+		client.URL = dfe.URLHomologation
+		client.TpAmb = "2"
+	}
+	if url := os.Getenv("SEFAZ_DFE_URL"); url != "" {
+		client.URL = url
+	}
+
+	interval := 15 * time.Minute
+	if intervalStr := os.Getenv("SEFAZ_DFE_INTERVAL"); intervalStr != "" {
+		if n, err := strconv.Atoi(intervalStr); err == nil && n > 0 {
+			interval = time.Duration(n) * time.Minute
+		}
+	}
+
+	var cnpjs []string
+	if list := os.Getenv("SEFAZ_DFE_CNPJ"); list != "" {
+		cnpjs = services.ParseOwnCNPJs(list)
+	}
+	consumer := nfe_consumer.NewDfeConsumer(db, nfePool, client, cnpjs, interval)
+	go consumer.Start(context.Background())
+}